@@ -1,72 +1,433 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/pperesbr/conduit/internal/api"
+	"github.com/pperesbr/conduit/internal/cli"
 	"github.com/pperesbr/conduit/internal/config"
 	"github.com/pperesbr/conduit/internal/manager"
+	"github.com/pperesbr/conduit/internal/pidfile"
+	"github.com/pperesbr/conduit/internal/systemd"
 	"github.com/pperesbr/conduit/internal/watcher"
 )
 
+// statsResetInterval is how often conduit checks whether a tunnel's accounting period has ended.
+const statsResetInterval = time.Minute
+
+// systemdReadyTimeout bounds how long conduit waits for its tunnels to become healthy before reporting readiness to
+// systemd anyway, so one unreachable tunnel does not fail the whole unit's startup.
+const systemdReadyTimeout = 30 * time.Second
+
 func main() {
-	configPath := flag.String("config", "config.yaml", "path to config file")
+	configPath := flag.String("config", "config.yaml", "path to config file or directory of *.yaml fragments, or - to read it from stdin")
+	fromEnv := flag.Bool("env", false, "build config from CONDUIT_* environment variables instead of a file; with an explicit -config, merge them over the file")
+	output := flag.String("o", "", "output format for subcommands: json or table (default: table on a terminal, json otherwise)")
+	apiAddr := flag.String("api", "", "API address of the running conduit queried by subcommands (default: api.listen from the config)")
+	waitForConfig := flag.Duration("wait-for-config", 0, "wait up to this long for the config file to appear before loading it, e.g. 30s (default: fail at once)")
+	validate := flag.Bool("validate", false, "load and validate the config, print any problems, and exit without starting tunnels")
+	logFormat := flag.String("log-format", "", "log format, text or json, overriding log.format (default: plain log lines)")
+	pidPath := flag.String("pidfile", "", "write the process ID to this file while running, refusing to start if it names a running conduit")
+	stateFile := flag.String("state-file", "", "save which tunnels are running, stopped, or paused to this file on shutdown and restore it on startup (default: off)")
+	logLevel := flag.String("log-level", "", "minimum log level, debug, info, warn, or error, overriding log.level (default: info)")
+	var overrides overrideFlags
+	flag.Var(&overrides, "set", "override a tunnel setting for this run as tunnel.field=value, e.g. db.localPort=15210 (repeatable)")
 	flag.Parse()
 
-	log.Printf("conduit: starting with config %s", *configPath)
+	configSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			configSet = true
+		}
+	})
+
+	if *validate {
+		if err := validateConfig(newLoader(*configPath, configSet, *fromEnv, overrides)); err != nil {
+			fmt.Fprintf(os.Stderr, "conduit: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.NArg() > 0 {
+		loader := newLoader(*configPath, configSet, *fromEnv, nil)
+		if err := runCommand(flag.Arg(0), *output, *apiAddr, loader); err != nil {
+			fmt.Fprintf(os.Stderr, "conduit: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	loader := newLoader(*configPath, configSet, *fromEnv, overrides)
+	log.Printf("conduit: starting with config from %s", describeSource(*configPath, configSet, *fromEnv))
+
+	// Install the handler before any tunnel starts so an early Ctrl-C interrupts startup instead of killing the process.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if *waitForConfig > 0 && (configSet || !*fromEnv) && *configPath != "-" {
+		log.Printf("conduit: waiting up to %s for %s", *waitForConfig, *configPath)
+		if err := config.WaitForFile(ctx, *configPath, *waitForConfig); err != nil {
+			log.Fatalf("conduit: %v", err)
+		}
+	}
 
-	cfg, err := config.Load(*configPath)
+	cfg, err := loader.Load()
 	if err != nil {
 		log.Fatalf("conduit: failed to load config: %v", err)
 	}
 
-	log.Printf("conduit: loaded %d tunnel(s) via %s@%s:%d",
-		len(cfg.TunnelConfigs), cfg.SSH.User, cfg.SSH.Host, cfg.SSH.Port)
+	if *logFormat != "" {
+		cfg.Log.Format = *logFormat
+	}
+	if *logLevel != "" {
+		cfg.Log.Level = *logLevel
+	}
+	logger, err := newLogger(os.Stderr, cfg.Log)
+	if err != nil {
+		log.Fatalf("conduit: %v", err)
+	}
+
+	if *pidPath != "" {
+		if err := pidfile.Write(*pidPath); err != nil {
+			logger.Error("refusing to start", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// From here on conduit exits through shutdown, so the pid file is removed however it stops.
+	shutdown := func(code int) {
+		if *pidPath != "" {
+			if err := pidfile.Remove(*pidPath); err != nil {
+				logger.Error("failed to remove pid file", "error", err)
+			}
+		}
+		os.Exit(code)
+	}
+
+	for _, warning := range cfg.Warnings() {
+		logger.Warn("config warning", "warning", warning)
+	}
+
+	logger.Info("config loaded", "tunnels", len(cfg.TunnelConfigs), "sshUser", cfg.SSH.User, "sshHost", cfg.SSH.Host,
+		"sshPort", cfg.SSH.Port)
 
 	mgr := manager.NewManager(&cfg.SSH)
+	mgr.SetLogger(logger)
+	mgr.SetStartupPolicy(cfg.Startup)
+	mgr.SetShutdownPolicy(cfg.Shutdown)
+	mgr.SetRelayWorkers(cfg.Relay.Workers)
+	mgr.SetReconcileMode(cfg.Reload.Mode)
+	mgr.SetStateFile(*stateFile)
 
 	for _, tunnelCfg := range cfg.TunnelConfigs {
 		if err := mgr.Add(tunnelCfg); err != nil {
-			log.Printf("conduit: failed to add tunnel %s: %v", tunnelCfg.Name, err)
+			logger.Error("failed to add tunnel", "tunnel", tunnelCfg.Name, "error", err)
 			continue
 		}
-		log.Printf("conduit: added tunnel %s (%s:%d -> localhost:%d)",
-			tunnelCfg.Name, tunnelCfg.RemoteHost, tunnelCfg.RemotePort, tunnelCfg.LocalPort)
+		local := net.JoinHostPort(tunnelCfg.LocalBindAddr(), strconv.Itoa(tunnelCfg.LocalPort))
+		if tunnelCfg.LocalSocket != "" {
+			local = tunnelCfg.LocalSocket
+		}
+		remote := net.JoinHostPort(tunnelCfg.RemoteHost, strconv.Itoa(tunnelCfg.RemotePort))
+		switch tunnelCfg.TunnelType() {
+		case config.TunnelTypeReverse:
+			logger.Info("added reverse tunnel", "tunnel", tunnelCfg.Name, "serverAddr", remote,
+				"localAddr", net.JoinHostPort(tunnelCfg.LocalHost, strconv.Itoa(tunnelCfg.LocalPort)))
+		case config.TunnelTypeDynamic:
+			logger.Info("added dynamic tunnel", "tunnel", tunnelCfg.Name, "localAddr", local)
+		default:
+			logger.Info("added tunnel", "tunnel", tunnelCfg.Name, "remoteAddr", remote, "localAddr", local)
+		}
+	}
+
+	if cfg.Controller.Enabled {
+		mgr.StartController(cfg.Controller.Interval)
+		logger.Info("controller converging tunnels", "interval", cfg.Controller.Interval)
+	}
+
+	mgr.StartStatsReset(statsResetInterval)
+
+	if cfg.Health.StuckThreshold > 0 {
+		mgr.SetStuckThreshold(cfg.Health.StuckThreshold)
+		mgr.StartStuckMonitor(cfg.Health.StuckThreshold)
+		logger.Info("warning about stuck tunnels", "threshold", cfg.Health.StuckThreshold)
+	}
+
+	var w manager.Watcher
+	var configWatcher *watcher.Watcher
+	if watchable, ok := loader.(config.Watchable); ok && len(watchable.WatchPaths()) > 0 {
+		configWatcher, err = watcher.NewFromLoader(loader, mgr)
+		if err != nil {
+			logger.Error("failed to create watcher", "error", err)
+			shutdown(1)
+		}
+		configWatcher.SetLogger(logger)
+		if cfg.Reload.Debounce > 0 {
+			configWatcher.SetDebounce(cfg.Reload.Debounce)
+		}
+		if cfg.Reload.PollInterval > 0 {
+			configWatcher.SetPollInterval(cfg.Reload.PollInterval)
+		}
+		w = configWatcher
+
+		logger.Info("watching config file for changes, or reload it with SIGHUP")
+	}
+
+	var server *http.Server
+	if cfg.API.Listen != "" {
+		server = &http.Server{Addr: cfg.API.Listen, Handler: api.NewHandler(mgr, cfg.API)}
+
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("api server failed", "error", err)
+			}
+		}()
+
+		logger.Info("api listening", "addr", cfg.API.Listen)
+	}
+
+	if configWatcher != nil {
+		go reloadOnHangup(ctx, configWatcher, logger)
+	}
+
+	if systemd.Enabled() {
+		go notifySystemd(ctx, mgr, logger)
+	}
+
+	runErr := mgr.Run(ctx, w)
+
+	if server != nil {
+		if err := server.Close(); err != nil {
+			logger.Error("failed to close api server", "error", err)
+		}
+	}
+
+	if runErr != nil {
+		logger.Error("stopped with errors", "error", runErr)
+		shutdown(1)
+	}
+
+	logger.Info("stopped")
+	shutdown(0)
+}
+
+// validateConfig loads the config through loader as conduit would at startup, printing its warnings and a summary.
+func validateConfig(loader config.Loader) error {
+	cfg, warnings, err := config.Check(loader)
+	if err != nil {
+		return err
+	}
+
+	for _, warning := range warnings {
+		fmt.Printf("warning: %s\n", warning)
+	}
+	fmt.Printf("config is valid: %d tunnel(s), %d warning(s)\n", len(cfg.TunnelConfigs), len(warnings))
+
+	return nil
+}
+
+// notifySystemd reports readiness to systemd once mgr has started its tunnels and they are healthy, or
+// systemdReadyTimeout has passed, then sends watchdog keep-alives while the manager still answers until ctx is done,
+// when it reports that conduit is stopping.
+func notifySystemd(ctx context.Context, mgr *manager.Manager, logger *slog.Logger) {
+	notify := func(state string) {
+		if _, err := systemd.Notify(state); err != nil {
+			logger.Warn("failed to notify systemd", "state", state, "error", err)
+		}
+	}
+	defer notify(systemd.Stopping)
+
+	select {
+	case <-mgr.Started():
+	case <-ctx.Done():
+		return
 	}
 
-	errors := mgr.StartAll()
-	if len(errors) > 0 {
-		for name, err := range errors {
-			log.Printf("conduit: failed to start tunnel %s: %v", name, err)
+	waitCtx, cancel := context.WithTimeout(ctx, systemdReadyTimeout)
+	err := mgr.WaitUntilHealthy(waitCtx)
+	cancel()
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		logger.Warn("reporting ready to systemd with unhealthy tunnels", "error", err)
+	}
+	notify(systemd.Ready)
+
+	interval, err := systemd.WatchdogInterval()
+	if err != nil {
+		logger.Warn("systemd watchdog disabled", "error", err)
+	}
+
+	var keepAlive <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+
+	for {
+		select {
+		case <-keepAlive:
+			// Summary takes the manager's lock, so a deadlocked manager stops the keep-alives and systemd restarts it.
+			mgr.Summary()
+			notify(systemd.Watchdog)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reloadOnHangup reloads the config through w whenever conduit receives SIGHUP, until ctx is done, logging what each
+// reload changed to logger.
+func reloadOnHangup(ctx context.Context, w *watcher.Watcher, logger *slog.Logger) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-hangup:
+			logger.Info("SIGHUP received, reloading config")
+			result, err := w.Reload()
+			if err != nil {
+				logger.Error("reload failed", "error", err)
+				continue
+			}
+			logger.Info("config reloaded", "added", result.Added, "removed", result.Removed, "restarted", result.Changed,
+				"updated", result.Updated, "failed", len(result.Failed))
+		case <-ctx.Done():
+			return
 		}
 	}
+}
+
+// newLogger builds the logger for cfg writing to w and makes it the default, so the log package writes through it too.
+// Without a format the standard logger keeps its plain timestamped lines and only the level applies.
+func newLogger(w io.Writer, cfg config.LogConfig) (*slog.Logger, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	level, _ := cfg.SlogLevel()
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch cfg.Format {
+	case config.LogFormatJSON:
+		slog.SetDefault(slog.New(slog.NewJSONHandler(w, opts)))
+	case config.LogFormatText:
+		slog.SetDefault(slog.New(slog.NewTextHandler(w, opts)))
+	default:
+		slog.SetLogLoggerLevel(level)
+	}
+
+	return slog.Default(), nil
+}
+
+// newLoader picks the config source from the command line: the environment with -env, stdin with -config -, or the
+// config file. With -env and an explicitly given -config, the environment is merged over the file.
+func newLoader(configPath string, configSet, fromEnv bool, overrides []config.Override) config.Loader {
+	var file config.Loader = &config.FileLoader{Path: configPath}
+	if configPath == "-" {
+		file = &config.ReaderLoader{Reader: os.Stdin}
+	}
 
-	for name, status := range mgr.Status() {
-		log.Printf("conduit: tunnel %s status: %s", name, status)
+	switch {
+	case fromEnv && configSet:
+		return &config.CompositeLoader{Loaders: []config.Loader{file, &config.EnvLoader{}}, Overrides: overrides}
+	case fromEnv:
+		return &config.EnvLoader{Overrides: overrides}
+	case configPath == "-":
+		return &config.ReaderLoader{Reader: os.Stdin, Overrides: overrides}
+	default:
+		return &config.FileLoader{Path: configPath, Overrides: overrides}
 	}
+}
 
-	w, err := watcher.New(*configPath, mgr)
+// describeSource names the config source newLoader picks, for the startup log.
+func describeSource(configPath string, configSet, fromEnv bool) string {
+	file := configPath
+	if configPath == "-" {
+		file = "stdin"
+	}
+
+	switch {
+	case fromEnv && configSet:
+		return file + " merged with environment"
+	case fromEnv:
+		return "environment"
+	default:
+		return file
+	}
+}
+
+// overrideFlags collects repeated -set flags.
+type overrideFlags []config.Override
+
+// String returns the overrides as they were given on the command line.
+func (o *overrideFlags) String() string {
+	values := make([]string, 0, len(*o))
+	for _, override := range *o {
+		values = append(values, override.String())
+	}
+	return strings.Join(values, ",")
+}
+
+// Set parses and records one -set value.
+func (o *overrideFlags) Set(value string) error {
+	override, err := config.ParseOverride(value)
 	if err != nil {
-		log.Fatalf("conduit: failed to create watcher: %v", err)
+		return err
 	}
+	*o = append(*o, override)
+	return nil
+}
 
-	if err := w.Start(); err != nil {
-		log.Fatalf("conduit: failed to start watcher: %v", err)
+// runCommand executes a read subcommand such as status against the API of a running conduit and prints the result. The
+// API token is taken from CONDUIT_API_TOKEN, or from api.token when the address comes from the config.
+func runCommand(command, output, apiAddr string, loader config.Loader) error {
+	if !slices.Contains(cli.Commands, command) {
+		return fmt.Errorf("unknown command %q, expected one of %s", command, strings.Join(cli.Commands, ", "))
 	}
 
-	log.Printf("conduit: watching config file for changes")
+	format, err := cli.ParseFormat(output, os.Stdout)
+	if err != nil {
+		return err
+	}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	token := os.Getenv("CONDUIT_API_TOKEN")
+	if apiAddr == "" {
+		cfg, err := loader.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config to find the api address: %w", err)
+		}
 
-	sig := <-sigChan
-	log.Printf("conduit: received signal %s, shutting down...", sig)
+		if cfg.API.Listen == "" {
+			return fmt.Errorf("no api address: pass -api or set api.listen in the config")
+		}
+		apiAddr = cfg.API.Listen
+		if token == "" {
+			token = cfg.API.Token
+		}
+	}
 
-	w.Stop()
-	mgr.StopAll()
+	client := cli.NewClient(apiAddr)
+	client.SetToken(token)
 
-	log.Printf("conduit: stopped")
+	return cli.Run(command, client, format, os.Stdout)
 }
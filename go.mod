@@ -4,7 +4,6 @@ go 1.25.4
 
 require (
 	github.com/fsnotify/fsnotify v1.9.0
-	github.com/pperesbr/gokit v0.0.0-20260107183620-3e9421f7d23b
 	golang.org/x/crypto v0.46.0
 	gopkg.in/yaml.v3 v3.0.1
 )
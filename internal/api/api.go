@@ -0,0 +1,533 @@
+package api
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pperesbr/conduit/internal/config"
+	"github.com/pperesbr/conduit/internal/manager"
+	"github.com/pperesbr/conduit/internal/tunnel"
+)
+
+// ScoreResponse is the body returned by the health score endpoint.
+type ScoreResponse struct {
+	Score     float64 `json:"score"`
+	Healthy   int     `json:"healthy"`
+	Stuck     int     `json:"stuck"`
+	Total     int     `json:"total"`
+	Threshold float64 `json:"threshold"`
+}
+
+// SummaryResponse is the body returned by the summary endpoint.
+type SummaryResponse struct {
+	Total          int      `json:"total"`
+	Running        int      `json:"running"`
+	Starting       int      `json:"starting"`
+	Stopped        int      `json:"stopped"`
+	Errored        int      `json:"errored"`
+	Disabled       int      `json:"disabled"`
+	Paused         int      `json:"paused"`
+	Healthy        int      `json:"healthy"`
+	Unhealthy      int      `json:"unhealthy"`
+	UnhealthyNames []string `json:"unhealthyNames"`
+}
+
+// TunnelStatus describes the desired and actual state of a single tunnel in the status endpoint.
+type TunnelStatus struct {
+	Name        string `json:"name"`
+	Desired     string `json:"desired"`
+	Actual      string `json:"actual"`
+	Error       string `json:"error,omitempty"`
+	Diverged    bool   `json:"diverged"`
+	Stuck       bool   `json:"stuck"`
+	Maintenance bool   `json:"maintenance"`
+	LocalAddr   string `json:"localAddr,omitempty"`
+	RemoteAddr  string `json:"remoteAddr"`
+	// Reverse is set for tunnels listening on RemoteAddr on the SSH server and forwarding to LocalAddr, and Dynamic for
+	// tunnels serving SOCKS5 on LocalAddr.
+	Reverse bool `json:"reverse,omitempty"`
+	Dynamic bool `json:"dynamic,omitempty"`
+	// SSHAddr is the resolved address of the SSH server and RemoteDialAddr the address the most recent forwarded
+	// connection was opened to.
+	SSHAddr        string `json:"sshAddr,omitempty"`
+	RemoteDialAddr string `json:"remoteDialAddr,omitempty"`
+	// Parked is set once the tunnel exhausted its retry budget; RetriesLeft is omitted for tunnels without a budget.
+	Parked      bool `json:"parked,omitempty"`
+	RetriesLeft *int `json:"retriesLeft,omitempty"`
+	// Connections, ActiveConnections, BytesIn, and BytesOut are counted since the tunnel last started; Restarts over its
+	// lifetime.
+	Connections       int64 `json:"connections"`
+	ActiveConnections int64 `json:"activeConnections"`
+	BytesIn           int64 `json:"bytesIn"`
+	BytesOut          int64 `json:"bytesOut"`
+	Restarts          int   `json:"restarts"`
+	// StartedAt and LastConnectedAt are set while the tunnel is running: when it last started, including automatic
+	// restarts, and when its SSH connection was last established.
+	StartedAt       *time.Time `json:"startedAt,omitempty"`
+	LastConnectedAt *time.Time `json:"lastConnectedAt,omitempty"`
+}
+
+// TunnelSummary describes a single tunnel in the tunnels endpoint.
+type TunnelSummary struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Healthy   bool   `json:"healthy"`
+	LocalPort int    `json:"localPort,omitempty"`
+}
+
+// TunnelStats holds the traffic counters of a single tunnel in the stats endpoint. Counters are kept since the tunnel
+// last started, or since its accounting period last reset.
+type TunnelStats struct {
+	Name               string     `json:"name"`
+	LocalPort          int        `json:"localPort,omitempty"`
+	BytesIn            int64      `json:"bytesIn"`
+	BytesOut           int64      `json:"bytesOut"`
+	Connections        int64      `json:"connections"`
+	ActiveConnections  int64      `json:"activeConnections"`
+	QueuedConnections  int64      `json:"queuedConnections"`
+	RefusedConnections int64      `json:"refusedConnections"`
+	StartedAt          *time.Time `json:"startedAt,omitempty"`
+	LastActivity       *time.Time `json:"lastActivity,omitempty"`
+}
+
+// TunnelHealth describes the health of a single tunnel in the health endpoint.
+type TunnelHealth struct {
+	Name        string   `json:"name"`
+	Status      string   `json:"status"`
+	LocalPort   int      `json:"localPort,omitempty"`
+	Healthy     bool     `json:"healthy"`
+	Stuck       bool     `json:"stuck"`
+	Maintenance bool     `json:"maintenance"`
+	Tags        []string `json:"tags,omitempty"`
+	Retries     int      `json:"retries,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	ProbeError  string   `json:"probeError,omitempty"`
+	// StartedAt, LastConnectedAt, and UptimeSeconds, the time since StartedAt, are set while the tunnel is running.
+	StartedAt       *time.Time `json:"startedAt,omitempty"`
+	LastConnectedAt *time.Time `json:"lastConnectedAt,omitempty"`
+	UptimeSeconds   int64      `json:"uptimeSeconds,omitempty"`
+}
+
+// HealthResponse is the body returned by the health endpoint.
+type HealthResponse struct {
+	Healthy bool           `json:"healthy"`
+	Tunnels []TunnelHealth `json:"tunnels"`
+}
+
+// ControlResponse is the body returned by the start, stop, restart, and reconnect endpoints.
+type ControlResponse struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// DrainResponse is the body returned by the drain endpoint.
+type DrainResponse struct {
+	Drained int `json:"drained"`
+	Forced  int `json:"forced"`
+}
+
+// ErrorResponse is the body returned when a request fails.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// defaultDrainTimeout is used by the drain endpoint when the request does not specify a timeout.
+const defaultDrainTimeout = 30 * time.Second
+
+// Handler serves conduit's HTTP endpoints backed by a Manager. Routes are relative to the root, so the handler can be
+// mounted under a prefix with http.StripPrefix.
+type Handler struct {
+	manager *manager.Manager
+	config  config.APIConfig
+	mux     *http.ServeMux
+}
+
+// NewHandler creates a Handler for the given Manager with its routes registered.
+func NewHandler(mgr *manager.Manager, cfg config.APIConfig) *Handler {
+	h := &Handler{
+		manager: mgr,
+		config:  cfg,
+		mux:     http.NewServeMux(),
+	}
+
+	h.mux.HandleFunc("GET /status", h.handleStatus)
+	h.mux.HandleFunc("GET /tunnels", h.handleTunnels)
+	h.mux.HandleFunc("GET /stats", h.handleStats)
+	h.mux.HandleFunc("GET /health", h.handleHealth)
+	h.mux.HandleFunc("GET /health/score", h.handleScore)
+	h.mux.HandleFunc("GET /summary", h.handleSummary)
+	h.mux.HandleFunc("GET /metrics", h.handleMetrics)
+	h.mux.HandleFunc("GET /config", h.handleConfig)
+	h.mux.HandleFunc("POST /tunnels/{name}/start", h.handleControl(h.manager.Start))
+	h.mux.HandleFunc("POST /tunnels/{name}/stop", h.handleControl(h.manager.Stop))
+	h.mux.HandleFunc("POST /tunnels/{name}/restart", h.handleControl(h.manager.Restart))
+	h.mux.HandleFunc("POST /tunnels/{name}/reconnect", h.handleControl(h.manager.Reconnect))
+	h.mux.HandleFunc("POST /tunnels/{name}/drain", h.handleDrain)
+	h.mux.HandleFunc("POST /tunnels/{name}/unpark", h.handleControl(h.manager.Unpark))
+
+	return h
+}
+
+// ServeHTTP dispatches the request to the registered routes, answering 401 instead when a token is configured and the
+// request does not carry it.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.config.Token != "" && !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="conduit"`)
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "missing or invalid api token"})
+		return
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+// authorized reports whether the request carries the configured token as a bearer token. The comparison takes the
+// same time wherever the tokens differ.
+func (h *Handler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.config.Token)) == 1
+}
+
+// handleTunnels lists the name, status, and health of every tunnel, sorted by name. Unlike the health endpoint it
+// always answers 200.
+func (h *Handler) handleTunnels(w http.ResponseWriter, r *http.Request) {
+	health := h.manager.HealthCheck()
+	sort.Slice(health, func(i, j int) bool { return health[i].Name < health[j].Name })
+
+	tunnels := make([]TunnelSummary, 0, len(health))
+	for _, status := range health {
+		tunnels = append(tunnels, TunnelSummary{
+			Name:      status.Name,
+			Status:    string(status.Status),
+			Healthy:   status.Healthy,
+			LocalPort: status.LocalPort,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, tunnels)
+}
+
+// handleStats reports the traffic counters of every tunnel, sorted by name.
+func (h *Handler) handleStats(w http.ResponseWriter, r *http.Request) {
+	stats := h.manager.Stats()
+
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resp := make([]TunnelStats, 0, len(names))
+	for _, name := range names {
+		s := stats[name]
+		resp = append(resp, TunnelStats{
+			Name:               name,
+			LocalPort:          s.LocalPort,
+			BytesIn:            s.BytesIn,
+			BytesOut:           s.BytesOut,
+			Connections:        s.Connections,
+			ActiveConnections:  s.ActiveConnections,
+			QueuedConnections:  s.QueuedConnections,
+			RefusedConnections: s.RefusedConnections,
+			StartedAt:          timeOrNil(s.StartedAt),
+			LastActivity:       timeOrNil(s.LastActivity),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleStatus lists the desired and actual state of every tunnel, sorted by name.
+func (h *Handler) handleStatus(w http.ResponseWriter, r *http.Request) {
+	snapshots := h.manager.Snapshot()
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Name < snapshots[j].Name })
+
+	statuses := make([]TunnelStatus, 0, len(snapshots))
+	for _, snap := range snapshots {
+		status := TunnelStatus{
+			Name:        snap.Name,
+			Desired:     string(snap.Desired),
+			Actual:      string(snap.Actual),
+			Error:       errorString(snap.Error),
+			Diverged:    snap.Diverged,
+			Stuck:       snap.Stuck,
+			Maintenance: snap.Maintenance,
+
+			SSHAddr:        snap.Connection.RemoteAddr,
+			RemoteDialAddr: snap.RemoteDialAddr,
+			Parked:         snap.Parked,
+
+			Restarts:        snap.Restarts,
+			StartedAt:       timeOrNil(snap.StartedAt),
+			LastConnectedAt: timeOrNil(snap.LastConnectedAt),
+		}
+
+		if snap.RetriesLeft >= 0 {
+			status.RetriesLeft = &snap.RetriesLeft
+		}
+
+		if tun := h.manager.Get(snap.Name); tun != nil {
+			stats := tun.Stats()
+			status.Connections = stats.Connections
+			status.ActiveConnections = stats.ActiveConnections
+			status.BytesIn = stats.BytesIn
+			status.BytesOut = stats.BytesOut
+			status.RemoteAddr = tun.RemoteAddr()
+			status.Reverse = tun.Reverse()
+			status.Dynamic = tun.Dynamic()
+			if snap.Actual == tunnel.StatusRunning {
+				status.LocalAddr = tun.LocalAddr()
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// handleHealth reports the health of every tunnel, answering 503 unless all of them are healthy.
+func (h *Handler) handleHealth(w http.ResponseWriter, r *http.Request) {
+	health := h.manager.HealthCheck()
+	sort.Slice(health, func(i, j int) bool { return health[i].Name < health[j].Name })
+
+	now := time.Now()
+	resp := HealthResponse{Healthy: true, Tunnels: make([]TunnelHealth, 0, len(health))}
+	for _, status := range health {
+		resp.Healthy = resp.Healthy && status.Healthy
+		resp.Tunnels = append(resp.Tunnels, TunnelHealth{
+			Name:        status.Name,
+			Status:      string(status.Status),
+			LocalPort:   status.LocalPort,
+			Healthy:     status.Healthy,
+			Stuck:       status.Stuck,
+			Maintenance: status.Maintenance,
+			Tags:        status.Tags,
+			Retries:     status.Retries,
+			Error:       errorString(status.Error),
+			ProbeError:  errorString(status.ProbeError),
+
+			StartedAt:       timeOrNil(status.StartedAt),
+			LastConnectedAt: timeOrNil(status.LastConnectedAt),
+			UptimeSeconds:   int64(status.Uptime(now).Seconds()),
+		})
+	}
+
+	code := http.StatusOK
+	if !resp.Healthy {
+		code = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, resp)
+}
+
+// handleMetrics writes per-tunnel state and traffic counters in the Prometheus text exposition format.
+func (h *Handler) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	status := h.manager.Status()
+	stats := h.manager.Stats()
+
+	names := make([]string, 0, len(status))
+	for name := range status {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metrics := []struct {
+		name  string
+		kind  string
+		help  string
+		value func(name string) float64
+	}{
+		{"conduit_tunnel_up", "gauge", "Whether the tunnel is running.", func(name string) float64 {
+			if status[name] == tunnel.StatusRunning {
+				return 1
+			}
+			return 0
+		}},
+		{"conduit_tunnel_bytes_in_total", "counter", "Bytes received from the remote since the tunnel started.", func(name string) float64 {
+			return float64(stats[name].BytesIn)
+		}},
+		{"conduit_tunnel_bytes_out_total", "counter", "Bytes sent to the remote since the tunnel started.", func(name string) float64 {
+			return float64(stats[name].BytesOut)
+		}},
+		{"conduit_tunnel_connections_total", "counter", "Connections accepted since the tunnel started.", func(name string) float64 {
+			return float64(stats[name].Connections)
+		}},
+		{"conduit_tunnel_active_connections", "gauge", "Connections currently open.", func(name string) float64 {
+			return float64(stats[name].ActiveConnections)
+		}},
+		{"conduit_tunnel_queued_connections", "gauge", "Connections waiting for a slot under maxConnections.", func(name string) float64 {
+			return float64(stats[name].QueuedConnections)
+		}},
+		{"conduit_tunnel_queue_wait_seconds_avg", "gauge", "Average time dequeued connections waited for a slot.", func(name string) float64 {
+			return stats[name].AvgQueueWait().Seconds()
+		}},
+		{"conduit_tunnel_refused_connections_total", "counter", "Connections refused because the limit and queue were full.", func(name string) float64 {
+			return float64(stats[name].RefusedConnections)
+		}},
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	for _, metric := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.kind)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s{tunnel=%q} %g\n", metric.name, name, metric.value(name))
+		}
+	}
+}
+
+// handleControl returns a handler that applies action to the named tunnel and reports its resulting status.
+func (h *Handler) handleControl(action func(name string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+
+		tun := h.manager.Get(name)
+		if tun == nil {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Error: fmt.Sprintf("tunnel %s not found", name)})
+			return
+		}
+
+		if err := action(name); err != nil {
+			writeJSON(w, http.StatusConflict, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, ControlResponse{Name: name, Status: string(tun.Status())})
+	}
+}
+
+// handleScore reports the fraction of healthy tunnels, answering 503 when it falls below the configured threshold so a
+// load balancer can drain a degraded instance. An instance without tunnels scores 0, and one without a healthy tunnel
+// answers 503 whatever the threshold, including the default of 0.
+func (h *Handler) handleScore(w http.ResponseWriter, r *http.Request) {
+	summary := h.manager.Summary()
+
+	resp := ScoreResponse{
+		Total:     summary.Total,
+		Healthy:   summary.Healthy,
+		Stuck:     len(h.manager.Stuck()),
+		Threshold: h.config.HealthThreshold,
+	}
+
+	if resp.Total > 0 {
+		resp.Score = float64(resp.Healthy) / float64(resp.Total)
+	}
+
+	code := http.StatusOK
+	if resp.Healthy == 0 || resp.Score < resp.Threshold {
+		code = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, resp)
+}
+
+// handleSummary reports tunnel counts by state and health without per-tunnel detail.
+func (h *Handler) handleSummary(w http.ResponseWriter, r *http.Request) {
+	summary := h.manager.Summary()
+
+	writeJSON(w, http.StatusOK, SummaryResponse{
+		Total:          summary.Total,
+		Running:        summary.Running,
+		Starting:       summary.Starting,
+		Stopped:        summary.Stopped,
+		Errored:        summary.Errored,
+		Disabled:       summary.Disabled,
+		Paused:         summary.Paused,
+		Healthy:        summary.Healthy,
+		Unhealthy:      summary.Unhealthy,
+		UnhealthyNames: summary.UnhealthyNames,
+	})
+}
+
+// handleDrain stops accepting connections on a single tunnel and waits for its open connections to finish within the
+// optional timeout query parameter, reporting how many drained and how many were closed forcibly.
+func (h *Handler) handleDrain(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	timeout := defaultDrainTimeout
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("invalid timeout %q", value)})
+			return
+		}
+		timeout = parsed
+	}
+
+	if h.manager.Get(name) == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: fmt.Sprintf("tunnel %s not found", name)})
+		return
+	}
+
+	result, err := h.manager.Drain(name, timeout)
+	if err != nil {
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, DrainResponse{Drained: result.Drained, Forced: result.Forced})
+}
+
+// handleConfig exports the effective config in the format query parameter, yaml by default. The SSH password is
+// referenced or redacted per the secrets query parameter and is never served in clear.
+func (h *Handler) handleConfig(w http.ResponseWriter, r *http.Request) {
+	opts := config.ExportOptions{
+		Format:  r.URL.Query().Get("format"),
+		Secrets: r.URL.Query().Get("secrets"),
+	}
+	if opts.Secrets == config.SecretsInclude {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "secrets cannot be included over the api"})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.manager.ExportConfig(&buf, opts); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	contentType := "application/yaml"
+	if opts.Format == config.ExportJSON {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		slog.Error("api: failed to write response", "error", err)
+	}
+}
+
+// errorString returns the message of err, or an empty string when err is nil.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// timeOrNil returns a pointer to t, or nil when t is the zero time so it is left out of the response.
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// writeJSON encodes v as the JSON response body with the given status code.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("api: failed to encode response", "error", err)
+	}
+}
@@ -0,0 +1,424 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pperesbr/conduit/internal/config"
+	"github.com/pperesbr/conduit/internal/manager"
+	"github.com/pperesbr/conduit/internal/tunnel"
+	"golang.org/x/crypto/ssh"
+)
+
+// TestHandleScore verifies the health score and status code for healthy, degraded, and down instances.
+func TestHandleScore(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	tests := []struct {
+		name      string
+		total     int
+		running   int
+		threshold float64
+		wantCode  int
+		wantScore float64
+	}{
+		{name: "fully healthy", total: 2, running: 2, threshold: 0.5, wantCode: http.StatusOK, wantScore: 1},
+		{name: "degraded above threshold", total: 4, running: 3, threshold: 0.5, wantCode: http.StatusOK, wantScore: 0.75},
+		{name: "degraded below threshold", total: 4, running: 1, threshold: 0.5, wantCode: http.StatusServiceUnavailable, wantScore: 0.25},
+		{name: "fully down", total: 2, running: 0, threshold: 0.5, wantCode: http.StatusServiceUnavailable, wantScore: 0},
+		{name: "fully down at default threshold", total: 2, running: 0, wantCode: http.StatusServiceUnavailable, wantScore: 0},
+		{name: "degraded at default threshold", total: 2, running: 1, wantCode: http.StatusOK, wantScore: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr := manager.NewManager(sshCfg)
+			defer mgr.StopAll()
+
+			for i := 0; i < tt.total; i++ {
+				name := fmt.Sprintf("t%d", i)
+				_ = mgr.Add(config.TunnelConfig{Name: name, RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: 0})
+				if i < tt.running {
+					if err := mgr.Start(name); err != nil {
+						t.Fatalf("unexpected error starting %s: %v", name, err)
+					}
+				}
+			}
+
+			handler := NewHandler(mgr, config.APIConfig{HealthThreshold: tt.threshold})
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/score", nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d", tt.wantCode, rec.Code)
+			}
+
+			var resp ScoreResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			if resp.Score != tt.wantScore {
+				t.Errorf("expected score %v, got %v", tt.wantScore, resp.Score)
+			}
+
+			if resp.Total != tt.total || resp.Healthy != tt.running {
+				t.Errorf("expected %d/%d healthy, got %d/%d", tt.running, tt.total, resp.Healthy, resp.Total)
+			}
+		})
+	}
+}
+
+// TestHandleScore_NoTunnels verifies that an instance without tunnels is reported as unavailable.
+func TestHandleScore_NoTunnels(t *testing.T) {
+	sshCfg, _ := tunnel.NewSSHConfig("user", "pass", "", "localhost", "", 22)
+	mgr := manager.NewManager(sshCfg)
+
+	handler := NewHandler(mgr, config.APIConfig{})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/score", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", rec.Code)
+	}
+}
+
+// setupTestSSHServer creates and starts a test SSH server for unit testing, returning the listener and SSH configuration.
+func setupTestSSHServer(t *testing.T) (net.Listener, *tunnel.SSHConfig) {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate private key: %v", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "testuser" && string(pass) == "testpass" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("invalid credentials")
+		},
+	}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handleTestSSHConnection(conn, serverConfig)
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	cfg, err := tunnel.NewSSHConfig("testuser", "testpass", "", "127.0.0.1", "", port)
+	if err != nil {
+		listener.Close()
+		t.Fatalf("failed to create ssh config: %v", err)
+	}
+
+	return listener, cfg
+}
+
+// handleTestSSHConnection handles an incoming SSH connection, sets up channels, and forwards traffic to the requested destination.
+func handleTestSSHConnection(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	defer sshConn.Close()
+
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() == "direct-tcpip" {
+			channel, requests, err := newChannel.Accept()
+			if err != nil {
+				continue
+			}
+			go ssh.DiscardRequests(requests)
+
+			var payload struct {
+				DestHost   string
+				DestPort   uint32
+				OriginHost string
+				OriginPort uint32
+			}
+			ssh.Unmarshal(newChannel.ExtraData(), &payload)
+
+			destAddr := net.JoinHostPort(payload.DestHost, strconv.Itoa(int(payload.DestPort)))
+			destConn, err := net.Dial("tcp", destAddr)
+			if err != nil {
+				channel.Close()
+				continue
+			}
+
+			go func() {
+				defer channel.Close()
+				defer destConn.Close()
+				io.Copy(channel, destConn)
+			}()
+			go func() {
+				defer channel.Close()
+				defer destConn.Close()
+				io.Copy(destConn, channel)
+			}()
+		}
+	}
+}
+
+// TestHandleDrain verifies the drain endpoint for an idle tunnel, an unknown tunnel, and an invalid timeout.
+func TestHandleDrain(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := manager.NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	_ = mgr.Add(config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: 0})
+	if err := mgr.Start("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	handler := NewHandler(mgr, config.APIConfig{})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tunnels/db/drain?timeout=100ms", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var resp DrainResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if resp.Drained != 0 || resp.Forced != 0 {
+		t.Errorf("expected nothing to drain, got %+v", resp)
+	}
+
+	if status := mgr.Status()["db"]; status != tunnel.StatusStopped {
+		t.Errorf("expected tunnel to be stopped, got %s", status)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tunnels/missing/drain", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown tunnel, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tunnels/db/drain?timeout=soon", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for invalid timeout, got %d", rec.Code)
+	}
+}
+
+// TestHandleTunnelsAndStats verifies the tunnels and stats endpoints list every tunnel sorted by name.
+func TestHandleTunnelsAndStats(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := manager.NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	_ = mgr.Add(config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: 0})
+	_ = mgr.Add(config.TunnelConfig{Name: "cache", RemoteHost: "127.0.0.1", RemotePort: 6379, LocalPort: 0})
+	if err := mgr.Start("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	handler := NewHandler(mgr, config.APIConfig{})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tunnels", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var tunnels []TunnelSummary
+	if err := json.NewDecoder(rec.Body).Decode(&tunnels); err != nil {
+		t.Fatalf("failed to decode tunnels: %v", err)
+	}
+	port := mgr.Get("db").LocalPort()
+	want := []TunnelSummary{
+		{Name: "cache", Status: string(tunnel.StatusStopped), Healthy: false},
+		{Name: "db", Status: string(tunnel.StatusRunning), Healthy: true, LocalPort: port},
+	}
+	if len(tunnels) != len(want) || tunnels[0] != want[0] || tunnels[1] != want[1] {
+		t.Errorf("expected %+v, got %+v", want, tunnels)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var stats []TunnelStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	if len(stats) != 2 || stats[0].Name != "cache" || stats[1].Name != "db" {
+		t.Fatalf("expected cache and db sorted by name, got %+v", stats)
+	}
+	if stats[0].StartedAt != nil || stats[1].StartedAt == nil {
+		t.Errorf("expected only db to report a start time, got %+v", stats)
+	}
+	if stats[1].LocalPort != port {
+		t.Errorf("expected db to report its assigned port %d, got %d", port, stats[1].LocalPort)
+	}
+}
+
+// TestHandler_Token verifies that a configured token is required on every route.
+func TestHandler_Token(t *testing.T) {
+	mgr := manager.NewManager(&tunnel.SSHConfig{})
+	handler := NewHandler(mgr, config.APIConfig{Token: "s3cret"})
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{name: "missing", header: "", want: http.StatusUnauthorized},
+		{name: "wrong token", header: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "wrong scheme", header: "Basic s3cret", want: http.StatusUnauthorized},
+		{name: "valid", header: "Bearer s3cret", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/tunnels", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("expected status %d, got %d: %s", tt.want, rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+// TestHandler_MountedUnderPrefix exercises the status, health, metrics, and control routes through a mux that mounts
+// the handler under a path prefix.
+func TestHandler_MountedUnderPrefix(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := manager.NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	_ = mgr.Add(config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: 0})
+	_ = mgr.Add(config.TunnelConfig{Name: "cache", RemoteHost: "127.0.0.1", RemotePort: 6379, LocalPort: 0})
+	if err := mgr.Start("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/conduit/", http.StripPrefix("/conduit", NewHandler(mgr, config.APIConfig{})))
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/conduit/status")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var statuses []TunnelStatus
+	if err := json.NewDecoder(rec.Body).Decode(&statuses); err != nil {
+		t.Fatalf("failed to decode status: %v", err)
+	}
+	if len(statuses) != 2 || statuses[0].Name != "cache" || statuses[1].Name != "db" {
+		t.Fatalf("expected cache and db sorted by name, got %+v", statuses)
+	}
+	if statuses[1].Actual != string(tunnel.StatusRunning) || statuses[1].LocalAddr == "" {
+		t.Errorf("expected db running with a local address, got %+v", statuses[1])
+	}
+
+	rec = serve(http.MethodGet, "/conduit/health")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 with cache stopped, got %d", rec.Code)
+	}
+
+	rec = serve(http.MethodPost, "/conduit/tunnels/cache/start")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var control ControlResponse
+	if err := json.NewDecoder(rec.Body).Decode(&control); err != nil {
+		t.Fatalf("failed to decode control response: %v", err)
+	}
+	if control.Status != string(tunnel.StatusRunning) {
+		t.Errorf("expected cache running after start, got %+v", control)
+	}
+
+	rec = serve(http.MethodGet, "/conduit/health")
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200 with all tunnels running, got %d: %s", rec.Code, rec.Body)
+	}
+
+	for _, action := range []string{"restart", "reconnect"} {
+		if rec := serve(http.MethodPost, "/conduit/tunnels/db/"+action); rec.Code != http.StatusOK {
+			t.Errorf("expected status 200 for %s, got %d: %s", action, rec.Code, rec.Body)
+		}
+	}
+
+	rec = serve(http.MethodGet, "/conduit/metrics")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	for _, want := range []string{`conduit_tunnel_up{tunnel="db"} 1`, `conduit_tunnel_up{tunnel="cache"} 1`, "# TYPE conduit_tunnel_bytes_in_total counter"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("expected metrics to contain %q, got:\n%s", want, rec.Body)
+		}
+	}
+
+	if rec := serve(http.MethodPost, "/conduit/tunnels/cache/stop"); rec.Code != http.StatusOK {
+		t.Errorf("expected status 200 for stop, got %d", rec.Code)
+	}
+	if status := mgr.Status()["cache"]; status != tunnel.StatusStopped {
+		t.Errorf("expected cache stopped, got %s", status)
+	}
+
+	if rec := serve(http.MethodPost, "/conduit/tunnels/missing/start"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown tunnel, got %d", rec.Code)
+	}
+
+	if rec := serve(http.MethodPost, "/conduit/tunnels/cache/reconnect"); rec.Code != http.StatusConflict {
+		t.Errorf("expected status 409 when reconnecting a stopped tunnel, got %d", rec.Code)
+	}
+}
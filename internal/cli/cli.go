@@ -0,0 +1,309 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pperesbr/conduit/internal/api"
+	"github.com/pperesbr/conduit/internal/config"
+)
+
+// Format selects how subcommands render their output.
+type Format string
+
+const (
+	FormatJSON  Format = "json"
+	FormatTable Format = "table"
+)
+
+// requestTimeout bounds a single request to a running conduit's API.
+const requestTimeout = 10 * time.Second
+
+// Commands lists the read-only subcommands understood by Run.
+var Commands = []string{"status", "list", "health", "export", "top"}
+
+// ParseFormat validates a -o value, falling back to the default for the given output when it is empty.
+func ParseFormat(value string, out *os.File) (Format, error) {
+	switch Format(value) {
+	case "":
+		return DefaultFormat(out), nil
+	case FormatJSON, FormatTable:
+		return Format(value), nil
+	default:
+		return "", fmt.Errorf("unknown output format %q, expected %q or %q", value, FormatJSON, FormatTable)
+	}
+}
+
+// DefaultFormat returns table when out is a terminal and json otherwise, so piped output is machine-readable.
+func DefaultFormat(out *os.File) Format {
+	if isTerminal(out) {
+		return FormatTable
+	}
+	return FormatJSON
+}
+
+// isTerminal reports whether w is a file attached to a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Client queries the HTTP API of a running conduit.
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// NewClient creates a Client for the API listening on addr. An address without a host, such as ":8080", is reached on
+// the loopback interface.
+func NewClient(addr string) *Client {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		addr = net.JoinHostPort("127.0.0.1", port)
+	}
+
+	return &Client{
+		baseURL: "http://" + addr,
+		http:    &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// SetToken makes the client send token as a bearer token with every request, for an API with api.token set.
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// Status fetches the state of every tunnel.
+func (c *Client) Status() ([]api.TunnelStatus, error) {
+	var statuses []api.TunnelStatus
+	if err := c.get("/status", &statuses); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// Summary fetches tunnel counts by state and health.
+func (c *Client) Summary() (api.SummaryResponse, error) {
+	var summary api.SummaryResponse
+	if err := c.get("/summary", &summary); err != nil {
+		return api.SummaryResponse{}, err
+	}
+	return summary, nil
+}
+
+// Health fetches the health of every tunnel. An unhealthy instance is not an error.
+func (c *Client) Health() (api.HealthResponse, error) {
+	var health api.HealthResponse
+	if err := c.get("/health", &health); err != nil {
+		return api.HealthResponse{}, err
+	}
+	return health, nil
+}
+
+// Config fetches the effective config of the running conduit in the given export format, with the SSH password
+// referenced rather than included.
+func (c *Client) Config(format string) ([]byte, error) {
+	resp, err := c.fetch("/config?format=" + url.QueryEscape(format))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach conduit api: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("conduit api returned %s for /config", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /config response: %w", err)
+	}
+	return data, nil
+}
+
+// get decodes the JSON body served at path into v, accepting 503 responses since health endpoints use them to report
+// degraded state.
+func (c *Client) get(path string, v any) error {
+	resp, err := c.fetch(path)
+	if err != nil {
+		return fmt.Errorf("failed to reach conduit api: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return fmt.Errorf("conduit api returned %s for %s", resp.Status, path)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", path, err)
+	}
+
+	return nil
+}
+
+// fetch sends a GET request for path, with the token when one is set.
+func (c *Client) fetch(path string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.http.Do(req)
+}
+
+// Run executes the named read subcommand against the API client and renders its result to w. Export writes YAML in
+// table mode and JSON otherwise. Top keeps refreshing while w is a terminal in table mode, and prints once otherwise.
+func Run(command string, client *Client, format Format, w io.Writer) error {
+	switch command {
+	case "status":
+		statuses, err := client.Status()
+		if err != nil {
+			return err
+		}
+		if format == FormatTable {
+			summary, err := client.Summary()
+			if err != nil {
+				return err
+			}
+			if err := RenderSummary(w, summary); err != nil {
+				return err
+			}
+		}
+		return RenderStatus(w, format, statuses)
+
+	case "list":
+		statuses, err := client.Status()
+		if err != nil {
+			return err
+		}
+		return RenderList(w, format, statuses)
+
+	case "health":
+		health, err := client.Health()
+		if err != nil {
+			return err
+		}
+		return RenderHealth(w, format, health)
+
+	case "export":
+		exportFormat := config.ExportYAML
+		if format == FormatJSON {
+			exportFormat = config.ExportJSON
+		}
+		data, err := client.Config(exportFormat)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+
+	case "top":
+		return Top(context.Background(), client, format, format == FormatTable && isTerminal(w), TopInterval, w)
+
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// RenderStatus writes the state of every tunnel.
+func RenderStatus(w io.Writer, format Format, statuses []api.TunnelStatus) error {
+	if format == FormatJSON {
+		return writeJSON(w, statuses)
+	}
+
+	sorted := sortedStatuses(statuses)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tDESIRED\tACTUAL\tLOCAL\tREMOTE\tERROR")
+	for _, s := range sorted {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Name, s.Desired, s.Actual, dash(s.LocalAddr), s.RemoteAddr, dash(s.Error))
+	}
+	return tw.Flush()
+}
+
+// RenderSummary writes the one-line header shown above the status table.
+func RenderSummary(w io.Writer, summary api.SummaryResponse) error {
+	_, err := fmt.Fprintf(w, "%d tunnels: %d running, %d starting, %d stopped, %d errored; %d/%d healthy\n\n",
+		summary.Total, summary.Running, summary.Starting, summary.Stopped, summary.Errored, summary.Healthy, summary.Total)
+	return err
+}
+
+// RenderList writes the names of every tunnel, one per line in table mode.
+func RenderList(w io.Writer, format Format, statuses []api.TunnelStatus) error {
+	sorted := sortedStatuses(statuses)
+
+	names := make([]string, 0, len(sorted))
+	for _, s := range sorted {
+		names = append(names, s.Name)
+	}
+
+	if format == FormatJSON {
+		return writeJSON(w, names)
+	}
+
+	for _, name := range names {
+		if _, err := fmt.Fprintln(w, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderHealth writes the health of every tunnel.
+func RenderHealth(w io.Writer, format Format, health api.HealthResponse) error {
+	if format == FormatJSON {
+		return writeJSON(w, health)
+	}
+
+	tunnels := make([]api.TunnelHealth, len(health.Tunnels))
+	copy(tunnels, health.Tunnels)
+	sort.Slice(tunnels, func(i, j int) bool { return tunnels[i].Name < tunnels[j].Name })
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATUS\tHEALTHY\tSTUCK\tMAINTENANCE\tERROR")
+	for _, t := range tunnels {
+		errMsg := t.Error
+		if errMsg == "" {
+			errMsg = t.ProbeError
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%t\t%t\t%s\n", t.Name, t.Status, t.Healthy, t.Stuck, t.Maintenance, dash(errMsg))
+	}
+	return tw.Flush()
+}
+
+// sortedStatuses returns a copy of statuses ordered by name.
+func sortedStatuses(statuses []api.TunnelStatus) []api.TunnelStatus {
+	sorted := make([]api.TunnelStatus, len(statuses))
+	copy(sorted, statuses)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
+
+// dash returns value, or "-" when it is empty, so table columns stay aligned.
+func dash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// writeJSON writes v as indented JSON.
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
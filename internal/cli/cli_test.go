@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pperesbr/conduit/internal/api"
+)
+
+// fixedStatuses is the snapshot every rendering test starts from, deliberately out of name order.
+var fixedStatuses = []api.TunnelStatus{
+	{Name: "replica", Desired: "running", Actual: "error", Error: "connection refused", Diverged: true, RemoteAddr: "db-replica:5432"},
+	{Name: "primary", Desired: "running", Actual: "running", LocalAddr: "127.0.0.1:5432", RemoteAddr: "db-primary:5432"},
+}
+
+// fixedHealth is the health report every rendering test starts from.
+var fixedHealth = api.HealthResponse{
+	Healthy: false,
+	Tunnels: []api.TunnelHealth{
+		{Name: "replica", Status: "error", Error: "connection refused", Stuck: true},
+		{Name: "primary", Status: "running", Healthy: true},
+	},
+}
+
+func TestRenderStatus(t *testing.T) {
+	var out bytes.Buffer
+	if err := RenderStatus(&out, FormatTable, fixedStatuses); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header and 2 rows, got:\n%s", out.String())
+	}
+	if fields := strings.Fields(lines[0]); strings.Join(fields, " ") != "NAME DESIRED ACTUAL LOCAL REMOTE ERROR" {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "primary running running 127.0.0.1:5432 db-primary:5432 -" {
+		t.Errorf("unexpected primary row %q", lines[1])
+	}
+	if fields := strings.Fields(lines[2]); strings.Join(fields, " ") != "replica running error - db-replica:5432 connection refused" {
+		t.Errorf("unexpected replica row %q", lines[2])
+	}
+
+	out.Reset()
+	if err := RenderStatus(&out, FormatJSON, fixedStatuses); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var decoded []map[string]any
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("expected valid json, got %v:\n%s", err, out.String())
+	}
+	if len(decoded) != 2 || decoded[0]["name"] != "replica" || decoded[0]["actual"] != "error" || decoded[0]["diverged"] != true {
+		t.Errorf("expected the snapshot fields under stable names, got %+v", decoded)
+	}
+}
+
+func TestRenderList(t *testing.T) {
+	var out bytes.Buffer
+	if err := RenderList(&out, FormatTable, fixedStatuses); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "primary\nreplica\n" {
+		t.Errorf("expected sorted names, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := RenderList(&out, FormatJSON, fixedStatuses); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var names []string
+	if err := json.Unmarshal(out.Bytes(), &names); err != nil {
+		t.Fatalf("expected valid json, got %v:\n%s", err, out.String())
+	}
+	if strings.Join(names, ",") != "primary,replica" {
+		t.Errorf("expected sorted names, got %v", names)
+	}
+}
+
+func TestRenderHealth(t *testing.T) {
+	var out bytes.Buffer
+	if err := RenderHealth(&out, FormatTable, fixedHealth); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header and 2 rows, got:\n%s", out.String())
+	}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "primary running true false false -" {
+		t.Errorf("unexpected primary row %q", lines[1])
+	}
+	if fields := strings.Fields(lines[2]); strings.Join(fields, " ") != "replica error false true false connection refused" {
+		t.Errorf("unexpected replica row %q", lines[2])
+	}
+
+	out.Reset()
+	if err := RenderHealth(&out, FormatJSON, fixedHealth); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var decoded api.HealthResponse
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("expected valid json, got %v:\n%s", err, out.String())
+	}
+	if decoded.Healthy || len(decoded.Tunnels) != 2 || !decoded.Tunnels[0].Stuck {
+		t.Errorf("expected the health report to round-trip, got %+v", decoded)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, value := range []string{"json", "table"} {
+		if format, err := ParseFormat(value, nil); err != nil || string(format) != value {
+			t.Errorf("ParseFormat(%q) = %q, %v", value, format, err)
+		}
+	}
+
+	if _, err := ParseFormat("yaml", nil); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestRun_QueriesAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status":
+			_ = json.NewEncoder(w).Encode(fixedStatuses)
+		case "/summary":
+			_ = json.NewEncoder(w).Encode(api.SummaryResponse{Total: 2, Running: 1, Errored: 1, Healthy: 1, Unhealthy: 1, UnhealthyNames: []string{"replica"}})
+		case "/config":
+			_, _ = w.Write([]byte("tunnels:\n  - name: replica\n"))
+		case "/health":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(fixedHealth)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+
+	for _, command := range Commands {
+		var out bytes.Buffer
+		if err := Run(command, client, FormatTable, &out); err != nil {
+			t.Errorf("%s: unexpected error: %v", command, err)
+		}
+		if !strings.Contains(out.String(), "replica") {
+			t.Errorf("%s: expected output to mention replica, got %q", command, out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := Run("status", client, FormatTable, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "2 tunnels: 1 running, 0 starting, 0 stopped, 1 errored; 1/2 healthy\n") {
+		t.Errorf("expected the summary header above the status table, got %q", out.String())
+	}
+
+	if err := Run("bogus", client, FormatTable, &bytes.Buffer{}); err == nil {
+		t.Error("expected error for unknown command")
+	}
+}
@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pperesbr/conduit/internal/api"
+)
+
+// TopInterval is how often the top view refreshes.
+const TopInterval = 500 * time.Millisecond
+
+// clearScreen moves the cursor home and clears the terminal before each frame of the top view.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// TopRow is one tunnel's line in the top view. Rates are bytes per second since the previous sample.
+type TopRow struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LocalAddr string  `json:"localAddr,omitempty"`
+	Active    int64   `json:"activeConnections"`
+	InRate    float64 `json:"bytesInPerSecond"`
+	OutRate   float64 `json:"bytesOutPerSecond"`
+	Restarts  int     `json:"restarts"`
+}
+
+// TopModel turns successive status samples into top rows, deriving throughput from how the byte counters grew.
+type TopModel struct {
+	previous   map[string]api.TunnelStatus
+	previousAt time.Time
+}
+
+// NewTopModel creates a TopModel with no previous sample.
+func NewTopModel() *TopModel {
+	return &TopModel{previous: make(map[string]api.TunnelStatus)}
+}
+
+// Update records a sample taken at now and returns its rows ordered by name. Rates are zero for a tunnel's first
+// sample and whenever its counters went backwards, as they do when the tunnel restarts.
+func (m *TopModel) Update(statuses []api.TunnelStatus, now time.Time) []TopRow {
+	elapsed := now.Sub(m.previousAt).Seconds()
+	current := make(map[string]api.TunnelStatus, len(statuses))
+
+	rows := make([]TopRow, 0, len(statuses))
+	for _, s := range sortedStatuses(statuses) {
+		current[s.Name] = s
+
+		row := TopRow{
+			Name:      s.Name,
+			Status:    s.Actual,
+			LocalAddr: s.LocalAddr,
+			Active:    s.ActiveConnections,
+			Restarts:  s.Restarts,
+		}
+		if prev, ok := m.previous[s.Name]; ok && elapsed > 0 {
+			row.InRate = rate(prev.BytesIn, s.BytesIn, elapsed)
+			row.OutRate = rate(prev.BytesOut, s.BytesOut, elapsed)
+		}
+		rows = append(rows, row)
+	}
+
+	m.previous = current
+	m.previousAt = now
+
+	return rows
+}
+
+// rate returns how fast a counter grew from before to after over seconds, or 0 if it was reset in between.
+func rate(before, after int64, seconds float64) float64 {
+	if after < before {
+		return 0
+	}
+	return float64(after-before) / seconds
+}
+
+// FormatRate formats a throughput in bytes per second with a binary unit, such as "1.5 KiB/s".
+func FormatRate(bytesPerSecond float64) string {
+	units := []string{"B/s", "KiB/s", "MiB/s", "GiB/s"}
+
+	value := bytesPerSecond
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%.0f %s", value, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+// RenderTop writes the top rows as a table.
+func RenderTop(w io.Writer, rows []TopRow) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATUS\tLOCAL\tACTIVE\tIN\tOUT\tRESTARTS")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%d\n",
+			r.Name, r.Status, dash(r.LocalAddr), r.Active, FormatRate(r.InRate), FormatRate(r.OutRate), r.Restarts)
+	}
+	return tw.Flush()
+}
+
+// Top shows the top view. With live set it redraws the table in place every interval until ctx is done; otherwise it
+// writes a single sample, as a table or as JSON, for output that is not a terminal.
+func Top(ctx context.Context, client *Client, format Format, live bool, interval time.Duration, w io.Writer) error {
+	model := NewTopModel()
+
+	statuses, err := client.Status()
+	if err != nil {
+		return err
+	}
+	rows := model.Update(statuses, time.Now())
+
+	if !live {
+		if format == FormatJSON {
+			return writeJSON(w, rows)
+		}
+		return RenderTop(w, rows)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fmt.Fprint(w, clearScreen)
+		fmt.Fprintf(w, "conduit top - %s, refreshing every %s\n\n", time.Now().Format(time.TimeOnly), interval)
+		if err := RenderTop(w, rows); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		statuses, err := client.Status()
+		if err != nil {
+			return err
+		}
+		rows = model.Update(statuses, time.Now())
+	}
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pperesbr/conduit/internal/api"
+)
+
+func TestTopModel_Update(t *testing.T) {
+	model := NewTopModel()
+	start := time.Date(2026, 1, 7, 12, 0, 0, 0, time.UTC)
+
+	rows := model.Update([]api.TunnelStatus{
+		{Name: "replica", Actual: "running", BytesIn: 1000, BytesOut: 500},
+		{Name: "primary", Actual: "running", LocalAddr: "127.0.0.1:5432", ActiveConnections: 3, BytesIn: 4096, Restarts: 2},
+	}, start)
+
+	if len(rows) != 2 || rows[0].Name != "primary" || rows[1].Name != "replica" {
+		t.Fatalf("expected rows ordered by name, got %+v", rows)
+	}
+	if rows[0].InRate != 0 || rows[0].OutRate != 0 {
+		t.Errorf("expected no rate on the first sample, got %+v", rows[0])
+	}
+	if rows[0].Active != 3 || rows[0].Restarts != 2 || rows[0].LocalAddr != "127.0.0.1:5432" {
+		t.Errorf("expected the status fields to carry over, got %+v", rows[0])
+	}
+
+	rows = model.Update([]api.TunnelStatus{
+		{Name: "replica", Actual: "running", BytesIn: 100, BytesOut: 50, Restarts: 1},
+		{Name: "primary", Actual: "running", BytesIn: 4096 + 2048, BytesOut: 1024},
+		{Name: "cache", Actual: "starting", BytesIn: 10},
+	}, start.Add(2*time.Second))
+
+	want := map[string][2]float64{
+		"cache":   {0, 0},
+		"primary": {1024, 512},
+		"replica": {0, 0},
+	}
+	for _, row := range rows {
+		if got := [2]float64{row.InRate, row.OutRate}; got != want[row.Name] {
+			t.Errorf("expected %s rates %v, got %v", row.Name, want[row.Name], got)
+		}
+	}
+}
+
+func TestFormatRate(t *testing.T) {
+	tests := map[float64]string{
+		0:                  "0 B/s",
+		512:                "512 B/s",
+		1536:               "1.5 KiB/s",
+		3 * 1024 * 1024:    "3.0 MiB/s",
+		5 << 40:            "5120.0 GiB/s",
+		1024*1024*1024 - 1: "1024.0 MiB/s",
+	}
+
+	for rate, want := range tests {
+		if got := FormatRate(rate); got != want {
+			t.Errorf("FormatRate(%v): expected %q, got %q", rate, want, got)
+		}
+	}
+}
+
+func TestRenderTop(t *testing.T) {
+	var out bytes.Buffer
+	rows := []TopRow{{Name: "primary", Status: "running", LocalAddr: "127.0.0.1:5432", Active: 1, InRate: 2048, Restarts: 1}}
+	if err := RenderTop(&out, rows); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected header and 1 row, got:\n%s", out.String())
+	}
+	if fields := strings.Join(strings.Fields(lines[1]), " "); fields != "primary running 127.0.0.1:5432 1 2.0 KiB/s 0 B/s 1" {
+		t.Errorf("unexpected row %q", lines[1])
+	}
+}
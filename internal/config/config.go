@@ -1,53 +1,508 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"net"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
-	"github.com/pperesbr/gokit/pkg/tunnel"
+	"github.com/pperesbr/conduit/internal/schedule"
+	"github.com/pperesbr/conduit/internal/tunnel"
 	"gopkg.in/yaml.v3"
 )
 
 // TunnelConfig defines the configuration for a network tunnel, including its name, remote host, and port mappings.
+// RemotePortCommand, when set, replaces RemotePort with the port printed by the command each time the tunnel connects.
+// Maintenance lists time windows, such as "Sun 02:00-04:00", during which the tunnel is expected to be down.
+// Access, when set, lists the only time windows, such as "Mon-Fri 09:00-18:00", during which new connections are accepted.
+// MaxConnections, when set, bounds the connections served at once; up to QueueSize more wait for a slot and any
+// beyond that are refused.
+// SSH, when set, replaces the top-level ssh section for this tunnel, so it can reach its remote through another server.
+// Type selects the direction: a reverse tunnel listens on remoteHost:remotePort on the SSH server and forwards to
+// localHost:localPort on this side, and a dynamic tunnel serves SOCKS5 on localPort, forwarding wherever clients ask.
+// LocalBind is the IP address the local listener binds, 127.0.0.1 by default, such as 0.0.0.0 to serve the network.
+// LocalSocket, when set instead of LocalPort, is the path of a Unix domain socket to listen on.
+// Enabled, true when unset, can be set to false to keep a tunnel registered but stopped.
+// Tags are free-form labels, such as an environment or database kind, for operating on a subset of tunnels at once.
+// StartRetries is how many more times a start tries to connect after the first attempt fails, waiting
+// StartRetryInterval before the first retry and twice as long before each one after.
+// DependsOn names tunnels that must be running before this one starts, such as a proxy in front of its service.
+// RateLimit, a size per second such as "1MB", caps the bytes relayed in each direction across the tunnel's connections.
+// IdleTimeout closes a forwarded connection once no bytes have flowed either way for that long; 0 never does.
 type TunnelConfig struct {
-	Name        string            `yaml:"name"`
-	RemoteHost  string            `yaml:"remoteHost"`
-	RemotePort  int               `yaml:"remotePort"`
-	LocalPort   int               `yaml:"localPort"`
-	AutoRestart AutoRestartConfig `yaml:"autoRestart"`
+	Name               string            `yaml:"name,omitempty"`
+	Enabled            *bool             `yaml:"enabled,omitempty"`
+	Tags               []string          `yaml:"tags,omitempty"`
+	Type               string            `yaml:"type,omitempty"`
+	RemoteHost         string            `yaml:"remoteHost,omitempty"`
+	RemotePort         int               `yaml:"remotePort,omitempty"`
+	RemotePortCommand  string            `yaml:"remotePortCommand,omitempty"`
+	LocalPort          int               `yaml:"localPort,omitempty"`
+	LocalHost          string            `yaml:"localHost,omitempty"`
+	LocalBind          string            `yaml:"localBind,omitempty"`
+	LocalSocket        string            `yaml:"localSocket,omitempty"`
+	TCPNoDelay         *bool             `yaml:"tcpNoDelay,omitempty"`
+	RetryChannel       bool              `yaml:"retryChannel,omitempty"`
+	ChannelOpen        ChannelOpenConfig `yaml:"channelOpen,omitempty"`
+	MaxConnections     int               `yaml:"maxConnections,omitempty"`
+	RateLimit          string            `yaml:"rateLimit,omitempty"`
+	IdleTimeout        time.Duration     `yaml:"idleTimeout,omitempty"`
+	QueueSize          int               `yaml:"queueSize,omitempty"`
+	ShutdownGrace      time.Duration     `yaml:"shutdownGrace,omitempty"`
+	Maintenance        []string          `yaml:"maintenance,omitempty"`
+	Access             []string          `yaml:"access,omitempty"`
+	Probe              ProbeConfig       `yaml:"probe,omitempty"`
+	StatsReset         string            `yaml:"statsReset,omitempty"`
+	AutoRestart        AutoRestartConfig `yaml:"autoRestart,omitempty"`
+	RetryBudget        RetryBudgetConfig `yaml:"retryBudget,omitempty"`
+	StartRetries       int               `yaml:"startRetries,omitempty"`
+	StartRetryInterval time.Duration     `yaml:"startRetryInterval,omitempty"`
+	DependsOn          []string          `yaml:"dependsOn,omitempty"`
+	SSH                *tunnel.SSHConfig `yaml:"ssh,omitempty"`
+}
+
+// Clone returns a deep copy of the TunnelConfig, so changes to its slices and pointers do not reach the original.
+func (t TunnelConfig) Clone() TunnelConfig {
+	t.Enabled = clonePtr(t.Enabled)
+	t.TCPNoDelay = clonePtr(t.TCPNoDelay)
+	t.Tags = slices.Clone(t.Tags)
+	t.Maintenance = slices.Clone(t.Maintenance)
+	t.Access = slices.Clone(t.Access)
+	t.DependsOn = slices.Clone(t.DependsOn)
+	if t.SSH != nil {
+		t.SSH = t.SSH.Clone()
+	}
+	return t
+}
+
+// clonePtr returns a pointer to a copy of the value p points to, or nil for nil.
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// DefaultStartRetryInterval is how long a start waits before its first retry when startRetryInterval is not set.
+const DefaultStartRetryInterval = time.Second
+
+// MaxStartRetryDelay caps the doubling wait between start retries; a longer startRetryInterval is used as is.
+const MaxStartRetryDelay = time.Minute
+
+// MaxStartRetries is the most startRetries a tunnel may set.
+const MaxStartRetries = 100
+
+// StartRetryDelay returns how long a start waits before retry number attempt, counting from 0.
+func (t TunnelConfig) StartRetryDelay(attempt int) time.Duration {
+	interval := t.StartRetryInterval
+	if interval <= 0 {
+		interval = DefaultStartRetryInterval
+	}
+
+	delay := interval
+	for range attempt {
+		if delay >= MaxStartRetryDelay {
+			break
+		}
+		delay = min(delay*2, MaxStartRetryDelay)
+	}
+	return delay
+}
+
+// Tunnel types select the direction a tunnel forwards in.
+const (
+	TunnelTypeLocal   = "local"
+	TunnelTypeReverse = "reverse"
+	TunnelTypeDynamic = "dynamic"
+)
+
+// RateLimitBytes returns the tunnel's rate limit in bytes per second, or 0 when it has none.
+func (t TunnelConfig) RateLimitBytes() int64 {
+	if t.RateLimit == "" {
+		return 0
+	}
+	rate, err := ParseByteSize(t.RateLimit)
+	if err != nil {
+		return 0
+	}
+	return rate
+}
+
+// TunnelType returns the tunnel's type, defaulting to TunnelTypeLocal when unset.
+func (t TunnelConfig) TunnelType() string {
+	if t.Type == "" {
+		return TunnelTypeLocal
+	}
+	return t.Type
+}
+
+// DefaultLocalBind is the address local listeners bind when localBind is not set.
+const DefaultLocalBind = "127.0.0.1"
+
+// LocalBindAddr returns the address the tunnel's local listener binds, defaulting to DefaultLocalBind.
+func (t TunnelConfig) LocalBindAddr() string {
+	if t.LocalBind == "" {
+		return DefaultLocalBind
+	}
+	return t.LocalBind
+}
+
+// Reverse reports whether the tunnel forwards from a listener on the SSH server to a local address.
+func (t TunnelConfig) Reverse() bool {
+	return t.Type == TunnelTypeReverse
+}
+
+// Dynamic reports whether the tunnel serves SOCKS5 instead of forwarding to a fixed remote address.
+func (t TunnelConfig) Dynamic() bool {
+	return t.Type == TunnelTypeDynamic
+}
+
+// NoDelay reports whether TCP_NODELAY should be set on forwarded connections, defaulting to true when unset.
+func (t TunnelConfig) NoDelay() bool {
+	return t.TCPNoDelay == nil || *t.TCPNoDelay
+}
+
+// IsEnabled reports whether the tunnel may be started, defaulting to true when enabled is unset.
+func (t TunnelConfig) IsEnabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
+// HasTag reports whether tag is one of the tunnel's tags.
+func (t TunnelConfig) HasTag(tag string) bool {
+	return slices.Contains(t.Tags, tag)
+}
+
+// Defaults for retrying channel opens the SSH server refuses for lack of resources.
+const (
+	DefaultChannelOpenRetries = 3
+	DefaultChannelOpenBackoff = 50 * time.Millisecond
+)
+
+// ChannelOpenConfig defines how a forwarded connection retries opening its SSH channel when the server temporarily
+// refuses new channels, so bursts of connections queue briefly instead of failing.
+type ChannelOpenConfig struct {
+	Retries *int          `yaml:"retries,omitempty"`
+	Backoff time.Duration `yaml:"backoff,omitempty"`
+}
+
+// RetryCount returns the configured number of retries, defaulting to DefaultChannelOpenRetries when unset.
+func (c ChannelOpenConfig) RetryCount() int {
+	if c.Retries == nil {
+		return DefaultChannelOpenRetries
+	}
+	return *c.Retries
+}
+
+// RetryBackoff returns the configured initial backoff, defaulting to DefaultChannelOpenBackoff when unset.
+func (c ChannelOpenConfig) RetryBackoff() time.Duration {
+	if c.Backoff == 0 {
+		return DefaultChannelOpenBackoff
+	}
+	return c.Backoff
+}
+
+// Probe modes select how a tunnel's active health probe reaches the remote service.
+const (
+	ProbeModeLocal = "local"
+	ProbeModeSSH   = "ssh"
+	ProbeModeHTTP  = "http"
+)
+
+// ProbeConfig defines an active health probe run periodically against a running tunnel. In local mode the probe dials
+// the local listener like a client would; in ssh mode it opens a channel over the existing SSH connection instead.
+// Expect, in local mode, turns the probe into an application check: Send is written first, if set, and the probe
+// passes only when the application answers with the bytes in Expect. In http mode the probe sends a GET for Path, "/"
+// by default, through the local listener and passes on ExpectStatus, or any 2xx status when it is unset.
+// FailureThreshold consecutive failed probes mark the tunnel unhealthy and SuccessThreshold consecutive passing ones
+// mark it recovered; both default to 1. RestartOnFailure restarts the tunnel each time its probe marks it unhealthy.
+type ProbeConfig struct {
+	Mode             string        `yaml:"mode,omitempty"`
+	Interval         time.Duration `yaml:"interval,omitempty"`
+	Timeout          time.Duration `yaml:"timeout,omitempty"`
+	Send             string        `yaml:"send,omitempty"`
+	Expect           string        `yaml:"expect,omitempty"`
+	Path             string        `yaml:"path,omitempty"`
+	ExpectStatus     int           `yaml:"expectStatus,omitempty"`
+	FailureThreshold int           `yaml:"failureThreshold,omitempty"`
+	SuccessThreshold int           `yaml:"successThreshold,omitempty"`
+	RestartOnFailure bool          `yaml:"restartOnFailure,omitempty"`
+}
+
+// HTTPPath returns the path requested by an http probe, defaulting to "/".
+func (p ProbeConfig) HTTPPath() string {
+	if p.Path == "" {
+		return "/"
+	}
+	return p.Path
+}
+
+// Failures returns how many consecutive failed probes mark the tunnel unhealthy, defaulting to 1.
+func (p ProbeConfig) Failures() int {
+	if p.FailureThreshold == 0 {
+		return 1
+	}
+	return p.FailureThreshold
+}
+
+// Successes returns how many consecutive passing probes mark an unhealthy tunnel recovered, defaulting to 1.
+func (p ProbeConfig) Successes() int {
+	if p.SuccessThreshold == 0 {
+		return 1
+	}
+	return p.SuccessThreshold
 }
 
 // AutoRestartConfig defines settings for automatic restart functionality, including enabling and restart intervals.
+// Canary, when set, keeps a restarted tunnel unhealthy until a connection through it reaches the remote service within
+// CanaryTimeout. MaxRetries, when set, is how many restarts in a row may fail before the manager gives up on the tunnel.
 type AutoRestartConfig struct {
-	Enabled  bool          `yaml:"enabled"`
-	Interval time.Duration `yaml:"interval"`
+	Enabled       bool          `yaml:"enabled,omitempty"`
+	Interval      time.Duration `yaml:"interval,omitempty"`
+	Canary        bool          `yaml:"canary,omitempty"`
+	CanaryTimeout time.Duration `yaml:"canaryTimeout,omitempty"`
+	MaxRetries    int           `yaml:"maxRetries,omitempty"`
+}
+
+// RetryBudgetConfig caps the automatic connection attempts made for a tunnel, counted together across startup retries,
+// auto-restarts, controller convergence, and reconnects after a dropped SSH connection, to Attempts per sliding Window.
+// A tunnel that runs out is parked: no more automatic attempts are made until it is unparked.
+type RetryBudgetConfig struct {
+	Attempts int           `yaml:"attempts,omitempty"`
+	Window   time.Duration `yaml:"window,omitempty"`
+}
+
+// ControllerConfig defines settings for the background controller that drives tunnels toward their desired state.
+type ControllerConfig struct {
+	Enabled  bool          `yaml:"enabled,omitempty"`
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// StartupConfig defines how initial tunnel connections are spread out and retried when conduit boots.
+// MaxConcurrentStarts bounds how many tunnels connect at once; they start one at a time when it is unset.
+type StartupConfig struct {
+	Stagger             time.Duration `yaml:"stagger,omitempty"`
+	Jitter              time.Duration `yaml:"jitter,omitempty"`
+	InitialRetries      int           `yaml:"initialRetries,omitempty"`
+	Backoff             time.Duration `yaml:"backoff,omitempty"`
+	MaxConcurrentStarts int           `yaml:"maxConcurrentStarts,omitempty"`
+}
+
+// ShutdownConfig defines how conduit stops its tunnels on SIGINT or SIGTERM. DrainTimeout bounds the total time spent
+// letting open connections finish under each tunnel's shutdownGrace before the remaining ones are closed, and is the
+// grace of tunnels that set none.
+type ShutdownConfig struct {
+	DrainTimeout time.Duration `yaml:"drainTimeout,omitempty"`
+}
+
+// APIConfig defines settings for the optional HTTP API, including the health score threshold used by load balancers.
+// When Token is set, every request must carry it as a bearer token in the Authorization header.
+type APIConfig struct {
+	Listen          string  `yaml:"listen,omitempty"`
+	HealthThreshold float64 `yaml:"healthThreshold,omitempty"`
+	Token           string  `yaml:"token,omitempty"`
+}
+
+// Log formats select how conduit writes its logs.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LogConfig defines how conduit writes its logs. Format is text or json key=value records; left empty, logs are
+// written as plain timestamped lines. Level is debug, info, warn, or error, and defaults to info.
+type LogConfig struct {
+	Format string `yaml:"format,omitempty"`
+	Level  string `yaml:"level,omitempty"`
+}
+
+// Validate checks the format and level.
+func (l LogConfig) Validate() error {
+	switch l.Format {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("log.format must be %q or %q", LogFormatText, LogFormatJSON)
+	}
+
+	if _, err := l.SlogLevel(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SlogLevel returns the configured level, info when it is unset.
+func (l LogConfig) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	if l.Level == "" {
+		return level, nil
+	}
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return level, fmt.Errorf("log.level must be debug, info, warn, or error, got %q", l.Level)
+	}
+	return level, nil
+}
+
+// HealthConfig defines settings for detecting tunnels that are desired running but fail to come up.
+type HealthConfig struct {
+	StuckThreshold time.Duration `yaml:"stuckThreshold,omitempty"`
+}
+
+// RelayConfig defines limits shared by every tunnel on relaying forwarded connections.
+type RelayConfig struct {
+	Workers int `yaml:"workers,omitempty"`
+}
+
+// Reconcile modes select how a reload handles tunnels that fail to apply.
+const (
+	ReconcileBestEffort    = "best-effort"
+	ReconcileStrict        = "strict"
+	ReconcileTransactional = "transactional"
+)
+
+// ReloadConfig defines policies applied when the configuration is reloaded while conduit is running. Debounce is how
+// long the config file must go without changes before a reload runs, so a burst of writes is applied once.
+// PollInterval, when set, makes the watcher check the file on that interval instead of relying on filesystem events.
+type ReloadConfig struct {
+	AllowEmpty   bool          `yaml:"allowEmpty,omitempty"`
+	Mode         string        `yaml:"mode,omitempty"`
+	Debounce     time.Duration `yaml:"debounce,omitempty"`
+	PollInterval time.Duration `yaml:"pollInterval,omitempty"`
 }
 
 // Config represents the top-level configuration that includes SSH settings and a list of network tunnel configurations.
+// AllowDuplicateLocalPorts lets tunnels share a localPort on overlapping bind addresses, reporting such duplicates as
+// warnings instead of rejecting them. The listeners do not set SO_REUSEPORT, so only one of them can be bound at a
+// time. Defaults are merged into the tunnels while the file is parsed, and the tunnels of the files listed under
+// include are appended to its own.
 type Config struct {
-	SSH           tunnel.SSHConfig `yaml:"ssh"`
-	TunnelConfigs []TunnelConfig   `yaml:"tunnels"`
+	SSH           tunnel.SSHConfig `yaml:"ssh,omitempty"`
+	Controller    ControllerConfig `yaml:"controller,omitempty"`
+	Startup       StartupConfig    `yaml:"startup,omitempty"`
+	Shutdown      ShutdownConfig   `yaml:"shutdown,omitempty"`
+	Reload        ReloadConfig     `yaml:"reload,omitempty"`
+	API           APIConfig        `yaml:"api,omitempty"`
+	Health        HealthConfig     `yaml:"health,omitempty"`
+	Relay         RelayConfig      `yaml:"relay,omitempty"`
+	Log           LogConfig        `yaml:"log,omitempty"`
+	Defaults      DefaultsConfig   `yaml:"defaults,omitempty"`
+	Include       []string         `yaml:"include,omitempty"`
+	TunnelConfigs []TunnelConfig   `yaml:"tunnels,omitempty"`
+
+	AllowDuplicateLocalPorts bool `yaml:"allowDuplicateLocalPorts,omitempty"`
+
+	sources  []tunnelSource
+	includes []string
+}
+
+// tunnelSource holds the text of tunnel fields as written in the config file before environment expansion, so errors
+// about values that collide only after expansion can point at the variables involved, along with the file the tunnel
+// was written in.
+type tunnelSource struct {
+	Name      string `yaml:"name"`
+	LocalPort string `yaml:"localPort"`
+	File      string `yaml:"-"`
+}
+
+// Config file formats. JSON files use the same field names as YAML ones.
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// FormatOf returns the format of the config file at path by its extension: FormatJSON for .json, and FormatYAML for
+// .yaml, .yml, and anything else.
+func FormatOf(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
+// Load reads a configuration file from the specified path, parses it in the format its extension names along with the
+// files it includes, applies any overrides, and validates the resulting Config object. A directory path loads and
+// merges the *.yaml fragments in it instead.
+func Load(path string, overrides ...Override) (*Config, error) {
+	cfg, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return finish(cfg, overrides)
+}
+
+// Parse expands environment variables in the contents of a YAML configuration file, parses it, applies any overrides,
+// and validates the result. Included files are resolved against the working directory.
+func Parse(data []byte, overrides ...Override) (*Config, error) {
+	cfg, err := parseFile("", data, FormatYAML)
+	if err != nil {
+		return nil, err
+	}
+
+	return finish(cfg, overrides)
 }
 
-// Load reads a configuration file from the specified path, parses it, and validates the resulting Config object.
-func Load(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+// ParseFile is Load for data already read from the config file at path: the format is chosen by its extension and
+// included files are resolved against its directory.
+func ParseFile(path string, data []byte, overrides ...Override) (*Config, error) {
+	cfg, err := parseFile(path, data, FormatOf(path))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
 	}
 
+	return finish(cfg, overrides)
+}
+
+// parse expands environment variables in the contents of a configuration file and parses it, merging the defaults
+// section into the tunnels, without validating it. JSON is checked to be well-formed JSON, rather than merely valid
+// YAML, and then decoded like YAML, which it is a subset of, so both formats share the yaml field names and types.
+func parse(data []byte, format string) (*Config, error) {
 	expanded := os.ExpandEnv(string(data))
-	var cfg Config
-	if err := yaml.Unmarshal([]byte(expanded), &cfg); err != nil {
+	if format == FormatJSON {
+		var v any
+		if err := json.Unmarshal([]byte(expanded), &v); err != nil {
+			return nil, fmt.Errorf("failed to parse config file as JSON: %w", err)
+		}
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(expanded), &doc); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	applyDefaults(&doc)
+
+	var cfg Config
+	if len(doc.Content) > 0 {
+		if err := doc.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+
+	var raw struct {
+		Tunnels []tunnelSource `yaml:"tunnels"`
+	}
+	if err := yaml.Unmarshal(data, &raw); err == nil {
+		cfg.sources = raw.Tunnels
+	}
+
+	return &cfg, nil
+}
+
+// finish applies overrides to a parsed Config and validates the result.
+func finish(cfg *Config, overrides []Override) (*Config, error) {
+	if err := cfg.Apply(overrides); err != nil {
+		return nil, err
+	}
 
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
-	return &cfg, nil
+	return cfg, nil
 }
 
 // Validate checks the configuration for errors such as missing fields, invalid values, or duplicate tunnel definitions.
@@ -56,44 +511,372 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("ssh: %w", err)
 	}
 
-	if len(c.TunnelConfigs) == 0 {
+	if c.Controller.Enabled && c.Controller.Interval <= 0 {
+		return fmt.Errorf("controller.interval must be greater than 0 when enabled")
+	}
+
+	if c.Startup.Stagger < 0 || c.Startup.Jitter < 0 || c.Startup.Backoff < 0 {
+		return fmt.Errorf("startup durations must not be negative")
+	}
+
+	if c.Startup.MaxConcurrentStarts < 0 {
+		return fmt.Errorf("startup.maxConcurrentStarts must not be negative")
+	}
+
+	if c.Startup.InitialRetries < 0 {
+		return fmt.Errorf("startup.initialRetries must not be negative")
+	}
+
+	if c.Shutdown.DrainTimeout < 0 {
+		return fmt.Errorf("shutdown.drainTimeout must not be negative")
+	}
+
+	if c.API.HealthThreshold < 0 || c.API.HealthThreshold > 1 {
+		return fmt.Errorf("api.healthThreshold must be between 0 and 1")
+	}
+
+	if c.Health.StuckThreshold < 0 {
+		return fmt.Errorf("health.stuckThreshold must not be negative")
+	}
+
+	switch c.Reload.Mode {
+	case "", ReconcileBestEffort, ReconcileStrict, ReconcileTransactional:
+	default:
+		return fmt.Errorf("reload.mode must be %q, %q, or %q", ReconcileBestEffort, ReconcileStrict, ReconcileTransactional)
+	}
+
+	if c.Reload.Debounce < 0 || c.Reload.PollInterval < 0 {
+		return fmt.Errorf("reload.debounce and reload.pollInterval must not be negative")
+	}
+
+	if c.Relay.Workers < 0 {
+		return fmt.Errorf("relay.workers must not be negative")
+	}
+
+	if err := c.Log.Validate(); err != nil {
+		return err
+	}
+
+	if len(c.TunnelConfigs) == 0 && !c.Reload.AllowEmpty {
 		return fmt.Errorf("at least one tunnel is required")
 	}
 
-	names := make(map[string]bool)
-	localPorts := make(map[int]bool)
+	names := make(map[string]int)
+	localPorts := make(map[int][]int)
+	localSockets := make(map[string]int)
 
 	for i, t := range c.TunnelConfigs {
 		if t.Name == "" {
 			return fmt.Errorf("tunnels[%d].name is required", i)
 		}
 
-		if names[t.Name] {
-			return fmt.Errorf("duplicate tunnel name: %s", t.Name)
+		if first, exists := names[t.Name]; exists {
+			return fmt.Errorf("duplicate tunnel name: %s%s%s", t.Name, c.fileNote(first, i), c.expansionNote("name", first, i))
+		}
+		names[t.Name] = i
+
+		switch t.Type {
+		case "", TunnelTypeLocal, TunnelTypeReverse, TunnelTypeDynamic:
+		default:
+			return fmt.Errorf("tunnels[%d].type must be %q, %q, or %q", i, TunnelTypeLocal, TunnelTypeReverse, TunnelTypeDynamic)
+		}
+
+		if t.LocalHost != "" && !t.Reverse() {
+			return fmt.Errorf("tunnels[%d].localHost is only used by reverse tunnels", i)
+		}
+
+		if t.LocalBind != "" {
+			if t.Reverse() {
+				return fmt.Errorf("tunnels[%d].localBind is not used by reverse tunnels, which listen on the SSH server", i)
+			}
+			if net.ParseIP(t.LocalBind) == nil {
+				return fmt.Errorf("tunnels[%d].localBind %q is not an IP address", i, t.LocalBind)
+			}
+		}
+
+		if t.LocalSocket != "" {
+			if err := t.validateLocalSocket(); err != nil {
+				return fmt.Errorf("tunnels[%d].localSocket: %w", i, err)
+			}
+			if first, exists := localSockets[t.LocalSocket]; exists && t.IsEnabled() {
+				return fmt.Errorf("duplicate localSocket: %s (tunnels[%d] and tunnels[%d])", t.LocalSocket, first, i)
+			}
+			if t.IsEnabled() {
+				localSockets[t.LocalSocket] = i
+			}
+		}
+
+		if t.Dynamic() {
+			if t.RemoteHost != "" || t.RemotePort != 0 || t.RemotePortCommand != "" {
+				return fmt.Errorf("tunnels[%d]: a dynamic tunnel's clients pick their destination, so it takes no remoteHost or remotePort", i)
+			}
+
+			if t.LocalPort < 0 {
+				return fmt.Errorf("tunnels[%d].localPort must be 0 or greater", i)
+			}
+		} else {
+			if t.RemoteHost == "" {
+				return fmt.Errorf("tunnels[%d].remoteHost is required", i)
+			}
+
+			if t.Reverse() {
+				if t.LocalHost == "" {
+					return fmt.Errorf("tunnels[%d].localHost is required for a reverse tunnel", i)
+				}
+				if t.RemotePortCommand != "" {
+					return fmt.Errorf("tunnels[%d]: remotePortCommand is not supported for a reverse tunnel", i)
+				}
+			}
+
+			if t.RemotePortCommand != "" {
+				if t.RemotePort != 0 {
+					return fmt.Errorf("tunnels[%d]: only one of remotePort or remotePortCommand may be set", i)
+				}
+			} else if t.RemotePort <= 0 {
+				return fmt.Errorf("tunnels[%d].remotePort must be greater than 0", i)
+			}
+
+			if t.Reverse() && t.LocalPort <= 0 {
+				return fmt.Errorf("tunnels[%d].localPort must be greater than 0", i)
+			}
+			if t.LocalPort < 0 {
+				return fmt.Errorf("tunnels[%d].localPort must be 0 or greater", i)
+			}
+		}
+
+		// A reverse tunnel's localPort is the port it connects to, not one it binds, and port 0 picks a free one. A
+		// disabled tunnel binds nothing, so it may share its address with an enabled one.
+		if !t.Reverse() && t.LocalPort != 0 && t.IsEnabled() {
+			for _, first := range localPorts[t.LocalPort] {
+				if bindsOverlap(c.TunnelConfigs[first].LocalBindAddr(), t.LocalBindAddr()) && !c.AllowDuplicateLocalPorts {
+					return fmt.Errorf("duplicate localPort: %d on %s%s%s", t.LocalPort, t.LocalBindAddr(),
+						c.fileNote(first, i), c.expansionNote("localPort", first, i))
+				}
+			}
+			localPorts[t.LocalPort] = append(localPorts[t.LocalPort], i)
+		}
+
+		if _, err := schedule.Parse(t.Maintenance); err != nil {
+			return fmt.Errorf("tunnels[%d].maintenance: %w", i, err)
+		}
+
+		if _, err := schedule.Parse(t.Access); err != nil {
+			return fmt.Errorf("tunnels[%d].access: %w", i, err)
+		}
+
+		if t.StatsReset != "" {
+			if _, err := schedule.ParseBoundary(t.StatsReset); err != nil {
+				return fmt.Errorf("tunnels[%d].statsReset: %w", i, err)
+			}
+		}
+
+		if err := t.Probe.validate(); err != nil {
+			return fmt.Errorf("tunnels[%d].probe: %w", i, err)
+		}
+
+		if t.ChannelOpen.RetryCount() < 0 || t.ChannelOpen.Backoff < 0 {
+			return fmt.Errorf("tunnels[%d].channelOpen retries and backoff must not be negative", i)
+		}
+
+		if t.MaxConnections < 0 || t.QueueSize < 0 {
+			return fmt.Errorf("tunnels[%d] maxConnections and queueSize must not be negative", i)
+		}
+
+		if t.QueueSize > 0 && t.MaxConnections == 0 {
+			return fmt.Errorf("tunnels[%d].queueSize requires maxConnections", i)
 		}
-		names[t.Name] = true
 
-		if t.RemoteHost == "" {
-			return fmt.Errorf("tunnels[%d].remoteHost is required", i)
+		if t.RateLimit != "" {
+			rate, err := ParseByteSize(t.RateLimit)
+			if err != nil {
+				return fmt.Errorf("tunnels[%d].rateLimit: %w", i, err)
+			}
+			if rate < 1 {
+				return fmt.Errorf("tunnels[%d].rateLimit must be at least 1 byte per second", i)
+			}
 		}
 
-		if t.RemotePort <= 0 {
-			return fmt.Errorf("tunnels[%d].remotePort must be greater than 0", i)
+		if t.StartRetries < 0 || t.StartRetryInterval < 0 {
+			return fmt.Errorf("tunnels[%d]: startRetries and startRetryInterval must not be negative", i)
 		}
 
-		if t.LocalPort <= 0 {
-			return fmt.Errorf("tunnels[%d].localPort must be greater than 0", i)
+		if t.StartRetries > MaxStartRetries {
+			return fmt.Errorf("tunnels[%d]: startRetries must be at most %d", i, MaxStartRetries)
 		}
 
-		if localPorts[t.LocalPort] {
-			return fmt.Errorf("duplicate localPort: %d", t.LocalPort)
+		if t.ShutdownGrace < 0 {
+			return fmt.Errorf("tunnels[%d].shutdownGrace must not be negative", i)
 		}
 
-		localPorts[t.LocalPort] = true
+		if t.IdleTimeout < 0 {
+			return fmt.Errorf("tunnels[%d].idleTimeout must not be negative", i)
+		}
 
 		if t.AutoRestart.Enabled && t.AutoRestart.Interval <= 0 {
 			return fmt.Errorf("tunnels[%d].autoRestart.interval must be greater than 0 when enabled", i)
 		}
+
+		if t.RetryBudget.Attempts < 0 {
+			return fmt.Errorf("tunnels[%d].retryBudget.attempts must not be negative", i)
+		}
+
+		if t.RetryBudget.Attempts > 0 && t.RetryBudget.Window <= 0 {
+			return fmt.Errorf("tunnels[%d].retryBudget.window must be greater than 0 when attempts is set", i)
+		}
+
+		if t.AutoRestart.MaxRetries < 0 {
+			return fmt.Errorf("tunnels[%d].autoRestart.maxRetries must not be negative", i)
+		}
+
+		if t.AutoRestart.CanaryTimeout < 0 {
+			return fmt.Errorf("tunnels[%d].autoRestart.canaryTimeout must not be negative", i)
+		}
+
+		if t.SSH != nil {
+			if err := t.SSH.Validate(); err != nil {
+				return fmt.Errorf("tunnels[%d].ssh: %w", i, err)
+			}
+		}
+	}
+
+	for i, t := range c.TunnelConfigs {
+		for _, dep := range t.DependsOn {
+			j, exists := names[dep]
+			if !exists {
+				return fmt.Errorf("tunnels[%d].dependsOn: unknown tunnel %s", i, dep)
+			}
+			// A disabled dependency never starts, so neither could the tunnel depending on it.
+			if t.IsEnabled() && !c.TunnelConfigs[j].IsEnabled() {
+				return fmt.Errorf("tunnels[%d].dependsOn: tunnel %s is disabled, disable %s as well or drop the dependency", i, dep, t.Name)
+			}
+		}
+	}
+
+	if _, err := StartOrder(c.TunnelConfigs); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateLocalSocket checks that a tunnel listening on a Unix domain socket has no local port or bind address to
+// conflict with it, and that the socket's directory exists.
+func (t TunnelConfig) validateLocalSocket() error {
+	if t.Reverse() {
+		return fmt.Errorf("not supported for a reverse tunnel")
+	}
+
+	if t.LocalPort != 0 || t.LocalBind != "" {
+		return fmt.Errorf("only one of localPort or localSocket may be set, and localBind does not apply to a socket")
+	}
+
+	dir := filepath.Dir(t.LocalSocket)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("directory %s does not exist", dir)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	return nil
+}
+
+// bindsOverlap reports whether listeners on the same port at the two bind addresses would collide: when the addresses
+// are equal, or when either is unspecified, such as 0.0.0.0, and so takes the port on every interface.
+func bindsOverlap(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return a == b
+	}
+	return ipA.Equal(ipB) || ipA.IsUnspecified() || ipB.IsUnspecified()
+}
+
+// expansionNote describes which of the given tunnels took the named field from an environment variable, or returns an
+// empty string when none did, so a collision introduced by expansion is recognizable as such.
+func (c *Config) expansionNote(field string, indexes ...int) string {
+	var origins []string
+
+	for _, i := range indexes {
+		if i >= len(c.sources) {
+			continue
+		}
+
+		raw := c.sources[i].Name
+		if field == "localPort" {
+			raw = c.sources[i].LocalPort
+		}
+
+		if strings.Contains(raw, "$") {
+			origins = append(origins, fmt.Sprintf("tunnels[%d].%s=%q", i, field, raw))
+		}
+	}
+
+	if len(origins) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" (after environment expansion of %s)", strings.Join(origins, ", "))
+}
+
+// fileNote returns a note naming the files two tunnels were written in, for errors about tunnels from different files,
+// or nothing when they share a file.
+func (c *Config) fileNote(a, b int) string {
+	if a >= len(c.sources) || b >= len(c.sources) || c.sources[a].File == c.sources[b].File {
+		return ""
+	}
+
+	return fmt.Sprintf(" (in %s and %s)", fileLabel(c.sources[a].File), fileLabel(c.sources[b].File))
+}
+
+// fileLabel names a config file in messages, standing in for a config that was not read from a file.
+func fileLabel(file string) string {
+	if file == "" {
+		return "the main config"
+	}
+	return file
+}
+
+// validate checks that an enabled probe has a known mode, a positive interval, and a non-negative timeout.
+func (p ProbeConfig) validate() error {
+	if p.Mode == "" {
+		return nil
+	}
+
+	if p.Mode != ProbeModeLocal && p.Mode != ProbeModeSSH && p.Mode != ProbeModeHTTP {
+		return fmt.Errorf("mode must be %q, %q, or %q", ProbeModeLocal, ProbeModeSSH, ProbeModeHTTP)
+	}
+
+	if p.Interval <= 0 {
+		return fmt.Errorf("interval must be greater than 0")
+	}
+
+	if p.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+
+	if p.Send != "" && p.Expect == "" {
+		return fmt.Errorf("send requires expect")
+	}
+
+	if p.Expect != "" && p.Mode != ProbeModeLocal {
+		return fmt.Errorf("expect requires mode %q", ProbeModeLocal)
+	}
+
+	if (p.Path != "" || p.ExpectStatus != 0) && p.Mode != ProbeModeHTTP {
+		return fmt.Errorf("path and expectStatus require mode %q", ProbeModeHTTP)
+	}
+
+	if p.Path != "" && !strings.HasPrefix(p.Path, "/") {
+		return fmt.Errorf("path must start with /")
+	}
+
+	if p.ExpectStatus != 0 && (p.ExpectStatus < 100 || p.ExpectStatus > 599) {
+		return fmt.Errorf("expectStatus must be an HTTP status code")
+	}
+
+	if p.FailureThreshold < 0 || p.SuccessThreshold < 0 {
+		return fmt.Errorf("failureThreshold and successThreshold must be positive")
 	}
 
 	return nil
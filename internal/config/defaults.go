@@ -0,0 +1,60 @@
+package config
+
+import "gopkg.in/yaml.v3"
+
+// DefaultsConfig holds tunnel settings applied to every tunnel in the same file that does not set them itself. Nested
+// blocks are merged field by field, so a tunnel setting only autoRestart.interval still takes autoRestart.enabled from
+// the defaults.
+type DefaultsConfig struct {
+	AutoRestart AutoRestartConfig `yaml:"autoRestart,omitempty"`
+}
+
+// applyDefaults copies the settings under the top-level defaults key of a parsed config document into each tunnel that
+// does not set them. It works on the YAML nodes rather than the decoded structs, so a value a tunnel sets explicitly,
+// even to false or 0, is kept.
+func applyDefaults(doc *yaml.Node) {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return
+	}
+
+	root := doc.Content[0]
+	defaults, tunnels := mappingValue(root, "defaults"), mappingValue(root, "tunnels")
+	if defaults == nil || defaults.Kind != yaml.MappingNode || tunnels == nil || tunnels.Kind != yaml.SequenceNode {
+		return
+	}
+
+	for _, t := range tunnels.Content {
+		if t.Kind == yaml.MappingNode {
+			mergeMapping(t, defaults)
+		}
+	}
+}
+
+// mappingValue returns the value stored under key in a mapping node, or nil when it is not there.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mergeMapping adds the keys of src missing from dst to dst, recursing into mappings present in both.
+func mergeMapping(dst, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+
+		existing := mappingValue(dst, key.Value)
+		switch {
+		case existing == nil:
+			dst.Content = append(dst.Content, key, value)
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			mergeMapping(existing, value)
+		}
+	}
+}
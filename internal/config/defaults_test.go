@@ -0,0 +1,79 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad_Defaults(t *testing.T) {
+	content := `
+ssh:
+  user: testuser
+  password: testpass
+  host: bastion.com
+  insecureIgnoreHostKey: true
+
+defaults:
+  autoRestart:
+    enabled: true
+    interval: 30s
+
+tunnels:
+  - name: inherits
+    remoteHost: db-server
+    remotePort: 5432
+    localPort: 5432
+  - name: disables
+    remoteHost: db-server
+    remotePort: 5433
+    localPort: 5433
+    autoRestart:
+      enabled: false
+  - name: overrides
+    remoteHost: db-server
+    remotePort: 5434
+    localPort: 5434
+    autoRestart:
+      interval: 1m
+`
+	cfg, err := Load(createTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]AutoRestartConfig{
+		"inherits":  {Enabled: true, Interval: 30 * time.Second},
+		"disables":  {Enabled: false, Interval: 30 * time.Second},
+		"overrides": {Enabled: true, Interval: time.Minute},
+	}
+	for _, tc := range cfg.TunnelConfigs {
+		if tc.AutoRestart != want[tc.Name] {
+			t.Errorf("%s: expected %+v, got %+v", tc.Name, want[tc.Name], tc.AutoRestart)
+		}
+	}
+}
+
+func TestLoad_DefaultsAreValidated(t *testing.T) {
+	content := `
+ssh:
+  user: testuser
+  password: testpass
+  host: bastion.com
+  insecureIgnoreHostKey: true
+
+defaults:
+  autoRestart:
+    enabled: true
+
+tunnels:
+  - name: db
+    remoteHost: db-server
+    remotePort: 5432
+    localPort: 5432
+`
+	_, err := Load(createTempConfig(t, content))
+	if err == nil || !strings.Contains(err.Error(), "autoRestart.interval") {
+		t.Fatalf("expected the defaulted autoRestart to be validated, got %v", err)
+	}
+}
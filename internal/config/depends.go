@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// StartOrder groups the tunnels into the waves they start in: the first holds those that depend on none of the others,
+// and each later one those whose dependencies all start in an earlier wave. Names within a wave are sorted.
+// Dependencies on tunnels outside the list are ignored, so a subset such as the tunnels added by a reload can be ordered
+// on its own. It fails when the dependencies form a cycle.
+func StartOrder(tunnels []TunnelConfig) ([][]string, error) {
+	pending := make(map[string][]string, len(tunnels))
+	for _, t := range tunnels {
+		pending[t.Name] = nil
+	}
+	for _, t := range tunnels {
+		for _, dep := range t.DependsOn {
+			if _, listed := pending[dep]; listed {
+				pending[t.Name] = append(pending[t.Name], dep)
+			}
+		}
+	}
+
+	var waves [][]string
+	started := make(map[string]bool, len(tunnels))
+
+	for len(pending) > 0 {
+		var wave []string
+		for name, deps := range pending {
+			if !slices.ContainsFunc(deps, func(dep string) bool { return !started[dep] }) {
+				wave = append(wave, name)
+			}
+		}
+
+		if len(wave) == 0 {
+			return nil, fmt.Errorf("dependency cycle between tunnels %s", strings.Join(cycle(pending), " -> "))
+		}
+
+		slices.Sort(wave)
+		for _, name := range wave {
+			started[name] = true
+			delete(pending, name)
+		}
+		waves = append(waves, wave)
+	}
+
+	return waves, nil
+}
+
+// cycle returns one dependency cycle among the pending tunnels, none of which can start, as a path that ends where it
+// began.
+func cycle(pending map[string][]string) []string {
+	names := make([]string, 0, len(pending))
+	for name := range pending {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	// Every pending tunnel waits on another pending one, so following the first such dependency must revisit a tunnel.
+	var path []string
+	seen := make(map[string]int)
+	for name := names[0]; ; {
+		if at, visited := seen[name]; visited {
+			return append(path[at:], name)
+		}
+		seen[name] = len(path)
+		path = append(path, name)
+
+		deps := slices.Clone(pending[name])
+		slices.Sort(deps)
+		for _, dep := range deps {
+			if _, blocked := pending[dep]; blocked {
+				name = dep
+				break
+			}
+		}
+	}
+}
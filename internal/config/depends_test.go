@@ -0,0 +1,91 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestStartOrder_Chain verifies that a chain of dependencies starts one tunnel at a time, dependencies first, and that
+// independent tunnels start in the first wave.
+func TestStartOrder_Chain(t *testing.T) {
+	waves, err := StartOrder([]TunnelConfig{
+		{Name: "web", DependsOn: []string{"app"}},
+		{Name: "app", DependsOn: []string{"proxy", "outside"}},
+		{Name: "proxy"},
+		{Name: "metrics"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := [][]string{{"metrics", "proxy"}, {"app"}, {"web"}}
+	if !reflect.DeepEqual(waves, want) {
+		t.Errorf("expected %v, got %v", want, waves)
+	}
+}
+
+// TestStartOrder_Cycle verifies that a dependency cycle is reported along with the tunnels in it.
+func TestStartOrder_Cycle(t *testing.T) {
+	_, err := StartOrder([]TunnelConfig{
+		{Name: "a", DependsOn: []string{"c"}},
+		{Name: "b", DependsOn: []string{"a"}},
+		{Name: "c", DependsOn: []string{"b"}},
+		{Name: "d", DependsOn: []string{"a"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "a -> c -> b -> a") {
+		t.Fatalf("expected a cycle through a, c, and b, got %v", err)
+	}
+}
+
+func TestValidate_DependsOn(t *testing.T) {
+	tests := []struct {
+		name      string
+		db        string
+		web       string
+		dbEnabled string
+		wantErr   string
+	}{
+		{"chain", "", "[db]", "true", ""},
+		{"unknown tunnel", "", "[cache]", "true", "unknown tunnel cache"},
+		{"self", "[db]", "", "true", "dependency cycle"},
+		{"cycle", "[web]", "[db]", "true", "dependency cycle"},
+		{"disabled dependency", "", "[db]", "false", "tunnel db is disabled"},
+		{"disabled without dependents", "", "", "false", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `
+ssh:
+  user: testuser
+  password: testpass
+  host: bastion.com
+  insecureIgnoreHostKey: true
+
+tunnels:
+  - name: db
+    remoteHost: db-server
+    remotePort: 5432
+    localPort: 5432
+    enabled: ` + tt.dbEnabled + `
+    dependsOn: ` + tt.db + `
+  - name: web
+    remoteHost: web-server
+    remotePort: 80
+    localPort: 8080
+    dependsOn: ` + tt.web + `
+`
+			_, err := Load(createTempConfig(t, content))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IsFragment reports whether a file name is picked up as a config fragment when conduit is pointed at a directory.
+func IsFragment(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return (ext == ".yaml" || ext == ".yml") && !strings.HasPrefix(name, ".")
+}
+
+// Fragments returns the paths of the config fragments in dir, sorted by name. Hidden files and subdirectories are
+// skipped.
+func Fragments(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config directory: %w", err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && IsFragment(entry.Name()) {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// parseDir parses every fragment in dir, with their includes, and merges them into one Config without validating it.
+// Tunnels are appended in the order of the fragments' names. At most one fragment may hold ssh and the other settings;
+// the rest may only set tunnels, defaults, and include, like included files.
+func parseDir(dir string) (*Config, error) {
+	paths, err := Fragments(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no *.yaml config files in directory %s", dir)
+	}
+
+	var merged *Config
+	var base string
+	var tunnels []TunnelConfig
+	var sources []tunnelSource
+	var includes []string
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		fragment, err := parseFile(path, data, FormatYAML)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		if !onlyTunnels(fragment) {
+			if merged != nil {
+				return nil, fmt.Errorf("only one file in %s may set more than tunnels, defaults, and include, but %s and %s do",
+					dir, base, path)
+			}
+			merged, base = fragment, path
+		}
+
+		tunnels = append(tunnels, fragment.TunnelConfigs...)
+		sources = append(sources, fragment.sources...)
+		includes = append(includes, fragment.includes...)
+	}
+
+	if merged == nil {
+		merged = &Config{}
+	}
+	merged.TunnelConfigs, merged.sources, merged.includes = tunnels, sources, includes
+
+	return merged, nil
+}
+
+// parsePath parses the config file at path, or the fragments in it when path is a directory, without validating the
+// result.
+func parsePath(path string) (*Config, error) {
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		return parseDir(path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	return parseFile(path, data, FormatOf(path))
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const fragmentSSH = `
+ssh:
+  user: testuser
+  password: testpass
+  host: bastion.com
+  insecureIgnoreHostKey: true
+`
+
+// TestLoad_Directory verifies that a directory path loads every *.yaml fragment in it, in name order, taking ssh from
+// the one fragment that sets it and skipping other files.
+func TestLoad_Directory(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"00-ssh.yaml": fragmentSSH,
+		"20-web.yaml": `
+tunnels:
+  - name: web
+    remoteHost: web-server
+    remotePort: 80
+    localPort: 8080
+`,
+		"10-db.yml": `
+tunnels:
+  - name: db
+    remoteHost: db-server
+    remotePort: 5432
+    localPort: 5432
+`,
+		"README.md":       "not a fragment",
+		".hidden.yaml":    "ssh: [",
+		"nested/x.yaml":   "ssh: [",
+		"disabled.yaml.x": "ssh: [",
+	})
+
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.SSH.Host != "bastion.com" {
+		t.Errorf("expected ssh from 00-ssh.yaml, got host %q", cfg.SSH.Host)
+	}
+	if len(cfg.TunnelConfigs) != 2 || cfg.TunnelConfigs[0].Name != "db" || cfg.TunnelConfigs[1].Name != "web" {
+		t.Errorf("expected tunnels db and web, got %+v", cfg.TunnelConfigs)
+	}
+
+	loaded, err := (&FileLoader{Path: dir}).Load()
+	if err != nil || len(loaded.TunnelConfigs) != 2 {
+		t.Errorf("expected FileLoader to load the directory too, got %v", err)
+	}
+}
+
+func TestLoad_DirectoryErrors(t *testing.T) {
+	web := `
+tunnels:
+  - name: web
+    remoteHost: web-server
+    remotePort: 80
+    localPort: 8080
+`
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr []string
+	}{
+		{
+			name:    "empty",
+			files:   map[string]string{"notes.txt": "nothing"},
+			wantErr: []string{"no *.yaml config files"},
+		},
+		{
+			name:    "two ssh blocks",
+			files:   map[string]string{"a.yaml": fragmentSSH, "b.yaml": fragmentSSH, "c.yaml": web},
+			wantErr: []string{"only one file", "a.yaml and ", "b.yaml do"},
+		},
+		{
+			name:    "duplicate name",
+			files:   map[string]string{"a.yaml": fragmentSSH + web, "b.yaml": strings.Replace(web, "8080", "8081", 1)},
+			wantErr: []string{"duplicate tunnel name: web", "a.yaml and ", "b.yaml)"},
+		},
+		{
+			name:    "duplicate port",
+			files:   map[string]string{"a.yaml": fragmentSSH + web, "b.yaml": strings.Replace(web, "name: web", "name: app", 1)},
+			wantErr: []string{"duplicate localPort: 8080", "a.yaml and ", "b.yaml)"},
+		},
+		{
+			name:    "invalid fragment",
+			files:   map[string]string{"a.yaml": fragmentSSH, "b.yaml": "tunnels: ["},
+			wantErr: []string{"b.yaml", "failed to parse config file"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeConfigFiles(t, tt.files)
+
+			_, err := Load(dir)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error containing %q, got %v", want, err)
+				}
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a missing path")
+	}
+}
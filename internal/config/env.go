@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	envSSHPrefix    = "CONDUIT_SSH_"
+	envTunnelPrefix = "CONDUIT_TUNNEL_"
+)
+
+// LoadFromEnv builds a Config from CONDUIT_SSH_* and CONDUIT_TUNNEL_<n>_* environment variables, applies any
+// overrides, and validates it.
+func LoadFromEnv(overrides ...Override) (*Config, error) {
+	cfg, err := parseEnv(os.Environ())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse environment: %w", err)
+	}
+
+	return finish(cfg, overrides)
+}
+
+// parseEnv converts a list of KEY=VALUE pairs into a Config, ordering tunnels by their numeric index.
+func parseEnv(environ []string) (*Config, error) {
+	var cfg Config
+	tunnels := make(map[int]*TunnelConfig)
+
+	for _, kv := range environ {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(key, envSSHPrefix):
+			if err := setSSHField(&cfg, strings.TrimPrefix(key, envSSHPrefix), value); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+
+		case strings.HasPrefix(key, envTunnelPrefix):
+			index, field, ok := strings.Cut(strings.TrimPrefix(key, envTunnelPrefix), "_")
+			if !ok {
+				continue
+			}
+
+			n, err := strconv.Atoi(index)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid tunnel index %q", key, index)
+			}
+
+			if tunnels[n] == nil {
+				tunnels[n] = &TunnelConfig{}
+			}
+
+			if err := setTunnelField(tunnels[n], field, value); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+
+	indexes := make([]int, 0, len(tunnels))
+	for n := range tunnels {
+		indexes = append(indexes, n)
+	}
+	sort.Ints(indexes)
+
+	for _, n := range indexes {
+		cfg.TunnelConfigs = append(cfg.TunnelConfigs, *tunnels[n])
+	}
+
+	return &cfg, nil
+}
+
+// setSSHField assigns a single CONDUIT_SSH_* value to the matching ssh field.
+func setSSHField(cfg *Config, field, value string) error {
+	switch field {
+	case "USER":
+		cfg.SSH.User = value
+	case "PASSWORD":
+		cfg.SSH.Password = value
+	case "KEYFILE":
+		cfg.SSH.KeyFile = nil
+		for _, path := range strings.Split(value, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				cfg.SSH.KeyFile = append(cfg.SSH.KeyFile, path)
+			}
+		}
+	case "KEYPASSPHRASE":
+		cfg.SSH.KeyPassphrase = value
+	case "HOST":
+		cfg.SSH.Host = value
+	case "KNOWNHOSTSFILE":
+		cfg.SSH.KnownHostsFile = value
+	case "PORT":
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid port %q", value)
+		}
+		cfg.SSH.Port = port
+	case "STRICTHOSTKEYCHECKING":
+		strict, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		cfg.SSH.StrictHostKeys = &strict
+	case "INSECUREIGNOREHOSTKEY":
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		cfg.SSH.InsecureIgnoreHostKey = insecure
+	case "AGENT":
+		agent, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		cfg.SSH.Agent = agent
+	}
+
+	return nil
+}
+
+// setTunnelField assigns a single CONDUIT_TUNNEL_<n>_* value to the matching tunnel field.
+func setTunnelField(t *TunnelConfig, field, value string) error {
+	switch field {
+	case "NAME":
+		t.Name = value
+	case "REMOTEHOST":
+		t.RemoteHost = value
+	case "REMOTEPORT":
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid port %q", value)
+		}
+		t.RemotePort = port
+	case "LOCALPORT":
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid port %q", value)
+		}
+		t.LocalPort = port
+	case "AUTORESTART_ENABLED":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		t.AutoRestart.Enabled = enabled
+	case "AUTORESTART_INTERVAL":
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		t.AutoRestart.Interval = interval
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadFromEnv_MatchesYAML(t *testing.T) {
+	t.Setenv("CONDUIT_SSH_USER", "testuser")
+	t.Setenv("CONDUIT_SSH_PASSWORD", "testpass")
+	t.Setenv("CONDUIT_SSH_HOST", "bastion.com")
+	t.Setenv("CONDUIT_SSH_INSECUREIGNOREHOSTKEY", "true")
+	t.Setenv("CONDUIT_SSH_PORT", "2222")
+	t.Setenv("CONDUIT_TUNNEL_1_NAME", "sig")
+	t.Setenv("CONDUIT_TUNNEL_1_REMOTEHOST", "oracle-sig")
+	t.Setenv("CONDUIT_TUNNEL_1_REMOTEPORT", "1521")
+	t.Setenv("CONDUIT_TUNNEL_1_LOCALPORT", "1521")
+	t.Setenv("CONDUIT_TUNNEL_1_AUTORESTART_ENABLED", "true")
+	t.Setenv("CONDUIT_TUNNEL_1_AUTORESTART_INTERVAL", "30s")
+	t.Setenv("CONDUIT_TUNNEL_2_NAME", "ods")
+	t.Setenv("CONDUIT_TUNNEL_2_REMOTEHOST", "oracle-ods")
+	t.Setenv("CONDUIT_TUNNEL_2_REMOTEPORT", "1521")
+	t.Setenv("CONDUIT_TUNNEL_2_LOCALPORT", "1522")
+
+	content := `
+ssh:
+  user: testuser
+  password: testpass
+  host: bastion.com
+  port: 2222
+  insecureIgnoreHostKey: true
+
+tunnels:
+  - name: sig
+    remoteHost: oracle-sig
+    remotePort: 1521
+    localPort: 1521
+    autoRestart:
+      enabled: true
+      interval: 30s
+  - name: ods
+    remoteHost: oracle-ods
+    remotePort: 1521
+    localPort: 1522
+`
+	want, err := Load(createTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error loading yaml: %v", err)
+	}
+
+	got, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error loading env: %v", err)
+	}
+
+	if got.SSH.User != want.SSH.User || got.SSH.Password != want.SSH.Password ||
+		got.SSH.Host != want.SSH.Host || got.SSH.Port != want.SSH.Port {
+		t.Errorf("expected ssh %+v, got %+v", want.SSH, got.SSH)
+	}
+
+	if !reflect.DeepEqual(got.TunnelConfigs, want.TunnelConfigs) {
+		t.Errorf("expected tunnels %+v, got %+v", want.TunnelConfigs, got.TunnelConfigs)
+	}
+}
+
+func TestLoadFromEnv_InvalidPort(t *testing.T) {
+	t.Setenv("CONDUIT_SSH_USER", "testuser")
+	t.Setenv("CONDUIT_SSH_PASSWORD", "testpass")
+	t.Setenv("CONDUIT_SSH_HOST", "bastion.com")
+	t.Setenv("CONDUIT_SSH_INSECUREIGNOREHOSTKEY", "true")
+	t.Setenv("CONDUIT_TUNNEL_1_NAME", "sig")
+	t.Setenv("CONDUIT_TUNNEL_1_REMOTEHOST", "oracle-sig")
+	t.Setenv("CONDUIT_TUNNEL_1_REMOTEPORT", "not-a-port")
+	t.Setenv("CONDUIT_TUNNEL_1_LOCALPORT", "1521")
+
+	_, err := LoadFromEnv()
+	if err == nil {
+		t.Fatal("expected error for invalid remote port")
+	}
+}
+
+func TestLoadFromEnv_Validates(t *testing.T) {
+	t.Setenv("CONDUIT_SSH_USER", "testuser")
+	t.Setenv("CONDUIT_SSH_PASSWORD", "testpass")
+	t.Setenv("CONDUIT_SSH_HOST", "bastion.com")
+	t.Setenv("CONDUIT_SSH_INSECUREIGNOREHOSTKEY", "true")
+
+	_, err := LoadFromEnv()
+	if err == nil {
+		t.Fatal("expected validation error when no tunnels are defined")
+	}
+}
+
+func TestParseEnv_KeyFileList(t *testing.T) {
+	cfg, err := parseEnv([]string{"CONDUIT_SSH_KEYFILE=/keys/id_old, /keys/id_new"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.SSH.KeyFile) != 2 || cfg.SSH.KeyFile[0] != "/keys/id_old" || cfg.SSH.KeyFile[1] != "/keys/id_new" {
+		t.Errorf("expected two key files in order, got %v", cfg.SSH.KeyFile)
+	}
+}
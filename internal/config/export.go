@@ -0,0 +1,136 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pperesbr/conduit/internal/tunnel"
+	"gopkg.in/yaml.v3"
+)
+
+// Export formats select how Export serializes a Config.
+const (
+	ExportYAML = "yaml"
+	ExportJSON = "json"
+)
+
+// Secret handling modes select what Export writes in place of the SSH passwords and key passphrases.
+const (
+	SecretsReference = "reference"
+	SecretsRedact    = "redact"
+	SecretsInclude   = "include"
+)
+
+// redactedSecret replaces secrets written with SecretsRedact.
+const redactedSecret = "REDACTED"
+
+// ExportOptions controls how Export serializes a Config. The zero value writes YAML with the SSH password and key
+// passphrase replaced by references to CONDUIT_SSH_PASSWORD and CONDUIT_SSH_KEYPASSPHRASE, and those of jump host n by
+// CONDUIT_SSH_JUMP<n>_PASSWORD and CONDUIT_SSH_JUMP<n>_KEYPASSPHRASE, which are expanded again when the file is loaded.
+// Secrets in a tunnel's own ssh block reference variables named after the tunnel, such as CONDUIT_SSH_DB_PASSWORD.
+type ExportOptions struct {
+	Format  string
+	Secrets string
+}
+
+// Export writes the Config in a form Load reads back into an equal Config. Fields left at their zero value are omitted.
+// JSON output uses the same field names and duration strings as YAML, so it loads as well.
+func (c *Config) Export(w io.Writer, opts ExportOptions) error {
+	out := *c
+	out.sources = nil
+
+	switch opts.Secrets {
+	case "", SecretsReference, SecretsRedact, SecretsInclude:
+	default:
+		return fmt.Errorf("unknown secrets mode %q, expected %q, %q, or %q", opts.Secrets, SecretsReference, SecretsRedact, SecretsInclude)
+	}
+	out.SSH = exportSSHSecrets(c.SSH, "", opts.Secrets)
+
+	out.TunnelConfigs = append(out.TunnelConfigs[:0:0], c.TunnelConfigs...)
+	for i := range out.TunnelConfigs {
+		t := &out.TunnelConfigs[i]
+		if t.SSH != nil {
+			ssh := exportSSHSecrets(*t.SSH, envName(t.Name)+"_", opts.Secrets)
+			t.SSH = &ssh
+		}
+	}
+
+	if len(out.TunnelConfigs) == 0 {
+		out.Reload.AllowEmpty = true
+	}
+
+	data, err := yaml.Marshal(&out)
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	switch opts.Format {
+	case "", ExportYAML:
+		_, err = w.Write(data)
+		return err
+
+	case ExportJSON:
+		var doc map[string]any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to encode config: %w", err)
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(doc)
+
+	default:
+		return fmt.Errorf("unknown export format %q, expected %q or %q", opts.Format, ExportYAML, ExportJSON)
+	}
+}
+
+// exportSSHSecrets returns a copy of ssh with its secrets, and those of its jump hosts, replaced according to mode. The
+// prefix is inserted into the names of referenced variables after CONDUIT_SSH_.
+func exportSSHSecrets(ssh tunnel.SSHConfig, prefix, mode string) tunnel.SSHConfig {
+	ssh.KeyFile = append(ssh.KeyFile[:0:0], ssh.KeyFile...)
+	ssh.Password = exportSecret(ssh.Password, prefix+"PASSWORD", mode)
+	ssh.KeyPassphrase = exportSecret(ssh.KeyPassphrase, prefix+"KEYPASSPHRASE", mode)
+
+	ssh.JumpHosts = append(ssh.JumpHosts[:0:0], ssh.JumpHosts...)
+	for i := range ssh.JumpHosts {
+		hop := &ssh.JumpHosts[i]
+		hop.Password = exportSecret(hop.Password, fmt.Sprintf("%sJUMP%d_PASSWORD", prefix, i+1), mode)
+		hop.KeyPassphrase = exportSecret(hop.KeyPassphrase, fmt.Sprintf("%sJUMP%d_KEYPASSPHRASE", prefix, i+1), mode)
+	}
+
+	return ssh
+}
+
+// envName turns a tunnel name into the form used in environment variable names: upper case, with every character other
+// than letters and digits replaced by an underscore.
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// exportSecret returns what Export writes for a non-empty secret under the given secrets mode: a reference to the
+// CONDUIT_SSH_<field> variable, the redaction marker, or the secret itself.
+func exportSecret(value, field, mode string) string {
+	if value == "" {
+		return ""
+	}
+
+	switch mode {
+	case SecretsRedact:
+		return redactedSecret
+	case SecretsInclude:
+		return value
+	default:
+		return "${" + envSSHPrefix + field + "}"
+	}
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// exportConfig exercises nested blocks, pointer fields, durations, and lists so a round trip covers every encoding.
+const exportConfig = `
+ssh:
+  user: testuser
+  password: testpass
+  host: bastion.com
+  port: 2222
+  insecureIgnoreHostKey: true
+
+startup:
+  stagger: 500ms
+  initialRetries: 2
+
+reload:
+  mode: strict
+
+tunnels:
+  - name: sigitm
+    remoteHost: db-server
+    remotePort: 1521
+    localPort: 1521
+    tcpNoDelay: false
+    channelOpen:
+      retries: 0
+    maintenance:
+      - Sun 02:00-04:00
+    probe:
+      mode: local
+      interval: 10s
+      expect: ok
+  - name: replica
+    remoteHost: db-replica
+    remotePort: 1521
+    localPort: 1522
+    shutdownGrace: 30s
+`
+
+// withoutAuth clears the SSH fields Validate derives from the others, since they hold functions.
+func withoutAuth(cfg *Config) *Config {
+	cfg.SSH.AuthMethods = nil
+	cfg.SSH.HostKeyCallback = nil
+	return cfg
+}
+
+func TestExport_RoundTrips(t *testing.T) {
+	for _, format := range []string{ExportYAML, ExportJSON} {
+		t.Run(format, func(t *testing.T) {
+			original, err := Parse([]byte(exportConfig))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var out bytes.Buffer
+			if err := original.Export(&out, ExportOptions{Format: format, Secrets: SecretsInclude}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			reloaded, err := Parse(out.Bytes())
+			if err != nil {
+				t.Fatalf("expected the export to load, got %v:\n%s", err, out.String())
+			}
+
+			if !reflect.DeepEqual(withoutAuth(original), withoutAuth(reloaded)) {
+				t.Errorf("expected the reloaded config to equal the original\noriginal: %+v\nreloaded: %+v", original, reloaded)
+			}
+		})
+	}
+}
+
+func TestExport_Secrets(t *testing.T) {
+	cfg, err := Parse([]byte(exportConfig))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := cfg.Export(&out, ExportOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(out.String(), "testpass") || !strings.Contains(out.String(), "${CONDUIT_SSH_PASSWORD}") {
+		t.Errorf("expected the password to be referenced by default, got:\n%s", out.String())
+	}
+
+	t.Setenv("CONDUIT_SSH_PASSWORD", "testpass")
+	reloaded, err := Parse(out.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reloaded.SSH.Password != "testpass" {
+		t.Errorf("expected the reference to expand on load, got %q", reloaded.SSH.Password)
+	}
+
+	out.Reset()
+	if err := cfg.Export(&out, ExportOptions{Secrets: SecretsRedact}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(out.String(), "testpass") || !strings.Contains(out.String(), "REDACTED") {
+		t.Errorf("expected the password to be redacted, got:\n%s", out.String())
+	}
+
+	if err := cfg.Export(&out, ExportOptions{Secrets: "plain"}); err == nil {
+		t.Error("expected error for unknown secrets mode")
+	}
+	if err := cfg.Export(&out, ExportOptions{Format: "toml"}); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// parseFile parses the contents of the config file at path, in the format its extension names, and merges in the
+// tunnels of the files it includes, without validating the result. An empty path stands for a config that was not
+// read from a file, whose includes are resolved against the working directory.
+func parseFile(path string, data []byte, format string) (*Config, error) {
+	cfg, err := parse(data, format)
+	if err != nil {
+		return nil, err
+	}
+	cfg.sources = fileSources(cfg.sources, len(cfg.TunnelConfigs), path)
+
+	stack := []string{}
+	if path != "" {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve config file: %w", err)
+		}
+		stack = append(stack, abs)
+	}
+
+	if err := cfg.include(cfg.Include, filepath.Dir(path), stack); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// include reads the files in paths, relative to dir unless absolute, and appends their tunnels to c, following their
+// own includes in turn. stack holds the files being included, outermost first, to catch a file including itself. A
+// file already merged through another include is skipped, so its tunnels are not added twice.
+func (c *Config) include(paths []string, dir string, stack []string) error {
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return fmt.Errorf("failed to resolve included file %s: %w", p, err)
+		}
+
+		for i, parent := range stack {
+			if parent == abs {
+				return fmt.Errorf("include cycle: %s", strings.Join(append(stack[i:], abs), " -> "))
+			}
+		}
+		if c.hasIncluded(abs) {
+			continue
+		}
+
+		data, err := os.ReadFile(abs)
+		if err != nil {
+			return fmt.Errorf("failed to read included file: %w", err)
+		}
+
+		included, err := parse(data, FormatOf(abs))
+		if err != nil {
+			return fmt.Errorf("included file %s: %w", abs, err)
+		}
+		if !onlyTunnels(included) {
+			return fmt.Errorf("included file %s may only set tunnels, defaults, and include", abs)
+		}
+
+		c.includes = append(c.includes, abs)
+		c.sources = append(c.sources, fileSources(included.sources, len(included.TunnelConfigs), abs)...)
+		c.TunnelConfigs = append(c.TunnelConfigs, included.TunnelConfigs...)
+
+		if err := c.include(included.Include, filepath.Dir(abs), append(stack, abs)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasIncluded reports whether the file at the absolute path abs has already been merged into c.
+func (c *Config) hasIncluded(abs string) bool {
+	for _, path := range c.includes {
+		if path == abs {
+			return true
+		}
+	}
+	return false
+}
+
+// IncludedFiles returns the absolute paths of the files the config included, directly or through other included
+// files, in the order they were read.
+func (c *Config) IncludedFiles() []string {
+	return c.includes
+}
+
+// onlyTunnels reports whether an included config sets nothing besides its tunnels, their defaults, and further
+// includes; everything else comes from the main config file.
+func onlyTunnels(cfg *Config) bool {
+	rest := *cfg
+	rest.TunnelConfigs, rest.Defaults, rest.Include, rest.sources = nil, DefaultsConfig{}, nil, nil
+	return reflect.ValueOf(rest).IsZero()
+}
+
+// fileSources pads sources to one entry per tunnel and records file as where the padded entries and those without a
+// file yet were written.
+func fileSources(sources []tunnelSource, tunnels int, file string) []tunnelSource {
+	for len(sources) < tunnels {
+		sources = append(sources, tunnelSource{})
+	}
+	for i := range sources {
+		if sources[i].File == "" {
+			sources[i].File = file
+		}
+	}
+	return sources
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfigFiles writes each file under dir, creating directories as needed, and returns dir.
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+const includeMain = `
+ssh:
+  user: testuser
+  password: testpass
+  host: bastion.com
+  insecureIgnoreHostKey: true
+
+include:
+  - tunnels/web.yaml
+
+tunnels:
+  - name: db
+    remoteHost: db-server
+    remotePort: 5432
+    localPort: 5432
+`
+
+// TestLoad_Include verifies that the tunnels of included files, and of the files they include in turn, are appended to
+// the main file's, each file's defaults applying to its own tunnels, and that the included files are reported.
+func TestLoad_Include(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": includeMain,
+		"tunnels/web.yaml": `
+include:
+  - ../shared/cache.json
+defaults:
+  autoRestart:
+    enabled: true
+    interval: 10s
+tunnels:
+  - name: web
+    remoteHost: web-server
+    remotePort: 80
+    localPort: 8080
+`,
+		"shared/cache.json": `{"tunnels": [{"name": "cache", "remoteHost": "cache-server", "remotePort": 6379, "localPort": 6379}]}`,
+	})
+
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, tc := range cfg.TunnelConfigs {
+		names = append(names, tc.Name)
+	}
+	if strings.Join(names, ",") != "db,web,cache" {
+		t.Errorf("expected tunnels db, web, and cache, got %v", names)
+	}
+	if cfg.TunnelConfigs[0].AutoRestart.Enabled || !cfg.TunnelConfigs[1].AutoRestart.Enabled {
+		t.Errorf("expected the included defaults to apply to web only, got %+v", cfg.TunnelConfigs)
+	}
+	if cfg.SSH.Host != "bastion.com" {
+		t.Errorf("expected the main file's ssh block, got host %q", cfg.SSH.Host)
+	}
+
+	want := []string{filepath.Join(dir, "tunnels/web.yaml"), filepath.Join(dir, "shared/cache.json")}
+	if got := cfg.IncludedFiles(); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("expected included files %v, got %v", want, got)
+	}
+}
+
+func TestLoad_IncludeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		web     string
+		wantErr []string
+	}{
+		{
+			name: "duplicate name",
+			web: `
+tunnels:
+  - name: db
+    remoteHost: other-db
+    remotePort: 5432
+    localPort: 15432
+`,
+			wantErr: []string{"duplicate tunnel name: db", "config.yaml and ", "web.yaml"},
+		},
+		{
+			name:    "cycle",
+			web:     "include: [../config.yaml]\n",
+			wantErr: []string{"include cycle", "config.yaml -> ", "web.yaml -> "},
+		},
+		{
+			name:    "self",
+			web:     "include: [web.yaml]\n",
+			wantErr: []string{"include cycle", "web.yaml -> "},
+		},
+		{
+			name:    "ssh block",
+			web:     "ssh:\n  host: elsewhere\n",
+			wantErr: []string{"may only set tunnels, defaults, and include"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeConfigFiles(t, map[string]string{"config.yaml": includeMain, "tunnels/web.yaml": tt.web})
+
+			_, err := Load(filepath.Join(dir, "config.yaml"))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error containing %q, got %v", want, err)
+				}
+			}
+		})
+	}
+
+	dir := writeConfigFiles(t, map[string]string{"config.yaml": includeMain})
+	if _, err := Load(filepath.Join(dir, "config.yaml")); err == nil || !strings.Contains(err.Error(), "included file") {
+		t.Errorf("expected an error about the missing included file, got %v", err)
+	}
+}
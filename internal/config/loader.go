@@ -0,0 +1,212 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Loader produces a validated Config from a single source, or from several merged together.
+type Loader interface {
+	Load() (*Config, error)
+}
+
+// Watchable is implemented by Loaders whose config lives in files that may change while conduit runs. WatchPaths lists
+// those files; a Loader returning none has nothing to watch.
+type Watchable interface {
+	WatchPaths() []string
+}
+
+// sourceLoader is implemented by the Loaders in this package, so a CompositeLoader can merge what they read before
+// overrides are applied and the result is validated.
+type sourceLoader interface {
+	loadSource() (*Config, error)
+}
+
+// FileLoader loads a YAML or JSON config file, chosen by its extension, expanding environment variables in it. A
+// directory Path loads the *.yaml fragments in it, as Load does.
+type FileLoader struct {
+	Path      string
+	Overrides []Override
+}
+
+// Load reads and validates the config file.
+func (l *FileLoader) Load() (*Config, error) {
+	cfg, err := l.loadSource()
+	if err != nil {
+		return nil, err
+	}
+
+	return finish(cfg, l.Overrides)
+}
+
+// loadSource reads and parses the config file and the files it includes without validating them.
+func (l *FileLoader) loadSource() (*Config, error) {
+	return parsePath(l.Path)
+}
+
+// WatchPaths returns the config file or directory.
+func (l *FileLoader) WatchPaths() []string {
+	return []string{l.Path}
+}
+
+// ReaderLoader loads a YAML config, which may also be written as JSON, from a reader such as stdin. The reader is
+// consumed on the first load and its contents are reused afterwards, so every load returns the same config.
+type ReaderLoader struct {
+	Reader    io.Reader
+	Overrides []Override
+
+	once sync.Once
+	data []byte
+	err  error
+}
+
+// Load reads the config on first use and validates it.
+func (l *ReaderLoader) Load() (*Config, error) {
+	cfg, err := l.loadSource()
+	if err != nil {
+		return nil, err
+	}
+
+	return finish(cfg, l.Overrides)
+}
+
+// loadSource parses the config read from the reader without validating it.
+func (l *ReaderLoader) loadSource() (*Config, error) {
+	l.once.Do(func() {
+		l.data, l.err = io.ReadAll(l.Reader)
+	})
+	if l.err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", l.err)
+	}
+
+	return parseFile("", l.data, FormatYAML)
+}
+
+// EnvLoader builds a config from CONDUIT_SSH_* and CONDUIT_TUNNEL_<n>_* environment variables, like LoadFromEnv.
+type EnvLoader struct {
+	Overrides []Override
+}
+
+// Load builds the config from the environment and validates it.
+func (l *EnvLoader) Load() (*Config, error) {
+	cfg, err := l.loadSource()
+	if err != nil {
+		return nil, err
+	}
+
+	return finish(cfg, l.Overrides)
+}
+
+// loadSource builds the config from the environment without validating it.
+func (l *EnvLoader) loadSource() (*Config, error) {
+	cfg, err := parseEnv(os.Environ())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse environment: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// CompositeLoader merges the configs of several Loaders, listed from lowest to highest precedence, and validates only
+// the merged result, so each source may hold part of the config. A source overrides the fields it sets, and tunnels
+// are matched by name, with new names appended in the order they are first seen. Fields cannot be unset by a later
+// source. Overrides on the inner Loaders of this package are ignored; set them on the CompositeLoader instead.
+type CompositeLoader struct {
+	Loaders   []Loader
+	Overrides []Override
+}
+
+// Load loads every source in order, merges them, and validates the result.
+func (l *CompositeLoader) Load() (*Config, error) {
+	cfg, err := l.loadSource()
+	if err != nil {
+		return nil, err
+	}
+
+	return finish(cfg, l.Overrides)
+}
+
+// loadSource loads and merges every source without validating the result.
+func (l *CompositeLoader) loadSource() (*Config, error) {
+	merged := &Config{}
+	for i, loader := range l.Loaders {
+		var cfg *Config
+		var err error
+		if source, ok := loader.(sourceLoader); ok {
+			cfg, err = source.loadSource()
+		} else {
+			cfg, err = loader.Load()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("source %d: %w", i+1, err)
+		}
+
+		mergeConfig(merged, cfg)
+	}
+
+	return merged, nil
+}
+
+// WatchPaths returns the files watched by any of the sources.
+func (l *CompositeLoader) WatchPaths() []string {
+	var paths []string
+	for _, loader := range l.Loaders {
+		if watchable, ok := loader.(Watchable); ok {
+			paths = append(paths, watchable.WatchPaths()...)
+		}
+	}
+	return paths
+}
+
+// mergeConfig merges src into dst: every field src sets replaces dst's, and tunnels are merged by name. Where tunnel
+// fields were written before environment expansion is not tracked across sources.
+func mergeConfig(dst, src *Config) {
+	tunnels := dst.TunnelConfigs
+	mergeFields(reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem())
+
+	for _, t := range src.TunnelConfigs {
+		index := -1
+		for i := range tunnels {
+			if tunnels[i].Name == t.Name {
+				index = i
+				break
+			}
+		}
+
+		if index < 0 {
+			tunnels = append(tunnels, t)
+			continue
+		}
+		mergeFields(reflect.ValueOf(&tunnels[index]).Elem(), reflect.ValueOf(t))
+	}
+
+	dst.TunnelConfigs = tunnels
+	dst.sources = nil
+	dst.includes = append(dst.includes, src.includes...)
+}
+
+// mergeFields copies each non-zero exported field of struct src into dst, descending into nested structs. Fields kept
+// out of YAML and the tunnel list, which mergeConfig merges by name, are skipped.
+func mergeFields(dst, src reflect.Value) {
+	t := src.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if !field.IsExported() || tag == "-" || tag == "tunnels" {
+			continue
+		}
+
+		value := src.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			mergeFields(dst.Field(i), value)
+			continue
+		}
+		if !value.IsZero() {
+			dst.Field(i).Set(value)
+		}
+	}
+}
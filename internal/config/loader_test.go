@@ -0,0 +1,147 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const loaderConfig = `
+ssh:
+  user: testuser
+  password: testpass
+  host: bastion.com
+  port: 22
+  insecureIgnoreHostKey: true
+
+tunnels:
+  - name: db
+    remoteHost: db.internal
+    remotePort: 5432
+    localPort: 15432
+`
+
+func TestFileLoader(t *testing.T) {
+	path := createTempConfig(t, loaderConfig)
+	loader := &FileLoader{Path: path, Overrides: []Override{{Key: "db.localPort", Value: "25432"}}}
+
+	cfg, err := loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.SSH.Host != "bastion.com" || len(cfg.TunnelConfigs) != 1 || cfg.TunnelConfigs[0].LocalPort != 25432 {
+		t.Errorf("expected the file with the override applied, got %+v", cfg)
+	}
+
+	if paths := loader.WatchPaths(); !reflect.DeepEqual(paths, []string{path}) {
+		t.Errorf("expected to watch %s, got %v", path, paths)
+	}
+
+	if _, err := (&FileLoader{Path: path + ".missing"}).Load(); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestReaderLoader(t *testing.T) {
+	loader := &ReaderLoader{Reader: strings.NewReader(loaderConfig)}
+
+	for range 2 {
+		cfg, err := loader.Load()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(cfg.TunnelConfigs) != 1 || cfg.TunnelConfigs[0].Name != "db" {
+			t.Errorf("expected the same config on every load, got %+v", cfg.TunnelConfigs)
+		}
+	}
+
+	if _, ok := Loader(loader).(Watchable); ok {
+		t.Error("expected a reader loader to have nothing to watch")
+	}
+
+	if _, err := (&ReaderLoader{Reader: strings.NewReader("ssh: [")}).Load(); err == nil {
+		t.Error("expected error for invalid YAML")
+	}
+}
+
+func TestEnvLoader(t *testing.T) {
+	t.Setenv("CONDUIT_SSH_USER", "testuser")
+	t.Setenv("CONDUIT_SSH_PASSWORD", "testpass")
+	t.Setenv("CONDUIT_SSH_HOST", "bastion.com")
+	t.Setenv("CONDUIT_SSH_INSECUREIGNOREHOSTKEY", "true")
+	t.Setenv("CONDUIT_TUNNEL_1_NAME", "db")
+	t.Setenv("CONDUIT_TUNNEL_1_REMOTEHOST", "db.internal")
+	t.Setenv("CONDUIT_TUNNEL_1_REMOTEPORT", "5432")
+	t.Setenv("CONDUIT_TUNNEL_1_LOCALPORT", "15432")
+
+	cfg, err := (&EnvLoader{}).Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want, err := Parse([]byte(loaderConfig))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.TunnelConfigs, want.TunnelConfigs) || cfg.SSH.Host != want.SSH.Host {
+		t.Errorf("expected %+v, got %+v", want, cfg)
+	}
+}
+
+func TestCompositeLoader_Precedence(t *testing.T) {
+	base := createTempConfig(t, loaderConfig+`
+  - name: cache
+    remoteHost: cache.internal
+    remotePort: 6379
+    localPort: 16379
+`)
+
+	// Neither source below is valid on its own: it only holds what it changes.
+	overlay := &ReaderLoader{Reader: strings.NewReader(`
+ssh:
+  host: bastion-2.com
+  insecureIgnoreHostKey: true
+tunnels:
+  - name: db
+    localPort: 25432
+  - name: queue
+    remoteHost: mq.internal
+    remotePort: 5672
+    localPort: 15672
+`)}
+	t.Setenv("CONDUIT_SSH_HOST", "bastion-3.com")
+	t.Setenv("CONDUIT_TUNNEL_1_NAME", "cache")
+	t.Setenv("CONDUIT_TUNNEL_1_LOCALPORT", "26379")
+
+	loader := &CompositeLoader{
+		Loaders:   []Loader{&FileLoader{Path: base}, overlay, &EnvLoader{}},
+		Overrides: []Override{{Key: "queue.localPort", Value: "25672"}},
+	}
+
+	cfg, err := loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.SSH.Host != "bastion-3.com" || cfg.SSH.User != "testuser" {
+		t.Errorf("expected the environment's host over the file's user, got %+v", cfg.SSH)
+	}
+
+	want := []TunnelConfig{
+		{Name: "db", RemoteHost: "db.internal", RemotePort: 5432, LocalPort: 25432},
+		{Name: "cache", RemoteHost: "cache.internal", RemotePort: 6379, LocalPort: 26379},
+		{Name: "queue", RemoteHost: "mq.internal", RemotePort: 5672, LocalPort: 25672},
+	}
+	if !reflect.DeepEqual(cfg.TunnelConfigs, want) {
+		t.Errorf("expected tunnels %+v, got %+v", want, cfg.TunnelConfigs)
+	}
+
+	if paths := loader.WatchPaths(); !reflect.DeepEqual(paths, []string{base}) {
+		t.Errorf("expected to watch only the file, got %v", paths)
+	}
+
+	partial := &CompositeLoader{Loaders: []Loader{&EnvLoader{}}}
+	if _, err := partial.Load(); err == nil {
+		t.Error("expected the merged result to be validated")
+	}
+}
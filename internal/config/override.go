@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Override replaces a single tunnel setting for one run, such as "db.localPort=15210" from the -set flag. Path is the
+// dotted path of YAML field names below the tunnel, and Value is parsed as YAML into that field.
+type Override struct {
+	Key   string
+	Value string
+}
+
+// ParseOverride splits a "key=value" override. The key must name a tunnel and at least one field below it.
+func ParseOverride(s string) (Override, error) {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return Override{}, fmt.Errorf("override %q must have the form tunnel.field=value", s)
+	}
+
+	key = strings.TrimSpace(key)
+	if !strings.Contains(key, ".") || strings.HasPrefix(key, ".") || strings.HasSuffix(key, ".") {
+		return Override{}, fmt.Errorf("override %q must have the form tunnel.field=value", s)
+	}
+
+	return Override{Key: key, Value: value}, nil
+}
+
+// String formats the override the way ParseOverride accepts it.
+func (o Override) String() string {
+	return o.Key + "=" + o.Value
+}
+
+// Apply sets each override on the tunnel it names. Tunnel names may contain dots; the longest name matching the start
+// of the key wins.
+func (c *Config) Apply(overrides []Override) error {
+	for _, o := range overrides {
+		index := -1
+		for i, t := range c.TunnelConfigs {
+			if strings.HasPrefix(o.Key, t.Name+".") && (index < 0 || len(t.Name) > len(c.TunnelConfigs[index].Name)) {
+				index = i
+			}
+		}
+
+		if index < 0 {
+			name, _, _ := strings.Cut(o.Key, ".")
+			return fmt.Errorf("override %s: no tunnel named %s", o, name)
+		}
+
+		path := strings.Split(strings.TrimPrefix(o.Key, c.TunnelConfigs[index].Name+"."), ".")
+		if err := setField(reflect.ValueOf(&c.TunnelConfigs[index]).Elem(), path, o.Value); err != nil {
+			return fmt.Errorf("override %s: %w", o, err)
+		}
+	}
+
+	return nil
+}
+
+// setField walks path through nested structs by YAML field name and decodes value into the field it ends at. Unset
+// struct pointers along the way, such as a tunnel's ssh block, are allocated.
+func setField(v reflect.Value, path []string, value string) error {
+	for i, name := range path {
+		if v.Kind() == reflect.Pointer && v.Type().Elem().Kind() == reflect.Struct {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+
+		if v.Kind() != reflect.Struct {
+			return fmt.Errorf("%s has no field %s", strings.Join(path[:i], "."), name)
+		}
+
+		field, ok := fieldByYAMLName(v, name)
+		if !ok {
+			return fmt.Errorf("unknown field %s", strings.Join(path[:i+1], "."))
+		}
+		v = field
+	}
+
+	target := reflect.New(v.Type())
+	if err := yaml.Unmarshal([]byte(value), target.Interface()); err != nil {
+		return fmt.Errorf("invalid value %q: %w", value, err)
+	}
+	v.Set(target.Elem())
+
+	return nil
+}
+
+// fieldByYAMLName returns the exported field of struct v whose YAML tag names it.
+func fieldByYAMLName(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if tag == name && tag != "-" {
+			return v.Field(i), true
+		}
+	}
+
+	return reflect.Value{}, false
+}
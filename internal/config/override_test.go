@@ -0,0 +1,101 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// overrideConfig is the config every override test starts from.
+const overrideConfig = `
+ssh:
+  user: testuser
+  password: testpass
+  host: bastion.com
+  insecureIgnoreHostKey: true
+
+tunnels:
+  - name: sigitm
+    remoteHost: db-server
+    remotePort: 1521
+    localPort: 1521
+  - name: sigitm.replica
+    remoteHost: db-replica
+    remotePort: 1521
+    localPort: 1522
+`
+
+func TestParseOverride(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Override
+		wantErr bool
+	}{
+		{"sigitm.localPort=15210", Override{Key: "sigitm.localPort", Value: "15210"}, false},
+		{"sigitm.remotePortCommand=echo a=b", Override{Key: "sigitm.remotePortCommand", Value: "echo a=b"}, false},
+		{"sigitm.localPort", Override{}, true},
+		{"localPort=15210", Override{}, true},
+		{".localPort=15210", Override{}, true},
+		{"sigitm.=15210", Override{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseOverride(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLoad_AppliesOverrides(t *testing.T) {
+	overrides := []Override{
+		{Key: "sigitm.localPort", Value: "15210"},
+		{Key: "sigitm.probe.interval", Value: "5s"},
+		{Key: "sigitm.tcpNoDelay", Value: "false"},
+		{Key: "sigitm.replica.localPort", Value: "15220"},
+	}
+
+	cfg, err := Load(createTempConfig(t, overrideConfig), overrides...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	primary, replica := cfg.TunnelConfigs[0], cfg.TunnelConfigs[1]
+	if primary.LocalPort != 15210 || primary.Probe.Interval != 5*time.Second || primary.NoDelay() {
+		t.Errorf("expected overrides applied to sigitm, got %+v", primary)
+	}
+	if replica.LocalPort != 15220 {
+		t.Errorf("expected the longest matching tunnel name to win, got replica localPort %d", replica.LocalPort)
+	}
+}
+
+func TestLoad_InvalidOverrides(t *testing.T) {
+	tests := []struct {
+		name     string
+		override Override
+		wantErr  string
+	}{
+		{"unknown tunnel", Override{Key: "missing.localPort", Value: "15210"}, "no tunnel named missing"},
+		{"unknown field", Override{Key: "sigitm.localport", Value: "15210"}, "unknown field localport"},
+		{"field below a scalar", Override{Key: "sigitm.localPort.value", Value: "1"}, "localPort has no field value"},
+		{"bad value", Override{Key: "sigitm.localPort", Value: "abc"}, `invalid value "abc"`},
+		{"value failing validation", Override{Key: "sigitm.localPort", Value: "1522"}, "duplicate localPort"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(createTempConfig(t, overrideConfig), tt.override)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
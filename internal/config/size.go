@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// byteUnits maps the unit suffixes accepted by ParseByteSize, in lower case, to their size in bytes. Units are binary,
+// so 1KB is 1024 bytes.
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+}
+
+// ParseByteSize parses a size such as "512KB", "1.5MB", or "2048", in bytes. Units are case-insensitive and binary.
+func ParseByteSize(s string) (int64, error) {
+	value := strings.TrimSpace(s)
+	split := strings.IndexFunc(value, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if split == -1 {
+		split = len(value)
+	}
+
+	number, unit := value[:split], strings.ToLower(strings.TrimSpace(value[split:]))
+
+	scale, known := byteUnits[unit]
+	if !known {
+		return 0, fmt.Errorf("unknown size unit in %q", s)
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	size := n * scale
+	if size > math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+
+	return int64(size), nil
+}
@@ -0,0 +1,75 @@
+package config
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{"2048", 2048, false},
+		{"512B", 512, false},
+		{"64KB", 64 << 10, false},
+		{"1MB", 1 << 20, false},
+		{"1.5 mb", 3 << 19, false},
+		{"2MiB", 2 << 20, false},
+		{"1G", 1 << 30, false},
+		{"", 0, true},
+		{"MB", 0, true},
+		{"10 parsecs", 0, true},
+		{"1.2.3KB", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseByteSize(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidate_RateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   string
+		want    int64
+		wantErr bool
+	}{
+		{"megabytes", "1MB", 1 << 20, false},
+		{"bytes", "4096", 4096, false},
+		{"unknown unit", "1 furlong", 0, true},
+		{"zero", "0KB", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `
+ssh:
+  user: testuser
+  password: testpass
+  host: bastion.com
+  insecureIgnoreHostKey: true
+
+tunnels:
+  - name: backup
+    remoteHost: backup-server
+    remotePort: 873
+    localPort: 8873
+    rateLimit: ` + tt.limit + `
+`
+			cfg, err := Load(createTempConfig(t, content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && cfg.TunnelConfigs[0].RateLimitBytes() != tt.want {
+				t.Errorf("expected %d bytes per second, got %d", tt.want, cfg.TunnelConfigs[0].RateLimitBytes())
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// waitPollInterval is how often WaitForFile checks whether the config file has appeared.
+var waitPollInterval = 250 * time.Millisecond
+
+// WaitForFile blocks until a non-empty file exists at path, for config files written by another process shortly after
+// conduit starts. It gives up after timeout or once ctx is done.
+func WaitForFile(ctx context.Context, path string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		info, err := os.Stat(path)
+		if err == nil && info.Size() > 0 {
+			return nil
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to check config file: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return fmt.Errorf("config file %s did not appear within %s", path, timeout)
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
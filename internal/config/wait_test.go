@@ -0,0 +1,57 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitForFile_LoadsOnceWritten(t *testing.T) {
+	waitPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { waitPollInterval = 250 * time.Millisecond })
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		// An empty file, as a sidecar may create before writing, does not count as the config appearing.
+		_ = os.WriteFile(path, nil, 0600)
+		time.Sleep(50 * time.Millisecond)
+		_ = os.WriteFile(path, []byte(loaderConfig), 0600)
+	}()
+
+	start := time.Now()
+	if err := WaitForFile(context.Background(), path, 5*time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if waited := time.Since(start); waited < 150*time.Millisecond {
+		t.Errorf("expected to wait for the file to be written, returned after %s", waited)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.TunnelConfigs) != 1 {
+		t.Errorf("expected the written config, got %+v", cfg.TunnelConfigs)
+	}
+}
+
+func TestWaitForFile_TimesOut(t *testing.T) {
+	waitPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { waitPollInterval = 250 * time.Millisecond })
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := WaitForFile(context.Background(), path, 50*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "did not appear within 50ms") {
+		t.Errorf("expected a timeout error, got: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := WaitForFile(ctx, path, time.Minute); err != context.Canceled {
+		t.Errorf("expected the wait to stop with its context, got: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Warning codes identify the kind of a Warning; they are stable so tooling can match on them.
+const (
+	WarnInsecureHostKey = "insecure-host-key"
+	WarnPrivilegedPort  = "privileged-port"
+	WarnDuplicateRemote = "duplicate-remote"
+	WarnDuplicateLocal  = "duplicate-local-port"
+	WarnBastionLoopback = "bastion-loopback"
+)
+
+// privilegedPortLimit is the first port that can be bound without elevated privileges on most systems.
+const privilegedPortLimit = 1024
+
+// Warning describes a setting that is valid but likely unintended. Tunnel names the tunnel it concerns and is empty for
+// settings outside the tunnel list.
+type Warning struct {
+	Code    string
+	Message string
+	Tunnel  string
+}
+
+// String formats the warning for logs.
+func (w Warning) String() string {
+	if w.Tunnel == "" {
+		return fmt.Sprintf("%s [%s]", w.Message, w.Code)
+	}
+	return fmt.Sprintf("tunnel %s: %s [%s]", w.Tunnel, w.Message, w.Code)
+}
+
+// LogValue groups the warning's code, tunnel, and message for structured logs.
+func (w Warning) LogValue() slog.Value {
+	attrs := []slog.Attr{slog.String("code", w.Code), slog.String("message", w.Message)}
+	if w.Tunnel != "" {
+		attrs = append(attrs, slog.String("tunnel", w.Tunnel))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// LoadWithWarnings is like Load, but also returns the warnings for the loaded Config.
+func LoadWithWarnings(path string, overrides ...Override) (*Config, []Warning, error) {
+	cfg, err := Load(path, overrides...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, cfg.Warnings(), nil
+}
+
+// Check loads and validates the config through loader exactly as conduit does at startup and on reload, without
+// starting anything, and returns the warnings for it. The error is the one that would make conduit reject the config.
+func Check(loader Loader) (*Config, []Warning, error) {
+	cfg, err := loader.Load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, cfg.Warnings(), nil
+}
+
+// Warnings lists the settings of a valid Config that are likely unintended, in config order.
+func (c *Config) Warnings() []Warning {
+	var warnings []Warning
+
+	if c.SSH.KnownHostsFile == "" {
+		warnings = append(warnings, Warning{
+			Code:    WarnInsecureHostKey,
+			Message: "ssh.insecureIgnoreHostKey is set without a knownHostsFile, so any host key is accepted and the server's identity is not verified",
+		})
+	}
+
+	remotes := make(map[string]string)
+	localPorts := make(map[int][]TunnelConfig)
+
+	for _, t := range c.TunnelConfigs {
+		// A reverse tunnel binds on the SSH server and only connects to its local and remote addresses.
+		if t.Reverse() {
+			continue
+		}
+
+		// Port 0, allowed for dynamic tunnels, picks a free unprivileged port.
+		if t.LocalPort > 0 && t.LocalPort < privilegedPortLimit {
+			warnings = append(warnings, Warning{
+				Code:    WarnPrivilegedPort,
+				Message: fmt.Sprintf("localPort %d is privileged and may need elevated permissions to bind", t.LocalPort),
+				Tunnel:  t.Name,
+			})
+		}
+
+		if t.LocalPort > 0 && t.IsEnabled() {
+			for _, first := range localPorts[t.LocalPort] {
+				if bindsOverlap(first.LocalBindAddr(), t.LocalBindAddr()) {
+					warnings = append(warnings, Warning{
+						Code:    WarnDuplicateLocal,
+						Message: fmt.Sprintf("shares localPort %d with tunnel %s, allowed by allowDuplicateLocalPorts; conduit does not set SO_REUSEPORT, so whichever starts second will fail to listen", t.LocalPort, first.Name),
+						Tunnel:  t.Name,
+					})
+					break
+				}
+			}
+			localPorts[t.LocalPort] = append(localPorts[t.LocalPort], t)
+		}
+
+		server := c.SSH
+		if t.SSH != nil {
+			server = *t.SSH
+		}
+
+		if isLoopbackHost(t.RemoteHost) {
+			warnings = append(warnings, Warning{
+				Code: WarnBastionLoopback,
+				Message: fmt.Sprintf("remoteHost %s is relative to the SSH server %s, so it reaches services bound to the "+
+					"server's own loopback, not to this host", t.RemoteHost, server.Host),
+				Tunnel: t.Name,
+			})
+		}
+
+		if t.RemotePortCommand != "" || t.Dynamic() {
+			continue
+		}
+
+		// The same remote address names different services behind different servers.
+		target := net.JoinHostPort(t.RemoteHost, strconv.Itoa(t.RemotePort))
+		remote := server.Addr() + " " + target
+		if first, exists := remotes[remote]; exists {
+			warnings = append(warnings, Warning{
+				Code:    WarnDuplicateRemote,
+				Message: fmt.Sprintf("forwards to %s like tunnel %s", target, first),
+				Tunnel:  t.Name,
+			})
+			continue
+		}
+		remotes[remote] = t.Name
+	}
+
+	return warnings
+}
+
+// isLoopbackHost reports whether host names the loopback interface, as "localhost" or a loopback IP such as 127.0.0.1
+// or ::1 does.
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadWithWarnings(t *testing.T) {
+	content := `
+ssh:
+  user: testuser
+  password: testpass
+  host: bastion.com
+  insecureIgnoreHostKey: true
+
+tunnels:
+  - name: oracle
+    remoteHost: db-server
+    remotePort: 1521
+    localPort: 1521
+  - name: web
+    remoteHost: web-server
+    remotePort: 80
+    localPort: 80
+  - name: oracle-copy
+    remoteHost: db-server
+    remotePort: 1521
+    localPort: 1522
+`
+	cfg, warnings, err := LoadWithWarnings(createTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg == nil {
+		t.Fatal("expected config")
+	}
+
+	type ref struct{ code, tunnel string }
+	var got []ref
+	for _, w := range warnings {
+		if w.Message == "" {
+			t.Errorf("expected a message for %s", w.Code)
+		}
+		got = append(got, ref{w.Code, w.Tunnel})
+	}
+
+	want := []ref{
+		{WarnInsecureHostKey, ""},
+		{WarnPrivilegedPort, "web"},
+		{WarnDuplicateRemote, "oracle-copy"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected warnings %v, got %v", want, got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	valid := `
+ssh:
+  user: testuser
+  password: testpass
+  host: bastion.com
+  insecureIgnoreHostKey: true
+
+tunnels:
+  - name: web
+    remoteHost: web-server
+    remotePort: 80
+    localPort: 80
+`
+	cfg, warnings, err := Check(&FileLoader{Path: createTempConfig(t, valid)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.TunnelConfigs) != 1 || len(warnings) != 2 {
+		t.Errorf("expected 1 tunnel and 2 warnings, got %d and %v", len(cfg.TunnelConfigs), warnings)
+	}
+
+	invalid := valid + `  - name: web
+    remoteHost: other-server
+    remotePort: 80
+    localPort: 8080
+`
+	if _, _, err := Check(&FileLoader{Path: createTempConfig(t, invalid)}); err == nil {
+		t.Error("expected error for a duplicate tunnel name")
+	}
+}
+
+func TestWarnings_CleanConfig(t *testing.T) {
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(knownHosts, nil, 0600); err != nil {
+		t.Fatalf("failed to write known_hosts: %v", err)
+	}
+
+	content := `
+ssh:
+  user: testuser
+  password: testpass
+  host: bastion.com
+  knownHostsFile: ` + knownHosts + `
+
+tunnels:
+  - name: oracle
+    remoteHost: db-server
+    remotePort: 1521
+    localPort: 1521
+`
+	cfg, err := Load(createTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if warnings := cfg.Warnings(); len(warnings) != 0 {
+		t.Errorf("expected no warnings, got %v", warnings)
+	}
+}
+
+func TestWarnings_BastionLoopback(t *testing.T) {
+	content := `
+ssh:
+  user: testuser
+  password: testpass
+  host: bastion.com
+  insecureIgnoreHostKey: true
+
+tunnels:
+  - name: admin
+    remoteHost: localhost
+    remotePort: 8080
+    localPort: 18080
+  - name: metrics
+    remoteHost: 127.0.0.1
+    remotePort: 9090
+    localPort: 19090
+  - name: db
+    remoteHost: db-server
+    remotePort: 5432
+    localPort: 15432
+  - name: other-admin
+    remoteHost: localhost
+    remotePort: 8080
+    localPort: 28080
+    ssh:
+      user: testuser
+      password: testpass
+      host: bastion-2.com
+      insecureIgnoreHostKey: true
+`
+	cfg, err := Load(createTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, w := range cfg.Warnings() {
+		if w.Code == WarnDuplicateRemote {
+			t.Errorf("expected the same loopback address on different servers not to be a duplicate, got %v", w)
+		}
+		if w.Code == WarnBastionLoopback {
+			got = append(got, w.Tunnel)
+		}
+	}
+
+	if want := []string{"admin", "metrics", "other-admin"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected loopback warnings for %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,66 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/pperesbr/conduit/internal/config"
+)
+
+// retryBudget caps the automatic start, restart, and reconnect attempts made for a single tunnel within a sliding
+// window. Once an attempt would exceed the cap the tunnel is parked, and every later attempt is refused until it is
+// unparked.
+type retryBudget struct {
+	cfg      config.RetryBudgetConfig
+	attempts []time.Time
+	parked   bool
+}
+
+// newRetryBudget creates an unparked retryBudget for cfg.
+func newRetryBudget(cfg config.RetryBudgetConfig) *retryBudget {
+	return &retryBudget{cfg: cfg}
+}
+
+// spend records an attempt at now, reporting false without recording it when the budget is parked or has no attempts
+// left in the window, in which case it becomes parked.
+func (b *retryBudget) spend(now time.Time) bool {
+	if b.parked {
+		return false
+	}
+
+	b.prune(now)
+	if len(b.attempts) >= b.cfg.Attempts {
+		b.parked = true
+		return false
+	}
+
+	b.attempts = append(b.attempts, now)
+	return true
+}
+
+// remaining returns how many attempts are left in the window ending at now. It does not modify the budget, so it is
+// safe under a read lock.
+func (b *retryBudget) remaining(now time.Time) int {
+	if b.parked {
+		return 0
+	}
+
+	cutoff := now.Add(-b.cfg.Window)
+	left := b.cfg.Attempts
+	for _, at := range b.attempts {
+		if at.After(cutoff) {
+			left--
+		}
+	}
+	return left
+}
+
+// prune forgets attempts that fell out of the window ending at now.
+func (b *retryBudget) prune(now time.Time) {
+	cutoff := now.Add(-b.cfg.Window)
+
+	i := 0
+	for i < len(b.attempts) && !b.attempts[i].After(cutoff) {
+		i++
+	}
+	b.attempts = b.attempts[i:]
+}
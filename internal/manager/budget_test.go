@@ -0,0 +1,30 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pperesbr/conduit/internal/config"
+)
+
+func TestRetryBudget_SlidingWindow(t *testing.T) {
+	budget := newRetryBudget(config.RetryBudgetConfig{Attempts: 2, Window: time.Minute})
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if !budget.spend(start) || !budget.spend(start.Add(30*time.Second)) {
+		t.Fatal("expected the first two attempts to be allowed")
+	}
+	if left := budget.remaining(start.Add(61 * time.Second)); left != 1 {
+		t.Errorf("expected the first attempt to slide out of the window, got %d left", left)
+	}
+	if !budget.spend(start.Add(61 * time.Second)) {
+		t.Fatal("expected an attempt to be allowed once the oldest slid out of the window")
+	}
+
+	if budget.spend(start.Add(62 * time.Second)) {
+		t.Fatal("expected the attempt beyond the budget to be refused")
+	}
+	if !budget.parked || budget.remaining(start.Add(time.Hour)) != 0 || budget.spend(start.Add(time.Hour)) {
+		t.Error("expected the budget to stay parked after the window passed")
+	}
+}
@@ -0,0 +1,108 @@
+package manager
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/pperesbr/conduit/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigDiff lists the tunnels a config would add, remove, or change relative to another, sorted by name. Tunnels
+// holds the details of each changed tunnel, and SSHChanged reports whether the top-level ssh section differs.
+type ConfigDiff struct {
+	Added      []string
+	Removed    []string
+	Changed    []string
+	Tunnels    map[string]TunnelChange
+	SSHChanged bool
+}
+
+// TunnelChange details how a tunnel's config changed. Fields lists the YAML names of the fields that differ, sorted. SSH
+// is set when the tunnel's own ssh block was added, removed, or changed, and Restart when the change can only be applied
+// by restarting the tunnel; settings such as auto-restart timing, probes, and maintenance windows are updated in place.
+type TunnelChange struct {
+	Fields  []string
+	SSH     bool
+	Restart bool
+}
+
+// Empty reports whether the diff contains no tunnel differences.
+func (d ConfigDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffConfigs compares the tunnels of two configs by name. It has no side effects and does not validate either config.
+// A tunnel counts as changed when Reconcile would act on it, by restarting it or updating it in place.
+func DiffConfigs(old, new *config.Config) ConfigDiff {
+	diff := ConfigDiff{
+		Tunnels:    make(map[string]TunnelChange),
+		SSHChanged: serverKey(&old.SSH) != serverKey(&new.SSH),
+	}
+
+	oldConfigs := make(map[string]config.TunnelConfig, len(old.TunnelConfigs))
+	for _, cfg := range old.TunnelConfigs {
+		oldConfigs[cfg.Name] = cfg
+	}
+
+	newNames := make(map[string]bool, len(new.TunnelConfigs))
+	for _, newCfg := range new.TunnelConfigs {
+		newNames[newCfg.Name] = true
+
+		oldCfg, exists := oldConfigs[newCfg.Name]
+		if !exists {
+			diff.Added = append(diff.Added, newCfg.Name)
+			continue
+		}
+
+		kind := tunnelConfigChanged(oldCfg, newCfg)
+		if kind == changeNone {
+			continue
+		}
+
+		diff.Changed = append(diff.Changed, newCfg.Name)
+		diff.Tunnels[newCfg.Name] = TunnelChange{
+			Fields:  changedFields(oldCfg, newCfg),
+			SSH:     serverKey(oldCfg.SSH) != serverKey(newCfg.SSH),
+			Restart: kind == changeRestart,
+		}
+	}
+
+	for _, cfg := range old.TunnelConfigs {
+		if !newNames[cfg.Name] {
+			diff.Removed = append(diff.Removed, cfg.Name)
+		}
+	}
+
+	slices.Sort(diff.Added)
+	slices.Sort(diff.Removed)
+	slices.Sort(diff.Changed)
+
+	return diff
+}
+
+// changedFields returns the YAML names of the fields, other than the name, whose values differ between two tunnel
+// configs, sorted. Fields are compared as they would be written to a config file.
+func changedFields(old, new config.TunnelConfig) []string {
+	oldValue, newValue := reflect.ValueOf(old), reflect.ValueOf(new)
+	t := oldValue.Type()
+
+	var fields []string
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if !t.Field(i).IsExported() || name == "" || name == "-" || name == "name" {
+			continue
+		}
+
+		oldData, _ := yaml.Marshal(oldValue.Field(i).Interface())
+		newData, _ := yaml.Marshal(newValue.Field(i).Interface())
+		if string(oldData) != string(newData) {
+			fields = append(fields, name)
+		}
+	}
+
+	slices.Sort(fields)
+
+	return fields
+}
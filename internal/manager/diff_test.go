@@ -0,0 +1,138 @@
+package manager
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pperesbr/conduit/internal/config"
+	"github.com/pperesbr/conduit/internal/tunnel"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	bastion := tunnel.SSHConfig{User: "testuser", Password: "testpass", Host: "bastion.com", Port: 22}
+	db := config.TunnelConfig{Name: "db", RemoteHost: "db.internal", RemotePort: 5432, LocalPort: 15432}
+	cache := config.TunnelConfig{Name: "cache", RemoteHost: "cache.internal", RemotePort: 6379, LocalPort: 16379}
+	old := &config.Config{SSH: bastion, TunnelConfigs: []config.TunnelConfig{db, cache}}
+
+	with := func(cfg config.TunnelConfig, change func(*config.TunnelConfig)) config.TunnelConfig {
+		change(&cfg)
+		return cfg
+	}
+	otherBastion := &tunnel.SSHConfig{User: "testuser", Password: "testpass", Host: "bastion-2.com"}
+
+	tests := []struct {
+		name    string
+		new     *config.Config
+		want    ConfigDiff
+		changes map[string]TunnelChange
+	}{
+		{
+			name: "no changes",
+			new:  &config.Config{SSH: bastion, TunnelConfigs: []config.TunnelConfig{cache, db}},
+			want: ConfigDiff{},
+		},
+		{
+			name: "added and removed",
+			new: &config.Config{SSH: bastion, TunnelConfigs: []config.TunnelConfig{
+				db,
+				{Name: "queue", RemoteHost: "mq.internal", RemotePort: 5672, LocalPort: 15672},
+				{Name: "api", RemoteHost: "api.internal", RemotePort: 443, LocalPort: 10443},
+			}},
+			want: ConfigDiff{Added: []string{"api", "queue"}, Removed: []string{"cache"}},
+		},
+		{
+			name: "fields changed",
+			new: &config.Config{SSH: bastion, TunnelConfigs: []config.TunnelConfig{
+				with(db, func(c *config.TunnelConfig) { c.RemotePort, c.LocalPort = 5433, 15433 }),
+				cache,
+			}},
+			want: ConfigDiff{Changed: []string{"db"}},
+			changes: map[string]TunnelChange{
+				"db": {Fields: []string{"localPort", "remotePort"}, Restart: true},
+			},
+		},
+		{
+			name: "windows updated in place",
+			new: &config.Config{SSH: bastion, TunnelConfigs: []config.TunnelConfig{
+				with(db, func(c *config.TunnelConfig) { c.Maintenance = []string{"Sun 02:00-04:00"} }),
+				with(cache, func(c *config.TunnelConfig) { c.Access = []string{"Mon-Fri 09:00-18:00"} }),
+			}},
+			want: ConfigDiff{Changed: []string{"cache", "db"}},
+			changes: map[string]TunnelChange{
+				"cache": {Fields: []string{"access"}},
+				"db":    {Fields: []string{"maintenance"}},
+			},
+		},
+		{
+			name: "ssh block added",
+			new: &config.Config{SSH: bastion, TunnelConfigs: []config.TunnelConfig{
+				with(db, func(c *config.TunnelConfig) { c.SSH = otherBastion }),
+				cache,
+			}},
+			want: ConfigDiff{Changed: []string{"db"}},
+			changes: map[string]TunnelChange{
+				"db": {Fields: []string{"ssh"}, SSH: true, Restart: true},
+			},
+		},
+		{
+			name: "top-level ssh changed",
+			new: &config.Config{SSH: *otherBastion, TunnelConfigs: []config.TunnelConfig{
+				db,
+				cache,
+			}},
+			want: ConfigDiff{SSHChanged: true},
+		},
+		{
+			name: "probe updated in place",
+			new: &config.Config{SSH: bastion, TunnelConfigs: []config.TunnelConfig{
+				db,
+				with(cache, func(c *config.TunnelConfig) { c.Probe.Interval = time.Minute }),
+			}},
+			want: ConfigDiff{Changed: []string{"cache"}},
+			changes: map[string]TunnelChange{
+				"cache": {Fields: []string{"probe"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DiffConfigs(old, tt.new)
+
+			if tt.changes == nil {
+				tt.changes = map[string]TunnelChange{}
+			}
+			if !reflect.DeepEqual(got.Tunnels, tt.changes) {
+				t.Errorf("expected changes %+v, got %+v", tt.changes, got.Tunnels)
+			}
+
+			got.Tunnels = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+			if got.Empty() != (len(tt.want.Added)+len(tt.want.Removed)+len(tt.want.Changed) == 0) {
+				t.Errorf("unexpected Empty() for %+v", got)
+			}
+		})
+	}
+}
+
+func TestDiffConfigs_SSHBlocksCompareBySettings(t *testing.T) {
+	block := func() *tunnel.SSHConfig {
+		return &tunnel.SSHConfig{User: "testuser", Password: "testpass", Host: "127.0.0.1", Port: 22,
+			InsecureIgnoreHostKey: true}
+	}
+
+	validated := block()
+	if err := validated.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	old := &config.Config{TunnelConfigs: []config.TunnelConfig{{Name: "db", RemoteHost: "db", RemotePort: 1, SSH: validated}}}
+	new := &config.Config{TunnelConfigs: []config.TunnelConfig{{Name: "db", RemoteHost: "db", RemotePort: 1, SSH: block()}}}
+
+	if diff := DiffConfigs(old, new); !diff.Empty() {
+		t.Errorf("expected equal ssh blocks to compare equal regardless of derived state, got %+v", diff)
+	}
+}
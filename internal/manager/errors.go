@@ -0,0 +1,63 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors the Manager returns, wrapped with the name of the tunnel concerned, for callers to tell apart with errors.Is.
+var (
+	ErrTunnelNotFound = errors.New("tunnel not found")
+	ErrTunnelExists   = errors.New("tunnel already exists")
+	ErrTunnelDisabled = errors.New("tunnel is disabled")
+	ErrTunnelPaused   = errors.New("tunnel is paused")
+)
+
+// tunnelError is one of the sentinel errors above with a message naming the tunnel.
+type tunnelError struct {
+	msg string
+	err error
+}
+
+func (e *tunnelError) Error() string { return e.msg }
+
+func (e *tunnelError) Unwrap() error { return e.err }
+
+// notFound returns an error matching ErrTunnelNotFound for the named tunnel.
+func notFound(name string) error {
+	return &tunnelError{msg: fmt.Sprintf("tunnel %s not found", name), err: ErrTunnelNotFound}
+}
+
+// alreadyExists returns an error matching ErrTunnelExists for the named tunnel.
+func alreadyExists(name string) error {
+	return &tunnelError{msg: fmt.Sprintf("tunnel %s already exists", name), err: ErrTunnelExists}
+}
+
+// notStartable returns an error matching ErrTunnelDisabled or ErrTunnelPaused for the named tunnel, or nil when it may
+// be started.
+func notStartable(name string, disabled, paused bool) error {
+	switch {
+	case disabled:
+		return &tunnelError{msg: fmt.Sprintf("tunnel %s is disabled", name), err: ErrTunnelDisabled}
+	case paused:
+		return &tunnelError{msg: fmt.Sprintf("tunnel %s is paused", name), err: ErrTunnelPaused}
+	}
+	return nil
+}
+
+// StartError reports that a tunnel failed to start or, when Restart is set, to come back up after being restarted. Err
+// is the cause, such as the SSH connection failing.
+type StartError struct {
+	Name    string
+	Restart bool
+	Err     error
+}
+
+func (e *StartError) Error() string {
+	if e.Restart {
+		return fmt.Sprintf("failed to restart tunnel %s: %v", e.Name, e.Err)
+	}
+	return fmt.Sprintf("failed to start tunnel %s: %v", e.Name, e.Err)
+}
+
+func (e *StartError) Unwrap() error { return e.Err }
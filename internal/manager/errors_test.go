@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pperesbr/conduit/internal/config"
+)
+
+// TestErrors_MatchSentinelsAndTypes verifies that the manager's errors can be told apart with errors.Is and errors.As
+// while keeping their messages.
+func TestErrors_MatchSentinelsAndTypes(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	for name, err := range map[string]error{
+		"Start":   mgr.Start("missing"),
+		"Stop":    mgr.Stop("missing"),
+		"Restart": mgr.Restart("missing"),
+		"Remove":  mgr.Remove("missing"),
+	} {
+		if !errors.Is(err, ErrTunnelNotFound) || err.Error() != "tunnel missing not found" {
+			t.Errorf("%s: expected ErrTunnelNotFound naming the tunnel, got %v", name, err)
+		}
+	}
+
+	disabled := false
+	db := config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521}
+	off := config.TunnelConfig{Name: "off", RemoteHost: "127.0.0.1", RemotePort: 1522, Enabled: &disabled}
+	unreachable := *sshCfg
+	unreachable.Port = freePort(t)
+	broken := config.TunnelConfig{Name: "broken", RemoteHost: "127.0.0.1", RemotePort: 1523, SSH: &unreachable}
+	for _, cfg := range []config.TunnelConfig{db, off, broken} {
+		if err := mgr.Add(cfg); err != nil {
+			t.Fatalf("failed to add %s: %v", cfg.Name, err)
+		}
+	}
+
+	if err := mgr.Add(db); !errors.Is(err, ErrTunnelExists) || err.Error() != "tunnel db already exists" {
+		t.Errorf("expected ErrTunnelExists, got %v", err)
+	}
+	if err := mgr.Start("off"); !errors.Is(err, ErrTunnelDisabled) {
+		t.Errorf("expected ErrTunnelDisabled, got %v", err)
+	}
+	if err := mgr.Pause("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mgr.Restart("db"); !errors.Is(err, ErrTunnelPaused) {
+		t.Errorf("expected ErrTunnelPaused, got %v", err)
+	}
+
+	var startErr *StartError
+	if err := mgr.Start("broken"); !errors.As(err, &startErr) || startErr.Name != "broken" || startErr.Restart {
+		t.Errorf("expected a StartError for broken, got %v", err)
+	}
+	if err := mgr.Restart("broken"); !errors.As(err, &startErr) || !startErr.Restart {
+		t.Errorf("expected a restart StartError for broken, got %v", err)
+	} else if want := "failed to restart tunnel broken: " + startErr.Err.Error(); err.Error() != want {
+		t.Errorf("expected message %q, got %q", want, err.Error())
+	}
+}
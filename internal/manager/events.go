@@ -0,0 +1,85 @@
+package manager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pperesbr/conduit/internal/tunnel"
+)
+
+// eventBuffer is how many events a subscriber's channel holds before further events for it are dropped.
+const eventBuffer = 64
+
+// Event reports a tunnel changing status, such as from running to error, at Time. When the change ends a start, stop,
+// or reconnect, Duration is how long that operation took, SSH handshake included; a restart reports its stop and its
+// start apart. Duration is 0 for a change beginning an operation and for failures noticed while running.
+type Event struct {
+	Tunnel   string
+	From     tunnel.Status
+	To       tunnel.Status
+	Time     time.Time
+	Duration time.Duration
+}
+
+// eventHub fans tunnel events out to subscribers without ever blocking the tunnel reporting them.
+type eventHub struct {
+	mu     sync.Mutex
+	subs   []chan Event
+	closed bool
+}
+
+// Events subscribes to the status changes of every tunnel, including ones added later, for as long as the Manager
+// runs. Each call returns a new channel buffering up to 64 events. Events are sent without waiting, so a subscriber
+// that falls further behind misses the events that do not fit, rather than stalling the tunnels; Status and Snapshot
+// tell where things stand after a gap. The channel is closed by Close.
+func (m *Manager) Events() <-chan Event {
+	ch := make(chan Event, eventBuffer)
+
+	m.events.mu.Lock()
+	defer m.events.mu.Unlock()
+
+	if m.events.closed {
+		close(ch)
+		return ch
+	}
+	m.events.subs = append(m.events.subs, ch)
+
+	return ch
+}
+
+// publish sends event to every subscriber with room for it. It never blocks, since it runs with the reporting
+// tunnel's lock held.
+func (h *eventHub) publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, ch := range h.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// close closes every subscriber's channel; events published afterwards are discarded.
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+
+	for _, ch := range h.subs {
+		close(ch)
+	}
+	h.subs = nil
+}
+
+// statusFunc returns the hook reporting the named tunnel's status changes as events.
+func (m *Manager) statusFunc(name string) tunnel.StatusFunc {
+	return func(from, to tunnel.Status, took time.Duration) {
+		m.events.publish(Event{Tunnel: name, From: from, To: to, Time: time.Now(), Duration: took})
+	}
+}
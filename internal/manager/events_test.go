@@ -0,0 +1,126 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pperesbr/conduit/internal/config"
+	"github.com/pperesbr/conduit/internal/tunnel"
+)
+
+func TestEvents_ReportTransitionsToEverySubscriber(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	first, second := mgr.Events(), mgr.Events()
+
+	if err := mgr.AddAndStart(config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 5432}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mgr.Stop("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Event{
+		{Tunnel: "db", From: tunnel.StatusStopped, To: tunnel.StatusStarting},
+		{Tunnel: "db", From: tunnel.StatusStarting, To: tunnel.StatusRunning},
+		{Tunnel: "db", From: tunnel.StatusRunning, To: tunnel.StatusStopped},
+	}
+
+	for _, events := range []<-chan Event{first, second} {
+		for _, w := range want {
+			select {
+			case got := <-events:
+				if got.Tunnel != w.Tunnel || got.From != w.From || got.To != w.To || got.Time.IsZero() {
+					t.Errorf("expected %s %s -> %s, got %+v", w.Tunnel, w.From, w.To, got)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("expected %s %s -> %s, got nothing", w.Tunnel, w.From, w.To)
+			}
+		}
+	}
+
+	if err := mgr.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, events := range []<-chan Event{first, second, mgr.Events()} {
+		if _, open := <-events; open {
+			t.Error("expected Close to close every subscriber's channel")
+		}
+	}
+}
+
+// TestEvents_CarryOperationDurations verifies that the events ending a start, reconnect, restart, and stop report how
+// long the operation took, while the events beginning one report none.
+func TestEvents_CarryOperationDurations(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.Close()
+	events := mgr.Events()
+
+	if err := mgr.AddAndStart(config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 5432}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, op := range []func(string) error{mgr.Reconnect, mgr.Restart, mgr.Stop} {
+		if err := op("db"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Start, reconnect, restart as a stop and a start, then stop.
+	want := []tunnel.Status{
+		tunnel.StatusStarting, tunnel.StatusRunning,
+		tunnel.StatusStarting, tunnel.StatusRunning,
+		tunnel.StatusStopped, tunnel.StatusStarting, tunnel.StatusRunning,
+		tunnel.StatusStopped,
+	}
+	for _, to := range want {
+		select {
+		case got := <-events:
+			if got.To != to {
+				t.Fatalf("expected a change to %s, got %+v", to, got)
+			}
+			if to == tunnel.StatusStarting && got.Duration != 0 {
+				t.Errorf("expected no duration on %s -> %s, got %s", got.From, got.To, got.Duration)
+			}
+			if to != tunnel.StatusStarting && (got.Duration <= 0 || got.Duration > 5*time.Second) {
+				t.Errorf("expected a plausible duration on %s -> %s, got %s", got.From, got.To, got.Duration)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected a change to %s, got nothing", to)
+		}
+	}
+}
+
+func TestEvents_SlowSubscriberDropsEvents(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.Close()
+
+	events := mgr.Events()
+	_ = mgr.Add(config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 5432})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range eventBuffer {
+			_ = mgr.Start("db")
+			_ = mgr.Stop("db")
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected a subscriber that does not read to never block the tunnels")
+	}
+
+	if len(events) != eventBuffer {
+		t.Errorf("expected the subscriber's buffer to be full with %d events, got %d", eventBuffer, len(events))
+	}
+}
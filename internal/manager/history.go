@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"regexp"
+	"sort"
+	"time"
+)
+
+// maxErrorHistory bounds how many distinct errors are remembered per tunnel; the least recently seen is evicted first.
+const maxErrorHistory = 10
+
+// digitsPattern matches runs of digits, which vary between otherwise identical errors (ports, PIDs, durations).
+var digitsPattern = regexp.MustCompile(`[0-9]+`)
+
+// ErrorRecord aggregates every occurrence of one class of error for a tunnel.
+type ErrorRecord struct {
+	Class     string
+	Message   string
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// errorHistory keeps a bounded set of distinct errors for a single tunnel, keyed by their classified message.
+type errorHistory struct {
+	records map[string]*ErrorRecord
+}
+
+// newErrorHistory creates an empty errorHistory.
+func newErrorHistory() *errorHistory {
+	return &errorHistory{records: make(map[string]*ErrorRecord)}
+}
+
+// record adds an occurrence of err, merging it into an existing record of the same class or evicting the stalest
+// record to make room for a new one.
+func (h *errorHistory) record(err error, now time.Time) {
+	class := classifyError(err)
+
+	if rec, ok := h.records[class]; ok {
+		rec.Count++
+		rec.Message = err.Error()
+		rec.LastSeen = now
+		return
+	}
+
+	if len(h.records) >= maxErrorHistory {
+		var stalest *ErrorRecord
+		for _, rec := range h.records {
+			if stalest == nil || rec.LastSeen.Before(stalest.LastSeen) {
+				stalest = rec
+			}
+		}
+		delete(h.records, stalest.Class)
+	}
+
+	h.records[class] = &ErrorRecord{
+		Class:     class,
+		Message:   err.Error(),
+		Count:     1,
+		FirstSeen: now,
+		LastSeen:  now,
+	}
+}
+
+// list returns a copy of the records, most recently seen first.
+func (h *errorHistory) list() []ErrorRecord {
+	records := make([]ErrorRecord, 0, len(h.records))
+	for _, rec := range h.records {
+		records = append(records, *rec)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].LastSeen.After(records[j].LastSeen)
+	})
+
+	return records
+}
+
+// classifyError reduces an error to a message that is identical for repeated occurrences of the same failure.
+func classifyError(err error) string {
+	return digitsPattern.ReplaceAllString(err.Error(), "N")
+}
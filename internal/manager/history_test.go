@@ -0,0 +1,58 @@
+package manager
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestErrorHistory_ClassifiesByMessageShape verifies that errors differing only in numbers share a record.
+func TestErrorHistory_ClassifiesByMessageShape(t *testing.T) {
+	h := newErrorHistory()
+	now := time.Now()
+
+	h.record(fmt.Errorf("dial tcp 10.0.0.1:40001: connection refused"), now)
+	h.record(fmt.Errorf("dial tcp 10.0.0.1:40002: connection refused"), now.Add(time.Second))
+
+	records := h.list()
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d: %+v", len(records), records)
+	}
+
+	if records[0].Count != 2 {
+		t.Errorf("expected count 2, got %d", records[0].Count)
+	}
+
+	if records[0].Message != "dial tcp 10.0.0.1:40002: connection refused" {
+		t.Errorf("expected the latest message to be kept, got %q", records[0].Message)
+	}
+
+	if !records[0].FirstSeen.Equal(now) || !records[0].LastSeen.Equal(now.Add(time.Second)) {
+		t.Errorf("unexpected timestamps: %+v", records[0])
+	}
+}
+
+// TestErrorHistory_EvictsStalest verifies that the history stays bounded by dropping the least recently seen error.
+func TestErrorHistory_EvictsStalest(t *testing.T) {
+	h := newErrorHistory()
+	now := time.Now()
+
+	for i := range maxErrorHistory + 1 {
+		h.record(fmt.Errorf("error %c", 'a'+i), now.Add(time.Duration(i)*time.Second))
+	}
+
+	records := h.list()
+	if len(records) != maxErrorHistory {
+		t.Fatalf("expected %d records, got %d", maxErrorHistory, len(records))
+	}
+
+	for _, rec := range records {
+		if rec.Message == "error a" {
+			t.Error("expected the stalest error to be evicted")
+		}
+	}
+
+	if records[0].Message != fmt.Sprintf("error %c", 'a'+maxErrorHistory) {
+		t.Errorf("expected the newest error first, got %q", records[0].Message)
+	}
+}
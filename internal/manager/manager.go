@@ -1,42 +1,272 @@
 package manager
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pperesbr/conduit/internal/config"
-	"github.com/pperesbr/gokit/pkg/tunnel"
+	"github.com/pperesbr/conduit/internal/probe"
+	"github.com/pperesbr/conduit/internal/schedule"
+	"github.com/pperesbr/conduit/internal/tunnel"
 )
 
-// HealthStatus represents the health and status information for a specific tunnel.
+// HealthStatus represents the health and status information for a specific tunnel. Retries counts the automatic
+// restarts that have failed in a row; once it reaches autoRestart.maxRetries the manager has given up on the tunnel.
+// Tags are the tunnel's configured tags, for grouping results. LocalPort is the port a running tunnel listens on,
+// including one picked for localPort 0, and is 0 otherwise and for reverse and socket tunnels. StartedAt is when a
+// running tunnel last started, including automatic restarts, and LastConnectedAt when its SSH connection was last
+// established, which a reconnect moves on without restarting the tunnel; both are zero unless the tunnel is running.
 type HealthStatus struct {
-	Name    string
-	Status  tunnel.Status
-	Error   error
-	Healthy bool
+	Name        string
+	Tags        []string
+	Status      tunnel.Status
+	LocalPort   int
+	Error       error
+	Healthy     bool
+	Stuck       bool
+	Maintenance bool
+	ProbeError  error
+	Retries     int
+
+	StartedAt       time.Time
+	LastConnectedAt time.Time
+}
+
+// Uptime returns how long the tunnel has been running since it last started, or 0 when it is not running.
+func (h HealthStatus) Uptime(now time.Time) time.Duration {
+	if h.StartedAt.IsZero() {
+		return 0
+	}
+	return now.Sub(h.StartedAt)
+}
+
+// defaultProbeTimeout bounds a single health probe when the tunnel's probe config does not set a timeout.
+const defaultProbeTimeout = 5 * time.Second
+
+// errCanaryPending marks a restarted tunnel whose canary connection has not succeeded yet.
+var errCanaryPending = errors.New("canary pending after restart")
+
+// healthPollInterval is how often WaitUntilHealthy checks the health of the tunnels it waits for.
+const healthPollInterval = 50 * time.Millisecond
+
+// portReleaseTimeout bounds how long Reconcile waits for a stopped tunnel's local port to become bindable again.
+const portReleaseTimeout = 2 * time.Second
+
+// portCommandTimeout bounds how long a remotePortCommand may run before the start attempt fails.
+const portCommandTimeout = 10 * time.Second
+
+// DesiredState represents the state a tunnel is intended to be in, as expressed through Add, Start, and Stop calls.
+type DesiredState string
+
+const (
+	DesiredStopped DesiredState = "stopped"
+	DesiredRunning DesiredState = "running"
+	// DesiredPaused records a paused tunnel in saved state; a paused tunnel's desired state is DesiredStopped otherwise.
+	DesiredPaused DesiredState = "paused"
+)
+
+// TunnelSnapshot captures the desired and actual state of a tunnel at a single point in time.
+type TunnelSnapshot struct {
+	Name        string
+	Desired     DesiredState
+	Actual      tunnel.Status
+	Error       error
+	Diverged    bool
+	Stuck       bool
+	Maintenance bool
+	Connection  tunnel.ConnectionInfo
+	Phases      tunnel.PhaseStats
+	// RemoteDialAddr is the address the most recent forwarded connection was opened to.
+	RemoteDialAddr string
+	// Parked is set when the tunnel exhausted its retry budget; RetriesLeft is -1 for tunnels without a budget.
+	Parked      bool
+	RetriesLeft int
+	// Restarts counts the successful restarts and reconnects made through the manager, including automatic ones.
+	// StartedAt and LastConnectedAt are as in HealthStatus.
+	Restarts        int
+	StartedAt       time.Time
+	LastConnectedAt time.Time
+}
+
+// Summary counts tunnels by state and health for dashboards that do not need per-tunnel detail.
+type Summary struct {
+	Total     int
+	Running   int
+	Starting  int
+	Stopped   int
+	Errored   int
+	Disabled  int
+	Paused    int
+	Healthy   int
+	Unhealthy int
+	// UnhealthyNames lists the unhealthy tunnels, sorted by name.
+	UnhealthyNames []string
+}
+
+// PeriodTotals records a tunnel's traffic during one completed accounting period, captured just before the scheduled
+// stats reset that ended it.
+type PeriodTotals struct {
+	Start       time.Time
+	End         time.Time
+	BytesIn     int64
+	BytesOut    int64
+	Connections int64
+}
+
+// statsPeriod tracks the current accounting period of a tunnel with a scheduled stats reset.
+type statsPeriod struct {
+	boundary schedule.Boundary
+	start    time.Time
+	previous *PeriodTotals
+}
+
+// Watcher is implemented by components that react to configuration changes while the Manager runs, such as the config file watcher.
+type Watcher interface {
+	Start() error
+	Stop() error
 }
 
 // Manager manages SSH tunnels, their configurations, and controls their lifecycle, including start, stop, and restart.
 type Manager struct {
-	sshConfig   *tunnel.SSHConfig
-	tunnels     map[string]*tunnel.Tunnel
-	configs     map[string]config.TunnelConfig
-	tunnelDones map[string]chan struct{}
-	done        chan struct{}
-	mu          sync.RWMutex
+	sshConfig     *tunnel.SSHConfig
+	servers       map[string]*tunnel.SSHConfig
+	tunnels       map[string]*tunnel.Tunnel
+	configs       map[string]config.TunnelConfig
+	desired       map[string]DesiredState
+	wantedSince   map[string]time.Time
+	tunnelDones   map[string]chan struct{}
+	startup       config.StartupConfig
+	shutdown      config.ShutdownConfig
+	stuckAfter    time.Duration
+	stuckWarned   map[string]bool
+	errHistory    map[string]*errorHistory
+	maintenance   map[string]schedule.Schedule
+	access        map[string]schedule.Schedule
+	probeDones    map[string]chan struct{}
+	probeErrors   map[string]error
+	probeStreaks  map[string]*probeStreak
+	probeRestart  map[string]bool
+	canaryErrors  map[string]error
+	budgets       map[string]*retryBudget
+	restarts      map[string]int
+	retries       map[string]int
+	appProbes     map[string]probe.AppProbe
+	taps          map[string]tunnel.TapFunc
+	periods       map[string]*statsPeriod
+	paused        map[string]bool
+	relayPool     *tunnel.RelayPool
+	relayWorkers  int
+	reconcileMode string
+	stateFile     string
+	socketDir     string
+	events        eventHub
+	clock         func() time.Time
+	logs          atomic.Pointer[slog.Logger]
+	started       chan struct{}
+	startedOnce   sync.Once
+	done          chan struct{}
+	mu            sync.RWMutex
 }
 
 // NewManager initializes and returns a new instance of Manager to manage SSH tunnels and their configurations.
 func NewManager(sshConfig *tunnel.SSHConfig) *Manager {
 	return &Manager{
-		sshConfig:   sshConfig,
-		tunnels:     make(map[string]*tunnel.Tunnel),
-		configs:     make(map[string]config.TunnelConfig),
-		tunnelDones: make(map[string]chan struct{}),
-		done:        make(chan struct{}),
+		sshConfig:    sshConfig,
+		servers:      make(map[string]*tunnel.SSHConfig),
+		tunnels:      make(map[string]*tunnel.Tunnel),
+		configs:      make(map[string]config.TunnelConfig),
+		desired:      make(map[string]DesiredState),
+		wantedSince:  make(map[string]time.Time),
+		tunnelDones:  make(map[string]chan struct{}),
+		stuckWarned:  make(map[string]bool),
+		errHistory:   make(map[string]*errorHistory),
+		maintenance:  make(map[string]schedule.Schedule),
+		access:       make(map[string]schedule.Schedule),
+		probeDones:   make(map[string]chan struct{}),
+		probeErrors:  make(map[string]error),
+		probeStreaks: make(map[string]*probeStreak),
+		probeRestart: make(map[string]bool),
+		canaryErrors: make(map[string]error),
+		budgets:      make(map[string]*retryBudget),
+		restarts:     make(map[string]int),
+		retries:      make(map[string]int),
+		appProbes:    make(map[string]probe.AppProbe),
+		taps:         make(map[string]tunnel.TapFunc),
+		periods:      make(map[string]*statsPeriod),
+		paused:       make(map[string]bool),
+		clock:        time.Now,
+		started:      make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// SetLogger sets the logger the manager reports tunnel lifecycle, reconcile, and health events to, with the tunnel name,
+// status, and error as attributes; it defaults to slog.Default.
+func (m *Manager) SetLogger(logger *slog.Logger) {
+	m.logs.Store(logger)
+}
+
+// logger returns the logger set with SetLogger, or slog.Default when none was.
+func (m *Manager) logger() *slog.Logger {
+	if logger := m.logs.Load(); logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
+// SetClock replaces the function used to read the current time when evaluating schedules; it defaults to time.Now.
+func (m *Manager) SetClock(now func() time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = now
+}
+
+// SetRelayWorkers bounds how many forwarded connections all tunnels relay at once, queuing the rest; 0 removes the limit.
+// It applies to every tunnel, including those added later, and is updated by Reconcile from relay.workers. Connections
+// already relayed keep their slots in the previous pool until they close.
+func (m *Manager) SetRelayWorkers(workers int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.relayWorkers = workers
+	m.relayPool = nil
+	if workers > 0 {
+		m.relayPool = tunnel.NewRelayPool(workers)
 	}
+
+	for _, tun := range m.tunnels {
+		tun.SetRelayPool(m.relayPool)
+	}
+}
+
+// SetStartupPolicy configures how StartAll spreads out and retries the initial tunnel connections.
+func (m *Manager) SetStartupPolicy(policy config.StartupConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.startup = policy
+}
+
+// SetShutdownPolicy configures how long Run lets tunnels drain in total when it shuts down.
+func (m *Manager) SetShutdownPolicy(policy config.ShutdownConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.shutdown = policy
 }
 
 // Add registers a new tunnel configuration and initializes the associated SSH tunnel if the name is not already in use.
@@ -45,54 +275,162 @@ func (m *Manager) Add(cfg config.TunnelConfig) error {
 	defer m.mu.Unlock()
 
 	if _, exists := m.tunnels[cfg.Name]; exists {
-		return fmt.Errorf("tunnel %s already exists", cfg.Name)
+		return alreadyExists(cfg.Name)
 	}
 
-	tun := tunnel.NewTunnel(m.sshConfig, cfg.RemoteHost, cfg.RemotePort, cfg.LocalPort)
-	m.tunnels[cfg.Name] = tun
+	maintenance, err := schedule.Parse(cfg.Maintenance)
+	if err != nil {
+		return fmt.Errorf("tunnel %s maintenance: %w", cfg.Name, err)
+	}
+
+	access, err := schedule.Parse(cfg.Access)
+	if err != nil {
+		return fmt.Errorf("tunnel %s access: %w", cfg.Name, err)
+	}
+
+	server, err := m.serverFor(cfg)
+	if err != nil {
+		return fmt.Errorf("tunnel %s ssh: %w", cfg.Name, err)
+	}
+
+	m.tunnels[cfg.Name] = m.newTunnel(cfg, server)
 	m.configs[cfg.Name] = cfg
+	m.desired[cfg.Name] = DesiredStopped
+	m.errHistory[cfg.Name] = newErrorHistory()
+	m.maintenance[cfg.Name] = maintenance
+	m.access[cfg.Name] = access
+	m.initStatsPeriodLocked(cfg)
+
+	if cfg.Probe.Mode != "" {
+		m.startProbeLocked(cfg.Name, cfg.Probe.Interval)
+	}
 
 	return nil
 }
 
+// AddAndStart registers and starts a tunnel as a single operation. If the start fails, the tunnel is removed again
+// unless keepOnFailure is set, in which case it stays registered in the error state with its desired state running so
+// auto-restart or the controller can bring it up later. Either way, the start failure is returned.
+func (m *Manager) AddAndStart(cfg config.TunnelConfig, keepOnFailure bool) error {
+	if err := m.Add(cfg); err != nil {
+		return err
+	}
+
+	err := m.Start(cfg.Name)
+	if err == nil || keepOnFailure {
+		return err
+	}
+
+	if removeErr := m.Remove(cfg.Name); removeErr != nil {
+		return fmt.Errorf("%w (rollback failed: %v)", err, removeErr)
+	}
+
+	return err
+}
+
 // Remove stops and removes the specified tunnel by name, along with its configuration, if it exists.
 func (m *Manager) Remove(name string) error {
 	m.stopAutoRestartForTunnel(name)
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
+	m.mu.RLock()
 	tun, exists := m.tunnels[name]
+	grace := m.configs[name].ShutdownGrace
+	m.mu.RUnlock()
+
 	if !exists {
-		return fmt.Errorf("tunnel %s not found", name)
+		return notFound(name)
 	}
 
 	if tun.Status() == tunnel.StatusRunning {
-		if err := tun.Stop(); err != nil {
+		if err := m.stopGracefully(context.Background(), name, tun, grace); err != nil {
 			return fmt.Errorf("failed to stop tunnel %s: %w", name, err)
 		}
 	}
 
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	delete(m.tunnels, name)
 	delete(m.configs, name)
+	delete(m.desired, name)
+	delete(m.wantedSince, name)
+	delete(m.stuckWarned, name)
+	delete(m.errHistory, name)
+	delete(m.maintenance, name)
+	delete(m.access, name)
+	delete(m.probeErrors, name)
+	delete(m.probeStreaks, name)
+	delete(m.probeRestart, name)
+	delete(m.canaryErrors, name)
+	delete(m.budgets, name)
+	delete(m.restarts, name)
+	delete(m.retries, name)
+	delete(m.appProbes, name)
+	delete(m.taps, name)
+	delete(m.periods, name)
+	delete(m.paused, name)
+	if done, exists := m.probeDones[name]; exists {
+		close(done)
+		delete(m.probeDones, name)
+	}
+	m.pruneServersLocked()
 
 	return nil
 }
 
 // Start attempts to start the tunnel identified by the given name, returning an error if it fails or doesn't exist.
 func (m *Manager) Start(name string) error {
+	return m.StartContext(context.Background(), name)
+}
+
+// StartContext is Start, but gives up connecting once ctx is done, leaving the tunnel in the error state.
+func (m *Manager) StartContext(ctx context.Context, name string) error {
+	m.resetRetries(name)
+	return m.start(ctx, name, nil)
+}
+
+// start starts the named tunnel like StartContext, without resetting its count of failed automatic restarts. A failed
+// connection is retried up to the tunnel's startRetries with backoff, until ctx is done or the tunnel is stopped,
+// replaced, or removed meanwhile; the last error is returned. Backoffs are waited out with wait, which reports whether
+// to go on, or by sleeping until ctx is done when wait is nil.
+func (m *Manager) start(ctx context.Context, name string, wait func(time.Duration) bool) error {
 	m.mu.RLock()
 	tun, exists := m.tunnels[name]
 	cfg, _ := m.configs[name]
 	m.mu.RUnlock()
 
 	if !exists {
-		return fmt.Errorf("tunnel %s not found", name)
+		return notFound(name)
 	}
 
-	if err := tun.Start(); err != nil {
-		return fmt.Errorf("failed to start tunnel %s: %w", name, err)
+	if err := notStartable(name, !cfg.IsEnabled(), m.isPaused(name)); err != nil {
+		return err
+	}
+
+	if wait == nil {
+		wait = func(d time.Duration) bool { return m.sleepContext(ctx, d) }
+	}
+
+	m.setDesired(name, DesiredRunning)
+
+	err := tun.StartContext(ctx)
+	for attempt := 0; err != nil && attempt < cfg.StartRetries; attempt++ {
+		m.recordError(name, err)
+
+		delay := cfg.StartRetryDelay(attempt)
+		m.logger().Warn("failed to connect tunnel, retrying", "tunnel", name, "retry", attempt+1,
+			"retries", cfg.StartRetries, "delay", delay, "error", err)
+
+		if !wait(delay) || !m.stillWanted(name, tun) {
+			break
+		}
+		err = tun.StartContext(ctx)
+	}
+	if err != nil {
+		m.recordError(name, err)
+		return &StartError{Name: name, Err: err}
 	}
+	m.logger().Debug("tunnel started", "tunnel", name, "status", tun.Status())
 
 	if cfg.AutoRestart.Enabled {
 		m.startAutoRestartForTunnel(name, cfg.AutoRestart.Interval)
@@ -101,254 +439,1362 @@ func (m *Manager) Start(name string) error {
 	return nil
 }
 
+// stillWanted reports whether tun is still the named tunnel and desired running, so a start waiting to retry can tell it
+// was stopped, replaced, or removed meanwhile.
+func (m *Manager) stillWanted(name string, tun *tunnel.Tunnel) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.tunnels[name] == tun && m.desired[name] == DesiredRunning
+}
+
 // Stop halts the tunnel identified by the given name, ensuring it is no longer active. Returns an error if unsuccessful.
 func (m *Manager) Stop(name string) error {
 	m.stopAutoRestartForTunnel(name)
 
 	m.mu.RLock()
 	tun, exists := m.tunnels[name]
+	grace := m.configs[name].ShutdownGrace
 	m.mu.RUnlock()
 
 	if !exists {
-		return fmt.Errorf("tunnel %s not found", name)
+		return notFound(name)
 	}
 
-	if err := tun.Stop(); err != nil {
+	m.setDesired(name, DesiredStopped)
+
+	if err := m.stopGracefully(context.Background(), name, tun, grace); err != nil {
 		return fmt.Errorf("failed to stop tunnel %s: %w", name, err)
 	}
+	m.logger().Debug("tunnel stopped", "tunnel", name, "status", tun.Status())
 
 	return nil
 }
 
 // Restart attempts to restart the tunnel identified by the given name, returning an error if the tunnel doesn't exist or fails to restart.
 func (m *Manager) Restart(name string) error {
+	m.resetRetries(name)
+	return m.restart(name)
+}
+
+// restart restarts the named tunnel like Restart, without resetting its count of failed automatic restarts.
+func (m *Manager) restart(name string) error {
 	m.mu.RLock()
 	tun, exists := m.tunnels[name]
+	cfg := m.configs[name]
 	m.mu.RUnlock()
 
 	if !exists {
-		return fmt.Errorf("tunnel %s not found", name)
+		return notFound(name)
+	}
+
+	if err := notStartable(name, !cfg.IsEnabled(), m.isPaused(name)); err != nil {
+		return err
+	}
+
+	m.setDesired(name, DesiredRunning)
+
+	if err := m.stopGracefully(context.Background(), name, tun, cfg.ShutdownGrace); err != nil {
+		return fmt.Errorf("failed to restart tunnel %s: failed to stop: %w", name, err)
 	}
 
-	if err := tun.Restart(); err != nil {
-		return fmt.Errorf("failed to restart tunnel %s: %w", name, err)
+	if err := tun.Start(); err != nil {
+		m.recordError(name, err)
+		return &StartError{Name: name, Restart: true, Err: err}
 	}
+	m.countRestart(name)
 
 	return nil
 }
 
-// StartAll starts all registered SSH tunnels, returning a map of tunnel names to errors for any failures encountered.
-func (m *Manager) StartAll() map[string]error {
+// SetRunning makes the tunnel identified by the given name running or stopped regardless of its current state, updating
+// its desired state. It reports whether a start or stop was needed.
+func (m *Manager) SetRunning(name string, running bool) (bool, error) {
 	m.mu.RLock()
-	names := make([]string, 0, len(m.tunnels))
-	for name := range m.tunnels {
-		names = append(names, name)
-	}
+	tun, exists := m.tunnels[name]
 	m.mu.RUnlock()
 
-	errors := make(map[string]error)
-	for _, name := range names {
-		if err := m.Start(name); err != nil {
-			errors[name] = err
+	if !exists {
+		return false, notFound(name)
+	}
+
+	if running {
+		if tun.Status() == tunnel.StatusRunning {
+			m.setDesired(name, DesiredRunning)
+			return false, nil
 		}
+		return true, m.Start(name)
 	}
 
-	return errors
+	if tun.Status() == tunnel.StatusStopped {
+		m.stopAutoRestartForTunnel(name)
+		m.setDesired(name, DesiredStopped)
+		return false, nil
+	}
+	return true, m.Stop(name)
 }
 
-// StopAll stops all active tunnels managed by the Manager and returns a map of tunnel names to their associated stop errors.
-func (m *Manager) StopAll() map[string]error {
-	m.mu.Lock()
-	for name, done := range m.tunnelDones {
-		close(done)
-		delete(m.tunnelDones, name)
-	}
-	m.mu.Unlock()
+// Drain gracefully stops the tunnel identified by the given name, letting its open connections finish within timeout
+// before forcibly closing the rest. The tunnel is left stopped.
+func (m *Manager) Drain(name string, timeout time.Duration) (tunnel.DrainResult, error) {
+	m.stopAutoRestartForTunnel(name)
 
 	m.mu.RLock()
-	defer m.mu.RUnlock()
+	tun, exists := m.tunnels[name]
+	m.mu.RUnlock()
 
-	errors := make(map[string]error)
-	for name, tun := range m.tunnels {
-		if err := tun.Stop(); err != nil {
-			errors[name] = err
-		}
+	if !exists {
+		return tunnel.DrainResult{}, notFound(name)
 	}
 
-	return errors
-}
+	m.setDesired(name, DesiredStopped)
 
-// Get returns the tunnel associated with the given name or nil if no such tunnel exists.
-func (m *Manager) Get(name string) *tunnel.Tunnel {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	result, err := tun.Drain(timeout)
+	if err != nil {
+		return result, fmt.Errorf("failed to drain tunnel %s: %w", name, err)
+	}
 
-	return m.tunnels[name]
+	return result, nil
 }
 
-// List returns a slice of strings containing the names of all registered SSH tunnels managed by the Manager.
-func (m *Manager) List() []string {
+// Reconnect rebuilds the SSH connection of the tunnel identified by the given name while keeping its local listener bound.
+func (m *Manager) Reconnect(name string) error {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
+	tun, exists := m.tunnels[name]
+	m.mu.RUnlock()
 
-	names := make([]string, 0, len(m.tunnels))
-	for name := range m.tunnels {
-		names = append(names, name)
+	if !exists {
+		return notFound(name)
 	}
 
-	return names
+	if err := tun.Reconnect(); err != nil {
+		m.recordError(name, err)
+		return fmt.Errorf("failed to reconnect tunnel %s: %w", name, err)
+	}
+	m.countRestart(name)
+
+	return nil
 }
 
-// Status returns the status of all managed tunnels as a map of tunnel names to their current statuses.
-func (m *Manager) Status() map[string]tunnel.Status {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// Pause stops the tunnel identified by the given name and keeps it stopped, with its config, until Resume is called. A
+// paused tunnel is reported as tunnel.StatusPaused and counts as healthy; StartAll, the controller, and reloads leave
+// it alone, and starting it directly fails. Pausing a paused tunnel does nothing.
+func (m *Manager) Pause(name string) error {
+	// The pause is set before stopping so nothing restarts the tunnel meanwhile, and dropped again if it fails to stop.
+	m.mu.Lock()
+	_, exists := m.tunnels[name]
+	wasPaused := m.paused[name]
+	if exists {
+		m.paused[name] = true
+	}
+	m.mu.Unlock()
 
-	status := make(map[string]tunnel.Status)
-	for name, tun := range m.tunnels {
-		status[name] = tun.Status()
+	if !exists {
+		return notFound(name)
 	}
 
-	return status
+	if err := m.Stop(name); err != nil {
+		if !wasPaused {
+			m.mu.Lock()
+			delete(m.paused, name)
+			m.mu.Unlock()
+		}
+		return err
+	}
+	m.logger().Info("tunnel paused", "tunnel", name)
+
+	return nil
 }
 
-// Stats retrieves statistics for all managed tunnels as a map of tunnel names to their respective stats.
-func (m *Manager) Stats() map[string]tunnel.Stats {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// Resume clears the pause on the tunnel identified by the given name and starts it again, unless its config disables
+// it. It fails for a tunnel that is not paused.
+func (m *Manager) Resume(name string) error {
+	m.mu.Lock()
+	cfg, exists := m.configs[name]
+	paused := m.paused[name]
+	delete(m.paused, name)
+	m.mu.Unlock()
 
-	stats := make(map[string]tunnel.Stats)
-	for name, tun := range m.tunnels {
-		stats[name] = tun.Stats()
+	if !exists {
+		return notFound(name)
 	}
 
-	return stats
+	if !paused {
+		return fmt.Errorf("tunnel %s is not paused", name)
+	}
+	m.logger().Info("tunnel resumed", "tunnel", name)
+
+	if !cfg.IsEnabled() {
+		return nil
+	}
+	return m.Start(name)
 }
 
-// HealthCheck evaluates the health status of all managed tunnels and returns a slice of their HealthStatus.
-func (m *Manager) HealthCheck() []HealthStatus {
+// isPaused reports whether the named tunnel is paused.
+func (m *Manager) isPaused(name string) bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
+	return m.paused[name]
+}
 
-	results := make([]HealthStatus, 0, len(m.tunnels))
+// resetRetries clears the count of failed automatic restarts of the named tunnel, so auto-restart tries it again.
+func (m *Manager) resetRetries(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.retries, name)
+}
 
-	for name, tun := range m.tunnels {
-		status := tun.Status()
-		lastErr := tun.LastError()
-		healthy := status == tunnel.StatusRunning && lastErr == nil
+// autoRestart restarts the named tunnel on behalf of auto-restart, counting consecutive failures and logging when the
+// failure that reaches maxRetries makes the manager give up on it.
+func (m *Manager) autoRestart(name string, maxRetries int) error {
+	err := m.restart(name)
 
-		results = append(results, HealthStatus{
-			Name:    name,
-			Status:  status,
-			Error:   lastErr,
-			Healthy: healthy,
-		})
-	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	return results
-}
+	if _, exists := m.tunnels[name]; !exists {
+		return err
+	}
 
-// Unhealthy returns a slice of HealthStatus objects representing tunnels that are not in a healthy state.
-func (m *Manager) Unhealthy() []HealthStatus {
-	all := m.HealthCheck()
+	if err == nil {
+		delete(m.retries, name)
+		return nil
+	}
 
-	unhealthy := make([]HealthStatus, 0)
-	for _, h := range all {
-		if !h.Healthy {
-			unhealthy = append(unhealthy, h)
-		}
+	m.retries[name]++
+	if maxRetries > 0 && m.retries[name] == maxRetries {
+		m.logger().Error("giving up on tunnel until it is started or restarted",
+			"tunnel", name, "failedRestarts", maxRetries, "error", err)
 	}
 
-	return unhealthy
+	return err
 }
 
-// Reconcile updates the Manager's state to match the provided configuration, modifying tunnel configurations as needed.
-func (m *Manager) Reconcile(newConfig *config.Config) error {
+// countRestart records a successful restart or reconnect of the named tunnel.
+func (m *Manager) countRestart(name string) {
 	m.mu.Lock()
-	m.sshConfig = &newConfig.SSH
-	m.mu.Unlock()
+	defer m.mu.Unlock()
 
-	currentNames := make(map[string]bool)
-	for _, name := range m.List() {
-		currentNames[name] = true
+	if _, exists := m.tunnels[name]; exists {
+		m.restarts[name]++
 	}
+}
 
-	newNames := make(map[string]bool)
-	newConfigs := make(map[string]config.TunnelConfig)
-	for _, cfg := range newConfig.TunnelConfigs {
-		newNames[cfg.Name] = true
-		newConfigs[cfg.Name] = cfg
-	}
+// StartAll starts all registered SSH tunnels except disabled and paused ones, returning a map of tunnel names to errors for any
+// failures encountered. Starts are spread out, run up to startup.maxConcurrentStarts at a time, and retried according to the startup policy.
+// Tunnels start after the ones they depend on, and are skipped with an error when one of those did not start.
+func (m *Manager) StartAll() map[string]error {
+	return m.StartAllContext(context.Background())
+}
 
-	for name := range currentNames {
-		if !newNames[name] {
-			log.Printf("reconcile: removing tunnel %s", name)
-			if err := m.Remove(name); err != nil {
-				log.Printf("reconcile: failed to remove %s: %v", name, err)
-			}
+// StartAllContext is StartAll, but stops launching tunnels once ctx is cancelled, cutting off the start in progress with
+// ctx's error. Tunnels already started are left running for the caller to stop; those never attempted are not reported
+// as errors.
+func (m *Manager) StartAllContext(ctx context.Context) map[string]error {
+	return m.startAll(ctx, nil)
+}
+
+// startAll is StartAllContext, but also leaves out the tunnels in skip.
+func (m *Manager) startAll(ctx context.Context, skip map[string]bool) map[string]error {
+	m.mu.RLock()
+	configs := make([]config.TunnelConfig, 0, len(m.tunnels))
+	dependsOn := make(map[string][]string, len(m.tunnels))
+	for name := range m.tunnels {
+		if cfg := m.configs[name]; cfg.IsEnabled() && !m.paused[name] && !skip[name] {
+			configs = append(configs, cfg)
+			dependsOn[name] = cfg.DependsOn
 		}
 	}
+	policy := m.startup
+	m.mu.RUnlock()
 
-	for name, cfg := range newConfigs {
-		if !currentNames[name] {
-			log.Printf("reconcile: adding tunnel %s", name)
-			if err := m.Add(cfg); err != nil {
-				log.Printf("reconcile: failed to add %s: %v", name, err)
-				continue
-			}
-			if err := m.Start(name); err != nil {
-				log.Printf("reconcile: failed to start %s: %v", name, err)
+	waves := m.startOrder(configs)
+	slots := make(chan struct{}, max(policy.MaxConcurrentStarts, 1))
+
+	var errorsMu sync.Mutex
+	errors := make(map[string]error)
+	started := make(map[string]bool)
+	handled, launched := 0, 0
+
+	for _, wave := range waves {
+		var wg sync.WaitGroup
+
+		for _, name := range wave {
+			errorsMu.Lock()
+			dep := missingDependency(dependsOn[name], started)
+			if dep != "" {
+				errors[name] = fmt.Errorf("not started: dependency %s did not start", dep)
 			}
-		}
-	}
+			errorsMu.Unlock()
 
-	for name, newCfg := range newConfigs {
-		if currentNames[name] {
-			m.mu.RLock()
-			oldCfg, exists := m.configs[name]
-			m.mu.RUnlock()
+			if dep != "" {
+				m.logger().Warn("skipping tunnel, a dependency did not start", "tunnel", name, "dependency", dep)
+				handled++
+				continue
+			}
 
-			if exists && tunnelConfigChanged(oldCfg, newCfg) {
-				log.Printf("reconcile: tunnel %s changed, restarting", name)
+			if ctx.Err() != nil || launched > 0 && !m.sleepContext(ctx, policy.Stagger+jitter(policy.Jitter)) || !acquireSlot(ctx, slots) {
+				wg.Wait()
+				m.logger().Warn("startup interrupted", "notStarted", len(configs)-handled, "total", len(configs))
+				return errors
+			}
+			handled++
+			launched++
+
+			wg.Go(func() {
+				// The slot is given back while a failed start backs off, so the wait does not hold up other tunnels.
+				held := true
+				defer func() {
+					if held {
+						<-slots
+					}
+				}()
+				wait := func(d time.Duration) bool {
+					<-slots
+					held = false
+					if !m.sleepContext(ctx, d) || !acquireSlot(ctx, slots) {
+						return false
+					}
+					held = true
+					return true
+				}
 
-				m.mu.Lock()
-				m.configs[name] = newCfg
-				m.mu.Unlock()
+				err := m.startWithRetries(ctx, name, policy, wait)
 
-				if err := m.Restart(name); err != nil {
-					log.Printf("reconcile: failed to restart %s: %v", name, err)
+				errorsMu.Lock()
+				if err != nil {
+					errors[name] = err
+				} else {
+					started[name] = true
 				}
-			}
+				errorsMu.Unlock()
+			})
 		}
+
+		// Tunnels in the next wave depend on this one, so it has to be up, or have failed, before they are started.
+		wg.Wait()
 	}
 
-	return nil
+	return errors
 }
 
-// Close terminates the Manager, stops all tunnels, and releases resources. Returns an error if any tunnel fails to stop.
-func (m *Manager) Close() error {
-	close(m.done)
-	errors := m.StopAll()
+// startOrder groups the given tunnels into waves by their dependencies, as config.StartOrder does. Should the
+// dependencies form a cycle, which a validated config rules out, the tunnels are all started together instead.
+func (m *Manager) startOrder(configs []config.TunnelConfig) [][]string {
+	waves, err := config.StartOrder(configs)
+	if err == nil {
+		return waves
+	}
 
-	if len(errors) > 0 {
-		return fmt.Errorf("errors closing manager: %v", errors)
+	m.logger().Warn("ignoring tunnel dependencies", "error", err)
+	names := make([]string, 0, len(configs))
+	for _, cfg := range configs {
+		names = append(names, cfg.Name)
 	}
+	slices.Sort(names)
 
-	return nil
+	return [][]string{names}
 }
 
-// startAutoRestartForTunnel initiates a periodic restart mechanism for the specified tunnel based on the given interval.
-func (m *Manager) startAutoRestartForTunnel(name string, interval time.Duration) {
-	m.mu.Lock()
-	if done, exists := m.tunnelDones[name]; exists {
-		close(done)
+// orderByDependencies returns the named tunnels, whose configs are in configs, ordered so each comes after the ones it
+// depends on.
+func (m *Manager) orderByDependencies(names []string, configs map[string]config.TunnelConfig) []string {
+	subset := make([]config.TunnelConfig, 0, len(names))
+	for _, name := range names {
+		subset = append(subset, configs[name])
 	}
 
-	done := make(chan struct{})
-	m.tunnelDones[name] = done
-	m.mu.Unlock()
+	ordered := make([]string, 0, len(names))
+	for _, wave := range m.startOrder(subset) {
+		ordered = append(ordered, wave...)
+	}
+	return ordered
+}
 
-	go func() {
+// failedDependency returns the first of the tunnel's dependencies found in failed, or an empty string when none is.
+func failedDependency(cfg config.TunnelConfig, failed map[string]error) string {
+	for _, dep := range cfg.DependsOn {
+		if _, exists := failed[dep]; exists {
+			return dep
+		}
+	}
+	return ""
+}
+
+// missingDependency returns the first of the dependencies not in started, or an empty string when all of them are.
+func missingDependency(dependsOn []string, started map[string]bool) string {
+	for _, dep := range dependsOn {
+		if !started[dep] {
+			return dep
+		}
+	}
+	return ""
+}
+
+// acquireSlot takes a slot from slots, waiting for one to free up, and reports false if ctx is cancelled first.
+func acquireSlot(ctx context.Context, slots chan struct{}) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// StopAll stops all active tunnels managed by the Manager in parallel, each honoring its own shutdown grace, and returns a map of tunnel names to their associated stop errors.
+func (m *Manager) StopAll() map[string]error {
+	return m.StopAllContext(context.Background())
+}
+
+// StopAllContext is StopAll, but once ctx is cancelled it stops waiting for open connections to drain and closes them,
+// bounding the total time spent shutting down.
+func (m *Manager) StopAllContext(ctx context.Context) map[string]error {
+	m.mu.Lock()
+	for name, done := range m.tunnelDones {
+		close(done)
+		delete(m.tunnelDones, name)
+	}
+	for name := range m.desired {
+		m.desired[name] = DesiredStopped
+	}
+	clear(m.wantedSince)
+
+	tunnels := make(map[string]*tunnel.Tunnel, len(m.tunnels))
+	graces := make(map[string]time.Duration, len(m.tunnels))
+	for name, tun := range m.tunnels {
+		tunnels[name] = tun
+		graces[name] = m.configs[name].ShutdownGrace
+	}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	var errorsMu sync.Mutex
+	errors := make(map[string]error)
+
+	for name, tun := range tunnels {
+		wg.Go(func() {
+			if err := m.stopGracefully(ctx, name, tun, graces[name]); err != nil {
+				errorsMu.Lock()
+				errors[name] = err
+				errorsMu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	return errors
+}
+
+// Get returns the tunnel associated with the given name or nil if no such tunnel exists.
+func (m *Manager) Get(name string) *tunnel.Tunnel {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.tunnels[name]
+}
+
+// Config returns a copy of the config the named tunnel currently runs with, as last applied by Add, UpdateTunnel, or
+// Reconcile, and false when there is no such tunnel.
+func (m *Manager) Config(name string) (config.TunnelConfig, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cfg, exists := m.configs[name]
+	if !exists {
+		return config.TunnelConfig{}, false
+	}
+	return cfg.Clone(), true
+}
+
+// Configs returns copies of the configs of all managed tunnels, keyed by tunnel name.
+func (m *Manager) Configs() map[string]config.TunnelConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	configs := make(map[string]config.TunnelConfig, len(m.configs))
+	for name, cfg := range m.configs {
+		configs[name] = cfg.Clone()
+	}
+	return configs
+}
+
+// List returns a slice of strings containing the names of all registered SSH tunnels managed by the Manager.
+func (m *Manager) List() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := make([]string, 0, len(m.tunnels))
+	for name := range m.tunnels {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// ListByTag returns the names of the managed tunnels carrying the given tag, sorted.
+func (m *Manager) ListByTag(tag string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := make([]string, 0)
+	for name, cfg := range m.configs {
+		if cfg.HasTag(tag) {
+			names = append(names, name)
+		}
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// StartByTag starts the enabled tunnels carrying the given tag that are not paused, one at a time, returning a map of tunnel names to
+// errors for any that failed.
+func (m *Manager) StartByTag(tag string) map[string]error {
+	errors := make(map[string]error)
+	for _, name := range m.ListByTag(tag) {
+		m.mu.RLock()
+		enabled := m.configs[name].IsEnabled() && !m.paused[name]
+		m.mu.RUnlock()
+
+		if !enabled {
+			continue
+		}
+		if err := m.Start(name); err != nil {
+			errors[name] = err
+		}
+	}
+
+	return errors
+}
+
+// StopByTag stops the tunnels carrying the given tag, returning a map of tunnel names to errors for any that failed.
+func (m *Manager) StopByTag(tag string) map[string]error {
+	errors := make(map[string]error)
+	for _, name := range m.ListByTag(tag) {
+		if err := m.Stop(name); err != nil {
+			errors[name] = err
+		}
+	}
+
+	return errors
+}
+
+// Status returns the status of all managed tunnels as a map of tunnel names to their current statuses. Disabled
+// tunnels are reported as tunnel.StatusDisabled, and paused ones as tunnel.StatusPaused.
+func (m *Manager) Status() map[string]tunnel.Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status := make(map[string]tunnel.Status)
+	for name, tun := range m.tunnels {
+		status[name] = m.statusOf(name, tun)
+	}
+
+	return status
+}
+
+// Stats retrieves statistics for all managed tunnels as a map of tunnel names to their respective stats.
+func (m *Manager) Stats() map[string]tunnel.Stats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := make(map[string]tunnel.Stats)
+	for name, tun := range m.tunnels {
+		stats[name] = tun.Stats()
+	}
+
+	return stats
+}
+
+// TotalStats returns the stats of all managed tunnels added together. LastActivity is the latest across tunnels and
+// StartedAt the earliest; LocalPort is left unset.
+func (m *Manager) TotalStats() tunnel.Stats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var total tunnel.Stats
+	for _, tun := range m.tunnels {
+		stats := tun.Stats()
+
+		total.BytesIn += stats.BytesIn
+		total.BytesOut += stats.BytesOut
+		total.Connections += stats.Connections
+		total.ActiveConnections += stats.ActiveConnections
+		total.QueuedConnections += stats.QueuedConnections
+		total.Dequeued += stats.Dequeued
+		total.QueueWait += stats.QueueWait
+		total.RefusedConnections += stats.RefusedConnections
+		total.TapDropped += stats.TapDropped
+		total.Phases.Accepted += stats.Phases.Accepted
+		total.Phases.Establishing += stats.Phases.Establishing
+		total.Phases.Active += stats.Phases.Active
+		total.Phases.Closing += stats.Phases.Closing
+
+		if stats.LastActivity.After(total.LastActivity) {
+			total.LastActivity = stats.LastActivity
+		}
+		if !stats.StartedAt.IsZero() && (total.StartedAt.IsZero() || stats.StartedAt.Before(total.StartedAt)) {
+			total.StartedAt = stats.StartedAt
+		}
+	}
+
+	return total
+}
+
+// ResetStats zeroes the cumulative counters of the named tunnel and returns its stats as they were before the reset.
+func (m *Manager) ResetStats(name string) (tunnel.Stats, error) {
+	m.mu.RLock()
+	tun, exists := m.tunnels[name]
+	m.mu.RUnlock()
+
+	if !exists {
+		return tunnel.Stats{}, notFound(name)
+	}
+
+	return tun.ResetStats(), nil
+}
+
+// PreviousPeriod returns the totals of the last completed accounting period of the named tunnel, and false when the
+// tunnel has no scheduled stats reset or no period has completed yet.
+func (m *Manager) PreviousPeriod(name string) (PeriodTotals, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	period, exists := m.periods[name]
+	if !exists || period.previous == nil {
+		return PeriodTotals{}, false
+	}
+
+	return *period.previous, true
+}
+
+// StartStatsReset launches a background loop that periodically resets the stats of tunnels whose accounting period
+// has ended, logging each period's totals before its counters are cleared.
+func (m *Manager) StartStatsReset(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.resetDueStats()
+			case <-m.done:
+				return
+			}
+		}
+	}()
+}
+
+// Snapshot returns the desired and actual state of every managed tunnel, flagging the ones whose actual state diverges.
+func (m *Manager) Snapshot() []TunnelSnapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	snapshots := make([]TunnelSnapshot, 0, len(m.tunnels))
+
+	for name, tun := range m.tunnels {
+		desired := m.desired[name]
+		actual := tun.Status()
+		connInfo, _ := tun.ConnectionInfo()
+		parked, retriesLeft := m.budgetStatus(name)
+		status := m.statusOf(name, tun)
+		startedAt, connectedAt := runningSince(tun, status)
+
+		snapshots = append(snapshots, TunnelSnapshot{
+			Name:        name,
+			Desired:     desired,
+			Actual:      status,
+			Error:       tun.LastError(),
+			Diverged:    stateDiverged(desired, actual),
+			Stuck:       m.isStuck(name, tun),
+			Maintenance: m.inMaintenance(name),
+			Connection:  connInfo,
+			Phases:      tun.Stats().Phases,
+
+			RemoteDialAddr: tun.RemoteDialAddr(),
+			Parked:         parked,
+			RetriesLeft:    retriesLeft,
+
+			Restarts:        m.restarts[name],
+			StartedAt:       startedAt,
+			LastConnectedAt: connectedAt,
+		})
+	}
+
+	return snapshots
+}
+
+// TunnelInfo describes a managed tunnel in full at a single point in time: its config, with defaults and overrides
+// already applied, its desired state and reported status, its last error, how often the manager restarted it, and its
+// stats. StartedAt, LastConnectedAt, and Uptime are as in HealthStatus. It is a copy, so changing it has no effect on
+// the tunnel.
+type TunnelInfo struct {
+	Name            string
+	Config          config.TunnelConfig
+	Desired         DesiredState
+	Status          tunnel.Status
+	Error           error
+	Restarts        int
+	StartedAt       time.Time
+	LastConnectedAt time.Time
+	Uptime          time.Duration
+	Stats           tunnel.Stats
+}
+
+// Describe returns everything known about the named tunnel, read under a single lock so the parts agree with each
+// other, and false when there is no such tunnel.
+func (m *Manager) Describe(name string) (TunnelInfo, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tun, exists := m.tunnels[name]
+	if !exists {
+		return TunnelInfo{}, false
+	}
+
+	status := m.statusOf(name, tun)
+	startedAt, connectedAt := runningSince(tun, status)
+	info := TunnelInfo{
+		Name:            name,
+		Config:          m.configs[name].Clone(),
+		Desired:         m.desired[name],
+		Status:          status,
+		Error:           tun.LastError(),
+		Restarts:        m.restarts[name],
+		StartedAt:       startedAt,
+		LastConnectedAt: connectedAt,
+		Stats:           tun.Stats(),
+	}
+	if !startedAt.IsZero() {
+		info.Uptime = m.clock().Sub(startedAt)
+	}
+
+	return info, true
+}
+
+// HealthCheck evaluates the health status of all managed tunnels and returns a slice of their HealthStatus. Disabled
+// and paused tunnels are not meant to run, so they are reported with tunnel.StatusDisabled or tunnel.StatusPaused and
+// count as healthy.
+func (m *Manager) HealthCheck() []HealthStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := make([]HealthStatus, 0, len(m.tunnels))
+
+	for name, tun := range m.tunnels {
+		status := m.statusOf(name, tun)
+		lastErr := tun.LastError()
+		probeErr := m.probeError(name)
+		healthy := notMeantToRun(status) || isHealthy(status, lastErr, probeErr)
+		startedAt, connectedAt := runningSince(tun, status)
+
+		results = append(results, HealthStatus{
+			Name:        name,
+			Tags:        slices.Clone(m.configs[name].Tags),
+			Status:      status,
+			LocalPort:   listenPort(tun, status),
+			Error:       lastErr,
+			Healthy:     healthy,
+			Stuck:       m.isStuck(name, tun),
+			Maintenance: m.inMaintenance(name),
+			ProbeError:  probeErr,
+			Retries:     m.retries[name],
+
+			StartedAt:       startedAt,
+			LastConnectedAt: connectedAt,
+		})
+	}
+
+	return results
+}
+
+// runningSince returns when tun last started and when its SSH connection was last established, or zero times unless
+// its status is running.
+func runningSince(tun *tunnel.Tunnel, status tunnel.Status) (time.Time, time.Time) {
+	if status != tunnel.StatusRunning {
+		return time.Time{}, time.Time{}
+	}
+	return tun.Stats().StartedAt, tun.ConnectedAt()
+}
+
+// listenPort returns the local port tun listens on while its status is running, or 0 when it listens on none.
+func listenPort(tun *tunnel.Tunnel, status tunnel.Status) int {
+	if status != tunnel.StatusRunning || tun.Reverse() || tun.LocalSocket() != "" {
+		return 0
+	}
+	return tun.LocalPort()
+}
+
+// Summary counts the managed tunnels by status and health in a single pass under the lock. Disabled and paused tunnels
+// count as healthy, as they do in HealthCheck.
+func (m *Manager) Summary() Summary {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	summary := Summary{Total: len(m.tunnels), UnhealthyNames: make([]string, 0)}
+
+	for name, tun := range m.tunnels {
+		status := m.statusOf(name, tun)
+
+		switch status {
+		case tunnel.StatusRunning:
+			summary.Running++
+		case tunnel.StatusStarting:
+			summary.Starting++
+		case tunnel.StatusStopped:
+			summary.Stopped++
+		case tunnel.StatusError:
+			summary.Errored++
+		case tunnel.StatusDisabled:
+			summary.Disabled++
+		case tunnel.StatusPaused:
+			summary.Paused++
+		}
+
+		if notMeantToRun(status) || isHealthy(status, tun.LastError(), m.probeError(name)) {
+			summary.Healthy++
+		} else {
+			summary.Unhealthy++
+			summary.UnhealthyNames = append(summary.UnhealthyNames, name)
+		}
+	}
+
+	slices.Sort(summary.UnhealthyNames)
+
+	return summary
+}
+
+// Unhealthy returns a slice of HealthStatus objects representing tunnels that are not in a healthy state.
+func (m *Manager) Unhealthy() []HealthStatus {
+	all := m.HealthCheck()
+
+	unhealthy := make([]HealthStatus, 0)
+	for _, h := range all {
+		if !h.Healthy {
+			unhealthy = append(unhealthy, h)
+		}
+	}
+
+	return unhealthy
+}
+
+// WaitUntilHealthy blocks until every named tunnel, or every managed tunnel when no names are given, is reported healthy
+// by HealthCheck. It returns an error naming the tunnels still unhealthy when ctx is done first, and fails at once for a
+// tunnel that does not exist.
+func (m *Manager) WaitUntilHealthy(ctx context.Context, names ...string) error {
+	ticker := time.NewTicker(healthPollInterval)
+	defer ticker.Stop()
+
+	for {
+		pending, err := m.unhealthyAmong(names)
+		if err != nil || len(pending) == 0 {
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("tunnels not healthy: %s: %w", strings.Join(pending, ", "), context.Cause(ctx))
+		case <-m.done:
+			return fmt.Errorf("tunnels not healthy: %s: manager closed", strings.Join(pending, ", "))
+		}
+	}
+}
+
+// unhealthyAmong returns the named tunnels, or all tunnels when names is empty, that are not healthy, sorted by name.
+func (m *Manager) unhealthyAmong(names []string) ([]string, error) {
+	health := make(map[string]bool)
+	for _, h := range m.HealthCheck() {
+		health[h.Name] = h.Healthy
+	}
+
+	if len(names) == 0 {
+		names = slices.Collect(maps.Keys(health))
+	}
+
+	var unhealthy []string
+	for _, name := range names {
+		healthy, exists := health[name]
+		if !exists {
+			return nil, notFound(name)
+		}
+		if !healthy {
+			unhealthy = append(unhealthy, name)
+		}
+	}
+
+	slices.Sort(unhealthy)
+
+	return unhealthy, nil
+}
+
+// Errors returns the distinct errors recently encountered while starting, restarting, or reconnecting the named tunnel,
+// most recently seen first. Repeated errors that differ only in numbers, such as ports, are aggregated into one record.
+func (m *Manager) Errors(name string) ([]ErrorRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	history, exists := m.errHistory[name]
+	if !exists {
+		return nil, notFound(name)
+	}
+
+	return history.list(), nil
+}
+
+// Stuck returns the tunnels whose desired state is running but that have been stopped, errored, or starting for longer
+// than the threshold set with SetStuckThreshold. It always returns an empty slice while no threshold is set.
+func (m *Manager) Stuck() []TunnelSnapshot {
+	stuck := make([]TunnelSnapshot, 0)
+	for _, snap := range m.Snapshot() {
+		if snap.Stuck {
+			stuck = append(stuck, snap)
+		}
+	}
+
+	return stuck
+}
+
+// SetStuckThreshold configures how long a tunnel may stay down while desired running before it is reported as stuck.
+// A zero threshold disables stuck detection.
+func (m *Manager) SetStuckThreshold(threshold time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stuckAfter = threshold
+}
+
+// StartStuckMonitor launches a background loop that periodically logs a warning for every tunnel that becomes stuck.
+// Each tunnel is reported once per episode and again only after it has recovered and become stuck anew.
+func (m *Manager) StartStuckMonitor(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.warnStuck()
+			case <-m.done:
+				return
+			}
+		}
+	}()
+}
+
+// Diff compares newConfig with the managed tunnels without applying it, as DiffConfigs does. Tunnels that Reconcile would
+// update in place count as changed, with TunnelChange.Restart unset.
+func (m *Manager) Diff(newConfig *config.Config) ConfigDiff {
+	return DiffConfigs(m.currentConfig(), newConfig)
+}
+
+// currentConfig returns the SSH settings and the configs of every managed tunnel, ordered by name.
+func (m *Manager) currentConfig() *config.Config {
+	m.mu.RLock()
+	cfg := &config.Config{SSH: *m.sshConfig}
+	for _, tunnelCfg := range m.configs {
+		cfg.TunnelConfigs = append(cfg.TunnelConfigs, tunnelCfg)
+	}
+	m.mu.RUnlock()
+
+	slices.SortFunc(cfg.TunnelConfigs, func(a, b config.TunnelConfig) int { return strings.Compare(a.Name, b.Name) })
+
+	return cfg
+}
+
+// ExportConfig writes the SSH settings and the configs of every managed tunnel, ordered by name, so a restart from the
+// written file reproduces the tunnels added or changed at runtime. Other top-level settings are not tracked by the
+// Manager and are left out.
+func (m *Manager) ExportConfig(w io.Writer, opts config.ExportOptions) error {
+	return m.currentConfig().Export(w, opts)
+}
+
+// UpdateTunnel applies cfg to the named tunnel. Changes to settings such as auto-restart timing, probes, and maintenance
+// or access windows take effect in place without dropping open connections; only changes to the forwarding parameters,
+// such as the remote address or local port, rebuild the tunnel, restarting it if it is meant to be running.
+func (m *Manager) UpdateTunnel(name string, cfg config.TunnelConfig) error {
+	if cfg.Name != name {
+		return fmt.Errorf("tunnel %s: config is for tunnel %s", name, cfg.Name)
+	}
+
+	m.mu.RLock()
+	old, exists := m.configs[name]
+	desired := m.desired[name]
+	m.mu.RUnlock()
+
+	if !exists {
+		return notFound(name)
+	}
+
+	switch tunnelConfigChanged(old, cfg) {
+	case changeNone:
+		return nil
+	case changeInPlace:
+		if err := m.update(name, cfg); err != nil {
+			return fmt.Errorf("failed to update tunnel %s: %w", name, err)
+		}
+		return nil
+	}
+
+	if err := m.replace(name, cfg); err != nil {
+		return fmt.Errorf("failed to update tunnel %s: %w", name, err)
+	}
+
+	if desired == DesiredRunning && cfg.IsEnabled() {
+		return m.Start(name)
+	}
+
+	return nil
+}
+
+// ReconcileResult reports what a Reconcile applied: the tunnels added, removed, restarted with a new config, and updated
+// in place without a restart, sorted by name, and the tunnels that failed with their errors. RolledBack is set when a
+// transactional reconcile undid its changes after a failure.
+type ReconcileResult struct {
+	Mode       string
+	Added      []string
+	Removed    []string
+	Changed    []string
+	Updated    []string
+	Failed     map[string]error
+	RolledBack bool
+}
+
+// SetReconcileMode selects how Reconcile handles tunnels that fail to apply: config.ReconcileBestEffort (the default)
+// applies everything else, config.ReconcileStrict stops at the first failure, and config.ReconcileTransactional restores
+// the previous config after a failure.
+func (m *Manager) SetReconcileMode(mode string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reconcileMode = mode
+}
+
+// Reconcile updates the Manager's state to match the provided configuration, modifying tunnel configurations as needed.
+// Failures are handled according to the reconcile mode; in strict and transactional mode the first failure is also
+// returned as an error.
+func (m *Manager) Reconcile(newConfig *config.Config) (ReconcileResult, error) {
+	m.mu.RLock()
+	mode := m.reconcileMode
+	previous := &config.Config{SSH: *m.sshConfig, Relay: config.RelayConfig{Workers: m.relayWorkers}}
+	previousDesired := make(map[string]DesiredState)
+	for name, cfg := range m.configs {
+		previous.TunnelConfigs = append(previous.TunnelConfigs, cfg)
+		previousDesired[name] = m.desired[name]
+	}
+	m.mu.RUnlock()
+
+	slices.SortFunc(previous.TunnelConfigs, func(a, b config.TunnelConfig) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	if mode == "" {
+		mode = config.ReconcileBestEffort
+	}
+
+	result, failed, err := m.reconcile(newConfig, mode != config.ReconcileBestEffort)
+	result.Mode = mode
+
+	if err == nil || mode != config.ReconcileTransactional {
+		return result, err
+	}
+
+	m.logger().Warn("reconcile failed, rolling back to the previous config", "tunnel", failed, "error", err)
+	if _, _, rollbackErr := m.reconcile(previous, false); rollbackErr != nil {
+		m.logger().Error("reconcile rollback failed", "error", rollbackErr)
+	}
+	for name, desired := range previousDesired {
+		if desired == DesiredStopped {
+			_ = m.Stop(name)
+		}
+	}
+	result.RolledBack = true
+
+	return result, fmt.Errorf("reconcile rolled back after tunnel %s failed: %w", failed, err)
+}
+
+// reconcile applies newConfig, recording every failure in the result. When abort is set it stops at the first failure
+// and returns the name of the failed tunnel along with its error.
+func (m *Manager) reconcile(newConfig *config.Config, abort bool) (ReconcileResult, string, error) {
+	diff := DiffConfigs(m.currentConfig(), newConfig)
+
+	m.mu.Lock()
+	m.sshConfig = &newConfig.SSH
+	relayChanged := m.relayWorkers != newConfig.Relay.Workers
+	m.mu.Unlock()
+
+	if relayChanged {
+		m.logger().Info("reconcile: resizing relay pool", "workers", newConfig.Relay.Workers)
+		m.SetRelayWorkers(newConfig.Relay.Workers)
+	}
+
+	result := ReconcileResult{Failed: make(map[string]error)}
+	fail := func(name string, err error) error {
+		result.Failed[name] = err
+		if abort {
+			return err
+		}
+		return nil
+	}
+
+	newConfigs := make(map[string]config.TunnelConfig)
+	for _, cfg := range newConfig.TunnelConfigs {
+		newConfigs[cfg.Name] = cfg
+	}
+
+	freedAddrs := make(map[string]bool)
+
+	for _, name := range diff.Removed {
+		m.mu.RLock()
+		oldCfg := m.configs[name]
+		m.mu.RUnlock()
+
+		m.logger().Info("reconcile: removing tunnel", "tunnel", name)
+		if err := m.Remove(name); err != nil {
+			m.logger().Error("reconcile: failed to remove tunnel", "tunnel", name, "error", err)
+			if err := fail(name, err); err != nil {
+				return result, name, err
+			}
+			continue
+		}
+		if !oldCfg.Reverse() {
+			freedAddrs[localListenAddr(oldCfg)] = true
+		}
+		result.Removed = append(result.Removed, name)
+	}
+
+	var changed []string
+	for _, name := range diff.Changed {
+		newCfg, change := newConfigs[name], diff.Tunnels[name]
+
+		m.mu.RLock()
+		oldCfg, exists := m.configs[name]
+		m.mu.RUnlock()
+
+		if !exists {
+			continue
+		}
+
+		if !change.Restart {
+			m.logger().Info("reconcile: updating tunnel in place", "tunnel", name, "fields", change.Fields)
+			if err := m.update(name, newCfg); err != nil {
+				m.logger().Error("reconcile: failed to update tunnel", "tunnel", name, "error", err)
+				if err := fail(name, err); err != nil {
+					return result, name, err
+				}
+				continue
+			}
+			result.Updated = append(result.Updated, name)
+			continue
+		}
+
+		m.logger().Info("reconcile: restarting changed tunnel", "tunnel", name, "fields", change.Fields)
+		if err := m.replace(name, newCfg); err != nil {
+			m.logger().Error("reconcile: failed to stop tunnel", "tunnel", name, "error", err)
+			if err := fail(name, err); err != nil {
+				return result, name, err
+			}
+			continue
+		}
+		if !oldCfg.Reverse() {
+			freedAddrs[localListenAddr(oldCfg)] = true
+		}
+		changed = append(changed, name)
+	}
+
+	for _, cfg := range newConfig.TunnelConfigs {
+		if !cfg.Reverse() && cfg.LocalPort > 0 && freedAddrs[localListenAddr(cfg)] {
+			if err := waitForPortRelease(localListenAddr(cfg), portReleaseTimeout); err != nil {
+				m.logger().Warn("reconcile: local port not released", "error", err)
+			}
+		}
+	}
+
+	for _, name := range m.orderByDependencies(changed, newConfigs) {
+		result.Changed = append(result.Changed, name)
+		if !newConfigs[name].IsEnabled() || m.isPaused(name) {
+			continue
+		}
+		if dep := failedDependency(newConfigs[name], result.Failed); dep != "" {
+			m.logger().Warn("reconcile: not restarting tunnel, a dependency failed", "tunnel", name, "dependency", dep)
+			if err := fail(name, fmt.Errorf("not started: dependency %s failed", dep)); err != nil {
+				return result, name, err
+			}
+			continue
+		}
+		if err := m.Start(name); err != nil {
+			m.logger().Error("reconcile: failed to restart tunnel", "tunnel", name, "error", err)
+			if err := fail(name, err); err != nil {
+				return result, name, err
+			}
+		}
+	}
+
+	for _, name := range m.orderByDependencies(diff.Added, newConfigs) {
+		cfg := newConfigs[name]
+
+		m.logger().Info("reconcile: adding tunnel", "tunnel", cfg.Name)
+		var err error
+		if dep := failedDependency(cfg, result.Failed); dep != "" && cfg.IsEnabled() {
+			m.logger().Warn("reconcile: not starting tunnel, a dependency failed", "tunnel", cfg.Name, "dependency", dep)
+			if err = m.Add(cfg); err == nil {
+				err = fmt.Errorf("not started: dependency %s failed", dep)
+			}
+		} else if cfg.IsEnabled() {
+			err = m.AddAndStart(cfg, true)
+		} else {
+			err = m.Add(cfg)
+		}
+		if m.Get(cfg.Name) != nil {
+			result.Added = append(result.Added, cfg.Name)
+		}
+		if err != nil {
+			m.logger().Error("reconcile: failed to add tunnel", "tunnel", cfg.Name, "error", err)
+			if err := fail(cfg.Name, err); err != nil {
+				return result, cfg.Name, err
+			}
+		}
+	}
+
+	slices.Sort(result.Added)
+	slices.Sort(result.Changed)
+	slices.Sort(result.Updated)
+
+	return result, "", nil
+}
+
+// StartController launches a background loop that periodically drives each tunnel's actual state toward its desired state.
+func (m *Manager) StartController(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.converge()
+			case <-m.done:
+				return
+			}
+		}
+	}()
+}
+
+// Run starts all tunnels and the optional watcher, blocks until ctx is cancelled, and then shuts everything down gracefully.
+// Failures to start individual tunnels are logged rather than returned; only errors that prevent running or stopping are.
+// With a state file set, tunnels saved as paused or stopped are held that way and not started, and the state is saved
+// again before the tunnels stop.
+func (m *Manager) Run(ctx context.Context, w Watcher) error {
+	m.mu.RLock()
+	stateFile := m.stateFile
+	m.mu.RUnlock()
+
+	var held map[string]bool
+	if stateFile != "" {
+		held = m.restoreHeld(stateFile)
+	}
+
+	for name, err := range m.startAll(ctx, held) {
+		m.logger().Error("failed to start tunnel", "tunnel", name, "error", err)
+	}
+
+	for name, status := range m.Status() {
+		m.logger().Info("tunnel status", "tunnel", name, "status", status)
+	}
+
+	if ctx.Err() != nil {
+		m.logger().Info("shutting down during startup", "cause", context.Cause(ctx))
+		if errors := m.stopAllWithin(); len(errors) > 0 {
+			return fmt.Errorf("errors stopping tunnels: %v", errors)
+		}
+		return nil
+	}
+
+	if w != nil {
+		if err := w.Start(); err != nil {
+			m.StopAll()
+			return fmt.Errorf("failed to start watcher: %w", err)
+		}
+	}
+	m.startedOnce.Do(func() { close(m.started) })
+
+	<-ctx.Done()
+	m.logger().Info("shutting down", "cause", context.Cause(ctx))
+
+	if w != nil {
+		if err := w.Stop(); err != nil {
+			m.logger().Error("failed to stop watcher", "error", err)
+		}
+	}
+
+	if stateFile != "" {
+		if err := m.SaveState(stateFile); err != nil {
+			m.logger().Error("failed to save state", "path", stateFile, "error", err)
+		}
+	}
+
+	if errors := m.stopAllWithin(); len(errors) > 0 {
+		return fmt.Errorf("errors stopping tunnels: %v", errors)
+	}
+
+	return nil
+}
+
+// Started returns a channel that is closed once Run has made its first attempt to start every tunnel and started the
+// watcher, whether or not the tunnels came up. It is never closed when Run is cancelled during startup.
+func (m *Manager) Started() <-chan struct{} {
+	return m.started
+}
+
+// stopAllWithin stops all tunnels like StopAll, cutting their drains short once shutdown.drainTimeout has passed.
+func (m *Manager) stopAllWithin() map[string]error {
+	m.mu.RLock()
+	timeout := m.shutdown.DrainTimeout
+	m.mu.RUnlock()
+
+	if timeout <= 0 {
+		return m.StopAll()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return m.StopAllContext(ctx)
+}
+
+// Close terminates the Manager, stops all tunnels, and releases resources, closing the channels returned by Events once
+// the tunnels have stopped. Returns an error if any tunnel fails to stop or the shadow socket directory cannot be
+// removed; the directory is removed either way.
+func (m *Manager) Close() error {
+	close(m.done)
+	stopErrs := m.StopAll()
+	m.events.close()
+
+	var err error
+	if len(stopErrs) > 0 {
+		err = fmt.Errorf("errors closing manager: %v", stopErrs)
+	}
+
+	if m.socketDir != "" {
+		if rmErr := os.RemoveAll(m.socketDir); rmErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to remove shadow sockets: %w", rmErr))
+		}
+	}
+
+	return err
+}
+
+// startAutoRestartForTunnel initiates a periodic restart mechanism for the specified tunnel based on the given interval.
+func (m *Manager) startAutoRestartForTunnel(name string, interval time.Duration) {
+	m.mu.Lock()
+	if done, exists := m.tunnelDones[name]; exists {
+		close(done)
+	}
+
+	done := make(chan struct{})
+	m.tunnelDones[name] = done
+	m.mu.Unlock()
+
+	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
@@ -357,27 +1803,326 @@ func (m *Manager) startAutoRestartForTunnel(name string, interval time.Duration)
 			case <-ticker.C:
 				m.mu.RLock()
 				tun, exists := m.tunnels[name]
+				maintenance := m.inMaintenance(name)
+				canary := m.configs[name].AutoRestart.Canary
+				maxRetries := m.configs[name].AutoRestart.MaxRetries
+				gaveUp := maxRetries > 0 && m.retries[name] >= maxRetries
+				pending := m.canaryErrors[name] != nil
 				m.mu.RUnlock()
 
-				if !exists {
-					return
-				}
+				if !exists {
+					return
+				}
+
+				if maintenance {
+					continue
+				}
+
+				status := tun.Status()
+				lastErr := tun.LastError()
+				switch {
+				case status == tunnel.StatusError || lastErr != nil:
+					if gaveUp || m.spendRetry(name) != nil {
+						continue
+					}
+					if canary {
+						m.setCanaryError(name, errCanaryPending)
+					}
+					if m.autoRestart(name, maxRetries) == nil && canary {
+						m.runCanary(name)
+					}
+				case canary && pending:
+					m.runCanary(name)
+				}
+			case <-done:
+				return
+			case <-m.done:
+				return
+			}
+		}
+	}()
+}
+
+// SetAppProbe replaces the application check run by a tunnel's local probe, taking precedence over probe.send and
+// probe.expect; nil reverts to the configured check. The tunnel must have a local probe configured to run it.
+func (m *Manager) SetAppProbe(name string, app probe.AppProbe) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cfg, exists := m.configs[name]
+	if !exists {
+		return notFound(name)
+	}
+
+	if cfg.Probe.Mode != config.ProbeModeLocal {
+		return fmt.Errorf("tunnel %s has no local probe configured", name)
+	}
+
+	if app == nil {
+		delete(m.appProbes, name)
+		return nil
+	}
+	m.appProbes[name] = app
+
+	return nil
+}
+
+// SetTap installs a hook observing the bytes relayed by the named tunnel, kept across restarts and reloads; nil
+// removes it. See tunnel.TapFunc for its cost.
+func (m *Manager) SetTap(name string, fn tunnel.TapFunc) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tun, exists := m.tunnels[name]
+	if !exists {
+		return notFound(name)
+	}
+
+	if fn == nil {
+		delete(m.taps, name)
+	} else {
+		m.taps[name] = fn
+	}
+	tun.SetTap(fn)
+
+	return nil
+}
+
+// appProbeFromConfig builds the application check described by a probe config, or returns nil when it has none.
+func appProbeFromConfig(cfg config.ProbeConfig) probe.AppProbe {
+	switch {
+	case cfg.Mode == config.ProbeModeHTTP:
+		return probe.HTTPGet(cfg.HTTPPath(), cfg.ExpectStatus)
+	case cfg.Expect == "":
+		return nil
+	case cfg.Send == "":
+		return probe.ExpectBanner([]byte(cfg.Expect))
+	default:
+		return probe.SendExpect([]byte(cfg.Send), []byte(cfg.Expect))
+	}
+}
+
+// restartProbeLocked stops the health probe of the named tunnel, forgetting its results, and starts it again as
+// described by cfg, if any. The caller must hold m.mu.
+func (m *Manager) restartProbeLocked(name string, cfg config.ProbeConfig) {
+	if done, exists := m.probeDones[name]; exists {
+		close(done)
+		delete(m.probeDones, name)
+	}
+	delete(m.probeErrors, name)
+	delete(m.probeStreaks, name)
+	delete(m.probeRestart, name)
+	if cfg.Mode != "" {
+		m.startProbeLocked(name, cfg.Interval)
+	}
+}
+
+// startProbeLocked launches the periodic health probe for the named tunnel. The caller must hold m.mu.
+func (m *Manager) startProbeLocked(name string, interval time.Duration) {
+	done := make(chan struct{})
+	m.probeDones[name] = done
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.runProbe(name)
+			case <-done:
+				return
+			case <-m.done:
+				return
+			}
+		}
+	}()
+}
+
+// runProbe probes the named tunnel once and records the result, logging when the probe starts failing or recovers.
+// The tunnel only turns unhealthy or recovers once its probe thresholds are met in a row.
+// Tunnels that are not running are not probed and have their previous result cleared.
+func (m *Manager) runProbe(name string) {
+	m.mu.RLock()
+	tun, exists := m.tunnels[name]
+	probeCfg := m.configs[name].Probe
+	app := m.appProbes[name]
+	m.mu.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	if tun.Status() != tunnel.StatusRunning {
+		m.mu.Lock()
+		delete(m.probeErrors, name)
+		delete(m.probeStreaks, name)
+		m.mu.Unlock()
+		return
+	}
+
+	timeout := probeCfg.Timeout
+	if timeout == 0 {
+		timeout = defaultProbeTimeout
+	}
+
+	if app == nil {
+		app = appProbeFromConfig(probeCfg)
+	}
+
+	var err error
+	if probeCfg.Mode == config.ProbeModeSSH {
+		err = tun.Probe(timeout)
+	} else {
+		err = probeListener(tun, app, timeout)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.tunnels[name]; !exists {
+		return
+	}
+
+	streak := m.probeStreaks[name]
+	if streak == nil {
+		streak = &probeStreak{}
+		m.probeStreaks[name] = streak
+	}
+
+	unhealthy := m.probeErrors[name] != nil
+	if err != nil {
+		streak.failures++
+		streak.successes = 0
+	} else {
+		streak.successes++
+		streak.failures = 0
+	}
+
+	switch {
+	case err != nil && unhealthy:
+		m.probeErrors[name] = err
+	case err != nil && streak.failures >= probeCfg.Failures():
+		m.logger().Warn("tunnel probe failed", "tunnel", name, "error", err)
+		m.probeErrors[name] = err
+		if probeCfg.RestartOnFailure && !m.probeRestart[name] {
+			m.probeRestart[name] = true
+			go m.restartAfterProbe(name, tun)
+		}
+	case err == nil && unhealthy && streak.successes >= probeCfg.Successes():
+		m.logger().Info("tunnel probe recovered", "tunnel", name)
+		m.probeErrors[name] = nil
+	}
+
+	if err == nil && streak.successes >= probeCfg.Successes() {
+		delete(m.probeRestart, name)
+	}
+}
+
+// restartAfterProbe restarts the named tunnel after its probe marked it unhealthy, unless it has been replaced or is no
+// longer meant to run, or its retry budget is spent. A tunnel is restarted once per failure: when the probe still fails
+// after the restart, it is left unhealthy until the probe passes again, so a dead service does not cause a restart loop.
+func (m *Manager) restartAfterProbe(name string, tun *tunnel.Tunnel) {
+	if !m.stillWanted(name, tun) {
+		return
+	}
+	if err := m.spendRetry(name); err != nil {
+		return
+	}
+
+	m.logger().Warn("restarting tunnel after failed probe", "tunnel", name)
+	if err := m.restart(name); err != nil {
+		m.logger().Error("failed to restart tunnel after failed probe", "tunnel", name, "error", err)
+	}
+}
+
+// probeStreak counts a tunnel's consecutive failed or passing probes, whichever kind came last.
+type probeStreak struct {
+	failures  int
+	successes int
+}
+
+// spendRetry takes an attempt from the named tunnel's retry budget before an automatic start, restart, or reconnect,
+// returning an error instead once the tunnel is parked. Tunnels without a budget are never parked.
+func (m *Manager) spendRetry(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cfg, exists := m.configs[name]
+	if !exists || cfg.RetryBudget.Attempts == 0 {
+		return nil
+	}
+
+	budget := m.budgets[name]
+	if budget == nil || budget.cfg != cfg.RetryBudget {
+		budget = newRetryBudget(cfg.RetryBudget)
+		m.budgets[name] = budget
+	}
+
+	wasParked := budget.parked
+	if budget.spend(m.clock()) {
+		return nil
+	}
+
+	err := fmt.Errorf("tunnel %s is parked: retry budget of %d attempts per %s exhausted",
+		name, cfg.RetryBudget.Attempts, cfg.RetryBudget.Window)
+	if !wasParked {
+		m.logger().Error("tunnel parked, unpark it to resume automatic retries", "tunnel", name, "error", err)
+	}
+	return err
+}
+
+// Unpark gives the named tunnel a fresh retry budget so automatic attempts resume after it was parked.
+func (m *Manager) Unpark(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.tunnels[name]; !exists {
+		return notFound(name)
+	}
+
+	if budget := m.budgets[name]; budget != nil && budget.parked {
+		m.logger().Info("tunnel unparked", "tunnel", name)
+	}
+	delete(m.budgets, name)
+
+	return nil
+}
+
+// budgetStatus reports whether the named tunnel is parked and how many attempts its retry budget has left, -1 when it
+// has none. The caller must hold m.mu.
+func (m *Manager) budgetStatus(name string) (bool, int) {
+	attempts := m.configs[name].RetryBudget.Attempts
+	if attempts == 0 {
+		return false, -1
+	}
+
+	budget := m.budgets[name]
+	if budget == nil {
+		return false, attempts
+	}
+	return budget.parked, budget.remaining(m.clock())
+}
+
+// probeListener dials the tunnel's local listener like a client would and, when app is set, runs the application check
+// over the connection.
+func probeListener(tun *tunnel.Tunnel, app probe.AppProbe, timeout time.Duration) error {
+	conn, err := net.DialTimeout(tun.LocalNetwork(), tun.DialAddr(), timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
 
-				status := tun.Status()
-				lastErr := tun.LastError()
-				if status == tunnel.StatusError || lastErr != nil {
-					_ = m.Restart(name)
-				}
-			case <-done:
-				return
-			case <-m.done:
-				return
-			}
-		}
-	}()
+	if app == nil {
+		return nil
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	return app.Probe(conn)
 }
 
-// stopAutoRestartForTunnel stops the auto-restart mechanism for the tunnel identified by the given name, if it exists.
+// stopAutoRestartForTunnel stops the auto-restart mechanism for the tunnel identified by the given name, if it exists,
+// along with any canary still pending from its last restart.
 func (m *Manager) stopAutoRestartForTunnel(name string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -386,24 +2131,612 @@ func (m *Manager) stopAutoRestartForTunnel(name string) {
 		close(done)
 		delete(m.tunnelDones, name)
 	}
+	delete(m.canaryErrors, name)
+}
+
+// runCanary sends one connection through the full path of a restarted tunnel, recording whether it reached the remote
+// service. The tunnel counts as unhealthy until a canary succeeds.
+func (m *Manager) runCanary(name string) {
+	m.mu.RLock()
+	tun, exists := m.tunnels[name]
+	cfg := m.configs[name]
+	app := m.appProbes[name]
+	previous := m.canaryErrors[name]
+	m.mu.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	timeout := cfg.AutoRestart.CanaryTimeout
+	if timeout == 0 {
+		timeout = defaultProbeTimeout
+	}
+
+	if app == nil {
+		app = appProbeFromConfig(cfg.Probe)
+	}
+
+	err := probeListener(tun, app, timeout)
+	if err == nil && app == nil {
+		err = tun.Probe(timeout)
+	}
+
+	switch {
+	case err != nil && previous == errCanaryPending:
+		m.logger().Warn("tunnel canary failed after restart, keeping it unhealthy", "tunnel", name, "error", err)
+	case err == nil && previous != nil:
+		m.logger().Info("tunnel canary succeeded after restart", "tunnel", name)
+	}
+
+	if err != nil {
+		err = fmt.Errorf("canary failed: %w", err)
+	}
+	m.setCanaryError(name, err)
+}
+
+// setCanaryError records the canary result of the named tunnel, clearing it when err is nil.
+func (m *Manager) setCanaryError(name string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.tunnels[name]; !exists || err == nil {
+		delete(m.canaryErrors, name)
+		return
+	}
+	m.canaryErrors[name] = err
+}
+
+// probeError returns the error keeping the named tunnel's probes from passing: a pending or failed canary first, then
+// the last periodic probe. The caller must hold m.mu.
+func (m *Manager) probeError(name string) error {
+	if err := m.canaryErrors[name]; err != nil {
+		return err
+	}
+	return m.probeErrors[name]
+}
+
+// converge issues Start, Stop, or Restart calls for every tunnel whose actual state diverges from its desired state.
+func (m *Manager) converge() {
+	for _, snap := range m.Snapshot() {
+		if !snap.Diverged || snap.Actual == tunnel.StatusStarting || snap.Maintenance {
+			continue
+		}
+
+		if snap.Desired == DesiredRunning && m.spendRetry(snap.Name) != nil {
+			continue
+		}
+
+		m.logger().Info("controller: converging tunnel", "tunnel", snap.Name, "status", snap.Actual, "desired", snap.Desired)
+
+		var err error
+		switch {
+		case snap.Desired == DesiredStopped:
+			err = m.Stop(snap.Name)
+		case snap.Actual == tunnel.StatusError:
+			err = m.restart(snap.Name)
+		default:
+			err = m.start(context.Background(), snap.Name, nil)
+		}
+
+		if err != nil {
+			m.logger().Error("controller: failed to converge tunnel", "tunnel", snap.Name, "error", err)
+		}
+	}
+}
+
+// warnStuck logs a warning for tunnels that have newly become stuck and forgets the ones that have recovered.
+func (m *Manager) warnStuck() {
+	stuck := make(map[string]TunnelSnapshot)
+	for _, snap := range m.Stuck() {
+		stuck[snap.Name] = snap
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name := range m.stuckWarned {
+		if _, ok := stuck[name]; !ok {
+			delete(m.stuckWarned, name)
+		}
+	}
+
+	for name, snap := range stuck {
+		if m.stuckWarned[name] {
+			continue
+		}
+		m.stuckWarned[name] = true
+		m.logger().Warn("tunnel is stuck: desired running but not up", "tunnel", name, "status", snap.Actual,
+			"for", m.stuckAfter, "error", snap.Error)
+	}
+}
+
+// initStatsPeriodLocked starts a fresh accounting period for a tunnel with a scheduled stats reset. The caller must
+// hold m.mu.
+func (m *Manager) initStatsPeriodLocked(cfg config.TunnelConfig) {
+	boundary, err := schedule.ParseBoundary(cfg.StatsReset)
+	if err != nil {
+		delete(m.periods, cfg.Name)
+		return
+	}
+
+	m.periods[cfg.Name] = &statsPeriod{boundary: boundary, start: boundary.PeriodStart(m.clock())}
+}
+
+// resetDueStats records the totals and resets the counters of every tunnel whose accounting period has ended.
+func (m *Manager) resetDueStats() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock()
+
+	for name, period := range m.periods {
+		start := period.boundary.PeriodStart(now)
+		if !start.After(period.start) {
+			continue
+		}
+
+		tun, exists := m.tunnels[name]
+		if !exists {
+			continue
+		}
+
+		stats := tun.ResetStats()
+		period.previous = &PeriodTotals{
+			Start:       period.start,
+			End:         start,
+			BytesIn:     stats.BytesIn,
+			BytesOut:    stats.BytesOut,
+			Connections: stats.Connections,
+		}
+		period.start = start
+
+		m.logger().Info("tunnel usage", "tunnel", name, "from", period.previous.Start.Format(time.RFC3339),
+			"to", period.previous.End.Format(time.RFC3339), "bytesIn", stats.BytesIn, "bytesOut", stats.BytesOut,
+			"connections", stats.Connections)
+	}
+}
+
+// startWithRetries starts the named tunnel, retrying failed attempts with exponential backoff and jitter per the policy.
+// Every backoff, including those of the tunnel's own startRetries, is waited out with wait.
+func (m *Manager) startWithRetries(ctx context.Context, name string, policy config.StartupConfig, wait func(time.Duration) bool) error {
+	if err := m.spendRetry(name); err != nil {
+		return err
+	}
+
+	m.resetRetries(name)
+	err := m.start(ctx, name, wait)
+
+	for attempt := 0; err != nil && attempt < policy.InitialRetries; attempt++ {
+		delay := policy.Backoff<<attempt + jitter(policy.Jitter)
+		m.logger().Warn("failed to start tunnel, retrying", "tunnel", name, "delay", delay, "error", err)
+
+		if !wait(delay) {
+			return err
+		}
+
+		if spendErr := m.spendRetry(name); spendErr != nil {
+			return spendErr
+		}
+
+		m.resetRetries(name)
+		err = m.start(ctx, name, wait)
+	}
+
+	return err
+}
+
+// sleepContext waits for the given duration, returning false if ctx is cancelled or the Manager is closed first.
+func (m *Manager) sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-m.done:
+		return false
+	}
+}
+
+// jitter returns a random duration in [0, limit), or zero when limit is not positive.
+func jitter(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	return rand.N(limit)
+}
+
+// runPortCommand runs a shell command and parses its trimmed stdout as a TCP port number.
+func runPortCommand(command string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), portCommandTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "sh", "-c", command).Output()
+	if err != nil {
+		return 0, fmt.Errorf("remotePortCommand failed: %w", err)
+	}
+
+	port, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("remotePortCommand returned an invalid port %q", strings.TrimSpace(string(out)))
+	}
+
+	return port, nil
+}
+
+// localListenAddr returns the address the local listener of the tunnel described by cfg binds.
+func localListenAddr(cfg config.TunnelConfig) string {
+	return net.JoinHostPort(cfg.LocalBindAddr(), strconv.Itoa(cfg.LocalPort))
+}
+
+// waitForPortRelease polls until a listener can be bound to the given address, confirming a previous owner has released
+// it.
+func waitForPortRelease(addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		listener, err := net.Listen("tcp", addr)
+		if err == nil {
+			return listener.Close()
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s still in use after %s: %w", addr, timeout, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// stopGracefully stops a tunnel, first draining its open connections for up to grace when it is running, or for up to
+// shutdown.drainTimeout when the tunnel sets no grace of its own. Cancelling ctx cuts the drain short.
+func (m *Manager) stopGracefully(ctx context.Context, name string, tun *tunnel.Tunnel, grace time.Duration) error {
+	if grace <= 0 {
+		m.mu.RLock()
+		grace = m.shutdown.DrainTimeout
+		m.mu.RUnlock()
+	}
+
+	if grace <= 0 || tun.Status() != tunnel.StatusRunning {
+		return tun.Stop()
+	}
+
+	result, err := tun.DrainContext(ctx, grace)
+	if result.Forced > 0 {
+		m.logger().Warn("closed connections still open after shutdown grace", "tunnel", name, "forced", result.Forced,
+			"grace", grace)
+	}
+
+	return err
+}
+
+// newTunnel builds a tunnel for cfg connecting through server, as returned by serverFor. The caller must hold m.mu.
+func (m *Manager) newTunnel(cfg config.TunnelConfig, server *tunnel.SSHConfig) *tunnel.Tunnel {
+	tun := tunnel.NewTunnel(server, cfg.RemoteHost, cfg.RemotePort, cfg.LocalPort)
+	switch cfg.TunnelType() {
+	case config.TunnelTypeReverse:
+		tun = tunnel.NewReverseTunnel(server, cfg.RemoteHost, cfg.RemotePort, cfg.LocalHost, cfg.LocalPort)
+	case config.TunnelTypeDynamic:
+		tun = tunnel.NewDynamicTunnel(server, cfg.LocalPort)
+	}
+	tun.SetLocalBind(cfg.LocalBindAddr())
+	tun.SetLocalSocket(cfg.LocalSocket)
+	tun.SetNoDelay(cfg.NoDelay())
+	tun.SetRetryChannel(cfg.RetryChannel)
+	tun.SetChannelOpenRetry(cfg.ChannelOpen.RetryCount(), cfg.ChannelOpen.RetryBackoff())
+	tun.SetRelayPool(m.relayPool)
+	tun.SetConnectionLimit(cfg.MaxConnections, cfg.QueueSize)
+	tun.SetRateLimit(cfg.RateLimitBytes())
+	tun.SetIdleTimeout(cfg.IdleTimeout)
+	tun.SetTap(m.taps[cfg.Name])
+	tun.SetStatusFunc(m.statusFunc(cfg.Name))
+	name := cfg.Name
+	tun.SetAcceptFunc(func(remote net.Addr) error {
+		return m.checkAccess(name, remote)
+	})
+	tun.SetReconnectGate(func() error {
+		return m.spendRetry(name)
+	})
+	if cfg.RemotePortCommand != "" {
+		command := cfg.RemotePortCommand
+		tun.SetRemotePortResolver(func() (int, error) {
+			return runPortCommand(command)
+		})
+	}
+	return tun
+}
+
+// replace stops the named tunnel and swaps in a fresh, stopped tunnel built from cfg, keeping its desired state and
+// history. The caller is expected to start it again.
+func (m *Manager) replace(name string, cfg config.TunnelConfig) error {
+	maintenance, access, err := parseSchedules(cfg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	old := m.tunnels[name]
+	grace := m.configs[name].ShutdownGrace
+	_, err = m.serverFor(cfg)
+	m.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+
+	m.stopAutoRestartForTunnel(name)
+
+	if err := m.stopGracefully(context.Background(), name, old, grace); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	server, err := m.serverFor(cfg)
+	if err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+
+	m.tunnels[name] = m.newTunnel(cfg, server)
+	m.configs[name] = cfg
+	m.maintenance[name] = maintenance
+	m.access[name] = access
+	m.pruneServersLocked()
+	m.initStatsPeriodLocked(cfg)
+
+	m.restartProbeLocked(name, cfg.Probe)
+
+	return nil
+}
+
+// update applies cfg to the named tunnel without rebuilding it, for changes that tunnelConfigChanged reports can be made
+// in place. Open connections are left alone; the auto-restart loop and probe are restarted only when their settings
+// changed. A tunnel that was disabled is stopped, and one that was enabled is started.
+func (m *Manager) update(name string, cfg config.TunnelConfig) error {
+	maintenance, access, err := parseSchedules(cfg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	old, exists := m.configs[name]
+	if !exists {
+		m.mu.Unlock()
+		return notFound(name)
+	}
+
+	m.configs[name] = cfg
+	m.maintenance[name] = maintenance
+	m.access[name] = access
+	if old.StatsReset != cfg.StatsReset {
+		m.initStatsPeriodLocked(cfg)
+	}
+	if old.Probe != cfg.Probe {
+		m.restartProbeLocked(name, cfg.Probe)
+	}
+	if old.RateLimit != cfg.RateLimit {
+		m.tunnels[name].SetRateLimit(cfg.RateLimitBytes())
+	}
+	if old.IdleTimeout != cfg.IdleTimeout {
+		m.tunnels[name].SetIdleTimeout(cfg.IdleTimeout)
+	}
+
+	rescheduled := old.AutoRestart.Enabled != cfg.AutoRestart.Enabled || old.AutoRestart.Interval != cfg.AutoRestart.Interval
+	running := m.desired[name] == DesiredRunning
+	if done, exists := m.tunnelDones[name]; exists && rescheduled {
+		close(done)
+		delete(m.tunnelDones, name)
+	}
+	m.mu.Unlock()
+
+	if rescheduled && running && cfg.AutoRestart.Enabled {
+		m.startAutoRestartForTunnel(name, cfg.AutoRestart.Interval)
+	}
+
+	switch {
+	case old.IsEnabled() && !cfg.IsEnabled():
+		m.logger().Info("tunnel disabled, stopping it", "tunnel", name)
+		return m.Stop(name)
+	case !old.IsEnabled() && cfg.IsEnabled() && !m.isPaused(name):
+		m.logger().Info("tunnel enabled, starting it", "tunnel", name)
+		return m.Start(name)
+	}
+
+	return nil
+}
+
+// parseSchedules parses the maintenance and access windows of cfg.
+func parseSchedules(cfg config.TunnelConfig) (schedule.Schedule, schedule.Schedule, error) {
+	maintenance, err := schedule.Parse(cfg.Maintenance)
+	if err != nil {
+		return nil, nil, fmt.Errorf("maintenance: %w", err)
+	}
+
+	access, err := schedule.Parse(cfg.Access)
+	if err != nil {
+		return nil, nil, fmt.Errorf("access: %w", err)
+	}
+
+	return maintenance, access, nil
+}
+
+// recordError adds err to the error history of the named tunnel, if it is still registered.
+func (m *Manager) recordError(name string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if history, exists := m.errHistory[name]; exists {
+		history.record(err, time.Now())
+	}
+}
+
+// setDesired records the desired state for the tunnel identified by the given name, if it is still registered.
+func (m *Manager) setDesired(name string, state DesiredState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.tunnels[name]; !exists {
+		return
+	}
+
+	if state != DesiredRunning {
+		delete(m.wantedSince, name)
+	} else if m.desired[name] != DesiredRunning {
+		m.wantedSince[name] = time.Now()
+	}
+	m.desired[name] = state
+}
+
+// checkAccess refuses a new connection to a tunnel outside its access windows, logging why. Tunnels without access
+// windows accept connections at any time.
+func (m *Manager) checkAccess(name string, remote net.Addr) error {
+	m.mu.RLock()
+	access := m.access[name]
+	now := m.clock()
+	m.mu.RUnlock()
+
+	if len(access) == 0 || access.Contains(now) {
+		return nil
+	}
+
+	m.logger().Warn("refused connection outside the tunnel's access schedule", "tunnel", name, "remote", remote)
+	return fmt.Errorf("tunnel %s is outside its access schedule", name)
+}
+
+// inMaintenance reports whether the named tunnel is currently inside one of its maintenance windows. The caller must
+// hold m.mu.
+func (m *Manager) inMaintenance(name string) bool {
+	return m.maintenance[name].Contains(m.clock())
+}
+
+// isStuck reports whether the named tunnel has been wanted running but not running for at least the stuck threshold.
+// The caller must hold m.mu.
+func (m *Manager) isStuck(name string, tun *tunnel.Tunnel) bool {
+	if m.stuckAfter <= 0 || m.desired[name] != DesiredRunning || m.inMaintenance(name) {
+		return false
+	}
+
+	downSince := tun.DownSince()
+	if downSince.IsZero() {
+		return false
+	}
+
+	since := m.wantedSince[name]
+	if downSince.After(since) {
+		since = downSince
+	}
+
+	return time.Since(since) >= m.stuckAfter
+}
+
+// statusOf returns the status reported for the named tunnel: tunnel.StatusDisabled when its config disables it,
+// tunnel.StatusPaused while it is paused, and its own status otherwise. The caller must hold m.mu.
+func (m *Manager) statusOf(name string, tun *tunnel.Tunnel) tunnel.Status {
+	if !m.configs[name].IsEnabled() {
+		return tunnel.StatusDisabled
+	}
+	if m.paused[name] {
+		return tunnel.StatusPaused
+	}
+	return tun.Status()
+}
+
+// notMeantToRun reports whether a status marks a tunnel that is down on purpose, because it is disabled or paused.
+func notMeantToRun(status tunnel.Status) bool {
+	return status == tunnel.StatusDisabled || status == tunnel.StatusPaused
+}
+
+// isHealthy reports whether a tunnel is running without a recorded error or a failing probe.
+func isHealthy(status tunnel.Status, lastErr, probeErr error) bool {
+	return status == tunnel.StatusRunning && lastErr == nil && probeErr == nil
+}
+
+// stateDiverged reports whether the actual tunnel status does not match the desired state.
+func stateDiverged(desired DesiredState, actual tunnel.Status) bool {
+	if desired == DesiredRunning {
+		return actual != tunnel.StatusRunning
+	}
+	return actual != tunnel.StatusStopped
+}
+
+// configChange classifies how a tunnel's config changed: not at all, only in settings that can be applied to the running
+// tunnel, or in its forwarding parameters, which require restarting it.
+type configChange int
+
+const (
+	changeNone configChange = iota
+	changeInPlace
+	changeRestart
+)
+
+// tunnelConfigChanged compares the old and new TunnelConfig structures and reports whether the tunnel must be restarted
+// to apply the new one, can be updated in place, or is unaffected.
+func tunnelConfigChanged(old, new config.TunnelConfig) configChange {
+	if restartRequired(old, new) {
+		return changeRestart
+	}
+	if inPlaceChanged(old, new) {
+		return changeInPlace
+	}
+	return changeNone
 }
 
-// tunnelConfigChanged checks if there are any differences between the old and new TunnelConfig structures.
-func tunnelConfigChanged(old, new config.TunnelConfig) bool {
+// restartRequired reports whether the two configs differ in the parameters the tunnel was built with.
+func restartRequired(old, new config.TunnelConfig) bool {
+	if serverKey(old.SSH) != serverKey(new.SSH) {
+		return true
+	}
 	if old.RemoteHost != new.RemoteHost {
 		return true
 	}
 	if old.RemotePort != new.RemotePort {
 		return true
 	}
-	if old.LocalPort != new.LocalPort {
+	if old.RemotePortCommand != new.RemotePortCommand {
+		return true
+	}
+	if old.LocalPort != new.LocalPort || old.LocalSocket != new.LocalSocket {
 		return true
 	}
-	if old.AutoRestart.Enabled != new.AutoRestart.Enabled {
+	if old.TunnelType() != new.TunnelType() || old.LocalHost != new.LocalHost || old.LocalBindAddr() != new.LocalBindAddr() {
 		return true
 	}
-	if old.AutoRestart.Interval != new.AutoRestart.Interval {
+	if old.NoDelay() != new.NoDelay() {
+		return true
+	}
+	if old.RetryChannel != new.RetryChannel {
+		return true
+	}
+	if old.MaxConnections != new.MaxConnections || old.QueueSize != new.QueueSize {
+		return true
+	}
+	if old.ChannelOpen.RetryCount() != new.ChannelOpen.RetryCount() || old.ChannelOpen.RetryBackoff() != new.ChannelOpen.RetryBackoff() {
 		return true
 	}
 	return false
 }
+
+// inPlaceChanged reports whether the two configs differ in settings the manager applies to a running tunnel.
+func inPlaceChanged(old, new config.TunnelConfig) bool {
+	if old.IsEnabled() != new.IsEnabled() || !slices.Equal(old.Tags, new.Tags) {
+		return true
+	}
+	if old.AutoRestart != new.AutoRestart || old.RetryBudget != new.RetryBudget ||
+		old.StartRetries != new.StartRetries || old.StartRetryInterval != new.StartRetryInterval {
+		return true
+	}
+	if !slices.Equal(old.DependsOn, new.DependsOn) || old.RateLimit != new.RateLimit || old.IdleTimeout != new.IdleTimeout {
+		return true
+	}
+	if old.ShutdownGrace != new.ShutdownGrace || old.StatsReset != new.StatsReset || old.Probe != new.Probe {
+		return true
+	}
+	return !slices.Equal(old.Maintenance, new.Maintenance) || !slices.Equal(old.Access, new.Access)
+}
@@ -1,16 +1,33 @@
 package manager
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/pperesbr/conduit/internal/config"
-	"github.com/pperesbr/gokit/pkg/tunnel"
+	"github.com/pperesbr/conduit/internal/probe"
+	"github.com/pperesbr/conduit/internal/tunnel"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -391,6 +408,302 @@ func TestHealthCheck(t *testing.T) {
 	}
 }
 
+// TestHealthCheck_ReportsAutoAssignedPort verifies that a tunnel with localPort 0 reports the port it was given in its
+// health and stats while running, and none once stopped.
+func TestHealthCheck_ReportsAutoAssignedPort(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	_ = mgr.Add(config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: 0})
+	if err := mgr.Start("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	health := mgr.HealthCheck()
+	if len(health) != 1 || health[0].LocalPort == 0 {
+		t.Fatalf("expected an assigned local port, got %+v", health)
+	}
+	port := health[0].LocalPort
+
+	if got := mgr.Stats()["db"].LocalPort; got != port {
+		t.Errorf("expected stats to report port %d, got %d", port, got)
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), time.Second)
+	if err != nil {
+		t.Fatalf("expected the tunnel to listen on port %d: %v", port, err)
+	}
+	conn.Close()
+
+	if err := mgr.Stop("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if health := mgr.HealthCheck(); health[0].LocalPort != 0 {
+		t.Errorf("expected no local port once stopped, got %d", health[0].LocalPort)
+	}
+}
+
+// TestHealthCheck_ReportsUptime verifies that a reconnect moves LastConnectedAt but not StartedAt, a restart moves both,
+// and a stopped tunnel reports neither.
+func TestHealthCheck_ReportsUptime(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	_ = mgr.Add(config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521})
+	if err := mgr.Start("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	started := mgr.HealthCheck()[0]
+	if started.StartedAt.IsZero() || !started.LastConnectedAt.Equal(started.StartedAt) {
+		t.Fatalf("expected a running tunnel to report when it started and connected, got %+v", started)
+	}
+	if uptime := started.Uptime(started.StartedAt.Add(time.Minute)); uptime != time.Minute {
+		t.Errorf("expected an uptime of 1m, got %s", uptime)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if err := mgr.Reconnect("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reconnected := mgr.HealthCheck()[0]
+	if !reconnected.StartedAt.Equal(started.StartedAt) || !reconnected.LastConnectedAt.After(started.LastConnectedAt) {
+		t.Errorf("expected a reconnect to move only LastConnectedAt, got %+v", reconnected)
+	}
+
+	if err := mgr.Restart("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	restarted := mgr.HealthCheck()[0]
+	if !restarted.StartedAt.After(started.StartedAt) || !restarted.LastConnectedAt.After(reconnected.LastConnectedAt) {
+		t.Errorf("expected a restart to move both timestamps, got %+v", restarted)
+	}
+	if snapshot := mgr.Snapshot()[0]; !snapshot.StartedAt.Equal(restarted.StartedAt) || snapshot.Restarts != 2 {
+		t.Errorf("expected the snapshot to report the same start and 2 restarts, got %+v", snapshot)
+	}
+
+	if err := mgr.Stop("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stopped := mgr.HealthCheck()[0]
+	if !stopped.StartedAt.IsZero() || !stopped.LastConnectedAt.IsZero() || stopped.Uptime(time.Now()) != 0 {
+		t.Errorf("expected a stopped tunnel to report no start, connection, or uptime, got %+v", stopped)
+	}
+}
+
+func TestHealthCheck_ReverseTunnel(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	err := mgr.Add(config.TunnelConfig{Name: "laptop", Type: config.TunnelTypeReverse, RemoteHost: "127.0.0.1", RemotePort: 8080, LocalHost: "127.0.0.1", LocalPort: 3000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !mgr.Get("laptop").Reverse() {
+		t.Fatal("expected a reverse tunnel")
+	}
+
+	// The test server refuses remote forwarding, so the tunnel fails to start like any other unreachable tunnel.
+	if err := mgr.Start("laptop"); err == nil || !strings.Contains(err.Error(), "remote listener") {
+		t.Errorf("expected the refused remote listener to fail the start, got: %v", err)
+	}
+
+	health := mgr.HealthCheck()
+	if len(health) != 1 || health[0].Healthy || health[0].Status != tunnel.StatusError || health[0].Error == nil {
+		t.Errorf("expected the reverse tunnel to be reported unhealthy, got %+v", health)
+	}
+}
+
+func TestLocalSocket_RemovedOnStopAndRemove(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	path := filepath.Join(t.TempDir(), "db.sock")
+	cfg := config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 5432, LocalSocket: path}
+	if err := mgr.AddAndStart(cfg, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Lstat(path); err != nil {
+		t.Fatalf("expected the socket to exist while running: %v", err)
+	}
+
+	if err := mgr.Stop("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the socket to be removed on stop, got %v", err)
+	}
+
+	if err := mgr.Start("db"); err != nil {
+		t.Fatalf("expected a restart on the same socket to succeed, got: %v", err)
+	}
+	if err := mgr.Remove("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the socket to be removed on remove, got %v", err)
+	}
+}
+
+func TestStartAllContext_CancelLeavesStartedTunnelsRunning(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	// A server that accepts connections but never speaks SSH, so starting through it hangs until cancelled.
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	defer silent.Close()
+	go func() {
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	hung := &tunnel.SSHConfig{User: "testuser", Password: "testpass", Host: "127.0.0.1", Port: silent.Addr().(*net.TCPAddr).Port,
+		InsecureIgnoreHostKey: true}
+	_ = mgr.Add(config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 5432})
+	_ = mgr.Add(config.TunnelConfig{Name: "hung", RemoteHost: "127.0.0.1", RemotePort: 5432, SSH: hung})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	errs := mgr.StartAllContext(ctx)
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("expected the batch to stop at the deadline, took %s", elapsed)
+	}
+
+	if !errors.Is(errs["hung"], context.DeadlineExceeded) {
+		t.Errorf("expected the hung start to be cut off by the deadline, got %v", errs["hung"])
+	}
+	if status := mgr.Get("hung").Status(); status != tunnel.StatusError {
+		t.Errorf("expected the hung tunnel to be left in error, got %s", status)
+	}
+
+	// Tunnels are started in no particular order: db either started before the deadline and must still be running,
+	// or was never attempted.
+	if status := mgr.Get("db").Status(); status != tunnel.StatusRunning && (status != tunnel.StatusStopped || errs["db"] != nil) {
+		t.Errorf("expected db to be running or untouched, got %s (%v)", status, errs["db"])
+	}
+}
+
+func TestStartAll_RespectsMaxConcurrentStarts(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+	mgr.SetStartupPolicy(config.StartupConfig{MaxConcurrentStarts: 3})
+
+	// The port command keeps each tunnel starting long enough for starts to overlap.
+	const tunnels = 12
+	for i := range tunnels {
+		_ = mgr.Add(config.TunnelConfig{Name: fmt.Sprintf("t%02d", i), RemoteHost: "127.0.0.1", RemotePortCommand: "sleep 0.1; echo 5432"})
+	}
+
+	events := mgr.Events()
+	peak := make(chan int)
+	go func() {
+		starting, highest := 0, 0
+		for event := range events {
+			switch {
+			case event.To == tunnel.StatusStarting:
+				starting++
+				highest = max(highest, starting)
+			case event.From == tunnel.StatusStarting:
+				starting--
+			}
+		}
+		peak <- highest
+	}()
+
+	if errs := mgr.StartAll(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	for _, h := range mgr.HealthCheck() {
+		if h.Status != tunnel.StatusRunning {
+			t.Errorf("expected %s to be running, got %s", h.Name, h.Status)
+		}
+	}
+
+	mgr.Close()
+	if highest := <-peak; highest != 3 {
+		t.Errorf("expected up to 3 tunnels starting at once, saw %d", highest)
+	}
+}
+
+// TestStartAll_BackoffFreesStartSlot verifies that a tunnel waiting to retry a failed start gives up its start slot,
+// so the next tunnel starts without waiting out the backoff.
+func TestStartAll_BackoffFreesStartSlot(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+	mgr.SetStartupPolicy(config.StartupConfig{MaxConcurrentStarts: 1})
+
+	_ = mgr.Add(config.TunnelConfig{Name: "a-failing", RemoteHost: "127.0.0.1", RemotePortCommand: "exit 1",
+		StartRetries: 1, StartRetryInterval: time.Second})
+	_ = mgr.Add(config.TunnelConfig{Name: "b-healthy", RemoteHost: "127.0.0.1", RemotePort: 5432})
+
+	events := mgr.Events()
+	begin := time.Now()
+	if errs := mgr.StartAll(); len(errs) != 1 || errs["a-failing"] == nil {
+		t.Fatalf("expected only a-failing to fail, got %v", errs)
+	}
+
+	for len(events) > 0 {
+		if event := <-events; event.Tunnel == "b-healthy" && event.To == tunnel.StatusRunning {
+			if waited := event.Time.Sub(begin); waited > 500*time.Millisecond {
+				t.Errorf("expected b-healthy to start during a-failing's backoff, started after %s", waited)
+			}
+			return
+		}
+	}
+	t.Error("expected b-healthy to start")
+}
+
+func TestDynamicTunnel_ReportsAssignedPort(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	if err := mgr.AddAndStart(config.TunnelConfig{Name: "socks", Type: config.TunnelTypeDynamic}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tun := mgr.Get("socks")
+	if !tun.Dynamic() || tun.Stats().LocalPort == 0 {
+		t.Errorf("expected a dynamic tunnel reporting the port it picked, got %d", tun.Stats().LocalPort)
+	}
+	if health := mgr.HealthCheck(); len(health) != 1 || !health[0].Healthy {
+		t.Errorf("expected the dynamic tunnel to be healthy, got %+v", health)
+	}
+}
+
 // TestUnhealthy_NoProblems validates that no tunnels are reported as unhealthy when all configured tunnels are functioning correctly.
 func TestUnhealthy_NoProblems(t *testing.T) {
 	sshServer, sshCfg := setupTestSSHServer(t)
@@ -574,12 +887,6 @@ func handleTestSSHConnection(conn net.Conn, config *ssh.ServerConfig) {
 
 	for newChannel := range chans {
 		if newChannel.ChannelType() == "direct-tcpip" {
-			channel, requests, err := newChannel.Accept()
-			if err != nil {
-				continue
-			}
-			go ssh.DiscardRequests(requests)
-
 			var payload struct {
 				DestHost   string
 				DestPort   uint32
@@ -588,12 +895,19 @@ func handleTestSSHConnection(conn net.Conn, config *ssh.ServerConfig) {
 			}
 			ssh.Unmarshal(newChannel.ExtraData(), &payload)
 
-			destAddr := fmt.Sprintf("%s:%d", payload.DestHost, payload.DestPort)
+			destAddr := net.JoinHostPort(payload.DestHost, strconv.Itoa(int(payload.DestPort)))
 			destConn, err := net.Dial("tcp", destAddr)
 			if err != nil {
-				channel.Close()
+				newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+
+			channel, requests, err := newChannel.Accept()
+			if err != nil {
+				destConn.Close()
 				continue
 			}
+			go ssh.DiscardRequests(requests)
 
 			go func() {
 				defer channel.Close()
@@ -627,7 +941,7 @@ func TestReconcile_AddNewTunnel(t *testing.T) {
 		},
 	}
 
-	err := mgr.Reconcile(newConfig)
+	_, err := mgr.Reconcile(newConfig)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -665,7 +979,7 @@ func TestReconcile_RemoveTunnel(t *testing.T) {
 		},
 	}
 
-	err := mgr.Reconcile(newConfig)
+	_, err := mgr.Reconcile(newConfig)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -704,7 +1018,7 @@ func TestReconcile_RestartChangedTunnel(t *testing.T) {
 		},
 	}
 
-	err := mgr.Reconcile(newConfig)
+	_, err := mgr.Reconcile(newConfig)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -744,7 +1058,7 @@ func TestReconcile_NoChanges(t *testing.T) {
 		},
 	}
 
-	err := mgr.Reconcile(newConfig)
+	_, err := mgr.Reconcile(newConfig)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -760,6 +1074,44 @@ func TestReconcile_NoChanges(t *testing.T) {
 	}
 }
 
+// TestReconcile_AppliesRelayWorkers verifies that a reload resizes the relay pool shared by the tunnels, and that
+// setting relay.workers back to 0 removes the limit.
+func TestReconcile_AppliesRelayWorkers(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	newConfig := &config.Config{
+		SSH:           *sshCfg,
+		Relay:         config.RelayConfig{Workers: 3},
+		TunnelConfigs: []config.TunnelConfig{{Name: "sigitm", RemoteHost: "127.0.0.1", RemotePort: 1521}},
+	}
+	if _, err := mgr.Reconcile(newConfig); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mgr.mu.RLock()
+	workers, pool := mgr.relayWorkers, mgr.relayPool
+	mgr.mu.RUnlock()
+	if workers != 3 || pool == nil {
+		t.Errorf("expected the reload to bound relays to 3 workers, got %d (pool %v)", workers, pool)
+	}
+
+	newConfig.Relay.Workers = 0
+	if _, err := mgr.Reconcile(newConfig); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mgr.mu.RLock()
+	pool = mgr.relayPool
+	mgr.mu.RUnlock()
+	if pool != nil {
+		t.Error("expected relay.workers 0 to remove the limit on reload")
+	}
+}
+
 // TestReconcile_MultipleChanges tests the Manager's ability to reconcile tunnel configurations with multiple changes.
 func TestReconcile_MultipleChanges(t *testing.T) {
 	sshServer, sshCfg := setupTestSSHServer(t)
@@ -781,7 +1133,7 @@ func TestReconcile_MultipleChanges(t *testing.T) {
 		},
 	}
 
-	err := mgr.Reconcile(newConfig)
+	_, err := mgr.Reconcile(newConfig)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -808,7 +1160,8 @@ func TestReconcile_MultipleChanges(t *testing.T) {
 	}
 }
 
-// TestTunnelConfigChanged validates if the tunnelConfigChanged function correctly detects changes in TunnelConfig values.
+// TestTunnelConfigChanged validates if the tunnelConfigChanged function tells changes requiring a restart from changes
+// applied in place.
 func TestTunnelConfigChanged(t *testing.T) {
 	base := config.TunnelConfig{
 		Name:       "test",
@@ -822,29 +1175,29 @@ func TestTunnelConfigChanged(t *testing.T) {
 	}
 
 	tests := []struct {
-		name    string
-		new     config.TunnelConfig
-		changed bool
+		name string
+		new  config.TunnelConfig
+		want configChange
 	}{
 		{
-			name:    "no change",
-			new:     base,
-			changed: false,
+			name: "no change",
+			new:  base,
+			want: changeNone,
 		},
 		{
-			name:    "remoteHost changed",
-			new:     config.TunnelConfig{Name: "test", RemoteHost: "host2", RemotePort: 1521, LocalPort: 1521},
-			changed: true,
+			name: "remoteHost changed",
+			new:  config.TunnelConfig{Name: "test", RemoteHost: "host2", RemotePort: 1521, LocalPort: 1521},
+			want: changeRestart,
 		},
 		{
-			name:    "remotePort changed",
-			new:     config.TunnelConfig{Name: "test", RemoteHost: "host1", RemotePort: 1522, LocalPort: 1521},
-			changed: true,
+			name: "remotePort changed",
+			new:  config.TunnelConfig{Name: "test", RemoteHost: "host1", RemotePort: 1522, LocalPort: 1521},
+			want: changeRestart,
 		},
 		{
-			name:    "localPort changed",
-			new:     config.TunnelConfig{Name: "test", RemoteHost: "host1", RemotePort: 1521, LocalPort: 1522},
-			changed: true,
+			name: "localPort changed",
+			new:  config.TunnelConfig{Name: "test", RemoteHost: "host1", RemotePort: 1521, LocalPort: 1522},
+			want: changeRestart,
 		},
 		{
 			name: "autoRestart enabled changed",
@@ -852,7 +1205,7 @@ func TestTunnelConfigChanged(t *testing.T) {
 				Name: "test", RemoteHost: "host1", RemotePort: 1521, LocalPort: 1521,
 				AutoRestart: config.AutoRestartConfig{Enabled: false, Interval: 30 * time.Second},
 			},
-			changed: true,
+			want: changeInPlace,
 		},
 		{
 			name: "autoRestart interval changed",
@@ -860,16 +1213,2440 @@ func TestTunnelConfigChanged(t *testing.T) {
 				Name: "test", RemoteHost: "host1", RemotePort: 1521, LocalPort: 1521,
 				AutoRestart: config.AutoRestartConfig{Enabled: true, Interval: 60 * time.Second},
 			},
-			changed: true,
+			want: changeInPlace,
+		},
+		{
+			name: "rateLimit changed",
+			new: config.TunnelConfig{
+				Name: "test", RemoteHost: "host1", RemotePort: 1521, LocalPort: 1521,
+				AutoRestart: config.AutoRestartConfig{Enabled: true, Interval: 30 * time.Second},
+				RateLimit:   "1MB",
+			},
+			want: changeInPlace,
 		},
 	}
 
+	withSSH := base
+	withSSH.SSH = &tunnel.SSHConfig{User: "testuser", Password: "testpass", Host: "bastion-2"}
+	tests = append(tests, struct {
+		name string
+		new  config.TunnelConfig
+		want configChange
+	}{name: "ssh block added", new: withSSH, want: changeRestart})
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			result := tunnelConfigChanged(base, tt.new)
-			if result != tt.changed {
-				t.Errorf("expected changed=%v, got %v", tt.changed, result)
+			if result != tt.want {
+				t.Errorf("expected change %v, got %v", tt.want, result)
 			}
 		})
 	}
 }
+
+func TestPerTunnelSSH(t *testing.T) {
+	globalServer, globalCfg := setupTestSSHServer(t)
+	globalServer.Close()
+
+	ownServer, ownCfg := setupTestSSHServer(t)
+	defer ownServer.Close()
+
+	otherServer, otherCfg := setupTestSSHServer(t)
+	defer otherServer.Close()
+
+	mgr := NewManager(globalCfg)
+	defer mgr.StopAll()
+
+	ssh := func(cfg *tunnel.SSHConfig) *tunnel.SSHConfig {
+		return &tunnel.SSHConfig{User: cfg.User, Password: cfg.Password, Host: cfg.Host, Port: cfg.Port,
+			InsecureIgnoreHostKey: cfg.InsecureIgnoreHostKey}
+	}
+	tunnels := []config.TunnelConfig{
+		{Name: "global", RemoteHost: "127.0.0.1", RemotePort: 1521},
+		{Name: "own", RemoteHost: "127.0.0.1", RemotePort: 1521, SSH: ssh(ownCfg)},
+		{Name: "own-2", RemoteHost: "127.0.0.1", RemotePort: 1522, SSH: ssh(ownCfg)},
+	}
+	for _, cfg := range tunnels {
+		if err := mgr.Add(cfg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if err := mgr.Start("global"); err == nil {
+		t.Error("expected the tunnel without an ssh block to use the unreachable global server")
+	}
+	for _, name := range []string{"own", "own-2"} {
+		if err := mgr.Start(name); err != nil {
+			t.Errorf("expected %s to connect through its own server, got: %v", name, err)
+		}
+	}
+	mgr.mu.RLock()
+	servers := len(mgr.servers)
+	mgr.mu.RUnlock()
+	if servers != 1 {
+		t.Errorf("expected tunnels with equal ssh blocks to share one server, got %d", servers)
+	}
+
+	if err := mgr.Add(config.TunnelConfig{Name: "bad", RemoteHost: "127.0.0.1", RemotePort: 1521, SSH: &tunnel.SSHConfig{Host: "127.0.0.1"}}); err == nil {
+		t.Error("expected an invalid ssh block to be rejected")
+	}
+
+	tunnels[2].SSH = ssh(otherCfg)
+	result, err := mgr.Reconcile(&config.Config{SSH: *globalCfg, TunnelConfigs: tunnels})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(result.Changed, []string{"own-2"}) {
+		t.Errorf("expected only the tunnel with a changed ssh block to restart, got %v", result.Changed)
+	}
+	if status := mgr.Status()["own-2"]; status != tunnel.StatusRunning {
+		t.Errorf("expected own-2 to run through the other server, got %s", status)
+	}
+
+	if err := mgr.Remove("own"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mgr.Remove("own-2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mgr.mu.RLock()
+	servers = len(mgr.servers)
+	mgr.mu.RUnlock()
+	if servers != 0 {
+		t.Errorf("expected unused servers to be forgotten, got %d", servers)
+	}
+}
+
+// TestSnapshot_DesiredVsActual verifies that a tunnel desired to be running but failing to start is reported as diverged.
+func TestSnapshot_DesiredVsActual(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+
+	_ = mgr.Add(config.TunnelConfig{Name: "test", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: 0})
+
+	snapshot := mgr.Snapshot()
+	if len(snapshot) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d", len(snapshot))
+	}
+
+	if snapshot[0].Desired != DesiredStopped || snapshot[0].Diverged {
+		t.Errorf("expected desired stopped without divergence after Add, got %+v", snapshot[0])
+	}
+
+	if err := mgr.Start("test"); err == nil {
+		t.Fatal("expected start to fail against a closed ssh server")
+	}
+
+	snapshot = mgr.Snapshot()
+	if snapshot[0].Desired != DesiredRunning {
+		t.Errorf("expected desired running, got %s", snapshot[0].Desired)
+	}
+
+	if snapshot[0].Actual != tunnel.StatusError {
+		t.Errorf("expected actual error, got %s", snapshot[0].Actual)
+	}
+
+	if !snapshot[0].Diverged {
+		t.Error("expected snapshot to report divergence")
+	}
+
+	if snapshot[0].Error == nil {
+		t.Error("expected snapshot to carry the last error")
+	}
+}
+
+// TestStartController_RestartsExternallyStoppedTunnel verifies the controller restarts a tunnel desired running but stopped externally.
+func TestStartController_RestartsExternallyStoppedTunnel(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.Close()
+
+	_ = mgr.Add(config.TunnelConfig{Name: "test", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: 0})
+	if err := mgr.Start("test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_ = mgr.Get("test").Stop()
+
+	if status := mgr.Status()["test"]; status != tunnel.StatusStopped {
+		t.Fatalf("expected tunnel to be stopped externally, got %s", status)
+	}
+
+	mgr.StartController(50 * time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if mgr.Status()["test"] == tunnel.StatusRunning {
+			return
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+
+	t.Errorf("expected controller to restart tunnel, got %s", mgr.Status()["test"])
+}
+
+// fakeWatcher records Start and Stop calls made by Manager.Run.
+type fakeWatcher struct {
+	started bool
+	stopped bool
+}
+
+func (w *fakeWatcher) Start() error {
+	w.started = true
+	return nil
+}
+
+func (w *fakeWatcher) Stop() error {
+	w.stopped = true
+	return nil
+}
+
+// TestRun_StartsAndShutsDownOnCancel verifies that Run starts tunnels and the watcher, then shuts both down when ctx is cancelled.
+func TestRun_StartsAndShutsDownOnCancel(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	_ = mgr.Add(config.TunnelConfig{Name: "t1", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: 0})
+	_ = mgr.Add(config.TunnelConfig{Name: "t2", RemoteHost: "127.0.0.1", RemotePort: 1522, LocalPort: 0})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &fakeWatcher{}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- mgr.Run(ctx, w)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		status := mgr.Status()
+		if status["t1"] == tunnel.StatusRunning && status["t2"] == tunnel.StatusRunning {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status := mgr.Status()
+	if status["t1"] != tunnel.StatusRunning || status["t2"] != tunnel.StatusRunning {
+		t.Fatalf("expected tunnels to be running, got %v", status)
+	}
+
+	select {
+	case <-mgr.Started():
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected Started to be closed once Run started the tunnels")
+	}
+
+	cancel()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected Run to return after cancel")
+	}
+
+	if !w.started || !w.stopped {
+		t.Errorf("expected watcher to be started and stopped, got %+v", w)
+	}
+
+	for name, s := range mgr.Status() {
+		if s != tunnel.StatusStopped {
+			t.Errorf("expected %s to be stopped, got %s", name, s)
+		}
+	}
+}
+
+// TestSetLogger_LogsStructuredFields verifies that reconcile and lifecycle events are logged with the tunnel name and
+// status as attributes, and that debug events respect the handler's level.
+func TestSetLogger_LogsStructuredFields(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	var mu sync.Mutex
+	var buf bytes.Buffer
+	logs := func() []map[string]any {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var records []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var record map[string]any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("failed to decode log line %q: %v", line, err)
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+	mgr.SetLogger(slog.New(slog.NewJSONHandler(lockedWriter{&mu, &buf}, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	cfg := &config.Config{SSH: *sshCfg, TunnelConfigs: []config.TunnelConfig{
+		{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: 0},
+	}}
+	if _, err := mgr.Reconcile(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]bool{"reconcile: adding tunnel": false, "tunnel started": false}
+	for _, record := range logs() {
+		msg, _ := record["msg"].(string)
+		if _, ok := want[msg]; !ok {
+			continue
+		}
+		if record["tunnel"] != "db" {
+			t.Errorf("expected %q to carry tunnel db, got %v", msg, record)
+		}
+		if msg == "tunnel started" && record["status"] != string(tunnel.StatusRunning) {
+			t.Errorf("expected %q to carry status running, got %v", msg, record)
+		}
+		want[msg] = true
+	}
+
+	for msg, seen := range want {
+		if !seen {
+			t.Errorf("expected a %q record, got %v", msg, logs())
+		}
+	}
+}
+
+// lockedWriter serializes writes to w, for buffers shared with tunnel goroutines.
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// TestExportConfig_RoundTrips verifies that the exported config, including tunnels added at runtime, reloads into the
+// same tunnel configs.
+func TestExportConfig_RoundTrips(t *testing.T) {
+	cfg, err := config.Parse([]byte(`
+ssh:
+  user: testuser
+  password: testpass
+  host: bastion.com
+  insecureIgnoreHostKey: true
+tunnels:
+  - name: db
+    remoteHost: db-server
+    remotePort: 1521
+    localPort: 1521
+    maintenance: ["Sun 02:00-04:00"]
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mgr := NewManager(&cfg.SSH)
+	added := config.TunnelConfig{Name: "cache", RemoteHost: "redis", RemotePort: 6379, LocalPort: 6379, ShutdownGrace: 5 * time.Second}
+	for _, tunnelCfg := range append(cfg.TunnelConfigs, added) {
+		if err := mgr.Add(tunnelCfg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := mgr.ExportConfig(&out, config.ExportOptions{Secrets: config.SecretsInclude}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reloaded, err := config.Parse(out.Bytes())
+	if err != nil {
+		t.Fatalf("expected the export to load, got %v:\n%s", err, out.String())
+	}
+
+	want := []config.TunnelConfig{added, cfg.TunnelConfigs[0]}
+	if !reflect.DeepEqual(reloaded.TunnelConfigs, want) {
+		t.Errorf("expected tunnels %+v, got %+v", want, reloaded.TunnelConfigs)
+	}
+	if reloaded.SSH.User != cfg.SSH.User || reloaded.SSH.Password != cfg.SSH.Password || reloaded.SSH.Host != cfg.SSH.Host {
+		t.Errorf("expected the ssh block to round-trip, got %+v", reloaded.SSH)
+	}
+}
+
+// TestRun_CancelDuringStartAll verifies that cancelling during startup stops launching tunnels, skips the watcher, and
+// tears down the tunnels that already came up.
+func TestRun_CancelDuringStartAll(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	mgr.SetStartupPolicy(config.StartupConfig{Stagger: 500 * time.Millisecond})
+
+	for _, name := range []string{"t1", "t2", "t3", "t4"} {
+		_ = mgr.Add(config.TunnelConfig{Name: name, RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: 0})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &fakeWatcher{}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- mgr.Run(ctx, w)
+	}()
+
+	running := func() int {
+		count := 0
+		for _, s := range mgr.Status() {
+			if s == tunnel.StatusRunning {
+				count++
+			}
+		}
+		return count
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for running() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if count := running(); count != 1 {
+		t.Fatalf("expected exactly the first tunnel to be running, got %d", count)
+	}
+
+	cancel()
+	cancelledAt := time.Now()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected Run to return after cancel")
+	}
+
+	if elapsed := time.Since(cancelledAt); elapsed >= 500*time.Millisecond {
+		t.Errorf("expected Run to return before the next staggered start, took %s", elapsed)
+	}
+
+	if w.started {
+		t.Error("expected the watcher not to be started after an interrupted startup")
+	}
+
+	for name, s := range mgr.Status() {
+		if s != tunnel.StatusStopped {
+			t.Errorf("expected %s to be stopped, got %s", name, s)
+		}
+	}
+}
+
+// TestStartAll_StartupPolicySpreadsAttempts verifies that the startup stagger spreads the initial connection of each tunnel in time.
+func TestStartAll_StartupPolicySpreadsAttempts(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	mgr.SetStartupPolicy(config.StartupConfig{
+		Stagger: 100 * time.Millisecond,
+		Jitter:  20 * time.Millisecond,
+	})
+
+	for _, name := range []string{"t1", "t2", "t3"} {
+		_ = mgr.Add(config.TunnelConfig{Name: name, RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: 0})
+	}
+	events := mgr.Events()
+
+	if errors := mgr.StartAll(); len(errors) != 0 {
+		t.Fatalf("expected 0 errors, got %v", errors)
+	}
+	defer mgr.StopAll()
+
+	// Attempts are spread from when each one begins connecting; the handshake time that follows varies.
+	startedAt := make([]time.Time, 0, 3)
+	for len(startedAt) < 3 {
+		if event := <-events; event.To == tunnel.StatusStarting {
+			startedAt = append(startedAt, event.Time)
+		}
+	}
+	sort.Slice(startedAt, func(i, j int) bool { return startedAt[i].Before(startedAt[j]) })
+
+	for i := 1; i < len(startedAt); i++ {
+		if gap := startedAt[i].Sub(startedAt[i-1]); gap < 100*time.Millisecond {
+			t.Errorf("expected starts to be at least 100ms apart, got %s", gap)
+		}
+	}
+}
+
+// TestStartAll_StartupPolicyRetries verifies that failed initial starts are retried with backoff before giving up.
+func TestStartAll_StartupPolicyRetries(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	mgr.SetStartupPolicy(config.StartupConfig{InitialRetries: 2, Backoff: 50 * time.Millisecond})
+
+	_ = mgr.Add(config.TunnelConfig{Name: "t1", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: 0})
+
+	begin := time.Now()
+	errors := mgr.StartAll()
+
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error, got %v", errors)
+	}
+
+	if elapsed := time.Since(begin); elapsed < 150*time.Millisecond {
+		t.Errorf("expected two backoff waits (50ms + 100ms), finished after %s", elapsed)
+	}
+}
+
+// TestStartAll_DependsOn verifies that tunnels start after the ones they depend on, and are skipped when a dependency
+// fails to start.
+func TestStartAll_DependsOn(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	unreachable := *sshCfg
+	unreachable.Port = freePort(t)
+
+	mgr := NewManager(sshCfg)
+	defer mgr.Close()
+	mgr.SetStartupPolicy(config.StartupConfig{MaxConcurrentStarts: 4})
+
+	for _, cfg := range []config.TunnelConfig{
+		{Name: "web", RemoteHost: "127.0.0.1", RemotePort: 80, DependsOn: []string{"app"}},
+		{Name: "app", RemoteHost: "127.0.0.1", RemotePort: 8080, DependsOn: []string{"proxy"}},
+		{Name: "proxy", RemoteHost: "127.0.0.1", RemotePort: 3128},
+		{Name: "broken", RemoteHost: "127.0.0.1", RemotePort: 5432, SSH: &unreachable},
+		{Name: "reports", RemoteHost: "127.0.0.1", RemotePort: 9090, DependsOn: []string{"broken"}},
+	} {
+		if err := mgr.Add(cfg); err != nil {
+			t.Fatalf("failed to add %s: %v", cfg.Name, err)
+		}
+	}
+
+	events := mgr.Events()
+	errs := mgr.StartAll()
+	defer mgr.StopAll()
+
+	if len(errs) != 2 || errs["broken"] == nil || errs["reports"] == nil {
+		t.Fatalf("expected broken and reports to fail, got %v", errs)
+	}
+	if !strings.Contains(errs["reports"].Error(), "dependency broken") {
+		t.Errorf("expected reports to be skipped for its dependency, got %v", errs["reports"])
+	}
+	if status := mgr.Status()["reports"]; status == tunnel.StatusRunning {
+		t.Error("expected reports not to be started")
+	}
+
+	var order []string
+	for len(order) < 3 {
+		select {
+		case event := <-events:
+			if event.To == tunnel.StatusRunning {
+				order = append(order, event.Tunnel)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected three tunnels to start, saw %v", order)
+		}
+	}
+	if !slices.Equal(order, []string{"proxy", "app", "web"}) {
+		t.Errorf("expected proxy, app, web to start in order, got %v", order)
+	}
+}
+
+// TestStart_RetriesConnection verifies that Start retries a failed connection per startRetries, succeeding once the SSH
+// server answers.
+func TestStart_RetriesConnection(t *testing.T) {
+	sshServer, _ := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	// flaky drops the first two connections before relaying to the SSH server, like a bastion still coming up.
+	flaky, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer flaky.Close()
+
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := flaky.Accept()
+			if err != nil {
+				return
+			}
+			if accepted.Add(1) <= 2 {
+				conn.Close()
+				continue
+			}
+			go func() {
+				defer conn.Close()
+				upstream, err := net.Dial("tcp", sshServer.Addr().String())
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				go io.Copy(upstream, conn)
+				_, _ = io.Copy(conn, upstream)
+			}()
+		}
+	}()
+
+	sshCfg, err := tunnel.NewSSHConfig("testuser", "testpass", "", "127.0.0.1", "", flaky.Addr().(*net.TCPAddr).Port)
+	if err != nil {
+		t.Fatalf("failed to create ssh config: %v", err)
+	}
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	_ = mgr.Add(config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: 0,
+		StartRetries: 3, StartRetryInterval: 10 * time.Millisecond})
+
+	if err := mgr.Start("db"); err != nil {
+		t.Fatalf("expected the start to succeed on a retry, got %v", err)
+	}
+	if got := accepted.Load(); got != 3 {
+		t.Errorf("expected 3 connection attempts, got %d", got)
+	}
+	if status := mgr.Status()["db"]; status != tunnel.StatusRunning {
+		t.Errorf("expected db running, got %s", status)
+	}
+}
+
+// TestStart_RetriesGiveUp verifies that Start returns the last error once its retries run out, and stops retrying when
+// its context is done.
+func TestStart_RetriesGiveUp(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+
+	_ = mgr.Add(config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: 0,
+		StartRetries: 2, StartRetryInterval: 50 * time.Millisecond})
+
+	begin := time.Now()
+	err := mgr.Start("db")
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("expected the last connection error, got %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed < 150*time.Millisecond {
+		t.Errorf("expected two backoff waits (50ms + 100ms), finished after %s", elapsed)
+	}
+
+	_ = mgr.Add(config.TunnelConfig{Name: "cache", RemoteHost: "127.0.0.1", RemotePort: 6379, LocalPort: 0,
+		StartRetries: 5, StartRetryInterval: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	begin = time.Now()
+	if err := mgr.StartContext(ctx, "cache"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+		t.Errorf("expected cancelling the context to end the retries, took %s", elapsed)
+	}
+}
+
+// TestStart_RemotePortCommand verifies that the tunnel forwards to the port printed by remotePortCommand.
+func TestStart_RemotePortCommand(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create destination server: %v", err)
+	}
+	defer destServer.Close()
+
+	go func() {
+		for {
+			conn, err := destServer.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("ok"))
+			conn.Close()
+		}
+	}()
+
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+
+	mgr := NewManager(sshCfg)
+	_ = mgr.Add(config.TunnelConfig{
+		Name:              "test",
+		RemoteHost:        "127.0.0.1",
+		RemotePortCommand: fmt.Sprintf("echo %d", destPort),
+		LocalPort:         0,
+	})
+
+	if err := mgr.Start("test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer mgr.Stop("test")
+
+	tun := mgr.Get("test")
+	if want := net.JoinHostPort("127.0.0.1", strconv.Itoa(destPort)); tun.RemoteAddr() != want {
+		t.Errorf("expected remote addr %s, got %s", want, tun.RemoteAddr())
+	}
+
+	conn, err := net.Dial("tcp", tun.LocalAddr())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("failed to read through tunnel: %v", err)
+	}
+
+	if string(buf) != "ok" {
+		t.Errorf("expected 'ok', got %q", buf)
+	}
+}
+
+// TestStart_RemotePortCommandGarbage verifies that a command printing something other than a port fails the start.
+func TestStart_RemotePortCommandGarbage(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	_ = mgr.Add(config.TunnelConfig{
+		Name:              "test",
+		RemoteHost:        "127.0.0.1",
+		RemotePortCommand: "echo not-a-port",
+		LocalPort:         0,
+	})
+
+	err := mgr.Start("test")
+	if err == nil {
+		t.Fatal("expected error for garbage port command output")
+	}
+
+	if !strings.Contains(err.Error(), "invalid port") {
+		t.Errorf("expected invalid port error, got %v", err)
+	}
+
+	if status := mgr.Status()["test"]; status != tunnel.StatusError {
+		t.Errorf("expected status error, got %s", status)
+	}
+}
+
+// TestSetRunning verifies that SetRunning only reports a change when the tunnel actually needs to start or stop.
+func TestSetRunning(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	_ = mgr.Add(config.TunnelConfig{Name: "test", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: 0})
+
+	steps := []struct {
+		running     bool
+		wantChanged bool
+		wantStatus  tunnel.Status
+	}{
+		{running: false, wantChanged: false, wantStatus: tunnel.StatusStopped},
+		{running: true, wantChanged: true, wantStatus: tunnel.StatusRunning},
+		{running: true, wantChanged: false, wantStatus: tunnel.StatusRunning},
+		{running: false, wantChanged: true, wantStatus: tunnel.StatusStopped},
+	}
+
+	for i, step := range steps {
+		changed, err := mgr.SetRunning("test", step.running)
+		if err != nil {
+			t.Fatalf("step %d: unexpected error: %v", i, err)
+		}
+
+		if changed != step.wantChanged {
+			t.Errorf("step %d: expected changed=%v, got %v", i, step.wantChanged, changed)
+		}
+
+		if status := mgr.Status()["test"]; status != step.wantStatus {
+			t.Errorf("step %d: expected status %s, got %s", i, step.wantStatus, status)
+		}
+
+		wantDesired := DesiredStopped
+		if step.running {
+			wantDesired = DesiredRunning
+		}
+		if desired := mgr.Snapshot()[0].Desired; desired != wantDesired {
+			t.Errorf("step %d: expected desired %s, got %s", i, wantDesired, desired)
+		}
+	}
+}
+
+// TestSetRunning_NotFound verifies that SetRunning returns an error for an unknown tunnel.
+func TestSetRunning_NotFound(t *testing.T) {
+	cfg, _ := tunnel.NewSSHConfig("user", "pass", "", "localhost", "", 22)
+	mgr := NewManager(cfg)
+
+	if _, err := mgr.SetRunning("not-exists", true); err == nil {
+		t.Fatal("expected error for non-existent tunnel")
+	}
+}
+
+// TestStopAllContext_DrainsUntilCancelled verifies that a tunnel without a shutdownGrace of its own drains for
+// shutdown.drainTimeout, its open connection flowing meanwhile, and that the connection is closed once the context
+// bounding the shutdown expires, well before that timeout.
+func TestStopAllContext_DrainsUntilCancelled(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create destination server: %v", err)
+	}
+	defer destServer.Close()
+
+	go func() {
+		for {
+			conn, err := destServer.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	mgr := NewManager(sshCfg)
+	mgr.SetShutdownPolicy(config.ShutdownConfig{DrainTimeout: 10 * time.Second})
+	_ = mgr.Add(config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: destServer.Addr().(*net.TCPAddr).Port})
+
+	if errs := mgr.StartAll(); len(errs) != 0 {
+		t.Fatalf("unexpected start errors: %v", errs)
+	}
+
+	conn, err := net.Dial("tcp", mgr.Get("db").LocalAddr())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	echo := func(msg string) error {
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			return err
+		}
+		_, err := io.ReadFull(conn, make([]byte, len(msg)))
+		return err
+	}
+	if err := echo("before"); err != nil {
+		t.Fatalf("failed to echo before stopping: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	stopped := make(chan map[string]error, 1)
+	go func() { stopped <- mgr.StopAllContext(ctx) }()
+
+	time.Sleep(100 * time.Millisecond)
+	if err := echo("during"); err != nil {
+		t.Fatalf("expected the connection to keep flowing while draining, got %v", err)
+	}
+
+	if errs := <-stopped; len(errs) != 0 {
+		t.Fatalf("unexpected stop errors: %v", errs)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the drain to end when the context expired, took %s", elapsed)
+	}
+
+	if err := echo("after"); err == nil {
+		t.Error("expected the connection to be closed after the drain was cut short")
+	}
+	if status := mgr.Status()["db"]; status != tunnel.StatusStopped {
+		t.Errorf("expected db to be stopped, got %s", status)
+	}
+}
+
+// TestStopAll_ShutdownGraceInParallel verifies that StopAll drains every tunnel concurrently, each for its own grace period.
+func TestStopAll_ShutdownGraceInParallel(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create destination server: %v", err)
+	}
+	defer destServer.Close()
+
+	go func() {
+		for {
+			conn, err := destServer.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+
+	mgr := NewManager(sshCfg)
+	_ = mgr.Add(config.TunnelConfig{Name: "short", RemoteHost: "127.0.0.1", RemotePort: destPort, ShutdownGrace: 300 * time.Millisecond})
+	_ = mgr.Add(config.TunnelConfig{Name: "long", RemoteHost: "127.0.0.1", RemotePort: destPort, ShutdownGrace: 600 * time.Millisecond})
+
+	if errs := mgr.StartAll(); len(errs) != 0 {
+		t.Fatalf("unexpected start errors: %v", errs)
+	}
+
+	for _, name := range []string{"short", "long"} {
+		conn, err := net.Dial("tcp", mgr.Get(name).LocalAddr())
+		if err != nil {
+			t.Fatalf("failed to connect to %s: %v", name, err)
+		}
+		defer conn.Close()
+
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := conn.Write([]byte("x")); err != nil {
+			t.Fatalf("failed to write through %s: %v", name, err)
+		}
+		if _, err := io.ReadFull(conn, make([]byte, 1)); err != nil {
+			t.Fatalf("failed to read through %s: %v", name, err)
+		}
+	}
+
+	start := time.Now()
+	if errs := mgr.StopAll(); len(errs) != 0 {
+		t.Fatalf("unexpected stop errors: %v", errs)
+	}
+	elapsed := time.Since(start)
+
+	if elapsed < 600*time.Millisecond {
+		t.Errorf("expected StopAll to wait for the longest grace period, took %s", elapsed)
+	}
+	if elapsed >= 900*time.Millisecond {
+		t.Errorf("expected tunnels to drain in parallel, took %s", elapsed)
+	}
+
+	for name, status := range mgr.Status() {
+		if status != tunnel.StatusStopped {
+			t.Errorf("expected %s to be stopped, got %s", name, status)
+		}
+	}
+}
+
+// TestStuck_ReportsTunnelDownPastThreshold verifies that a tunnel desired running but errored is reported as stuck only
+// after the configured threshold, while a tunnel desired stopped never is.
+func TestStuck_ReportsTunnelDownPastThreshold(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	mgr.SetStuckThreshold(100 * time.Millisecond)
+	_ = mgr.Add(config.TunnelConfig{Name: "broken", RemoteHost: "127.0.0.1", RemotePort: 1521})
+	_ = mgr.Add(config.TunnelConfig{Name: "idle", RemoteHost: "127.0.0.1", RemotePort: 1522})
+
+	if err := mgr.Start("broken"); err == nil {
+		t.Fatal("expected start to fail with the ssh server closed")
+	}
+
+	if stuck := mgr.Stuck(); len(stuck) != 0 {
+		t.Fatalf("expected no stuck tunnels before the threshold, got %v", stuck)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	stuck := mgr.Stuck()
+	if len(stuck) != 1 || stuck[0].Name != "broken" {
+		t.Fatalf("expected only broken to be stuck, got %v", stuck)
+	}
+	if stuck[0].Actual != tunnel.StatusError {
+		t.Errorf("expected stuck tunnel to be errored, got %s", stuck[0].Actual)
+	}
+
+	for _, h := range mgr.HealthCheck() {
+		if h.Stuck != (h.Name == "broken") {
+			t.Errorf("expected %s stuck=%v, got %v", h.Name, h.Name == "broken", h.Stuck)
+		}
+	}
+
+	_ = mgr.Stop("broken")
+	if stuck := mgr.Stuck(); len(stuck) != 0 {
+		t.Errorf("expected no stuck tunnels once desired stopped, got %v", stuck)
+	}
+}
+
+// TestErrors_AggregatesRepeatedFailures verifies that repeated start failures are counted in one record while a
+// different failure gets its own.
+func TestErrors_AggregatesRepeatedFailures(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to occupy local port: %v", err)
+	}
+	defer occupied.Close()
+
+	mgr := NewManager(sshCfg)
+	_ = mgr.Add(config.TunnelConfig{
+		Name:       "flaky",
+		RemoteHost: "127.0.0.1",
+		RemotePort: 1521,
+		LocalPort:  occupied.Addr().(*net.TCPAddr).Port,
+	})
+
+	if err := mgr.Start("flaky"); err == nil {
+		t.Fatal("expected start to fail while the local port is taken")
+	}
+
+	sshServer.Close()
+	for range 3 {
+		if err := mgr.Start("flaky"); err == nil {
+			t.Fatal("expected start to fail with the ssh server closed")
+		}
+	}
+
+	records, err := mgr.Errors("flaky")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 distinct errors, got %d: %+v", len(records), records)
+	}
+
+	if !strings.Contains(records[0].Message, "failed to connect to ssh server") || records[0].Count != 3 {
+		t.Errorf("expected the ssh failure first with count 3, got %+v", records[0])
+	}
+
+	if !strings.Contains(records[1].Message, "failed to create local listener") || records[1].Count != 1 {
+		t.Errorf("expected the listener failure with count 1, got %+v", records[1])
+	}
+
+	if records[0].FirstSeen.After(records[0].LastSeen) {
+		t.Errorf("expected first seen %s not after last seen %s", records[0].FirstSeen, records[0].LastSeen)
+	}
+
+	if _, err := mgr.Errors("missing"); err == nil {
+		t.Error("expected error for unknown tunnel")
+	}
+}
+
+// TestMaintenance_SuppressesRestartsAndStuckWarnings verifies that a tunnel failing inside its maintenance window is
+// neither restarted nor reported as stuck, and that restarts resume once the window closes.
+func TestMaintenance_SuppressesRestartsAndStuckWarnings(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+
+	// Sunday 03:00, inside the "Sun 02:00-04:00" window.
+	var now atomic.Int64
+	now.Store(time.Date(2025, time.June, 1, 3, 0, 0, 0, time.UTC).UnixNano())
+
+	mgr := NewManager(sshCfg)
+	defer mgr.Close()
+	mgr.SetClock(func() time.Time { return time.Unix(0, now.Load()) })
+	mgr.SetStuckThreshold(time.Millisecond)
+
+	_ = mgr.Add(config.TunnelConfig{
+		Name:        "db",
+		RemoteHost:  "127.0.0.1",
+		RemotePort:  1521,
+		Maintenance: []string{"Sun 02:00-04:00"},
+		AutoRestart: config.AutoRestartConfig{Enabled: true, Interval: 20 * time.Millisecond},
+	})
+
+	if err := mgr.Start("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mgr.StartController(20 * time.Millisecond)
+
+	sshServer.Close()
+	if err := mgr.Reconnect("db"); err == nil {
+		t.Fatal("expected reconnect to fail with the ssh server closed")
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	records, _ := mgr.Errors("db")
+	if len(records) != 1 || records[0].Count != 1 {
+		t.Fatalf("expected no restart attempts during maintenance, got %+v", records)
+	}
+
+	if stuck := mgr.Stuck(); len(stuck) != 0 {
+		t.Errorf("expected no stuck warnings during maintenance, got %+v", stuck)
+	}
+
+	health := mgr.HealthCheck()
+	if len(health) != 1 || health[0].Healthy || !health[0].Maintenance {
+		t.Errorf("expected an unhealthy tunnel flagged as in maintenance, got %+v", health)
+	}
+
+	now.Store(time.Date(2025, time.June, 1, 4, 0, 0, 0, time.UTC).UnixNano())
+	time.Sleep(200 * time.Millisecond)
+
+	records, _ = mgr.Errors("db")
+	if len(records) != 1 || records[0].Count < 2 {
+		t.Errorf("expected restart attempts after the window closed, got %+v", records)
+	}
+
+	if stuck := mgr.Stuck(); len(stuck) != 1 {
+		t.Errorf("expected the tunnel to be stuck after the window closed, got %+v", stuck)
+	}
+}
+
+// TestAddAndStart_Success verifies that AddAndStart registers the tunnel and leaves it running.
+func TestAddAndStart_Success(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	if err := mgr.AddAndStart(config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tun := mgr.Get("db")
+	if tun == nil {
+		t.Fatal("expected tunnel to be registered")
+	}
+	if tun.Status() != tunnel.StatusRunning {
+		t.Errorf("expected status %s, got %s", tunnel.StatusRunning, tun.Status())
+	}
+}
+
+// TestAddAndStart_StartFailure verifies that a failed start rolls the add back by default and keeps an errored tunnel
+// that is still desired running when asked to.
+func TestAddAndStart_StartFailure(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+
+	if err := mgr.AddAndStart(config.TunnelConfig{Name: "rolled-back", RemoteHost: "127.0.0.1", RemotePort: 1521}, false); err == nil {
+		t.Fatal("expected start failure")
+	}
+	if mgr.Get("rolled-back") != nil {
+		t.Error("expected the tunnel to be removed after the failed start")
+	}
+
+	if err := mgr.AddAndStart(config.TunnelConfig{Name: "kept", RemoteHost: "127.0.0.1", RemotePort: 1522}, true); err == nil {
+		t.Fatal("expected start failure")
+	}
+
+	snapshot := mgr.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].Name != "kept" {
+		t.Fatalf("expected only the kept tunnel, got %+v", snapshot)
+	}
+	if snapshot[0].Actual != tunnel.StatusError || snapshot[0].Desired != DesiredRunning {
+		t.Errorf("expected kept tunnel errored and desired running, got %+v", snapshot[0])
+	}
+
+	if err := mgr.AddAndStart(config.TunnelConfig{Name: "kept", RemoteHost: "127.0.0.1", RemotePort: 1522}, false); err == nil {
+		t.Error("expected duplicate add to fail")
+	}
+	if mgr.Get("kept") == nil {
+		t.Error("expected a failed duplicate add not to remove the existing tunnel")
+	}
+}
+
+// TestProbe_SSHModeBypassesLocalListener verifies that an ssh-mode probe reflects whether the remote service is reachable
+// while leaving the tunnel's client connection counters untouched.
+func TestProbe_SSHModeBypassesLocalListener(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create destination server: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := destServer.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.Close()
+
+	_ = mgr.Add(config.TunnelConfig{
+		Name:       "db",
+		RemoteHost: "127.0.0.1",
+		RemotePort: destServer.Addr().(*net.TCPAddr).Port,
+		Probe:      config.ProbeConfig{Mode: config.ProbeModeSSH, Interval: 20 * time.Millisecond, Timeout: time.Second},
+	})
+	if err := mgr.Start("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	health := mgr.HealthCheck()
+	if !health[0].Healthy || health[0].ProbeError != nil {
+		t.Errorf("expected probe to pass while the remote is up, got %+v", health[0])
+	}
+
+	destServer.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	health = mgr.HealthCheck()
+	if health[0].Healthy || health[0].ProbeError == nil {
+		t.Errorf("expected probe to fail once the remote is down, got %+v", health[0])
+	}
+	if health[0].Status != tunnel.StatusRunning {
+		t.Errorf("expected the tunnel itself to stay running, got %s", health[0].Status)
+	}
+
+	if stats := mgr.Get("db").Stats(); stats.Connections != 0 || stats.ActiveConnections != 0 {
+		t.Errorf("expected probes not to count as client connections, got %+v", stats)
+	}
+}
+
+// freePort returns a loopback port that was free when checked.
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// TestReconcile_MovesLocalPortBetweenTunnels verifies that a port released by a removed or changed tunnel can be bound
+// by another tunnel in the same reconcile pass.
+func TestReconcile_MovesLocalPortBetweenTunnels(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	port := freePort(t)
+	otherPort := freePort(t)
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	if err := mgr.AddAndStart(config.TunnelConfig{Name: "a", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: port}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, _ = mgr.Reconcile(&config.Config{
+		SSH:           *sshCfg,
+		TunnelConfigs: []config.TunnelConfig{{Name: "b", RemoteHost: "127.0.0.1", RemotePort: 1522, LocalPort: port}},
+	})
+
+	for _, h := range mgr.HealthCheck() {
+		if h.Name != "b" || h.Status != tunnel.StatusRunning {
+			t.Fatalf("expected only b running after taking a's port, got %+v", h)
+		}
+	}
+	if got := mgr.Get("b").LocalPort(); got != port {
+		t.Errorf("expected b on port %d, got %d", port, got)
+	}
+
+	_, _ = mgr.Reconcile(&config.Config{
+		SSH: *sshCfg,
+		TunnelConfigs: []config.TunnelConfig{
+			{Name: "b", RemoteHost: "127.0.0.1", RemotePort: 1522, LocalPort: otherPort},
+			{Name: "c", RemoteHost: "127.0.0.1", RemotePort: 1523, LocalPort: port},
+		},
+	})
+
+	for _, h := range mgr.HealthCheck() {
+		if h.Status != tunnel.StatusRunning {
+			t.Errorf("expected %s running after moving the port, got %s: %v", h.Name, h.Status, h.Error)
+		}
+	}
+	if got := mgr.Get("b").LocalPort(); got != otherPort {
+		t.Errorf("expected changed b to move to port %d, got %d", otherPort, got)
+	}
+	if got := mgr.Get("c").LocalPort(); got != port {
+		t.Errorf("expected c on port %d, got %d", port, got)
+	}
+}
+
+// TestResetDueStats_MonthlyBoundary verifies that crossing the monthly boundary records the finished period's totals
+// and then zeroes the tunnel's counters.
+func TestResetDueStats_MonthlyBoundary(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create destination server: %v", err)
+	}
+	defer destServer.Close()
+
+	go func() {
+		for {
+			conn, err := destServer.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	var now atomic.Int64
+	now.Store(time.Date(2025, time.June, 30, 23, 59, 0, 0, time.UTC).UnixNano())
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+	mgr.SetClock(func() time.Time { return time.Unix(0, now.Load()).UTC() })
+
+	_ = mgr.AddAndStart(config.TunnelConfig{
+		Name:       "db",
+		RemoteHost: "127.0.0.1",
+		RemotePort: destServer.Addr().(*net.TCPAddr).Port,
+		StatsReset: "monthly",
+	}, false)
+
+	conn, err := net.Dial("tcp", mgr.Get("db").LocalAddr())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if _, err := io.ReadFull(conn, make([]byte, 5)); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for mgr.Get("db").Stats().BytesIn == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mgr.resetDueStats()
+	if _, ok := mgr.PreviousPeriod("db"); ok {
+		t.Fatal("expected no completed period before the boundary")
+	}
+
+	now.Store(time.Date(2025, time.July, 1, 0, 1, 0, 0, time.UTC).UnixNano())
+	mgr.resetDueStats()
+
+	totals, ok := mgr.PreviousPeriod("db")
+	if !ok {
+		t.Fatal("expected the June period to be recorded")
+	}
+	if totals.BytesIn != 5 || totals.BytesOut != 5 || totals.Connections != 1 {
+		t.Errorf("expected June totals of 5 bytes each way over 1 connection, got %+v", totals)
+	}
+	if !totals.Start.Equal(time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC)) || !totals.End.Equal(time.Date(2025, time.July, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the period to span June, got %s to %s", totals.Start, totals.End)
+	}
+
+	if stats := mgr.Get("db").Stats(); stats.BytesIn != 0 || stats.BytesOut != 0 || stats.Connections != 0 {
+		t.Errorf("expected counters to be reset, got %+v", stats)
+	}
+}
+
+// TestSummary_CountsMixedStates verifies Summary agrees with a known mix of running, stopped, and errored tunnels.
+func TestSummary_CountsMixedStates(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	_ = mgr.Add(config.TunnelConfig{Name: "up-a", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: 0})
+	_ = mgr.Add(config.TunnelConfig{Name: "up-b", RemoteHost: "127.0.0.1", RemotePort: 1522, LocalPort: 0})
+	_ = mgr.Add(config.TunnelConfig{Name: "idle", RemoteHost: "127.0.0.1", RemotePort: 1523, LocalPort: 0})
+	_ = mgr.Add(config.TunnelConfig{Name: "broken", RemoteHost: "127.0.0.1", RemotePortCommand: "echo not-a-port", LocalPort: 0})
+
+	if err := mgr.Start("up-a"); err != nil {
+		t.Fatalf("failed to start up-a: %v", err)
+	}
+	if err := mgr.Start("up-b"); err != nil {
+		t.Fatalf("failed to start up-b: %v", err)
+	}
+	if err := mgr.Start("broken"); err == nil {
+		t.Fatal("expected broken to fail to start")
+	}
+
+	summary := mgr.Summary()
+
+	want := Summary{Total: 4, Running: 2, Stopped: 1, Errored: 1, Healthy: 2, Unhealthy: 2}
+	got := summary
+	got.UnhealthyNames = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected counts %+v, got %+v", want, got)
+	}
+
+	if !reflect.DeepEqual(summary.UnhealthyNames, []string{"broken", "idle"}) {
+		t.Errorf("expected sorted unhealthy names [broken idle], got %v", summary.UnhealthyNames)
+	}
+
+	healthy := 0
+	for _, status := range mgr.HealthCheck() {
+		if status.Healthy {
+			healthy++
+		}
+	}
+	if healthy != summary.Healthy {
+		t.Errorf("expected Summary to agree with HealthCheck, got %d vs %d healthy", summary.Healthy, healthy)
+	}
+}
+
+// TestAccess_RefusesConnectionsOutsideWindow verifies that new connections are refused outside a tunnel's access
+// schedule and forwarded inside it, while the tunnel itself stays up.
+func TestAccess_RefusesConnectionsOutsideWindow(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create destination server: %v", err)
+	}
+	defer destServer.Close()
+
+	go func() {
+		for {
+			conn, err := destServer.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("ok"))
+			conn.Close()
+		}
+	}()
+
+	// Saturday 12:00, outside the "Mon-Fri 09:00-18:00" window.
+	var now atomic.Int64
+	now.Store(time.Date(2025, time.June, 7, 12, 0, 0, 0, time.UTC).UnixNano())
+
+	mgr := NewManager(sshCfg)
+	defer mgr.Close()
+	mgr.SetClock(func() time.Time { return time.Unix(0, now.Load()) })
+
+	_ = mgr.Add(config.TunnelConfig{
+		Name:       "db",
+		RemoteHost: "127.0.0.1",
+		RemotePort: destServer.Addr().(*net.TCPAddr).Port,
+		Access:     []string{"Mon-Fri 09:00-18:00"},
+	})
+	if err := mgr.Start("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	read := func() (string, error) {
+		conn, err := net.Dial("tcp", mgr.Get("db").LocalAddr())
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		data, err := io.ReadAll(conn)
+		return string(data), err
+	}
+
+	if data, err := read(); err != nil || data != "" {
+		t.Errorf("expected the connection to be closed unanswered outside the window, got %q, %v", data, err)
+	}
+	if status := mgr.Status()["db"]; status != tunnel.StatusRunning {
+		t.Errorf("expected the tunnel to stay running, got %s", status)
+	}
+
+	// Monday 10:00, inside the window.
+	now.Store(time.Date(2025, time.June, 9, 10, 0, 0, 0, time.UTC).UnixNano())
+
+	if data, err := read(); err != nil || data != "ok" {
+		t.Errorf("expected the connection to be forwarded inside the window, got %q, %v", data, err)
+	}
+
+	if stats := mgr.Get("db").Stats(); stats.Connections != 1 {
+		t.Errorf("expected only the allowed connection to be counted, got %d", stats.Connections)
+	}
+}
+
+// TestTotalStats_AggregatesTunnels verifies that TotalStats adds up the traffic and connections of every tunnel,
+// including the traffic of connections that are still open.
+func TestTotalStats_AggregatesTunnels(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create destination server: %v", err)
+	}
+	defer destServer.Close()
+
+	go func() {
+		for {
+			conn, err := destServer.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+	for _, name := range []string{"db", "cache"} {
+		if err := mgr.AddAndStart(config.TunnelConfig{Name: name, RemoteHost: "127.0.0.1", RemotePort: destPort}, false); err != nil {
+			t.Fatalf("failed to start %s: %v", name, err)
+		}
+	}
+
+	open := func(name, msg string) net.Conn {
+		conn, err := net.Dial("tcp", mgr.Get(name).LocalAddr())
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		if _, err := io.ReadFull(conn, make([]byte, len(msg))); err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		return conn
+	}
+
+	open("db", "hello").Close()
+	held := open("cache", "hi")
+	defer held.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for mgr.Get("db").Stats().ActiveConnections != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	total := mgr.TotalStats()
+	if total.BytesIn != 7 || total.BytesOut != 7 {
+		t.Errorf("expected 7 bytes each way across tunnels, got in %d, out %d", total.BytesIn, total.BytesOut)
+	}
+	if total.Connections != 2 || total.ActiveConnections != 1 {
+		t.Errorf("expected 2 connections with 1 still open, got %d and %d", total.Connections, total.ActiveConnections)
+	}
+	if total.StartedAt.IsZero() || total.LastActivity.IsZero() {
+		t.Errorf("expected start and activity times to be set, got %+v", total)
+	}
+}
+
+// TestProbe_AppProbeReflectsResponse verifies that a send-and-expect probe marks a tunnel healthy only while the
+// application behind it answers correctly.
+// TestProbe_PerTunnelThresholds verifies that each tunnel turns unhealthy and recovers only after its own number of
+// consecutive failed and passing probes.
+func TestProbe_PerTunnelThresholds(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.Close()
+
+	var failing atomic.Bool
+	check := probe.Func(func(net.Conn) error {
+		if failing.Load() {
+			return fmt.Errorf("probe failed")
+		}
+		return nil
+	})
+
+	thresholds := map[string][2]int{"batch": {3, 1}, "critical": {1, 2}}
+	for name, th := range thresholds {
+		_ = mgr.Add(config.TunnelConfig{
+			Name:       name,
+			RemoteHost: "127.0.0.1",
+			RemotePort: 1521,
+			Probe: config.ProbeConfig{
+				Mode:             config.ProbeModeLocal,
+				Interval:         time.Hour,
+				FailureThreshold: th[0],
+				SuccessThreshold: th[1],
+			},
+		})
+		_ = mgr.SetAppProbe(name, check)
+		if err := mgr.Start(name); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	healthy := func() map[string]bool {
+		result := make(map[string]bool)
+		for _, h := range mgr.HealthCheck() {
+			result[h.Name] = h.Healthy
+		}
+		return result
+	}
+
+	steps := []struct {
+		failing bool
+		want    map[string]bool
+	}{
+		{true, map[string]bool{"batch": true, "critical": false}},
+		{true, map[string]bool{"batch": true, "critical": false}},
+		{true, map[string]bool{"batch": false, "critical": false}},
+		{false, map[string]bool{"batch": true, "critical": false}},
+		{false, map[string]bool{"batch": true, "critical": true}},
+	}
+
+	for i, step := range steps {
+		failing.Store(step.failing)
+		for name := range thresholds {
+			mgr.runProbe(name)
+		}
+
+		if got := healthy(); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("after probe %d (failing=%t): expected %v, got %v", i+1, step.failing, step.want, got)
+		}
+	}
+}
+
+func TestProbe_AppProbeReflectsResponse(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	var reply atomic.Value
+	reply.Store("PONG\n")
+
+	destServer, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create destination server: %v", err)
+	}
+	defer destServer.Close()
+
+	go func() {
+		for {
+			conn, err := destServer.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 5)
+				if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "PING\n" {
+					return
+				}
+				_, _ = conn.Write([]byte(reply.Load().(string)))
+			}()
+		}
+	}()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.Close()
+
+	_ = mgr.Add(config.TunnelConfig{
+		Name:       "db",
+		RemoteHost: "127.0.0.1",
+		RemotePort: destServer.Addr().(*net.TCPAddr).Port,
+		Probe: config.ProbeConfig{
+			Mode:     config.ProbeModeLocal,
+			Interval: 20 * time.Millisecond,
+			Timeout:  time.Second,
+			Send:     "PING\n",
+			Expect:   "PONG\n",
+		},
+	})
+	if err := mgr.Start("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if health := mgr.HealthCheck(); !health[0].Healthy || health[0].ProbeError != nil {
+		t.Errorf("expected the probe to pass on a correct response, got %+v", health[0])
+	}
+
+	reply.Store("NOPE\n")
+	time.Sleep(150 * time.Millisecond)
+
+	health := mgr.HealthCheck()
+	if health[0].Healthy || health[0].ProbeError == nil {
+		t.Errorf("expected the probe to fail on an incorrect response, got %+v", health[0])
+	}
+	if health[0].Status != tunnel.StatusRunning {
+		t.Errorf("expected the tunnel itself to stay running, got %s", health[0].Status)
+	}
+
+	if err := mgr.SetAppProbe("db", probe.ExpectBanner(nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	if health := mgr.HealthCheck(); !health[0].Healthy {
+		t.Errorf("expected a custom probe to replace the configured one, got %+v", health[0])
+	}
+}
+
+// TestProbe_HTTPReflectsStatusAndRestarts verifies that an http probe marks the tunnel unhealthy while the service
+// behind it answers with an error, even though the tunnel itself runs, and that restartOnFailure restarts it.
+func TestProbe_HTTPReflectsStatusAndRestarts(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	var code atomic.Int32
+	code.Store(http.StatusOK)
+
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(int(code.Load()))
+	}))
+	defer service.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.Close()
+
+	_ = mgr.Add(config.TunnelConfig{
+		Name:       "api",
+		RemoteHost: "127.0.0.1",
+		RemotePort: service.Listener.Addr().(*net.TCPAddr).Port,
+		Probe: config.ProbeConfig{
+			Mode:             config.ProbeModeHTTP,
+			Interval:         20 * time.Millisecond,
+			Timeout:          time.Second,
+			Path:             "/healthz",
+			RestartOnFailure: true,
+		},
+	})
+	if err := mgr.Start("api"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if health := mgr.HealthCheck(); !health[0].Healthy {
+		t.Errorf("expected the probe to pass on 200, got %+v", health[0])
+	}
+
+	code.Store(http.StatusServiceUnavailable)
+	time.Sleep(150 * time.Millisecond)
+
+	health := mgr.HealthCheck()
+	if health[0].Healthy || health[0].ProbeError == nil || !strings.Contains(health[0].ProbeError.Error(), "503") {
+		t.Errorf("expected the probe to fail on 503, got %+v", health[0])
+	}
+
+	snapshots := mgr.Snapshot()
+	if snapshots[0].Restarts != 1 {
+		t.Errorf("expected one restart after the probe failed, got %d", snapshots[0].Restarts)
+	}
+	if snapshots[0].Actual != tunnel.StatusRunning {
+		t.Errorf("expected the tunnel to run again after its restart, got %s", snapshots[0].Actual)
+	}
+
+	code.Store(http.StatusOK)
+	time.Sleep(150 * time.Millisecond)
+
+	if health := mgr.HealthCheck(); !health[0].Healthy {
+		t.Errorf("expected the probe to recover, got %+v", health[0])
+	}
+}
+
+// TestReconcile_Modes verifies the state each reconcile mode leaves behind when a new tunnel fails to start: best-effort
+// applies everything else, strict stops at the failure, and transactional restores the previous tunnels.
+func TestReconcile_Modes(t *testing.T) {
+	tests := []struct {
+		mode       string
+		wantErr    bool
+		wantNames  []string
+		rolledBack bool
+	}{
+		{config.ReconcileBestEffort, false, []string{"a", "b", "c"}, false},
+		{config.ReconcileStrict, true, []string{"a", "b"}, false},
+		{config.ReconcileTransactional, true, []string{"a", "z"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			sshServer, sshCfg := setupTestSSHServer(t)
+			defer sshServer.Close()
+
+			mgr := NewManager(sshCfg)
+			defer mgr.Close()
+			mgr.SetReconcileMode(tt.mode)
+
+			for _, name := range []string{"a", "z"} {
+				if err := mgr.AddAndStart(config.TunnelConfig{Name: name, RemoteHost: "127.0.0.1", RemotePort: 1521}, false); err != nil {
+					t.Fatalf("failed to start %s: %v", name, err)
+				}
+			}
+
+			result, err := mgr.Reconcile(&config.Config{
+				SSH: *sshCfg,
+				TunnelConfigs: []config.TunnelConfig{
+					{Name: "a", RemoteHost: "127.0.0.1", RemotePort: 1521},
+					{Name: "b", RemoteHost: "127.0.0.1", RemotePortCommand: "echo not-a-port"},
+					{Name: "c", RemoteHost: "127.0.0.1", RemotePort: 1523},
+				},
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if result.Mode != tt.mode || result.RolledBack != tt.rolledBack {
+				t.Errorf("expected mode %s with rolledBack %v, got %+v", tt.mode, tt.rolledBack, result)
+			}
+			if len(result.Failed) != 1 || result.Failed["b"] == nil {
+				t.Errorf("expected only b to fail, got %v", result.Failed)
+			}
+			if !slices.Equal(result.Removed, []string{"z"}) {
+				t.Errorf("expected z to be removed, got %v", result.Removed)
+			}
+
+			names := mgr.List()
+			slices.Sort(names)
+			if !slices.Equal(names, tt.wantNames) {
+				t.Errorf("expected tunnels %v, got %v", tt.wantNames, names)
+			}
+
+			status := mgr.Status()
+			if status["a"] != tunnel.StatusRunning {
+				t.Errorf("expected the unchanged tunnel to keep running, got %s", status["a"])
+			}
+			for _, name := range []string{"c", "z"} {
+				if _, exists := status[name]; exists && status[name] != tunnel.StatusRunning {
+					t.Errorf("expected %s to be running, got %s", name, status[name])
+				}
+			}
+		})
+	}
+}
+
+// setupToggleProxy forwards connections to target while up is set and drops them, including those already forwarded,
+// when it is cleared, simulating a network path to the SSH server that fails and recovers.
+func setupToggleProxy(t *testing.T, target string) (int, func(up bool)) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create proxy: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var mu sync.Mutex
+	up := true
+	var open []net.Conn
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			if !up {
+				mu.Unlock()
+				conn.Close()
+				continue
+			}
+			backend, err := net.Dial("tcp", target)
+			if err != nil {
+				mu.Unlock()
+				conn.Close()
+				continue
+			}
+			open = append(open, conn, backend)
+			mu.Unlock()
+
+			go func() {
+				io.Copy(backend, conn)
+				backend.Close()
+			}()
+			go func() {
+				io.Copy(conn, backend)
+				conn.Close()
+			}()
+		}
+	}()
+
+	setUp := func(value bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		up = value
+		if !up {
+			for _, conn := range open {
+				conn.Close()
+			}
+			open = nil
+		}
+	}
+
+	return listener.Addr().(*net.TCPAddr).Port, setUp
+}
+
+// TestAutoRestart_CanaryGatesHealthy verifies that a tunnel restarted after its SSH connection recovered is not reported
+// healthy while the remote service is still down, and becomes healthy once the remote recovers too.
+func TestAutoRestart_CanaryGatesHealthy(t *testing.T) {
+	sshServer, _ := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	proxyPort, setUp := setupToggleProxy(t, sshServer.Addr().String())
+	sshCfg, err := tunnel.NewSSHConfig("testuser", "testpass", "", "127.0.0.1", "", proxyPort)
+	if err != nil {
+		t.Fatalf("failed to create ssh config: %v", err)
+	}
+
+	remotePort := freePort(t)
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	_ = mgr.Add(config.TunnelConfig{
+		Name:       "db",
+		RemoteHost: "127.0.0.1",
+		RemotePort: remotePort,
+		LocalPort:  0,
+		AutoRestart: config.AutoRestartConfig{
+			Enabled:       true,
+			Interval:      50 * time.Millisecond,
+			Canary:        true,
+			CanaryTimeout: time.Second,
+		},
+	})
+
+	if err := mgr.Start("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	health := func() HealthStatus {
+		return mgr.HealthCheck()[0]
+	}
+
+	// The SSH path fails, so reconnecting leaves the tunnel in error for auto-restart to pick up.
+	setUp(false)
+	if err := mgr.Reconnect("db"); err == nil {
+		t.Fatal("expected reconnect to fail while the ssh path is down")
+	}
+	setUp(true)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for mgr.Get("db").Status() != tunnel.StatusRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := mgr.Get("db").Status(); status != tunnel.StatusRunning {
+		t.Fatalf("expected auto-restart to bring the tunnel back once ssh recovered, got %s", status)
+	}
+
+	for range 5 {
+		if h := health(); h.Healthy {
+			t.Fatalf("expected the tunnel to stay unhealthy while the remote is down, got %+v", h)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if h := health(); h.ProbeError == nil || !strings.Contains(h.ProbeError.Error(), "canary") {
+		t.Errorf("expected the canary to be reported as the reason, got %v", h.ProbeError)
+	}
+
+	remote, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", remotePort))
+	if err != nil {
+		t.Fatalf("failed to start remote: %v", err)
+	}
+	defer remote.Close()
+	go func() {
+		for {
+			conn, err := remote.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	deadline = time.Now().Add(3 * time.Second)
+	for !health().Healthy && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if h := health(); !h.Healthy {
+		t.Errorf("expected the tunnel to become healthy once the remote recovered, got %+v", h)
+	}
+}
+
+func TestAutoRestart_GivesUpAfterMaxRetries(t *testing.T) {
+	sshServer, _ := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	proxyPort, setUp := setupToggleProxy(t, sshServer.Addr().String())
+	sshCfg, err := tunnel.NewSSHConfig("testuser", "testpass", "", "127.0.0.1", "", proxyPort)
+	if err != nil {
+		t.Fatalf("failed to create ssh config: %v", err)
+	}
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	_ = mgr.Add(config.TunnelConfig{
+		Name:        "db",
+		RemoteHost:  "127.0.0.1",
+		RemotePort:  5432,
+		AutoRestart: config.AutoRestartConfig{Enabled: true, Interval: 20 * time.Millisecond, MaxRetries: 3},
+	})
+
+	if err := mgr.Start("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// giveUp takes the SSH path down until auto-restart has failed maxRetries times, then brings it back.
+	giveUp := func() {
+		t.Helper()
+
+		setUp(false)
+		if err := mgr.Reconnect("db"); err == nil {
+			t.Fatal("expected reconnect to fail while the ssh path is down")
+		}
+
+		deadline := time.Now().Add(3 * time.Second)
+		for mgr.HealthCheck()[0].Retries < 3 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		setUp(true)
+
+		time.Sleep(150 * time.Millisecond)
+		if h := mgr.HealthCheck()[0]; h.Retries != 3 || h.Status != tunnel.StatusError {
+			t.Fatalf("expected auto-restart to give up in the error state after 3 failures, got %+v", h)
+		}
+	}
+
+	giveUp()
+	if err := mgr.Restart("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h := mgr.HealthCheck()[0]; h.Retries != 0 || !h.Healthy {
+		t.Errorf("expected Restart to reset the retry count, got %+v", h)
+	}
+
+	giveUp()
+	if err := mgr.Start("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h := mgr.HealthCheck()[0]; h.Retries != 0 || !h.Healthy {
+		t.Errorf("expected Start to reset the retry count, got %+v", h)
+	}
+}
+
+// TestRetryBudget_ParksAfterMixedRetries verifies that startup, auto-restart, and controller attempts draw from one
+// budget, that the tunnel is parked once it runs out even after the SSH server is reachable again, and that unparking
+// resumes automatic retries.
+func TestRetryBudget_ParksAfterMixedRetries(t *testing.T) {
+	sshServer, _ := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	proxyPort, setUp := setupToggleProxy(t, sshServer.Addr().String())
+	sshCfg, err := tunnel.NewSSHConfig("testuser", "testpass", "", "127.0.0.1", "", proxyPort)
+	if err != nil {
+		t.Fatalf("failed to create ssh config: %v", err)
+	}
+
+	mgr := NewManager(sshCfg)
+	defer mgr.Close()
+
+	_ = mgr.Add(config.TunnelConfig{
+		Name:        "db",
+		RemoteHost:  "127.0.0.1",
+		RemotePort:  1521,
+		LocalPort:   0,
+		AutoRestart: config.AutoRestartConfig{Enabled: true, Interval: 30 * time.Millisecond},
+		RetryBudget: config.RetryBudgetConfig{Attempts: 4, Window: time.Hour},
+	})
+
+	snapshot := func() TunnelSnapshot {
+		return mgr.Snapshot()[0]
+	}
+
+	if errors := mgr.StartAll(); len(errors) != 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+	if snap := snapshot(); snap.Parked || snap.RetriesLeft != 3 {
+		t.Fatalf("expected the initial start to spend one attempt, got parked=%t left=%d", snap.Parked, snap.RetriesLeft)
+	}
+
+	setUp(false)
+	if err := mgr.Reconnect("db"); err == nil {
+		t.Fatal("expected reconnect to fail while the ssh path is down")
+	}
+	mgr.StartController(30 * time.Millisecond)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !snapshot().Parked && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if snap := snapshot(); !snap.Parked || snap.RetriesLeft != 0 {
+		t.Fatalf("expected the tunnel to be parked with no retries left, got parked=%t left=%d", snap.Parked, snap.RetriesLeft)
+	}
+
+	setUp(true)
+	time.Sleep(200 * time.Millisecond)
+	if status := mgr.Get("db").Status(); status != tunnel.StatusError {
+		t.Fatalf("expected a parked tunnel to stay down once ssh recovered, got %s", status)
+	}
+
+	if err := mgr.Unpark("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deadline = time.Now().Add(3 * time.Second)
+	for mgr.Get("db").Status() != tunnel.StatusRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if snap := snapshot(); snap.Actual != tunnel.StatusRunning || snap.Parked {
+		t.Errorf("expected automatic retries to bring the tunnel back once unparked, got %s parked=%t", snap.Actual, snap.Parked)
+	}
+}
+
+// TestUpdateTunnel_AppliesInPlaceUnlessForwardingChanges verifies that UpdateTunnel keeps the running tunnel when only
+// its auto-restart timing changes and rebuilds and restarts it when its local port changes.
+func TestUpdateTunnel_AppliesInPlaceUnlessForwardingChanges(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	cfg := config.TunnelConfig{
+		Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: freePort(t),
+		AutoRestart: config.AutoRestartConfig{Enabled: true, Interval: time.Minute},
+	}
+	if err := mgr.AddAndStart(cfg, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	original := mgr.Get("db")
+
+	cfg.AutoRestart.Interval = 2 * time.Minute
+	if err := mgr.UpdateTunnel("db", cfg); err != nil {
+		t.Fatalf("unexpected error updating auto-restart: %v", err)
+	}
+	if mgr.Get("db") != original || original.Status() != tunnel.StatusRunning {
+		t.Errorf("expected the running tunnel to be kept, got status %s", mgr.Get("db").Status())
+	}
+
+	cfg.LocalPort = freePort(t)
+	if err := mgr.UpdateTunnel("db", cfg); err != nil {
+		t.Fatalf("unexpected error updating local port: %v", err)
+	}
+	if mgr.Get("db") == original {
+		t.Error("expected the tunnel to be rebuilt after its local port changed")
+	}
+	if got := mgr.Get("db"); got.Status() != tunnel.StatusRunning || got.LocalPort() != cfg.LocalPort {
+		t.Errorf("expected db running on port %d, got %s on %d", cfg.LocalPort, got.Status(), got.LocalPort())
+	}
+
+	if err := mgr.UpdateTunnel("db", config.TunnelConfig{Name: "other"}); err == nil {
+		t.Error("expected an error for a config naming another tunnel")
+	}
+	if err := mgr.UpdateTunnel("missing", config.TunnelConfig{Name: "missing"}); err == nil {
+		t.Error("expected an error for an unknown tunnel")
+	}
+}
+
+// TestWaitUntilHealthy verifies that WaitUntilHealthy returns once the named tunnels are healthy and otherwise fails at
+// the deadline naming the tunnels that never became healthy.
+func TestWaitUntilHealthy(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	if err := mgr.Add(config.TunnelConfig{Name: "idle", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: freePort(t)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mgr.Add(config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1522, LocalPort: freePort(t)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = mgr.Start("db")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := mgr.WaitUntilHealthy(ctx, "db"); err != nil {
+		t.Fatalf("expected db to become healthy, got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := mgr.WaitUntilHealthy(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "idle") || strings.Contains(err.Error(), "db") {
+		t.Errorf("expected a deadline error naming only idle, got %v", err)
+	}
+
+	if err := mgr.WaitUntilHealthy(context.Background(), "missing"); err == nil {
+		t.Error("expected an error for an unknown tunnel")
+	}
+}
+
+// TestReconcile_EnabledTransitions verifies that a disabled tunnel is registered without starting, stopped when a reload
+// disables it, and started again when a reload enables it.
+func TestReconcile_EnabledTransitions(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	enabled, disabled := true, false
+	db := config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: freePort(t)}
+	cache := config.TunnelConfig{Name: "cache", RemoteHost: "127.0.0.1", RemotePort: 6379, LocalPort: freePort(t), Enabled: &disabled}
+
+	if _, err := mgr.Reconcile(&config.Config{SSH: *sshCfg, TunnelConfigs: []config.TunnelConfig{db, cache}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	status := mgr.Status()
+	if status["db"] != tunnel.StatusRunning || status["cache"] != tunnel.StatusDisabled {
+		t.Fatalf("expected db running and cache disabled, got %v", status)
+	}
+	if err := mgr.Start("cache"); err == nil {
+		t.Error("expected starting a disabled tunnel to fail")
+	}
+	if summary := mgr.Summary(); summary.Disabled != 1 || summary.Healthy != 2 {
+		t.Errorf("expected the disabled tunnel counted as disabled and healthy, got %+v", summary)
+	}
+
+	db.Enabled, cache.Enabled = &disabled, &enabled
+	result, err := mgr.Reconcile(&config.Config{SSH: *sshCfg, TunnelConfigs: []config.TunnelConfig{db, cache}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(result.Updated, []string{"cache", "db"}) || len(result.Changed) != 0 {
+		t.Errorf("expected both tunnels updated in place, got %+v", result)
+	}
+
+	status = mgr.Status()
+	if status["db"] != tunnel.StatusDisabled || status["cache"] != tunnel.StatusRunning {
+		t.Fatalf("expected db disabled and cache running, got %v", status)
+	}
+	if got := mgr.Get("db").Status(); got != tunnel.StatusStopped {
+		t.Errorf("expected disabled db to be stopped, got %s", got)
+	}
+	for _, snap := range mgr.Snapshot() {
+		if snap.Diverged {
+			t.Errorf("expected %s not to diverge, got %+v", snap.Name, snap)
+		}
+	}
+}
+
+// TestDescribe_ReturnsCopy verifies that Describe reports a tunnel's config and runtime state together, and that changing
+// the result leaves the manager's copy alone.
+func TestDescribe_ReturnsCopy(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	enabled := true
+	server := *sshCfg
+	cfg := config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521, Tags: []string{"oracle"},
+		Enabled: &enabled, SSH: &server}
+	if err := mgr.AddAndStart(cfg, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info, ok := mgr.Describe("db")
+	if !ok {
+		t.Fatal("expected db to be described")
+	}
+	if info.Name != "db" || info.Status != tunnel.StatusRunning || info.Desired != DesiredRunning || info.Error != nil {
+		t.Errorf("expected db running as desired, got %+v", info)
+	}
+	if info.Config.RemotePort != 1521 || info.StartedAt.IsZero() || info.Uptime < 0 || info.Stats.LocalPort == 0 {
+		t.Errorf("expected the config, start time, and stats of db, got %+v", info)
+	}
+
+	info.Config.Tags[0] = "changed"
+	*info.Config.Enabled = false
+	info.Config.SSH.Host = "elsewhere"
+
+	again, _ := mgr.Describe("db")
+	if again.Config.Tags[0] != "oracle" || !again.Config.IsEnabled() || again.Config.SSH.Host != sshCfg.Host {
+		t.Errorf("expected changes to the described config not to reach the manager, got %+v", again.Config)
+	}
+
+	if _, ok := mgr.Describe("missing"); ok {
+		t.Error("expected an unknown tunnel not to be described")
+	}
+}
+
+// TestConfigs_ReflectReconcile verifies that Config and Configs return the configs last applied by Reconcile, as copies.
+func TestConfigs_ReflectReconcile(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	db := config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521, Tags: []string{"oracle"}}
+	web := config.TunnelConfig{Name: "web", RemoteHost: "127.0.0.1", RemotePort: 80}
+	if _, err := mgr.Reconcile(&config.Config{SSH: *sshCfg, TunnelConfigs: []config.TunnelConfig{db, web}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, ok := mgr.Config("db")
+	if !ok || got.RemotePort != 1521 {
+		t.Fatalf("expected the config of db, got %+v", got)
+	}
+	got.Tags[0] = "changed"
+
+	db.RemotePort = 1522
+	if _, err := mgr.Reconcile(&config.Config{SSH: *sshCfg, TunnelConfigs: []config.TunnelConfig{db}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	configs := mgr.Configs()
+	if len(configs) != 1 || configs["db"].RemotePort != 1522 || configs["db"].Tags[0] != "oracle" {
+		t.Errorf("expected only db with its reloaded config, got %+v", configs)
+	}
+	if _, ok := mgr.Config("web"); ok {
+		t.Error("expected the removed tunnel to have no config")
+	}
+}
+
+// TestPause_SurvivesReconcile verifies that a paused tunnel stays stopped through StartAll, the controller, and reloads
+// that leave it unchanged, change it in place, or rebuild it, and that Resume brings it back.
+func TestPause_SurvivesReconcile(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	db := config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: freePort(t)}
+	web := config.TunnelConfig{Name: "web", RemoteHost: "127.0.0.1", RemotePort: 80, LocalPort: freePort(t)}
+	reconcile := func() ReconcileResult {
+		t.Helper()
+		result, err := mgr.Reconcile(&config.Config{SSH: *sshCfg, TunnelConfigs: []config.TunnelConfig{db, web}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return result
+	}
+	expectPaused := func(when string) {
+		t.Helper()
+		if status := mgr.Status()["db"]; status != tunnel.StatusPaused {
+			t.Errorf("%s: expected db paused, got %s", when, status)
+		}
+		if got := mgr.Get("db").Status(); got != tunnel.StatusStopped {
+			t.Errorf("%s: expected paused db to be stopped, got %s", when, got)
+		}
+	}
+
+	reconcile()
+	if err := mgr.Pause("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectPaused("after Pause")
+
+	if err := mgr.Start("db"); err == nil || !strings.Contains(err.Error(), "paused") {
+		t.Errorf("expected starting a paused tunnel to fail, got %v", err)
+	}
+	if errs := mgr.StartAll(); errs["db"] != nil {
+		t.Errorf("expected StartAll to skip the paused tunnel, got %v", errs["db"])
+	}
+	mgr.converge()
+	expectPaused("after StartAll and converge")
+
+	if summary := mgr.Summary(); summary.Paused != 1 || summary.Healthy != 2 {
+		t.Errorf("expected the paused tunnel counted as paused and healthy, got %+v", summary)
+	}
+
+	reconcile()
+	expectPaused("after an unchanged reload")
+
+	db.Tags = []string{"oracle"}
+	if result := reconcile(); !slices.Equal(result.Updated, []string{"db"}) {
+		t.Errorf("expected db updated in place, got %+v", result)
+	}
+	expectPaused("after an in-place update")
+
+	db.RemotePort = 1522
+	if result := reconcile(); !slices.Equal(result.Changed, []string{"db"}) || len(result.Failed) != 0 {
+		t.Errorf("expected db rebuilt without failures, got %+v", result)
+	}
+	expectPaused("after a rebuild")
+
+	if err := mgr.Resume("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status := mgr.Status()["db"]; status != tunnel.StatusRunning {
+		t.Errorf("expected db running after Resume, got %s", status)
+	}
+	if err := mgr.Resume("db"); err == nil {
+		t.Error("expected resuming a tunnel that is not paused to fail")
+	}
+	if err := mgr.Pause("missing"); err == nil {
+		t.Error("expected pausing an unknown tunnel to fail")
+	}
+}
+
+// TestByTag_OperatesOnMatchingTunnels verifies that the tag operations act only on tunnels carrying the tag and that
+// health results report each tunnel's tags.
+func TestByTag_OperatesOnMatchingTunnels(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	mgr := NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	tunnels := []config.TunnelConfig{
+		{Name: "sig", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: freePort(t), Tags: []string{"oracle", "prod"}},
+		{Name: "ods", RemoteHost: "127.0.0.1", RemotePort: 1522, LocalPort: freePort(t), Tags: []string{"oracle"}},
+		{Name: "cache", RemoteHost: "127.0.0.1", RemotePort: 6379, LocalPort: freePort(t), Tags: []string{"prod"}},
+	}
+	for _, cfg := range tunnels {
+		if err := mgr.Add(cfg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if got := mgr.ListByTag("oracle"); !reflect.DeepEqual(got, []string{"ods", "sig"}) {
+		t.Errorf("expected ods and sig tagged oracle, got %v", got)
+	}
+	if got := mgr.ListByTag("missing"); len(got) != 0 {
+		t.Errorf("expected no tunnels for an unused tag, got %v", got)
+	}
+
+	if errors := mgr.StartByTag("oracle"); len(errors) != 0 {
+		t.Fatalf("expected 0 errors, got %v", errors)
+	}
+	status := mgr.Status()
+	if status["sig"] != tunnel.StatusRunning || status["ods"] != tunnel.StatusRunning || status["cache"] != tunnel.StatusStopped {
+		t.Errorf("expected only the oracle tunnels running, got %v", status)
+	}
+
+	if errors := mgr.StopByTag("prod"); len(errors) != 0 {
+		t.Fatalf("expected 0 errors, got %v", errors)
+	}
+	status = mgr.Status()
+	if status["sig"] != tunnel.StatusStopped || status["ods"] != tunnel.StatusRunning {
+		t.Errorf("expected only sig stopped among the oracle tunnels, got %v", status)
+	}
+
+	for _, h := range mgr.HealthCheck() {
+		if h.Name == "sig" && !reflect.DeepEqual(h.Tags, []string{"oracle", "prod"}) {
+			t.Errorf("expected sig's tags in its health status, got %v", h.Tags)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"slices"
+
+	"github.com/pperesbr/conduit/internal/config"
+	"github.com/pperesbr/conduit/internal/tunnel"
+	"gopkg.in/yaml.v3"
+)
+
+// serverFor returns the SSH configuration the tunnel described by cfg connects through: its own ssh block when set,
+// otherwise the global one. Tunnels whose ssh blocks are identical share one validated configuration, and with it any
+// jump host connections. The caller must hold m.mu.
+func (m *Manager) serverFor(cfg config.TunnelConfig) (*tunnel.SSHConfig, error) {
+	if cfg.SSH == nil {
+		return m.sshConfig, nil
+	}
+
+	key := serverKey(cfg.SSH)
+	if server, exists := m.servers[key]; exists {
+		return server, nil
+	}
+
+	server := *cfg.SSH
+	server.JumpHosts = slices.Clone(cfg.SSH.JumpHosts)
+	if err := server.Validate(); err != nil {
+		return nil, err
+	}
+
+	m.servers[key] = &server
+
+	return &server, nil
+}
+
+// pruneServersLocked forgets the per-tunnel SSH configurations no registered tunnel uses anymore. The caller must hold
+// m.mu.
+func (m *Manager) pruneServersLocked() {
+	used := make(map[string]bool)
+	for _, cfg := range m.configs {
+		if cfg.SSH != nil {
+			used[serverKey(cfg.SSH)] = true
+		}
+	}
+
+	for key := range m.servers {
+		if !used[key] {
+			delete(m.servers, key)
+		}
+	}
+}
+
+// serverKey identifies an SSH configuration by its settings, so equal ssh blocks map to the same server. A nil
+// configuration, meaning the global one, has an empty key.
+func serverKey(ssh *tunnel.SSHConfig) string {
+	if ssh == nil {
+		return ""
+	}
+
+	data, _ := yaml.Marshal(ssh)
+	return string(data)
+}
@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pperesbr/conduit/internal/config"
+)
+
+// maxPort is the highest valid TCP port.
+const maxPort = 65535
+
+// NewShadow builds a Manager for a candidate config that can be started and health-checked alongside the live one
+// before the config is applied, for example with StartAll followed by HealthCheck. So it never collides with the live
+// tunnels, each tunnel listens on an ephemeral local port, or on its configured port shifted by portOffset when that
+// is positive; LocalPort on its tunnels reports the port actually bound. Reverse tunnels have their port on the SSH
+// server moved the same way, reported by RemoteAddr, and socket tunnels listen in a temporary directory removed by
+// Close, reported by LocalSocket. Auto-restart is disabled so failures show up instead of being retried away. Close
+// the shadow when done with it.
+func NewShadow(cfg *config.Config, portOffset int) (*Manager, error) {
+	if portOffset < 0 {
+		return nil, fmt.Errorf("port offset must not be negative")
+	}
+
+	sshConfig := cfg.SSH
+	m := NewManager(&sshConfig)
+	m.SetReconcileMode(cfg.Reload.Mode)
+
+	for _, tunnelCfg := range cfg.TunnelConfigs {
+		if tunnelCfg.LocalSocket != "" && !tunnelCfg.Reverse() {
+			if m.socketDir == "" {
+				dir, err := os.MkdirTemp("", "conduit-shadow-")
+				if err != nil {
+					_ = m.Close()
+					return nil, fmt.Errorf("failed to create shadow socket directory: %w", err)
+				}
+				m.socketDir = dir
+			}
+			tunnelCfg.LocalSocket = filepath.Join(m.socketDir, tunnelCfg.Name+".sock")
+		} else if err := shiftPort(&tunnelCfg, portOffset); err != nil {
+			_ = m.Close()
+			return nil, err
+		}
+		tunnelCfg.AutoRestart = config.AutoRestartConfig{}
+
+		if err := m.Add(tunnelCfg); err != nil {
+			_ = m.Close()
+			return nil, fmt.Errorf("failed to add shadow tunnel: %w", err)
+		}
+	}
+
+	return m, nil
+}
+
+// shiftPort moves the port a shadow tunnel binds by portOffset, or to an ephemeral one when portOffset is 0.
+func shiftPort(tunnelCfg *config.TunnelConfig, portOffset int) error {
+	// A reverse tunnel binds its remote port on the SSH server instead, so that is the one shifted.
+	port := &tunnelCfg.LocalPort
+	if tunnelCfg.Reverse() {
+		port = &tunnelCfg.RemotePort
+	}
+
+	if portOffset > 0 {
+		*port += portOffset
+	} else {
+		*port = 0
+	}
+	if *port > maxPort {
+		return fmt.Errorf("tunnel %s: shadow port %d is out of range", tunnelCfg.Name, *port)
+	}
+
+	return nil
+}
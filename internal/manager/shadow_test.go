@@ -0,0 +1,128 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pperesbr/conduit/internal/config"
+	"github.com/pperesbr/conduit/internal/tunnel"
+)
+
+// TestNewShadow_RunsBesideLiveManager verifies that a shadow built from a candidate config comes up on ports of its own
+// while the live tunnels keep theirs, and that each manager reports its own health.
+func TestNewShadow_RunsBesideLiveManager(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	port := freePort(t)
+	live := NewManager(sshCfg)
+	defer live.Close()
+
+	_ = live.Add(config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: port})
+	if err := live.Start("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	candidate := &config.Config{
+		SSH: *sshCfg,
+		TunnelConfigs: []config.TunnelConfig{
+			{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: port},
+			{Name: "cache", RemoteHost: "127.0.0.1", RemotePort: 6379, LocalPort: port + 1},
+		},
+	}
+
+	shadow, err := NewShadow(candidate, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if errors := shadow.StartAll(); len(errors) != 0 {
+		t.Fatalf("expected the shadow to come up, got %v", errors)
+	}
+
+	for _, h := range shadow.HealthCheck() {
+		if !h.Healthy {
+			t.Errorf("expected shadow tunnel %s to be healthy, got %+v", h.Name, h)
+		}
+		if got := shadow.Get(h.Name).LocalPort(); got == port || got == port+1 {
+			t.Errorf("expected shadow tunnel %s on an ephemeral port, got %d", h.Name, got)
+		}
+	}
+
+	if err := shadow.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := live.Get("db").LocalPort(); got != port {
+		t.Errorf("expected the live tunnel to keep port %d, got %d", port, got)
+	}
+	if h := live.HealthCheck(); len(h) != 1 || !h[0].Healthy {
+		t.Errorf("expected the live manager to stay healthy after the shadow closed, got %+v", h)
+	}
+
+	sshServer.Close()
+	broken := &config.Config{
+		SSH:           *sshCfg,
+		TunnelConfigs: []config.TunnelConfig{{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: port}},
+	}
+
+	shadow, err = NewShadow(broken, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer shadow.Close()
+
+	if errors := shadow.StartAll(); len(errors) != 1 {
+		t.Fatalf("expected the shadow to fail to reach the ssh server, got %v", errors)
+	}
+	if h := shadow.HealthCheck(); len(h) != 1 || h[0].Healthy || h[0].Status != tunnel.StatusError {
+		t.Errorf("expected the shadow to report its own failure, got %+v", h)
+	}
+	if h := live.HealthCheck(); !h[0].Healthy {
+		t.Errorf("expected the live tunnel to be unaffected by the failing shadow, got %+v", h)
+	}
+
+	if _, err := NewShadow(&config.Config{TunnelConfigs: []config.TunnelConfig{{Name: "db", LocalPort: 60000}}}, 10000); err == nil {
+		t.Error("expected error for a shadow port beyond 65535")
+	}
+}
+
+// TestNewShadow_SocketTunnels verifies that a shadow socket tunnel listens on a temporary path of its own, leaving the
+// live tunnel's socket alone, and that Close removes it.
+func TestNewShadow_SocketTunnels(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	tunnelCfg := config.TunnelConfig{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalSocket: filepath.Join(t.TempDir(), "db.sock")}
+	live := NewManager(sshCfg)
+	defer live.Close()
+
+	_ = live.Add(tunnelCfg)
+	if err := live.Start("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	shadow, err := NewShadow(&config.Config{SSH: *sshCfg, TunnelConfigs: []config.TunnelConfig{tunnelCfg}}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if errors := shadow.StartAll(); len(errors) != 0 {
+		t.Fatalf("expected the shadow to come up, got %v", errors)
+	}
+
+	socket := shadow.Get("db").LocalSocket()
+	if socket == tunnelCfg.LocalSocket {
+		t.Fatalf("expected the shadow socket on a path of its own, got %s", socket)
+	}
+
+	if err := shadow.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(socket)); !os.IsNotExist(err) {
+		t.Errorf("expected Close to remove the shadow socket directory, got %v", err)
+	}
+	if h := live.HealthCheck(); len(h) != 1 || !h[0].Healthy {
+		t.Errorf("expected the live socket tunnel to stay healthy, got %+v", h)
+	}
+}
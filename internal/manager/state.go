@@ -0,0 +1,170 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// SavedState is the desired state of each managed tunnel as written by SaveState, keyed by tunnel name. Paused tunnels
+// are recorded as DesiredPaused.
+type SavedState struct {
+	Tunnels map[string]DesiredState `json:"tunnels"`
+}
+
+// SetStateFile makes Run restore the desired state saved at path before starting the tunnels, and save it there again
+// before stopping them on shutdown, so tunnels stopped or paused by hand stay that way across restarts and are never
+// briefly started. An empty path, the default, disables this.
+func (m *Manager) SetStateFile(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stateFile = path
+}
+
+// SaveState writes the desired state of every managed tunnel to path as JSON. Tunnels their config disables are left
+// out unless paused, as they are stopped by the config rather than by hand and must start once it enables them. The
+// file is replaced atomically, so a crash while saving leaves the previous state intact.
+func (m *Manager) SaveState(path string) error {
+	m.mu.RLock()
+	state := SavedState{Tunnels: make(map[string]DesiredState, len(m.tunnels))}
+	for name := range m.tunnels {
+		if !m.configs[name].IsEnabled() && !m.paused[name] {
+			continue
+		}
+		state.Tunnels[name] = m.desired[name]
+		if m.paused[name] {
+			state.Tunnels[name] = DesiredPaused
+		}
+	}
+	m.mu.RUnlock()
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(append(data, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+
+	return nil
+}
+
+// LoadState reads the state saved at path by SaveState and drives each tunnel in it toward its saved desired state:
+// paused tunnels are paused, stopped ones stopped, and running ones started, or resumed if they are paused now.
+// Tunnels missing from the file keep their current state, and ones no longer managed are ignored. A missing file is not
+// an error, as on the first run there is nothing to restore. Tunnels that could not be brought to their saved state are
+// returned with their errors.
+func (m *Manager) LoadState(path string) (map[string]error, error) {
+	state, err := readState(path)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make(map[string]error)
+	for _, name := range slices.Sorted(maps.Keys(state.Tunnels)) {
+		if err := m.restoreState(name, state.Tunnels[name]); err != nil {
+			errs[name] = err
+		}
+	}
+
+	return errs, nil
+}
+
+// readState reads the state saved at path by SaveState. A missing file reads as an empty state.
+func readState(path string) (SavedState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return SavedState{}, nil
+	}
+	if err != nil {
+		return SavedState{}, fmt.Errorf("failed to read state: %w", err)
+	}
+
+	var state SavedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return SavedState{}, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+
+	return state, nil
+}
+
+// restoreHeld reads the state saved at path and pauses or stops the tunnels saved that way, returning their names so
+// they are skipped when the tunnels are started. Errors are logged rather than returned, as a state that cannot be
+// restored must not keep the tunnels from starting.
+func (m *Manager) restoreHeld(path string) map[string]bool {
+	state, err := readState(path)
+	if err != nil {
+		m.logger().Error("failed to restore saved state", "path", path, "error", err)
+		return nil
+	}
+
+	held := make(map[string]bool)
+	for _, name := range slices.Sorted(maps.Keys(state.Tunnels)) {
+		desired := state.Tunnels[name]
+		if desired == DesiredRunning {
+			continue
+		}
+		if err := m.restoreState(name, desired); err != nil {
+			m.logger().Error("failed to restore tunnel state", "tunnel", name, "error", err)
+			continue
+		}
+		held[name] = true
+	}
+
+	return held
+}
+
+// restoreState brings the named tunnel to the desired state saved for it, doing nothing for a tunnel that is not
+// managed.
+func (m *Manager) restoreState(name string, desired DesiredState) error {
+	m.mu.RLock()
+	cfg, exists := m.configs[name]
+	paused := m.paused[name]
+	m.mu.RUnlock()
+
+	if !exists {
+		return nil
+	}
+
+	switch desired {
+	case DesiredPaused:
+		return m.Pause(name)
+	case DesiredStopped:
+		if paused {
+			m.mu.Lock()
+			delete(m.paused, name)
+			m.mu.Unlock()
+		}
+		_, err := m.SetRunning(name, false)
+		return err
+	case DesiredRunning:
+		if paused {
+			return m.Resume(name)
+		}
+		if !cfg.IsEnabled() {
+			return nil
+		}
+		_, err := m.SetRunning(name, true)
+		return err
+	}
+
+	return fmt.Errorf("unknown saved state %q", desired)
+}
@@ -0,0 +1,157 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pperesbr/conduit/internal/config"
+	"github.com/pperesbr/conduit/internal/tunnel"
+)
+
+// TestState_RestoresDesiredState verifies that state saved by one manager brings the tunnels of another, started from
+// the same config, back to being paused, stopped, and running as they were.
+func TestState_RestoresDesiredState(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	configs := []config.TunnelConfig{
+		{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521},
+		{Name: "web", RemoteHost: "127.0.0.1", RemotePort: 80},
+		{Name: "cache", RemoteHost: "127.0.0.1", RemotePort: 6379},
+	}
+	start := func() *Manager {
+		t.Helper()
+		mgr := NewManager(sshCfg)
+		for _, cfg := range configs {
+			if err := mgr.Add(cfg); err != nil {
+				t.Fatalf("failed to add %s: %v", cfg.Name, err)
+			}
+		}
+		if errs := mgr.StartAll(); len(errs) != 0 {
+			t.Fatalf("expected all tunnels to start, got %v", errs)
+		}
+		return mgr
+	}
+
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	first := start()
+	if err := first.Pause("db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := first.Stop("web"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := first.SaveState(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first.StopAll()
+
+	second := start()
+	defer second.StopAll()
+
+	errs, err := second.LoadState(path)
+	if err != nil || len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v %v", err, errs)
+	}
+
+	status := second.Status()
+	if status["db"] != tunnel.StatusPaused || status["web"] != tunnel.StatusStopped || status["cache"] != tunnel.StatusRunning {
+		t.Errorf("expected db paused, web stopped, and cache running, got %v", status)
+	}
+	for _, snap := range second.Snapshot() {
+		if snap.Name == "web" && snap.Desired != DesiredStopped {
+			t.Errorf("expected web to be desired stopped, got %s", snap.Desired)
+		}
+	}
+}
+
+// TestRun_RestoresStateBeforeStarting verifies that Run holds tunnels saved as paused or stopped without ever starting
+// them, and that a tunnel its config disables is not saved as stopped.
+func TestRun_RestoresStateBeforeStarting(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	saved := `{"tunnels": {"db": "paused", "web": "stopped", "cache": "running"}}`
+	if err := os.WriteFile(path, []byte(saved), 0644); err != nil {
+		t.Fatalf("failed to write state file: %v", err)
+	}
+
+	disabled := false
+	mgr := NewManager(sshCfg)
+	for _, cfg := range []config.TunnelConfig{
+		{Name: "db", RemoteHost: "127.0.0.1", RemotePort: 1521},
+		{Name: "web", RemoteHost: "127.0.0.1", RemotePort: 80},
+		{Name: "cache", RemoteHost: "127.0.0.1", RemotePort: 6379},
+		{Name: "off", RemoteHost: "127.0.0.1", RemotePort: 8080, Enabled: &disabled},
+	} {
+		if err := mgr.Add(cfg); err != nil {
+			t.Fatalf("failed to add %s: %v", cfg.Name, err)
+		}
+	}
+	mgr.SetStateFile(path)
+	events := mgr.Events()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- mgr.Run(ctx, nil)
+	}()
+
+	select {
+	case <-mgr.Started():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Run to start the tunnels")
+	}
+
+	status := mgr.Status()
+	if status["db"] != tunnel.StatusPaused || status["web"] != tunnel.StatusStopped || status["cache"] != tunnel.StatusRunning {
+		t.Errorf("expected db paused, web stopped, and cache running, got %v", status)
+	}
+
+	cancel()
+	if err := <-result; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for len(events) > 0 {
+		if event := <-events; event.Tunnel != "cache" && event.To == tunnel.StatusStarting {
+			t.Errorf("expected %s never to be started, got %+v", event.Tunnel, event)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read state file: %v", err)
+	}
+	var state SavedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatalf("failed to parse state file: %v", err)
+	}
+	if _, ok := state.Tunnels["off"]; ok || state.Tunnels["db"] != DesiredPaused || state.Tunnels["web"] != DesiredStopped {
+		t.Errorf("expected db paused and web stopped to be saved without the disabled tunnel, got %v", state.Tunnels)
+	}
+}
+
+// TestLoadState_MissingAndInvalidFiles verifies that a missing state file is not an error and an unreadable one is.
+func TestLoadState_MissingAndInvalidFiles(t *testing.T) {
+	mgr := NewManager(&tunnel.SSHConfig{})
+	dir := t.TempDir()
+
+	if errs, err := mgr.LoadState(filepath.Join(dir, "missing.json")); err != nil || len(errs) != 0 {
+		t.Errorf("expected a missing state file to be skipped, got %v %v", err, errs)
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte("{"), 0644); err != nil {
+		t.Fatalf("failed to write state file: %v", err)
+	}
+	if _, err := mgr.LoadState(invalid); err == nil {
+		t.Error("expected an invalid state file to fail")
+	}
+}
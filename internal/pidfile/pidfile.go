@@ -0,0 +1,83 @@
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Write creates the pid file at path holding the ID of the current process, so a second conduit started with the same
+// path refuses to run. It fails when the file names a process that is still running; a file left behind by a process
+// that has exited, or one that cannot be parsed, is stale and overwritten.
+func Write(path string) error {
+	for attempt := 0; ; attempt++ {
+		err := create(path)
+		if err == nil || !errors.Is(err, os.ErrExist) || attempt > 0 {
+			return err
+		}
+
+		pid, err := Read(path)
+		if err == nil && pid != os.Getpid() && alive(pid) {
+			return fmt.Errorf("conduit is already running with pid %d (pid file %s)", pid, path)
+		}
+
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale pid file: %w", err)
+		}
+	}
+}
+
+// create writes the current process ID to a new file at path, failing with os.ErrExist when it is already there.
+func create(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return err
+		}
+		return fmt.Errorf("failed to create pid file: %w", err)
+	}
+
+	_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to write pid file: %w", err)
+	}
+
+	return nil
+}
+
+// Read returns the process ID stored in the pid file at path.
+func Read(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("pid file %s does not hold a process id", path)
+	}
+	return pid, nil
+}
+
+// Remove deletes the pid file at path, unless it has since been taken over by another process. A missing file is not an
+// error.
+func Remove(path string) error {
+	pid, err := Read(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err == nil && pid != os.Getpid() {
+		return nil
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove pid file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package pidfile
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestWrite_CreatesAndRemoves verifies that the pid file holds the current process ID and is removed again.
+func TestWrite_CreatesAndRemoves(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conduit.pid")
+
+	if err := Write(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pid, err := Read(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pid != os.Getpid() {
+		t.Errorf("expected pid %d, got %d", os.Getpid(), pid)
+	}
+
+	if err := Remove(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected pid file to be removed, got %v", err)
+	}
+}
+
+// TestWrite_RefusesLiveProcess verifies that a pid file naming another running process is left alone.
+func TestWrite_RefusesLiveProcess(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot start a helper process: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	path := filepath.Join(t.TempDir(), "conduit.pid")
+	if err := os.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0o644); err != nil {
+		t.Fatalf("failed to write pid file: %v", err)
+	}
+
+	err := Write(path)
+	if err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Fatalf("expected an already running error, got %v", err)
+	}
+
+	if err := Remove(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pid, err := Read(path); err != nil || pid != cmd.Process.Pid {
+		t.Errorf("expected the other process's pid file to be kept, got %d, %v", pid, err)
+	}
+}
+
+// TestWrite_OverwritesStaleFile verifies that pid files left by exited processes or holding garbage are replaced.
+func TestWrite_OverwritesStaleFile(t *testing.T) {
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("cannot run a helper process: %v", err)
+	}
+
+	for _, content := range []string{strconv.Itoa(cmd.Process.Pid), "not a pid", ""} {
+		path := filepath.Join(t.TempDir(), "conduit.pid")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write pid file: %v", err)
+		}
+
+		if err := Write(path); err != nil {
+			t.Fatalf("content %q: unexpected error: %v", content, err)
+		}
+		if pid, err := Read(path); err != nil || pid != os.Getpid() {
+			t.Errorf("content %q: expected our pid, got %d, %v", content, pid, err)
+		}
+	}
+}
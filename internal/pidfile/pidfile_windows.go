@@ -0,0 +1,16 @@
+//go:build windows
+
+package pidfile
+
+import "os"
+
+// alive reports whether a process with the given ID exists. On Windows, finding a process opens a handle to it, which
+// fails once it has exited.
+func alive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
@@ -0,0 +1,83 @@
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// AppProbe verifies the application behind a tunnel over a connection made through it, for example by completing a
+// protocol handshake. The caller sets the connection's deadline and closes it afterwards.
+type AppProbe interface {
+	Probe(conn net.Conn) error
+}
+
+// Func adapts an ordinary function to the AppProbe interface.
+type Func func(conn net.Conn) error
+
+// Probe calls f(conn).
+func (f Func) Probe(conn net.Conn) error {
+	return f(conn)
+}
+
+// ExpectBanner returns an AppProbe that passes when the application greets a new connection with banner, as SSH, SMTP,
+// or MySQL servers do.
+func ExpectBanner(banner []byte) AppProbe {
+	return Func(func(conn net.Conn) error {
+		return expect(conn, banner)
+	})
+}
+
+// SendExpect returns an AppProbe that writes request and passes when the application answers with response.
+func SendExpect(request, response []byte) AppProbe {
+	return Func(func(conn net.Conn) error {
+		if _, err := conn.Write(request); err != nil {
+			return fmt.Errorf("failed to send probe request: %w", err)
+		}
+		return expect(conn, response)
+	})
+}
+
+// HTTPGet returns an AppProbe that sends an HTTP GET for path and passes when the response status is status, or any 2xx
+// status when status is 0.
+func HTTPGet(path string, status int) AppProbe {
+	return Func(func(conn net.Conn) error {
+		req, err := http.NewRequest(http.MethodGet, "http://"+conn.RemoteAddr().String()+path, nil)
+		if err != nil {
+			return fmt.Errorf("invalid probe request: %w", err)
+		}
+		req.Close = true
+
+		if err := req.Write(conn); err != nil {
+			return fmt.Errorf("failed to send probe request: %w", err)
+		}
+
+		resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+		if err != nil {
+			return fmt.Errorf("failed to read probe response: %w", err)
+		}
+		resp.Body.Close()
+
+		if status == 0 && resp.StatusCode/100 != 2 || status != 0 && resp.StatusCode != status {
+			return fmt.Errorf("unexpected probe response status %s", resp.Status)
+		}
+		return nil
+	})
+}
+
+// expect reads len(want) bytes from conn and compares them with want.
+func expect(conn net.Conn, want []byte) error {
+	got := make([]byte, len(want))
+	if n, err := io.ReadFull(conn, got); err != nil {
+		return fmt.Errorf("failed to read probe response after %d of %d bytes: %w", n, len(want), err)
+	}
+
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("unexpected probe response %q, want %q", got, want)
+	}
+
+	return nil
+}
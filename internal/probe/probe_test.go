@@ -0,0 +1,100 @@
+package probe
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// serve runs handler on the server end of an in-memory connection and returns the client end.
+func serve(t *testing.T, handler func(net.Conn)) net.Conn {
+	t.Helper()
+
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	go func() {
+		handler(server)
+		server.Close()
+	}()
+
+	return client
+}
+
+func TestExpectBanner(t *testing.T) {
+	greet := func(banner string) func(net.Conn) {
+		return func(conn net.Conn) { _, _ = conn.Write([]byte(banner)) }
+	}
+
+	if err := ExpectBanner([]byte("SSH-2.0-")).Probe(serve(t, greet("SSH-2.0-OpenSSH_9.6\r\n"))); err != nil {
+		t.Errorf("expected matching banner to pass, got %v", err)
+	}
+
+	err := ExpectBanner([]byte("SSH-2.0-")).Probe(serve(t, greet("220 smtp ready\r\n")))
+	if err == nil || !strings.Contains(err.Error(), "unexpected probe response") {
+		t.Errorf("expected mismatched banner to fail, got %v", err)
+	}
+
+	err = ExpectBanner([]byte("SSH-2.0-")).Probe(serve(t, greet("SSH")))
+	if err == nil || !strings.Contains(err.Error(), "after 3 of 8 bytes") {
+		t.Errorf("expected short banner to fail, got %v", err)
+	}
+}
+
+func TestSendExpect(t *testing.T) {
+	echoUpper := func(conn net.Conn) {
+		buf := make([]byte, 5)
+		n, _ := conn.Read(buf)
+		_, _ = conn.Write([]byte(strings.ToUpper(string(buf[:n]))))
+	}
+
+	if err := SendExpect([]byte("ping\n"), []byte("PING\n")).Probe(serve(t, echoUpper)); err != nil {
+		t.Errorf("expected matching response to pass, got %v", err)
+	}
+
+	if err := SendExpect([]byte("ping\n"), []byte("pong\n")).Probe(serve(t, echoUpper)); err == nil {
+		t.Error("expected mismatched response to fail")
+	}
+}
+
+func TestHTTPGet(t *testing.T) {
+	respond := func(code int) func(net.Conn) {
+		return func(conn net.Conn) {
+			req, err := http.ReadRequest(bufio.NewReader(conn))
+			if err != nil {
+				return
+			}
+			if req.URL.Path != "/healthz" {
+				code = http.StatusNotFound
+			}
+			resp := &http.Response{StatusCode: code, ProtoMajor: 1, ProtoMinor: 1, Request: req}
+			_ = resp.Write(conn)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		status  int
+		code    int
+		wantErr bool
+	}{
+		{name: "any 2xx", status: 0, code: http.StatusNoContent},
+		{name: "5xx", status: 0, code: http.StatusServiceUnavailable, wantErr: true},
+		{name: "exact status", status: http.StatusUnauthorized, code: http.StatusUnauthorized},
+		{name: "other status", status: http.StatusUnauthorized, code: http.StatusOK, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := HTTPGet("/healthz", tt.status).Probe(serve(t, respond(tt.code)))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// Boundary is a recurring calendar boundary at which periodic accounting starts a new period.
+type Boundary string
+
+const (
+	Hourly  Boundary = "hourly"
+	Daily   Boundary = "daily"
+	Weekly  Boundary = "weekly"
+	Monthly Boundary = "monthly"
+)
+
+// ParseBoundary validates a boundary name.
+func ParseBoundary(value string) (Boundary, error) {
+	switch b := Boundary(value); b {
+	case Hourly, Daily, Weekly, Monthly:
+		return b, nil
+	default:
+		return "", fmt.Errorf("unknown boundary %q, expected %s, %s, %s, or %s", value, Hourly, Daily, Weekly, Monthly)
+	}
+}
+
+// PeriodStart returns the start of the period containing t, evaluated in t's location. Weeks start on Monday.
+func (b Boundary) PeriodStart(t time.Time) time.Time {
+	year, month, day := t.Date()
+
+	switch b {
+	case Hourly:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, t.Location())
+	case Daily:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	case Weekly:
+		sinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-sinceMonday, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	}
+}
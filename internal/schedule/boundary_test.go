@@ -0,0 +1,41 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBoundary_PeriodStart(t *testing.T) {
+	now := time.Date(2025, time.June, 18, 14, 35, 10, 0, time.UTC) // a Wednesday
+
+	tests := []struct {
+		boundary Boundary
+		want     time.Time
+	}{
+		{Hourly, time.Date(2025, time.June, 18, 14, 0, 0, 0, time.UTC)},
+		{Daily, time.Date(2025, time.June, 18, 0, 0, 0, 0, time.UTC)},
+		{Weekly, time.Date(2025, time.June, 16, 0, 0, 0, 0, time.UTC)},
+		{Monthly, time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if got := tt.boundary.PeriodStart(now); !got.Equal(tt.want) {
+			t.Errorf("%s: expected %s, got %s", tt.boundary, tt.want, got)
+		}
+	}
+
+	sunday := time.Date(2025, time.June, 22, 23, 0, 0, 0, time.UTC)
+	if got := Weekly.PeriodStart(sunday); !got.Equal(time.Date(2025, time.June, 16, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected Sunday to belong to the week starting Monday the 16th, got %s", got)
+	}
+}
+
+func TestParseBoundary(t *testing.T) {
+	if b, err := ParseBoundary("monthly"); err != nil || b != Monthly {
+		t.Errorf("ParseBoundary(monthly) = %q, %v", b, err)
+	}
+
+	if _, err := ParseBoundary("fortnightly"); err == nil {
+		t.Error("expected error for unknown boundary")
+	}
+}
@@ -0,0 +1,151 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dayNames maps the accepted three-letter day abbreviations to their weekday.
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window is a recurring daily time range, optionally restricted to certain weekdays. A window whose end is before its
+// start runs past midnight into the following day.
+type Window struct {
+	days  [7]bool
+	start int
+	end   int
+}
+
+// Schedule is a set of windows; a time falls within the schedule when it falls within any of its windows.
+type Schedule []Window
+
+// Parse parses a list of window specs such as "Mon-Fri 09:00-18:00", "Sat,Sun 02:00-04:00", or "22:00-02:00". Days
+// are optional and default to every day.
+func Parse(specs []string) (Schedule, error) {
+	schedule := make(Schedule, 0, len(specs))
+
+	for _, spec := range specs {
+		window, err := parseWindow(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", spec, err)
+		}
+		schedule = append(schedule, window)
+	}
+
+	return schedule, nil
+}
+
+// Contains reports whether t falls within any window of the schedule, evaluated in t's location.
+func (s Schedule) Contains(t time.Time) bool {
+	for _, w := range s {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether t falls within the window.
+func (w Window) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+
+	if w.start < w.end {
+		return w.days[day] && minute >= w.start && minute < w.end
+	}
+
+	previous := (day + 6) % 7
+	return (w.days[day] && minute >= w.start) || (w.days[previous] && minute < w.end)
+}
+
+// parseWindow parses a single "[days] HH:MM-HH:MM" spec.
+func parseWindow(spec string) (Window, error) {
+	var w Window
+
+	fields := strings.Fields(spec)
+	var times string
+	switch len(fields) {
+	case 1:
+		for i := range w.days {
+			w.days[i] = true
+		}
+		times = fields[0]
+	case 2:
+		if err := parseDays(fields[0], &w.days); err != nil {
+			return Window{}, err
+		}
+		times = fields[1]
+	default:
+		return Window{}, fmt.Errorf("expected \"[days] HH:MM-HH:MM\"")
+	}
+
+	from, to, ok := strings.Cut(times, "-")
+	if !ok {
+		return Window{}, fmt.Errorf("expected a time range HH:MM-HH:MM")
+	}
+
+	var err error
+	if w.start, err = parseClock(from); err != nil {
+		return Window{}, err
+	}
+	if w.end, err = parseClock(to); err != nil {
+		return Window{}, err
+	}
+
+	if w.start == w.end {
+		return Window{}, fmt.Errorf("window must not be empty")
+	}
+
+	return w, nil
+}
+
+// parseDays parses a comma-separated list of days or day ranges such as "Mon-Fri,Sun".
+func parseDays(spec string, days *[7]bool) error {
+	for _, part := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+
+		first, ok := dayNames[strings.ToLower(from)]
+		if !ok {
+			return fmt.Errorf("unknown day %q", from)
+		}
+
+		last := first
+		if isRange {
+			if last, ok = dayNames[strings.ToLower(to)]; !ok {
+				return fmt.Errorf("unknown day %q", to)
+			}
+		}
+
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseClock parses an HH:MM time of day into minutes past midnight. 24:00 is accepted as the end of the day.
+func parseClock(value string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hour, &minute); err != nil || len(value) != 5 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+
+	if hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+
+	return hour*60 + minute, nil
+}
@@ -0,0 +1,65 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns the given weekday and time of day in the first week of June 2025, which starts on a Sunday.
+func at(day time.Weekday, hour, minute int) time.Time {
+	return time.Date(2025, time.June, 1+int(day), hour, minute, 0, 0, time.UTC)
+}
+
+func TestParse_Contains(t *testing.T) {
+	tests := []struct {
+		name  string
+		specs []string
+		time  time.Time
+		want  bool
+	}{
+		{"every day inside", []string{"02:00-04:00"}, at(time.Wednesday, 3, 0), true},
+		{"every day at end", []string{"02:00-04:00"}, at(time.Wednesday, 4, 0), false},
+		{"weekday range inside", []string{"Mon-Fri 09:00-18:00"}, at(time.Friday, 17, 59), true},
+		{"weekday range weekend", []string{"Mon-Fri 09:00-18:00"}, at(time.Saturday, 10, 0), false},
+		{"day list", []string{"Sat,Sun 02:00-04:00"}, at(time.Sunday, 2, 30), true},
+		{"wrapping day range", []string{"Fri-Mon 00:00-24:00"}, at(time.Sunday, 12, 0), true},
+		{"overnight before midnight", []string{"Sat 22:00-02:00"}, at(time.Saturday, 23, 0), true},
+		{"overnight after midnight", []string{"Sat 22:00-02:00"}, at(time.Sunday, 1, 0), true},
+		{"overnight wrong day", []string{"Sat 22:00-02:00"}, at(time.Saturday, 1, 0), false},
+		{"any window", []string{"01:00-02:00", "Tue 10:00-11:00"}, at(time.Tuesday, 10, 30), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.specs)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := s.Contains(tt.time); got != tt.want {
+				t.Errorf("Contains(%s) = %v, want %v", tt.time, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	specs := []string{
+		"",
+		"Mon",
+		"Mon 09:00",
+		"Funday 09:00-10:00",
+		"Mon-Xyz 09:00-10:00",
+		"25:00-26:00",
+		"09:60-10:00",
+		"9:00-10:00",
+		"10:00-10:00",
+		"Mon 09:00-10:00 extra",
+	}
+
+	for _, spec := range specs {
+		if _, err := Parse([]string{spec}); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notification states understood by systemd.
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Enabled reports whether conduit runs as a systemd service expecting notifications.
+func Enabled() bool {
+	return os.Getenv("NOTIFY_SOCKET") != ""
+}
+
+// Notify sends state to the service manager over the socket named by NOTIFY_SOCKET, reporting whether it was sent. When
+// conduit is not running under systemd, or the unit is not Type=notify, NOTIFY_SOCKET is unset and Notify does nothing.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+
+	// A leading @ names a socket in the abstract namespace.
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("failed to reach systemd notify socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("failed to notify systemd: %w", err)
+	}
+
+	return true, nil
+}
+
+// WatchdogInterval returns the WatchdogSec of the unit, as passed in WATCHDOG_USEC, or 0 when the watchdog is not
+// enabled for this process. systemd restarts the service unless Watchdog is sent within every interval.
+func WatchdogInterval() (time.Duration, error) {
+	value := os.Getenv("WATCHDOG_USEC")
+	if value == "" {
+		return 0, nil
+	}
+
+	// WATCHDOG_PID, when set, names the process the watchdog applies to, which may be a parent of conduit.
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+
+	usec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC %q", value)
+	}
+
+	return time.Duration(usec) * time.Microsecond, nil
+}
@@ -0,0 +1,82 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestNotify_NoSocket verifies that Notify does nothing outside systemd.
+func TestNotify_NoSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	sent, err := Notify(Ready)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sent {
+		t.Error("expected nothing to be sent without NOTIFY_SOCKET")
+	}
+}
+
+// TestNotify_SendsState verifies that the state is written as one datagram to the notify socket.
+func TestNotify_SendsState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	listener, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	sent, err := Notify(Ready)
+	if err != nil || !sent {
+		t.Fatalf("expected the state to be sent, got %v, %v", sent, err)
+	}
+
+	_ = listener.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 64)
+	n, err := listener.Read(buf)
+	if err != nil {
+		t.Fatalf("failed to read notification: %v", err)
+	}
+	if got := string(buf[:n]); got != Ready {
+		t.Errorf("expected %q, got %q", Ready, got)
+	}
+}
+
+// TestWatchdogInterval verifies parsing of WATCHDOG_USEC and that a watchdog meant for another process is ignored.
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		usec    string
+		pid     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "disabled", usec: "", want: 0},
+		{name: "enabled", usec: "30000000", want: 30 * time.Second},
+		{name: "this process", usec: "2000000", pid: strconv.Itoa(os.Getpid()), want: 2 * time.Second},
+		{name: "other process", usec: "2000000", pid: "1", want: 0},
+		{name: "invalid", usec: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+
+			got, err := WatchdogInterval()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,453 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"gopkg.in/yaml.v3"
+)
+
+// KeyFiles lists private key paths that are offered to the server in order until one is accepted. In YAML it may be
+// written either as a single path or as a list of paths.
+type KeyFiles []string
+
+// UnmarshalYAML decodes either a single scalar path or a sequence of paths.
+func (k *KeyFiles) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*k = nil
+		if value.Value != "" {
+			*k = KeyFiles{value.Value}
+		}
+		return nil
+	}
+
+	var files []string
+	if err := value.Decode(&files); err != nil {
+		return err
+	}
+	*k = files
+
+	return nil
+}
+
+// keySigner pairs a parsed private key with the file it was loaded from.
+type keySigner struct {
+	path   string
+	signer ssh.Signer
+}
+
+// SSHConfig represents the configuration for establishing an SSH connection, including authentication and host details.
+// KeyPassphrase decrypts whichever of the key files are encrypted. With KnownHostsFile set, StrictHostKeys (on unless
+// set to false) rejects servers whose key is not listed; turned off, unknown hosts are trusted on first use and added
+// to the file, while a key that differs from the listed one is still rejected. KnownHostsFile is required unless
+// InsecureIgnoreHostKey is set, which accepts any host key and so rules out StrictHostKeys; a KnownHostsFile, when
+// given, takes precedence over it. JumpHosts are connected through in order before the server itself, each with its
+// own address, user, and authentication; the connection through them is shared by every tunnel using this SSHConfig.
+// With Agent set, the keys held by the ssh-agent listening on SSH_AUTH_SOCK are offered before any password or keyFile.
+// ConnectTimeout bounds connecting to the server, handshake included, and KeepAliveInterval, when set, is how often
+// the connection is checked with a keepalive request; one that fails or goes unanswered that long marks it as failed.
+type SSHConfig struct {
+	User                  string              `yaml:"user,omitempty"`
+	Password              string              `yaml:"password,omitempty"`
+	KeyFile               KeyFiles            `yaml:"keyFile,omitempty"`
+	KeyPassphrase         string              `yaml:"keyPassphrase,omitempty"`
+	Host                  string              `yaml:"host,omitempty"`
+	KnownHostsFile        string              `yaml:"knownHostsFile,omitempty"`
+	StrictHostKeys        *bool               `yaml:"strictHostKeyChecking,omitempty"`
+	InsecureIgnoreHostKey bool                `yaml:"insecureIgnoreHostKey,omitempty"`
+	Port                  int                 `yaml:"port,omitempty"`
+	Agent                 bool                `yaml:"agent,omitempty"`
+	JumpHosts             []SSHConfig         `yaml:"jumpHosts,omitempty"`
+	ConnectTimeout        time.Duration       `yaml:"connectTimeout,omitempty"`
+	KeepAliveInterval     time.Duration       `yaml:"keepAliveInterval,omitempty"`
+	AuthMethods           []ssh.AuthMethod    `yaml:"-"`
+	HostKeyCallback       ssh.HostKeyCallback `yaml:"-"`
+
+	keys  []keySigner
+	jumps *jumpChain
+}
+
+// NewSSHConfig creates and returns a new SSHConfig object with the specified parameters and performs required validations.
+// An empty knownHostsFile sets InsecureIgnoreHostKey, so the server's host key is not verified.
+func NewSSHConfig(user, password, keyFile, host, knownHostsFile string, port int) (*SSHConfig, error) {
+	cfg := &SSHConfig{
+		User:                  user,
+		Password:              password,
+		Host:                  host,
+		KnownHostsFile:        knownHostsFile,
+		InsecureIgnoreHostKey: knownHostsFile == "",
+		Port:                  port,
+	}
+	if keyFile != "" {
+		cfg.KeyFile = KeyFiles{keyFile}
+	}
+
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Clone returns a copy of the SSHConfig that shares no slices or pointers a caller could change with the original.
+// Authentication methods and the host key callback are copied as values, so the copy still connects the same way.
+func (c *SSHConfig) Clone() *SSHConfig {
+	clone := *c
+	clone.KeyFile = slices.Clone(c.KeyFile)
+	clone.AuthMethods = slices.Clone(c.AuthMethods)
+	if c.StrictHostKeys != nil {
+		strict := *c.StrictHostKeys
+		clone.StrictHostKeys = &strict
+	}
+	if c.JumpHosts != nil {
+		clone.JumpHosts = make([]SSHConfig, len(c.JumpHosts))
+		for i := range c.JumpHosts {
+			clone.JumpHosts[i] = *c.JumpHosts[i].Clone()
+		}
+	}
+	return &clone
+}
+
+// Addr returns the SSH host and port formatted as a string in the "host:port" format.
+func (c *SSHConfig) Addr() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+// IsInsecure determines if the SSHConfig lacks a KnownHostsFile, implying an insecure host key verification strategy.
+func (c *SSHConfig) IsInsecure() bool {
+	return c.KnownHostsFile == ""
+}
+
+// StrictHostKeyChecking reports whether servers missing from the known_hosts file are rejected rather than added.
+func (c *SSHConfig) StrictHostKeyChecking() bool {
+	return c.StrictHostKeys == nil || *c.StrictHostKeys
+}
+
+// Validate checks the SSHConfig fields for required values, sets defaults, and prepares authentication methods.
+func (c *SSHConfig) Validate() error {
+	if c.Port == 0 {
+		c.Port = 22
+	}
+
+	if c.Host == "" {
+		return fmt.Errorf("host is required")
+	}
+
+	if c.User == "" {
+		return fmt.Errorf("user is required")
+	}
+
+	if c.Password == "" && len(c.KeyFile) == 0 && !c.Agent {
+		return fmt.Errorf("password, keyFile, or agent is required")
+	}
+
+	if c.ConnectTimeout < 0 {
+		return fmt.Errorf("connectTimeout must not be negative")
+	}
+
+	if c.KeepAliveInterval < 0 {
+		return fmt.Errorf("keepAliveInterval must not be negative")
+	}
+
+	if c.KeyPassphrase != "" && len(c.KeyFile) == 0 {
+		return fmt.Errorf("keyPassphrase requires keyFile")
+	}
+
+	if len(c.KeyFile) > 0 {
+		c.keys = make([]keySigner, 0, len(c.KeyFile))
+		signers := make([]ssh.Signer, 0, len(c.KeyFile))
+
+		for _, path := range c.KeyFile {
+			signer, err := parseKeyFile(path, c.KeyPassphrase)
+			if err != nil {
+				return err
+			}
+
+			c.keys = append(c.keys, keySigner{path: path, signer: signer})
+			signers = append(signers, signer)
+		}
+
+		c.AuthMethods = []ssh.AuthMethod{ssh.PublicKeys(signers...)}
+	} else if c.Password == "" {
+		c.AuthMethods = nil
+	} else {
+		c.AuthMethods = []ssh.AuthMethod{
+			ssh.Password(c.Password),
+			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range questions {
+					answers[i] = c.Password
+				}
+				return answers, nil
+			}),
+		}
+	}
+
+	if err := c.validateJumpHosts(); err != nil {
+		return err
+	}
+
+	switch {
+	case c.KnownHostsFile == "" && c.StrictHostKeys != nil:
+		return fmt.Errorf("strictHostKeyChecking requires knownHostsFile, without which host keys are not verified at all")
+	case c.KnownHostsFile == "" && !c.InsecureIgnoreHostKey:
+		return fmt.Errorf("knownHostsFile is required to verify the server's host key; set insecureIgnoreHostKey to accept any key")
+	}
+
+	if c.KnownHostsFile != "" {
+		checker, err := newHostKeyChecker(c.KnownHostsFile, c.StrictHostKeyChecking())
+		if err != nil {
+			return err
+		}
+		c.HostKeyCallback = checker.verify
+	} else {
+		c.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	}
+
+	return nil
+}
+
+// parseKeyFile reads the private key at path, decrypting it with passphrase when it is encrypted. A missing file, a
+// missing passphrase, and a wrong passphrase are reported as distinct errors.
+func parseKeyFile(path, passphrase string) (ssh.Signer, error) {
+	key, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("keyFile %s: key not found: %w", path, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyFile %s: %w", path, err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse keyFile %s: %w", path, err)
+		}
+		return signer, nil
+	}
+
+	if passphrase == "" {
+		return nil, fmt.Errorf("keyFile %s is encrypted: keyPassphrase is required", path)
+	}
+
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	if errors.Is(err, x509.IncorrectPasswordError) {
+		return nil, fmt.Errorf("keyFile %s: incorrect passphrase: %w", path, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse keyFile %s: %w", path, err)
+	}
+
+	return signer, nil
+}
+
+// hostKeyChecker verifies server host keys against a known_hosts file, adding unknown hosts to it when not strict.
+type hostKeyChecker struct {
+	path   string
+	strict bool
+
+	mu    sync.Mutex
+	check ssh.HostKeyCallback
+}
+
+// newHostKeyChecker loads the known_hosts file at path.
+func newHostKeyChecker(path string, strict bool) (*hostKeyChecker, error) {
+	check, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known_hosts: %w", err)
+	}
+
+	return &hostKeyChecker{path: path, strict: strict, check: check}, nil
+}
+
+// verify is an ssh.HostKeyCallback describing why a host key was rejected, and trusting unknown hosts on first use
+// when not strict.
+func (h *hostKeyChecker) verify(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	err := h.check(hostname, remote, key)
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return err
+	}
+
+	if len(keyErr.Want) > 0 {
+		return fmt.Errorf("host key mismatch for %s: the server offered a %s key that differs from the one in %s, "+
+			"so it may be impersonated: %w", hostname, key.Type(), h.path, err)
+	}
+
+	if h.strict {
+		return fmt.Errorf("host key for %s is not in %s and strictHostKeyChecking is on: %w", hostname, h.path, err)
+	}
+
+	if err := h.trust(hostname, remote, key); err != nil {
+		return fmt.Errorf("failed to add host key for %s to %s: %w", hostname, h.path, err)
+	}
+
+	return nil
+}
+
+// trust appends the host key to the known_hosts file and reloads it, so the key is checked from now on. The caller
+// must hold h.mu.
+func (h *hostKeyChecker) trust(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	addresses := []string{hostname}
+	if remote != nil && remote.String() != hostname {
+		addresses = append(addresses, remote.String())
+	}
+
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(f, knownhosts.Line(addresses, key)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	check, err := knownhosts.New(h.path)
+	if err != nil {
+		return err
+	}
+	h.check = check
+
+	return nil
+}
+
+// authMethods returns the methods used to authenticate a single connection. When keys are configured, onKey is called
+// with the path of the key the server accepted, since the client only signs with a key after the server agrees to it.
+func (c *SSHConfig) authMethods(onKey func(path string)) []ssh.AuthMethod {
+	if len(c.keys) == 0 {
+		return c.AuthMethods
+	}
+
+	signers := make([]ssh.Signer, 0, len(c.keys))
+	for _, key := range c.keys {
+		signer, ok := key.signer.(ssh.MultiAlgorithmSigner)
+		if !ok {
+			signers = append(signers, key.signer)
+			continue
+		}
+		signers = append(signers, &recordingSigner{MultiAlgorithmSigner: signer, path: key.path, onSign: onKey})
+	}
+
+	return []ssh.AuthMethod{ssh.PublicKeys(signers...)}
+}
+
+// clientConfig builds the client configuration for one connection to the server, returning a function that closes
+// the ssh-agent connection once authentication is done. onKey is passed to authMethods.
+func (c *SSHConfig) clientConfig(onKey func(path string)) (*ssh.ClientConfig, func(), error) {
+	auth := c.authMethods(onKey)
+	closeAuth := func() {}
+	if c.Agent {
+		agentAuth, closeAgent, err := dialAgent()
+		if err != nil {
+			return nil, nil, err
+		}
+		closeAuth = func() { _ = closeAgent() }
+		auth = append([]ssh.AuthMethod{agentAuth}, auth...)
+	}
+
+	return &ssh.ClientConfig{
+		User:            c.User,
+		Auth:            auth,
+		HostKeyCallback: c.HostKeyCallback,
+		Config: ssh.Config{
+			KeyExchanges: []string{
+				"diffie-hellman-group-exchange-sha256",
+				"diffie-hellman-group14-sha256",
+				"diffie-hellman-group14-sha1",
+				"curve25519-sha256",
+				"curve25519-sha256@libssh.org",
+				"ecdh-sha2-nistp256",
+				"ecdh-sha2-nistp384",
+				"ecdh-sha2-nistp521",
+			},
+		},
+	}, closeAuth, nil
+}
+
+// dialServer opens a TCP connection to addr, giving up after ConnectTimeout when one is set or once ctx is done.
+func (c *SSHConfig) dialServer(ctx context.Context, addr string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: c.ConnectTimeout}
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+// handshake runs the SSH handshake over conn, failing once ConnectTimeout has passed when one is set or once ctx is
+// done, so a server that accepts the connection but never answers cannot hang the caller.
+func (c *SSHConfig) handshake(ctx context.Context, conn net.Conn, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if c.ConnectTimeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(c.ConnectTimeout))
+	}
+
+	// Expiring the deadline unblocks the handshake; the connection is the caller's to close.
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Unix(1, 0)) })
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if !stop() {
+		if err == nil {
+			_ = sshConn.Close()
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// dialAgent connects to the ssh-agent named by SSH_AUTH_SOCK, returning an auth method offering its keys and a function
+// closing the connection once authentication is done.
+func dialAgent() (ssh.AuthMethod, func() error, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, fmt.Errorf("ssh agent: SSH_AUTH_SOCK is not set")
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ssh agent: failed to connect to %s: %w", socket, err)
+	}
+
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), conn.Close, nil
+}
+
+// recordingSigner wraps a Signer to report its key file once it is used to sign the authentication request.
+type recordingSigner struct {
+	ssh.MultiAlgorithmSigner
+	path   string
+	onSign func(path string)
+}
+
+// Sign records the key file and delegates to the wrapped Signer.
+func (s *recordingSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	s.onSign(s.path)
+	return s.MultiAlgorithmSigner.Sign(rand, data)
+}
+
+// SignWithAlgorithm records the key file and delegates to the wrapped Signer.
+func (s *recordingSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	s.onSign(s.path)
+	return s.MultiAlgorithmSigner.SignWithAlgorithm(rand, data, algorithm)
+}
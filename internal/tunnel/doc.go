@@ -0,0 +1,5 @@
+// Package tunnel forwards local ports to remote hosts over SSH.
+//
+// It started as a copy of github.com/pperesbr/gokit/pkg/tunnel at v0.0.0-20260107183620-3e9421f7d23b and is
+// maintained here from then on; changes are not synced back to gokit.
+package tunnel
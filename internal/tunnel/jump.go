@@ -0,0 +1,254 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// validateJumpHosts validates every jump host and checks that its address resolves, then prepares the chain shared by
+// the tunnels dialing through them.
+func (c *SSHConfig) validateJumpHosts() error {
+	c.jumps = nil
+	if len(c.JumpHosts) == 0 {
+		return nil
+	}
+
+	for i := range c.JumpHosts {
+		hop := &c.JumpHosts[i]
+		if len(hop.JumpHosts) > 0 {
+			return fmt.Errorf("jump host %d: jumpHosts cannot be nested, list every hop in order instead", i+1)
+		}
+
+		if err := hop.Validate(); err != nil {
+			return fmt.Errorf("jump host %d: %w", i+1, err)
+		}
+
+		if _, err := net.LookupHost(hop.Host); err != nil {
+			return fmt.Errorf("jump host %d: cannot resolve %s: %w", i+1, hop.Host, err)
+		}
+	}
+
+	c.jumps = &jumpChain{hops: c.JumpHosts}
+
+	return nil
+}
+
+// jumpPingTimeout bounds the keepalive that checks whether the last jump host still answers after a dial through it
+// failed.
+const jumpPingTimeout = 5 * time.Second
+
+// jumpChain holds the SSH connections through a config's jump hosts, opened on first use and shared by every tunnel
+// dialing through them. It closes once the last connection made through it is gone, and reconnects on the next dial
+// after the last hop stopped answering. Its lock is never held across network I/O: the chain is connected and dialed
+// through outside it, and the result published under it.
+type jumpChain struct {
+	hops []SSHConfig
+
+	mu         sync.Mutex
+	clients    []*ssh.Client
+	connecting chan struct{} // closed once the connect in progress, if any, has finished
+	refs       int
+	gen        int
+}
+
+// dial opens a connection to addr through the last jump host, connecting the chain first if needed, unless ctx is done
+// first. A failed dial over an open chain leaves it open for the tunnels using it unless the last hop no longer
+// answers a keepalive within jumpPingTimeout; a dial cut off by ctx never closes it. The returned function must be
+// called once the connection is no longer used.
+func (j *jumpChain) dial(ctx context.Context, addr string) (net.Conn, func(), error) {
+	for {
+		j.mu.Lock()
+		if wait := j.connecting; wait != nil {
+			j.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			}
+		}
+
+		if len(j.clients) > 0 {
+			last, gen := j.last(), j.gen
+			j.mu.Unlock()
+
+			conn, err := last.DialContext(ctx, "tcp", addr)
+			if err == nil {
+				if release := j.acquire(gen); release != nil {
+					return conn, release, nil
+				}
+				// The chain was closed while dialing, taking the connection with it.
+				_ = conn.Close()
+				continue
+			}
+			if ctx.Err() != nil || pingWithin(last, jumpPingTimeout) == nil {
+				return nil, nil, j.reachError(addr, err)
+			}
+
+			j.mu.Lock()
+			if j.gen == gen {
+				j.closeLocked()
+			}
+			j.mu.Unlock()
+			continue
+		}
+
+		done := make(chan struct{})
+		j.connecting = done
+		j.mu.Unlock()
+
+		clients, err := j.connect(ctx)
+
+		j.mu.Lock()
+		j.connecting = nil
+		close(done)
+		if err != nil {
+			j.mu.Unlock()
+			return nil, nil, err
+		}
+		j.clients = clients
+		last, gen := j.last(), j.gen
+		j.mu.Unlock()
+
+		conn, err := last.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			// Close the fresh chain unless another tunnel has started using it meanwhile.
+			j.mu.Lock()
+			if j.gen == gen && j.refs == 0 {
+				j.closeLocked()
+			}
+			j.mu.Unlock()
+			return nil, nil, j.reachError(addr, err)
+		}
+
+		if release := j.acquire(gen); release != nil {
+			return conn, release, nil
+		}
+		_ = conn.Close()
+	}
+}
+
+// pingWithin checks that the SSH connection of client answers a keepalive request within timeout, so a black-holed
+// connection is not waited on until TCP gives up.
+func pingWithin(client *ssh.Client, timeout time.Duration) error {
+	answered := make(chan error, 1)
+	go func() {
+		answered <- pingClient(client)
+	}()
+
+	select {
+	case err := <-answered:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("no keepalive reply within %s", timeout)
+	}
+}
+
+// reachError wraps err, returned by the last jump host when dialing addr.
+func (j *jumpChain) reachError(addr string, err error) error {
+	return fmt.Errorf("jump host %d (%s): failed to reach %s: %w", len(j.hops), j.hops[len(j.hops)-1].Addr(), addr, err)
+}
+
+// last returns the client connected to the final jump host. The caller must hold j.mu.
+func (j *jumpChain) last() *ssh.Client {
+	return j.clients[len(j.clients)-1]
+}
+
+// connect connects to every jump host in order, each through the one before, and returns the clients, innermost last.
+// On failure the hops already connected are closed again.
+func (j *jumpChain) connect(ctx context.Context) ([]*ssh.Client, error) {
+	var clients []*ssh.Client
+	fail := func(err error) ([]*ssh.Client, error) {
+		closeClients(clients)
+		return nil, err
+	}
+
+	for i := range j.hops {
+		hop := &j.hops[i]
+
+		var conn net.Conn
+		var err error
+		if i == 0 {
+			conn, err = hop.dialServer(ctx, hop.Addr())
+		} else {
+			conn, err = clients[len(clients)-1].DialContext(ctx, "tcp", hop.Addr())
+		}
+		if err != nil {
+			return fail(fmt.Errorf("jump host %d (%s): failed to connect: %w", i+1, hop.Addr(), err))
+		}
+
+		clientConfig, closeAuth, err := hop.clientConfig(func(string) {})
+		if err != nil {
+			_ = conn.Close()
+			return fail(fmt.Errorf("jump host %d (%s): %w", i+1, hop.Addr(), err))
+		}
+
+		client, err := hop.handshake(ctx, conn, hop.Addr(), clientConfig)
+		closeAuth()
+		if err != nil {
+			_ = conn.Close()
+			return fail(fmt.Errorf("jump host %d (%s): %w", i+1, hop.Addr(), err))
+		}
+
+		clients = append(clients, client)
+	}
+
+	return clients, nil
+}
+
+// acquire counts a new connection through the chain and returns the function releasing it, or nil when the chain has
+// been closed since it was generation gen.
+func (j *jumpChain) acquire(gen int) func() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.gen != gen {
+		return nil
+	}
+	return j.acquireLocked()
+}
+
+// acquireLocked counts a new connection through the chain and returns the function releasing it. Releases of
+// connections made before the chain was last closed are ignored. The caller must hold j.mu.
+func (j *jumpChain) acquireLocked() func() {
+	j.refs++
+	gen := j.gen
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			j.mu.Lock()
+			defer j.mu.Unlock()
+
+			if j.gen != gen {
+				return
+			}
+
+			j.refs--
+			if j.refs == 0 {
+				j.closeLocked()
+			}
+		})
+	}
+}
+
+// closeLocked closes every hop, innermost first. The caller must hold j.mu.
+func (j *jumpChain) closeLocked() {
+	closeClients(j.clients)
+
+	j.clients = nil
+	j.refs = 0
+	j.gen++
+}
+
+// closeClients closes the clients of a jump chain, innermost first.
+func closeClients(clients []*ssh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		_ = clients[i].Close()
+	}
+}
@@ -0,0 +1,274 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestJumpHosts_SharedChain(t *testing.T) {
+	jumpServer, jumpCfg := setupTestSSHServer(t)
+	defer jumpServer.Close()
+
+	bastion, sshCfg := setupTestSSHServer(t)
+	defer bastion.Close()
+
+	destServer := setupTestDestinationServerFunc(t, func(conn net.Conn) {
+		io.Copy(conn, conn)
+		conn.Close()
+	})
+	defer destServer.Close()
+
+	cfg := *sshCfg
+	cfg.JumpHosts = []SSHConfig{*jumpCfg}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+	tunnels := []*Tunnel{NewTunnel(&cfg, "127.0.0.1", destPort, 0), NewTunnel(&cfg, "127.0.0.1", destPort, 0)}
+	for _, tunnel := range tunnels {
+		if err := tunnel.Start(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if echoed := echoThrough(t, tunnel, []byte("through the jump")); string(echoed) != "through the jump" {
+			t.Errorf("expected the echo through the jump host, got %q", echoed)
+		}
+	}
+
+	cfg.jumps.mu.Lock()
+	clients, refs := len(cfg.jumps.clients), cfg.jumps.refs
+	cfg.jumps.mu.Unlock()
+	if clients != 1 || refs != 2 {
+		t.Errorf("expected both tunnels to share one jump connection, got %d connection(s) used %d time(s)", clients, refs)
+	}
+
+	for _, tunnel := range tunnels {
+		tunnel.Stop()
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		cfg.jumps.mu.Lock()
+		clients = len(cfg.jumps.clients)
+		cfg.jumps.mu.Unlock()
+		if clients == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if clients != 0 {
+		t.Error("expected the jump connection to close after the last tunnel stopped")
+	}
+
+	jumpServer.Close()
+	tunnel := NewTunnel(&cfg, "127.0.0.1", destPort, 0)
+	err := tunnel.Start()
+	if err == nil {
+		tunnel.Stop()
+		t.Fatal("expected error with the jump host down")
+	}
+	if !strings.Contains(err.Error(), "jump host 1") || tunnel.LastError() == nil {
+		t.Errorf("expected the failing hop in the tunnel error, got: %v", err)
+	}
+}
+
+// TestJumpHosts_RefusedDialKeepsChain verifies that a tunnel failing to reach its server through a shared jump chain
+// leaves the chain, and the tunnels already using it, untouched.
+func TestJumpHosts_RefusedDialKeepsChain(t *testing.T) {
+	jumpServer, jumpCfg := setupTestSSHServer(t)
+	defer jumpServer.Close()
+
+	bastion, sshCfg := setupTestSSHServer(t)
+	defer bastion.Close()
+
+	destServer := setupTestDestinationServerFunc(t, func(conn net.Conn) {
+		io.Copy(conn, conn)
+		conn.Close()
+	})
+	defer destServer.Close()
+
+	cfg := *sshCfg
+	cfg.JumpHosts = []SSHConfig{*jumpCfg}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+	running := NewTunnel(&cfg, "127.0.0.1", destPort, 0)
+	if err := running.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer running.Stop()
+
+	cfg.jumps.mu.Lock()
+	before := cfg.jumps.gen
+	cfg.jumps.mu.Unlock()
+
+	bastion.Close()
+	refused := NewTunnel(&cfg, "127.0.0.1", destPort, 0)
+	if err := refused.Start(); err == nil {
+		refused.Stop()
+		t.Fatal("expected error with the server refusing connections")
+	}
+
+	cfg.jumps.mu.Lock()
+	clients, refs, after := len(cfg.jumps.clients), cfg.jumps.refs, cfg.jumps.gen
+	cfg.jumps.mu.Unlock()
+	if clients != 1 || refs != 1 || after != before {
+		t.Errorf("expected the jump connection to stay open for the running tunnel, got %d connection(s) used %d time(s)", clients, refs)
+	}
+
+	if echoed := echoThrough(t, running, []byte("still through")); string(echoed) != "still through" {
+		t.Errorf("expected the running tunnel to keep forwarding, got %q", echoed)
+	}
+}
+
+// TestJumpHosts_CancelledStartKeepsChain verifies that a start cut off by its context while dialing through a shared
+// jump chain leaves the chain, and the tunnels already using it, untouched.
+func TestJumpHosts_CancelledStartKeepsChain(t *testing.T) {
+	var hold atomic.Bool
+	gate := make(chan struct{})
+	defer close(gate)
+
+	jumpServer, jumpCfg := setupTestSSHServerWithHandler(t, func(newChannel ssh.NewChannel) {
+		if !hold.Load() {
+			forwardTestChannel(newChannel)
+			return
+		}
+		go func() {
+			<-gate
+			newChannel.Reject(ssh.ConnectionFailed, "held")
+		}()
+	})
+	defer jumpServer.Close()
+
+	bastion, sshCfg := setupTestSSHServer(t)
+	defer bastion.Close()
+
+	destServer := setupTestDestinationServerFunc(t, func(conn net.Conn) {
+		io.Copy(conn, conn)
+		conn.Close()
+	})
+	defer destServer.Close()
+
+	cfg := *sshCfg
+	cfg.JumpHosts = []SSHConfig{*jumpCfg}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+	running := NewTunnel(&cfg, "127.0.0.1", destPort, 0)
+	if err := running.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer running.Stop()
+
+	hold.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	cancelled := NewTunnel(&cfg, "127.0.0.1", destPort, 0)
+	if err := cancelled.StartContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		cancelled.Stop()
+		t.Fatalf("expected the start to be cut off by the context, got %v", err)
+	}
+
+	cfg.jumps.mu.Lock()
+	clients, refs := len(cfg.jumps.clients), cfg.jumps.refs
+	cfg.jumps.mu.Unlock()
+	if clients != 1 || refs != 1 {
+		t.Errorf("expected the jump connection to stay open for the running tunnel, got %d connection(s) used %d time(s)", clients, refs)
+	}
+
+	if echoed := echoThrough(t, running, []byte("still through")); string(echoed) != "still through" {
+		t.Errorf("expected the running tunnel to keep forwarding, got %q", echoed)
+	}
+}
+
+// TestJumpHosts_HungDialDoesNotBlockChain verifies that a dial stuck waiting on the last jump host does not hold the
+// chain, so other tunnels can still start through it.
+func TestJumpHosts_HungDialDoesNotBlockChain(t *testing.T) {
+	var holdNext atomic.Bool
+	gate := make(chan struct{})
+	defer close(gate)
+
+	jumpServer, jumpCfg := setupTestSSHServerWithHandler(t, func(newChannel ssh.NewChannel) {
+		if !holdNext.CompareAndSwap(true, false) {
+			forwardTestChannel(newChannel)
+			return
+		}
+		go func() {
+			<-gate
+			newChannel.Reject(ssh.ConnectionFailed, "held")
+		}()
+	})
+	defer jumpServer.Close()
+
+	bastion, sshCfg := setupTestSSHServer(t)
+	defer bastion.Close()
+
+	cfg := *sshCfg
+	cfg.JumpHosts = []SSHConfig{*jumpCfg}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	running := NewTunnel(&cfg, "127.0.0.1", 5432, 0)
+	if err := running.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer running.Stop()
+
+	holdNext.Store(true)
+	hung := NewTunnel(&cfg, "127.0.0.1", 5432, 0)
+	go hung.Start()
+	defer hung.Stop()
+	for holdNext.Load() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	started := make(chan error, 1)
+	other := NewTunnel(&cfg, "127.0.0.1", 5432, 0)
+	go func() {
+		started <- other.Start()
+	}()
+	defer other.Stop()
+
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a tunnel to start through the chain while another dial through it hangs")
+	}
+}
+
+func TestJumpHosts_Validate(t *testing.T) {
+	_, sshCfg := setupTestSSHServer(t)
+
+	cfg := *sshCfg
+	cfg.JumpHosts = []SSHConfig{{Host: "jump.invalid", User: "testuser", Password: "testpass", InsecureIgnoreHostKey: true}}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "cannot resolve") {
+		t.Errorf("expected an unresolvable jump host to be rejected, got: %v", err)
+	}
+
+	cfg.JumpHosts = []SSHConfig{{Host: "127.0.0.1", User: "testuser", InsecureIgnoreHostKey: true}}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "jump host 1") {
+		t.Errorf("expected a jump host without auth to be rejected, got: %v", err)
+	}
+
+	cfg.JumpHosts = []SSHConfig{{Host: "127.0.0.1", User: "testuser", Password: "testpass", JumpHosts: []SSHConfig{*sshCfg}}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected nested jump hosts to be rejected")
+	}
+}
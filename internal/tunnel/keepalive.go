@@ -0,0 +1,56 @@
+package tunnel
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// keepAlive sends a keepalive request over client every interval for as long as the connection lasts. A request that
+// fails or goes unanswered for an interval means the connection is dead even if TCP has not noticed yet, so the tunnel
+// is marked as failed and client closed.
+func (t *Tunnel) keepAlive(client *ssh.Client, interval time.Duration) {
+	gone := watchClient(client)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case <-ticker.C:
+		}
+
+		answered := make(chan error, 1)
+		go func() {
+			answered <- pingClient(client)
+		}()
+
+		select {
+		case <-gone:
+			return
+		case err := <-answered:
+			if err != nil {
+				t.keepAliveFailed(client, err)
+				return
+			}
+		case <-time.After(interval):
+			t.keepAliveFailed(client, fmt.Errorf("no keepalive reply within %s", interval))
+			return
+		}
+	}
+}
+
+// keepAliveFailed marks the tunnel as failed when the SSH connection it is using stopped answering keepalives, and
+// closes that connection. A connection the tunnel has already replaced or dropped is only closed.
+func (t *Tunnel) keepAliveFailed(client *ssh.Client, err error) {
+	t.mu.Lock()
+	if t.client == client && t.status == StatusRunning {
+		t.setStatus(StatusError)
+		t.lastError = fmt.Errorf("keepalive failed: %w", err)
+	}
+	t.mu.Unlock()
+
+	_ = client.Close()
+}
@@ -0,0 +1,171 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setupStallingProxy relays TCP connections to target until stall is called, after which it keeps the connections open
+// but stops passing data, like a peer that vanished without closing anything.
+func setupStallingProxy(t *testing.T, target string) (addr string, stall func()) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	stalled := make(chan struct{})
+	var once sync.Once
+
+	relay := func(dst, src net.Conn) {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := src.Read(buf)
+			select {
+			case <-stalled:
+				io.Copy(io.Discard, src)
+				return
+			default:
+			}
+			if n > 0 {
+				dst.Write(buf[:n])
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			upstream, err := net.Dial("tcp", target)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			t.Cleanup(func() {
+				conn.Close()
+				upstream.Close()
+			})
+			go relay(upstream, conn)
+			go relay(conn, upstream)
+		}
+	}()
+
+	return listener.Addr().String(), func() { once.Do(func() { close(stalled) }) }
+}
+
+func TestKeepAlive_MarksSilentConnectionFailed(t *testing.T) {
+	sshServer, cfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	proxyAddr, stall := setupStallingProxy(t, sshServer.Addr().String())
+	host, port, _ := net.SplitHostPort(proxyAddr)
+	cfg.Host = host
+	cfg.Port, _ = strconv.Atoi(port)
+	cfg.KeepAliveInterval = 50 * time.Millisecond
+
+	tun := NewTunnel(cfg, "127.0.0.1", 5432, 0)
+	if err := tun.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tun.Stop()
+
+	time.Sleep(150 * time.Millisecond)
+	if tun.Status() != StatusRunning {
+		t.Fatalf("expected answered keepalives to keep the tunnel running, got %s: %v", tun.Status(), tun.LastError())
+	}
+
+	stall()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for tun.Status() != StatusError && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if tun.Status() != StatusError {
+		t.Fatalf("expected the tunnel to fail once keepalives go unanswered, got %s", tun.Status())
+	}
+	if err := tun.LastError(); err == nil || !strings.Contains(err.Error(), "keepalive failed") {
+		t.Errorf("expected a keepalive error, got %v", err)
+	}
+}
+
+// setupSilentServer starts a server that accepts connections but never speaks SSH, returning its port.
+func setupSilentServer(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestStart_ConnectTimeout(t *testing.T) {
+	cfg := &SSHConfig{User: "testuser", Password: "testpass", Host: "127.0.0.1", Port: setupSilentServer(t),
+		ConnectTimeout: 100 * time.Millisecond, InsecureIgnoreHostKey: true}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tun := NewTunnel(cfg, "127.0.0.1", 5432, 0)
+	started := time.Now()
+	if err := tun.Start(); err == nil {
+		tun.Stop()
+		t.Fatal("expected Start to fail against a silent server")
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("expected Start to give up after connectTimeout, took %s", elapsed)
+	}
+
+	cfg.ConnectTimeout = -time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected a negative connectTimeout to be rejected")
+	}
+}
+
+func TestStartContext_CancelsHungHandshake(t *testing.T) {
+	cfg := &SSHConfig{User: "testuser", Password: "testpass", Host: "127.0.0.1", Port: setupSilentServer(t),
+		InsecureIgnoreHostKey: true}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	tun := NewTunnel(cfg, "127.0.0.1", 5432, 0)
+	err := tun.StartContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		tun.Stop()
+		t.Fatalf("expected the start to be cut off by the context, got %v", err)
+	}
+	if tun.Status() != StatusError || tun.LocalPort() != 0 {
+		t.Errorf("expected a cancelled start to leave no listener behind, got %s on port %d", tun.Status(), tun.LocalPort())
+	}
+}
@@ -0,0 +1,73 @@
+//go:build unix
+
+package tunnel
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+// TestConfigureConn_NoDelay verifies that accepted connections get TCP_NODELAY set according to the tunnel setting.
+func TestConfigureConn_NoDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		noDelay bool
+	}{
+		{name: "enabled", noDelay: true},
+		{name: "disabled", noDelay: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sshCfg, _ := NewSSHConfig("user", "pass", "", "localhost", "", 22)
+			tunnel := NewTunnel(sshCfg, "127.0.0.1", 1521, 0)
+			tunnel.SetNoDelay(tt.noDelay)
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to create listener: %v", err)
+			}
+			defer listener.Close()
+
+			client, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			defer client.Close()
+
+			accepted, err := listener.Accept()
+			if err != nil {
+				t.Fatalf("failed to accept: %v", err)
+			}
+			defer accepted.Close()
+
+			tunnel.configureConn(accepted)
+
+			if got := tcpNoDelay(t, accepted.(*net.TCPConn)); got != tt.noDelay {
+				t.Errorf("expected TCP_NODELAY=%v, got %v", tt.noDelay, got)
+			}
+		})
+	}
+}
+
+// tcpNoDelay reads the TCP_NODELAY socket option of a TCP connection.
+func tcpNoDelay(t *testing.T, conn *net.TCPConn) bool {
+	t.Helper()
+
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatalf("failed to get raw conn: %v", err)
+	}
+
+	var value int
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		value, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_NODELAY)
+	})
+	if err != nil || sockErr != nil {
+		t.Fatalf("failed to read TCP_NODELAY: %v %v", err, sockErr)
+	}
+
+	return value != 0
+}
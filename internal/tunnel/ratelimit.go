@@ -0,0 +1,58 @@
+package tunnel
+
+import (
+	"sync"
+	"time"
+)
+
+// rateBurst is the share of a second's worth of bytes a rate limiter lets through at once after sitting idle.
+const rateBurst = 10
+
+// rateLimiter is a token bucket pacing the bytes relayed in one direction across all of a tunnel's connections. Writes
+// take their bytes from the bucket up front and wait for any shortfall to refill, so concurrent connections share the
+// rate between them.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter creates a rateLimiter passing rate bytes per second, starting with a full bucket.
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{rate: rate, tokens: burstSize(rate), last: time.Now()}
+}
+
+// burstSize returns how many bytes the bucket holds at most at the given rate.
+func burstSize(rate int64) float64 {
+	return max(float64(rate)/rateBurst, 1)
+}
+
+// setRate changes the rate from now on, keeping the bytes already taken from the bucket.
+func (l *rateLimiter) setRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	l.rate = rate
+	l.tokens = min(l.tokens, burstSize(rate))
+}
+
+// reserve takes n bytes from the bucket and returns how long to wait before sending them.
+func (l *rateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+}
+
+// refill adds the bytes earned since the last refill, up to the bucket's size.
+func (l *rateLimiter) refill(now time.Time) {
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*float64(l.rate), burstSize(l.rate))
+	l.last = now
+}
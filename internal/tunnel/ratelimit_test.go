@@ -0,0 +1,73 @@
+package tunnel
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestRateLimit_CapsThroughput verifies that data relayed through a rate-limited tunnel arrives no faster than the cap,
+// allowing for the initial burst.
+func TestRateLimit_CapsThroughput(t *testing.T) {
+	sshServer, cfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	const rate, size = 128 * 1024, 96 * 1024
+	payload := bytes.Repeat([]byte("x"), size)
+
+	destServer := setupTestDestinationServerFunc(t, func(conn net.Conn) {
+		defer conn.Close()
+		_, _ = conn.Write(payload)
+	})
+	defer destServer.Close()
+
+	tun := NewTunnel(cfg, "127.0.0.1", destServer.Addr().(*net.TCPAddr).Port, 0)
+	tun.SetRateLimit(rate)
+	if err := tun.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tun.Close()
+
+	conn, err := net.Dial("tcp", tun.LocalAddr())
+	if err != nil {
+		t.Fatalf("failed to connect to tunnel: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	begin := time.Now()
+	received, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	elapsed := time.Since(begin)
+
+	if len(received) != size {
+		t.Fatalf("expected %d bytes, got %d", size, len(received))
+	}
+
+	minimum := time.Duration(size-rate/rateBurst) * time.Second / rate
+	if elapsed < minimum {
+		t.Errorf("expected the transfer to take at least %s at %d bytes/s, took %s", minimum, rate, elapsed)
+	}
+}
+
+// TestRateLimiter_SetRate verifies that reservations wait for the shortfall at the current rate, and that changing the
+// rate applies to the next reservation.
+func TestRateLimiter_SetRate(t *testing.T) {
+	limiter := newRateLimiter(1000)
+
+	if wait := limiter.reserve(100); wait != 0 {
+		t.Errorf("expected the burst to pass at once, waited %s", wait)
+	}
+	if wait := limiter.reserve(500); wait < 450*time.Millisecond || wait > 500*time.Millisecond {
+		t.Errorf("expected to wait about 500ms for 500 bytes at 1000 bytes/s, got %s", wait)
+	}
+
+	limiter.setRate(1_000_000)
+	if wait := limiter.reserve(1000); wait > 5*time.Millisecond {
+		t.Errorf("expected the raised rate to apply at once, got %s", wait)
+	}
+}
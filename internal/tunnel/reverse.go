@@ -0,0 +1,137 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// localDialTimeout bounds connecting to the local target of a reverse tunnel for a single forwarded connection.
+const localDialTimeout = 10 * time.Second
+
+// NewReverseTunnel initializes a reverse Tunnel, which asks the SSH server to listen on bindHost:bindPort and forwards
+// every connection made there to localHost:localPort on this side. A bindPort of 0 lets the server pick the port.
+func NewReverseTunnel(config *SSHConfig, bindHost string, bindPort int, localHost string, localPort int) *Tunnel {
+	t := NewTunnel(config, bindHost, bindPort, localPort)
+	t.localHost = localHost
+	t.reverse = true
+	return t
+}
+
+// Reverse reports whether the tunnel forwards from a listener on the SSH server to a local address.
+func (t *Tunnel) Reverse() bool {
+	return t.reverse
+}
+
+// validateReverse checks the ports and local target of a reverse tunnel.
+func (t *Tunnel) validateReverse() error {
+	if t.remotePort < 0 {
+		return fmt.Errorf("remotePort must be 0 or greater")
+	}
+
+	if t.localHost == "" {
+		return fmt.Errorf("localHost is required for a reverse tunnel")
+	}
+
+	if t.localPort <= 0 {
+		return fmt.Errorf("localPort must be greater than 0 for a reverse tunnel")
+	}
+
+	return nil
+}
+
+// listen opens the listener the tunnel accepts connections on: a local one on the configured socket or bind address and
+// port, or, for a reverse tunnel, one on the SSH server over client.
+func (t *Tunnel) listen(client *ssh.Client) (net.Listener, error) {
+	t.mu.RLock()
+	remoteAddr := net.JoinHostPort(t.remoteHost, strconv.Itoa(t.remotePort))
+	localAddr := net.JoinHostPort(t.localHost, strconv.Itoa(t.localPort))
+	socket := t.localSocket
+	t.mu.RUnlock()
+
+	if t.reverse {
+		listener, err := client.Listen("tcp", remoteAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create remote listener on %s: %w", remoteAddr, err)
+		}
+		return listener, nil
+	}
+
+	if socket != "" {
+		return listenUnix(socket)
+	}
+
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create local listener: %w", err)
+	}
+	return listener, nil
+}
+
+// remoteListenerLost marks a reverse tunnel as failed when its listener on the SSH server stops accepting connections,
+// which happens when the SSH connection is lost. It does nothing if the listener was already replaced or closed.
+func (t *Tunnel) remoteListenerLost(listener net.Listener, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.listener != listener {
+		return
+	}
+
+	t.setStatus(StatusError)
+	t.lastError = fmt.Errorf("remote listener closed: %w", err)
+}
+
+// dialLocalTarget connects to the local target of a reverse tunnel for a connection accepted on the SSH server and
+// records the address it reached.
+func (t *Tunnel) dialLocalTarget() (net.Conn, error) {
+	addr := t.LocalAddr()
+
+	conn, err := net.DialTimeout("tcp", addr, localDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach local target %s: %w", addr, err)
+	}
+
+	t.configureConn(conn)
+
+	t.mu.Lock()
+	t.lastDialAddr = conn.RemoteAddr().String()
+	t.mu.Unlock()
+
+	return conn, nil
+}
+
+// probeReverse checks that a reverse tunnel's SSH connection answers and that its local target accepts connections.
+func (t *Tunnel) probeReverse(timeout time.Duration) error {
+	t.mu.RLock()
+	client := t.client
+	t.mu.RUnlock()
+
+	if err := pingClient(client); err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", t.LocalAddr(), timeout)
+	if err != nil {
+		return fmt.Errorf("failed to reach local target %s: %w", t.LocalAddr(), err)
+	}
+
+	_ = conn.Close()
+	return nil
+}
+
+// pingClient checks that the SSH connection of client answers a keepalive request.
+func pingClient(client *ssh.Client) error {
+	if client == nil {
+		return fmt.Errorf("tunnel is not connected")
+	}
+
+	if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+		return fmt.Errorf("ssh connection is not responding: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package tunnel
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// serveTestForwards answers the global requests of a test SSH connection, listening locally for each tcpip-forward
+// request and opening a forwarded-tcpip channel back to the client for every connection made there.
+func serveTestForwards(sshConn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	var mu sync.Mutex
+	listeners := make(map[string]net.Listener)
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
+
+	for req := range reqs {
+		var bind struct {
+			Addr string
+			Port uint32
+		}
+		if req.Type != "tcpip-forward" && req.Type != "cancel-tcpip-forward" || ssh.Unmarshal(req.Payload, &bind) != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		key := net.JoinHostPort(bind.Addr, strconv.Itoa(int(bind.Port)))
+
+		if req.Type == "cancel-tcpip-forward" {
+			mu.Lock()
+			if listener, exists := listeners[key]; exists {
+				listener.Close()
+				delete(listeners, key)
+			}
+			mu.Unlock()
+			req.Reply(true, nil)
+			continue
+		}
+
+		listener, err := net.Listen("tcp", key)
+		if err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		port := uint32(listener.Addr().(*net.TCPAddr).Port)
+		if bind.Port == 0 {
+			key = net.JoinHostPort(bind.Addr, strconv.Itoa(int(port)))
+		}
+		mu.Lock()
+		listeners[key] = listener
+		mu.Unlock()
+		req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+
+				origin := conn.RemoteAddr().(*net.TCPAddr)
+				payload := ssh.Marshal(struct {
+					Addr       string
+					Port       uint32
+					OriginAddr string
+					OriginPort uint32
+				}{bind.Addr, port, origin.IP.String(), uint32(origin.Port)})
+
+				channel, requests, err := sshConn.OpenChannel("forwarded-tcpip", payload)
+				if err != nil {
+					conn.Close()
+					continue
+				}
+				go ssh.DiscardRequests(requests)
+				go func() {
+					defer channel.Close()
+					defer conn.Close()
+					io.Copy(channel, conn)
+				}()
+				go func() {
+					defer channel.Close()
+					defer conn.Close()
+					io.Copy(conn, channel)
+				}()
+			}
+		}()
+	}
+}
+
+func TestReverseTunnel_ForwardsToLocalTarget(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	laptop := setupTestDestinationServerFunc(t, func(conn net.Conn) {
+		io.Copy(conn, conn)
+		conn.Close()
+	})
+	defer laptop.Close()
+
+	tunnel := NewReverseTunnel(sshCfg, "127.0.0.1", 0, "127.0.0.1", laptop.Addr().(*net.TCPAddr).Port)
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tunnel.Stop()
+
+	if !tunnel.Reverse() || tunnel.LocalAddr() != laptop.Addr().String() {
+		t.Errorf("expected a reverse tunnel to the laptop service, got local %s", tunnel.LocalAddr())
+	}
+	if strings.HasSuffix(tunnel.RemoteAddr(), ":0") {
+		t.Errorf("expected the port the server bound, got %s", tunnel.RemoteAddr())
+	}
+
+	// Connecting to the server's listener plays the part of a client on the bastion.
+	if echoed := echoThroughAddr(t, tunnel.RemoteAddr(), []byte("from the bastion")); string(echoed) != "from the bastion" {
+		t.Fatalf("expected the echo from the local target, got %q", echoed)
+	}
+
+	if tunnel.Status() != StatusRunning {
+		t.Errorf("expected running, got %s", tunnel.Status())
+	}
+	if stats := tunnel.Stats(); stats.Connections != 1 {
+		t.Errorf("expected the connection to be counted, got %+v", stats)
+	}
+	if err := tunnel.Probe(time.Second); err != nil {
+		t.Errorf("expected the probe to pass, got: %v", err)
+	}
+
+	if err := tunnel.Reconnect(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tunnel.Status() != StatusRunning {
+		t.Errorf("expected running after reconnecting, got %s: %v", tunnel.Status(), tunnel.LastError())
+	}
+	if echoed := echoThroughAddr(t, tunnel.RemoteAddr(), []byte("again")); string(echoed) != "again" {
+		t.Errorf("expected the echo after reconnecting, got %q", echoed)
+	}
+}
+
+func TestReverseTunnel_ReportsLostConnection(t *testing.T) {
+	var conns []net.Conn
+	var mu sync.Mutex
+	sshServer, sshCfg := setupTestSSHServer(t)
+	proxy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer proxy.Close()
+	go func() {
+		for {
+			client, err := proxy.Accept()
+			if err != nil {
+				return
+			}
+			server, err := net.Dial("tcp", sshServer.Addr().String())
+			if err != nil {
+				client.Close()
+				return
+			}
+			mu.Lock()
+			conns = append(conns, client, server)
+			mu.Unlock()
+			go io.Copy(server, client)
+			go io.Copy(client, server)
+		}
+	}()
+	defer sshServer.Close()
+
+	cfg := *sshCfg
+	cfg.Port = proxy.Addr().(*net.TCPAddr).Port
+
+	tunnel := NewReverseTunnel(&cfg, "127.0.0.1", 0, "127.0.0.1", 1)
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tunnel.Stop()
+
+	mu.Lock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+	mu.Unlock()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for tunnel.Status() != StatusError && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if tunnel.Status() != StatusError || !strings.Contains(tunnel.LastError().Error(), "remote listener closed") {
+		t.Errorf("expected the lost remote listener to be reported, got %s: %v", tunnel.Status(), tunnel.LastError())
+	}
+}
+
+func TestReverseTunnel_Validate(t *testing.T) {
+	_, sshCfg := setupTestSSHServer(t)
+
+	if err := NewReverseTunnel(sshCfg, "127.0.0.1", 8080, "", 3000).Validate(); err == nil {
+		t.Error("expected a missing local host to be rejected")
+	}
+	if err := NewReverseTunnel(sshCfg, "127.0.0.1", 8080, "127.0.0.1", 0).Validate(); err == nil {
+		t.Error("expected a missing local port to be rejected")
+	}
+	if err := NewReverseTunnel(sshCfg, "127.0.0.1", 0, "127.0.0.1", 3000).Validate(); err != nil {
+		t.Errorf("expected a server-assigned remote port to be allowed, got: %v", err)
+	}
+}
+
+// echoThroughAddr writes payload to addr and returns what comes back.
+func echoThroughAddr(t *testing.T, addr string, payload []byte) []byte {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to connect to %s: %v", addr, err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(payload); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	buf := make([]byte, len(payload))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	return buf
+}
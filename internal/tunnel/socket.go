@@ -0,0 +1,82 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"time"
+)
+
+// errSocketInUse reports a socket file that another listener still answers on.
+var errSocketInUse = errors.New("in use by another process")
+
+// SetLocalSocket makes the tunnel listen on a Unix domain socket at path instead of a local port. The socket file is
+// removed when the tunnel stops. It takes effect on the next Start and has no effect on a reverse tunnel.
+func (t *Tunnel) SetLocalSocket(path string) {
+	if t.reverse {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.localSocket = path
+}
+
+// LocalSocket returns the path of the Unix domain socket the tunnel listens on, or an empty string for a TCP listener.
+func (t *Tunnel) LocalSocket() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.localSocket
+}
+
+// LocalNetwork returns the network of the tunnel's local end, "unix" for a socket listener and "tcp" otherwise, to dial
+// DialAddr with.
+func (t *Tunnel) LocalNetwork() string {
+	if t.LocalSocket() != "" {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// listenUnix listens on the Unix domain socket at path. A socket file left behind by a process that did not shut down
+// cleanly is removed first; a socket that still answers, or any other file at path, is left alone and makes listening
+// fail.
+func listenUnix(path string) (net.Listener, error) {
+	if err := removeSocketFile(path); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create local socket listener: %w", err)
+	}
+	return listener, nil
+}
+
+// removeSocketFile removes the Unix domain socket at path if there is one, refusing to remove anything but a socket,
+// or a socket some process still accepts connections on.
+func removeSocketFile(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check local socket %s: %w", path, err)
+	}
+
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("local socket path %s exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("local socket %s is %w", path, errSocketInUse)
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove local socket %s: %w", path, err)
+	}
+	return nil
+}
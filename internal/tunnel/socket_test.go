@@ -0,0 +1,120 @@
+package tunnel
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalSocket_ForwardsAndCleansUp(t *testing.T) {
+	sshServer, cfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer := setupTestDestinationServer(t, "hello over a socket")
+	defer destServer.Close()
+
+	_, portStr, _ := net.SplitHostPort(destServer.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	path := filepath.Join(t.TempDir(), "db.sock")
+
+	// A socket left behind by a previous run that did not shut down cleanly.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to create stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	tun := NewTunnel(cfg, "127.0.0.1", port, 0)
+	tun.SetLocalSocket(path)
+
+	if err := tun.Start(); err != nil {
+		t.Fatalf("expected a stale socket file to be replaced, got: %v", err)
+	}
+	defer tun.Close()
+
+	if tun.LocalAddr() != path || tun.DialAddr() != path || tun.LocalNetwork() != "unix" {
+		t.Errorf("expected the local end to be unix %s, got %s %s", path, tun.LocalNetwork(), tun.LocalAddr())
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("failed to connect to socket: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	data, err := io.ReadAll(conn)
+	_ = conn.Close()
+	if err != nil || string(data) != "hello over a socket" {
+		t.Errorf("expected data forwarded through the socket, got %q (%v)", data, err)
+	}
+
+	if err := tun.Stop(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the socket file to be removed on stop, got %v", err)
+	}
+
+	if err := tun.Start(); err != nil {
+		t.Fatalf("expected a restart on the same socket to succeed, got: %v", err)
+	}
+}
+
+func TestLocalSocket_KeepsOtherFiles(t *testing.T) {
+	sshServer, cfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	path := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(path, []byte("keep me"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	tun := NewTunnel(cfg, "127.0.0.1", 5432, 0)
+	tun.SetLocalSocket(path)
+
+	if err := tun.Start(); err == nil {
+		tun.Close()
+		t.Fatal("expected listening over a regular file to fail")
+	}
+
+	if data, err := os.ReadFile(path); err != nil || string(data) != "keep me" {
+		t.Errorf("expected the file to be left alone, got %q (%v)", data, err)
+	}
+}
+
+func TestLocalSocket_RefusesSocketInUse(t *testing.T) {
+	sshServer, cfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	path := filepath.Join(t.TempDir(), "db.sock")
+	live, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to create live socket: %v", err)
+	}
+	defer live.Close()
+
+	tun := NewTunnel(cfg, "127.0.0.1", 5432, 0)
+	tun.SetLocalSocket(path)
+
+	if err := tun.Start(); err == nil || !strings.Contains(err.Error(), "in use") {
+		tun.Close()
+		t.Fatalf("expected listening over a socket in use to fail, got: %v", err)
+	}
+
+	go func() {
+		if conn, err := live.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("expected the live socket to keep answering, got: %v", err)
+	}
+	conn.Close()
+}
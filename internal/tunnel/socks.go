@@ -0,0 +1,183 @@
+package tunnel
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// socksHandshakeTimeout bounds how long a SOCKS client may take to say where it wants to connect.
+const socksHandshakeTimeout = 30 * time.Second
+
+// SOCKS5 protocol constants from RFC 1928. Only the CONNECT command without authentication is supported.
+const (
+	socksVersion       = 5
+	socksNoAuth        = 0x00
+	socksNoAcceptable  = 0xff
+	socksConnect       = 0x01
+	socksAddrIPv4      = 0x01
+	socksAddrDomain    = 0x03
+	socksAddrIPv6      = 0x04
+	socksSucceeded     = 0x00
+	socksFailure       = 0x01
+	socksNotAllowed    = 0x02
+	socksRefused       = 0x05
+	socksBadCommand    = 0x07
+	socksBadAddrType   = 0x08
+	socksRequestHeader = 4
+)
+
+// NewDynamicTunnel initializes a dynamic Tunnel, which serves SOCKS5 on localPort, like ssh -D, and forwards each
+// connection to the address its client asks for. A localPort of 0 picks a free port, reported by LocalPort and Stats.
+func NewDynamicTunnel(config *SSHConfig, localPort int) *Tunnel {
+	t := NewTunnel(config, "", 0, localPort)
+	t.dynamic = true
+	return t
+}
+
+// Dynamic reports whether the tunnel serves SOCKS5 instead of forwarding to a fixed remote address.
+func (t *Tunnel) Dynamic() bool {
+	return t.dynamic
+}
+
+// socksError is a failed SOCKS request along with the reply code sent to the client for it.
+type socksError struct {
+	code byte
+	err  error
+}
+
+func (e *socksError) Error() string { return e.err.Error() }
+func (e *socksError) Unwrap() error { return e.err }
+
+// openSOCKS reads the SOCKS request of a client connected to a dynamic tunnel, opens a channel to the address it asks
+// for over client, and tells the client how that went.
+func (t *Tunnel) openSOCKS(conn net.Conn, client *ssh.Client) (net.Conn, error) {
+	_ = conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	addr, err := socksHandshake(conn)
+	if err != nil {
+		var reqErr *socksError
+		if errors.As(err, &reqErr) {
+			_ = socksReply(conn, reqErr.code)
+		}
+		return nil, fmt.Errorf("socks: %w", err)
+	}
+
+	remote, err := t.openChannelTo(client, addr)
+	if err != nil {
+		_ = socksReply(conn, socksReplyCode(err))
+		return nil, fmt.Errorf("socks: failed to reach %s: %w", addr, err)
+	}
+
+	if err := socksReply(conn, socksSucceeded); err != nil {
+		_ = remote.Close()
+		return nil, fmt.Errorf("socks: %w", err)
+	}
+
+	t.mu.Lock()
+	t.lastDialAddr = addr
+	t.mu.Unlock()
+
+	return remote, nil
+}
+
+// socksHandshake negotiates a SOCKS5 session without authentication and returns the address of the CONNECT request
+// that follows. Requests the tunnel cannot serve are returned as a *socksError carrying the reply to send.
+func socksHandshake(conn net.Conn) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", fmt.Errorf("failed to read greeting: %w", err)
+	}
+	if header[0] != socksVersion {
+		return "", fmt.Errorf("unsupported version %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", fmt.Errorf("failed to read greeting: %w", err)
+	}
+
+	method := byte(socksNoAcceptable)
+	for _, m := range methods {
+		if m == socksNoAuth {
+			method = socksNoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return "", err
+	}
+	if method == socksNoAcceptable {
+		return "", fmt.Errorf("client does not offer connecting without authentication")
+	}
+
+	request := make([]byte, socksRequestHeader)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", fmt.Errorf("failed to read request: %w", err)
+	}
+	if request[1] != socksConnect {
+		return "", &socksError{socksBadCommand, fmt.Errorf("unsupported command %d", request[1])}
+	}
+
+	var host string
+	switch request[3] {
+	case socksAddrIPv4, socksAddrIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if request[3] == socksAddrIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", fmt.Errorf("failed to read address: %w", err)
+		}
+		host = ip.String()
+	case socksAddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", fmt.Errorf("failed to read address: %w", err)
+		}
+		name := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", fmt.Errorf("failed to read address: %w", err)
+		}
+		host = string(name)
+	default:
+		return "", &socksError{socksBadAddrType, fmt.Errorf("unsupported address type %d", request[3])}
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", fmt.Errorf("failed to read port: %w", err)
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// socksReply answers a SOCKS request with code. The bound address is left unspecified, as the real one is on the far
+// side of the SSH server.
+func socksReply(conn net.Conn, code byte) error {
+	_, err := conn.Write([]byte{socksVersion, code, 0, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// socksReplyCode maps a failure to open a channel to the closest SOCKS reply.
+func socksReplyCode(err error) byte {
+	var openErr *ssh.OpenChannelError
+	if !errors.As(err, &openErr) {
+		return socksFailure
+	}
+
+	switch openErr.Reason {
+	case ssh.Prohibited:
+		return socksNotAllowed
+	case ssh.ConnectionFailed:
+		return socksRefused
+	default:
+		return socksFailure
+	}
+}
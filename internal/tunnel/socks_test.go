@@ -0,0 +1,101 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// socksRequest asks the SOCKS5 proxy at proxyAddr to connect to the address described by atyp and addr, returning the
+// connection and the reply code.
+func socksRequest(t *testing.T, proxyAddr string, command, atyp byte, addr []byte, port int) (net.Conn, byte) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", proxyAddr)
+	if err != nil {
+		t.Fatalf("failed to connect to the proxy: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	conn.Write([]byte{5, 1, 0})
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(conn, method); err != nil || !bytes.Equal(method, []byte{5, 0}) {
+		t.Fatalf("expected no authentication to be accepted, got %v: %v", method, err)
+	}
+
+	request := append([]byte{5, command, 0, atyp}, addr...)
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	conn.Write(request)
+
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("failed to read the reply: %v", err)
+	}
+	return conn, reply[1]
+}
+
+func TestDynamicTunnel_SOCKS5(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer := setupTestDestinationServerFunc(t, func(conn net.Conn) {
+		io.Copy(conn, conn)
+		conn.Close()
+	})
+	defer destServer.Close()
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+
+	tunnel := NewDynamicTunnel(sshCfg, 0)
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tunnel.Stop()
+
+	port := tunnel.Stats().LocalPort
+	if port == 0 || port != tunnel.LocalPort() || tunnel.RemoteAddr() != "" {
+		t.Fatalf("expected the assigned SOCKS port in the stats, got %d (listening on %d)", port, tunnel.LocalPort())
+	}
+
+	targets := map[string]struct {
+		atyp byte
+		addr []byte
+	}{
+		"ipv4":   {0x01, net.ParseIP("127.0.0.1").To4()},
+		"domain": {0x03, append([]byte{byte(len("localhost"))}, "localhost"...)},
+	}
+	for name, target := range targets {
+		conn, code := socksRequest(t, tunnel.LocalAddr(), 0x01, target.atyp, target.addr, destPort)
+		if code != 0x00 {
+			t.Fatalf("%s: expected the connect to succeed, got reply %d", name, code)
+		}
+
+		conn.Write([]byte(name))
+		buf := make([]byte, len(name))
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != name {
+			t.Errorf("%s: expected the echo through the proxy, got %q: %v", name, buf, err)
+		}
+		conn.Close()
+	}
+
+	if dialed := tunnel.RemoteDialAddr(); dialed == "" {
+		t.Error("expected the last SOCKS destination to be recorded")
+	}
+
+	conn, code := socksRequest(t, tunnel.LocalAddr(), 0x02, 0x01, net.ParseIP("127.0.0.1").To4(), destPort)
+	conn.Close()
+	if code != 0x07 {
+		t.Errorf("expected BIND to be refused as unsupported, got reply %d", code)
+	}
+
+	if err := tunnel.Probe(time.Second); err != nil {
+		t.Errorf("expected the probe to pass, got: %v", err)
+	}
+
+	tunnel.Stop()
+	if port := tunnel.Stats().LocalPort; port != 0 {
+		t.Errorf("expected no SOCKS port once stopped, got %d", port)
+	}
+}
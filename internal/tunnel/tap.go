@@ -0,0 +1,104 @@
+package tunnel
+
+import (
+	"net"
+	"slices"
+	"sync/atomic"
+)
+
+// Direction identifies which way relayed bytes flow through a tunnel.
+type Direction string
+
+const (
+	DirectionOut Direction = "local->remote"
+	DirectionIn  Direction = "remote->local"
+)
+
+// tapBuffer is how many chunks may wait for a slow TapFunc before further chunks are dropped. A chunk holds at most
+// one read of a relay, up to 32 KiB.
+const tapBuffer = 256
+
+// TapFunc observes a chunk of bytes relayed through a tunnel in the given direction, for inspection or logging. It
+// receives its own copy of the bytes and cannot alter the stream. Calls come from a single goroutine per tunnel in the
+// order chunks were relayed; chunks arriving while tapBuffer of them are still waiting are dropped rather than slowing
+// the relay, and counted in Stats.TapDropped. Tapping copies every chunk, so it costs throughput and memory and is
+// meant for debugging rather than production traffic.
+type TapFunc func(dir Direction, data []byte)
+
+// tapChunk is a copy of relayed bytes waiting to be passed to a TapFunc.
+type tapChunk struct {
+	dir  Direction
+	data []byte
+}
+
+// tap feeds copies of relayed chunks to a TapFunc from its own goroutine until it is closed or the tunnel run it
+// belongs to ends.
+type tap struct {
+	fn      TapFunc
+	chunks  chan tapChunk
+	stop    chan struct{}
+	dropped atomic.Int64
+}
+
+// newTap starts a tap calling fn until done is closed.
+func newTap(fn TapFunc, done <-chan struct{}) *tap {
+	tp := &tap{
+		fn:     fn,
+		chunks: make(chan tapChunk, tapBuffer),
+		stop:   make(chan struct{}),
+	}
+	go tp.run(done)
+	return tp
+}
+
+// run passes queued chunks to the TapFunc until the tap is closed or done is closed.
+func (tp *tap) run(done <-chan struct{}) {
+	for {
+		select {
+		case chunk := <-tp.chunks:
+			tp.fn(chunk.dir, chunk.data)
+		case <-tp.stop:
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+// observe queues a copy of data for the TapFunc, dropping it when the buffer is full.
+func (tp *tap) observe(dir Direction, data []byte) {
+	select {
+	case tp.chunks <- tapChunk{dir: dir, data: slices.Clone(data)}:
+	default:
+		tp.dropped.Add(1)
+	}
+}
+
+// close stops the tap; chunks still queued are discarded.
+func (tp *tap) close() {
+	close(tp.stop)
+}
+
+// tappedConn wraps the local side of a forwarded connection, passing what the client sends and receives to a tap.
+type tappedConn struct {
+	net.Conn
+	tap *tap
+}
+
+// Read reads from the client and taps the bytes bound for the remote.
+func (c *tappedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.tap.observe(DirectionOut, p[:n])
+	}
+	return n, err
+}
+
+// Write writes to the client and taps the bytes that came from the remote.
+func (c *tappedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.tap.observe(DirectionIn, p[:n])
+	}
+	return n, err
+}
@@ -0,0 +1,131 @@
+package tunnel
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startEchoTunnel starts a tunnel to an echo destination with the given tap installed.
+func startEchoTunnel(t *testing.T, fn TapFunc) *Tunnel {
+	t.Helper()
+
+	sshServer, sshCfg := setupTestSSHServer(t)
+	t.Cleanup(func() { sshServer.Close() })
+
+	destServer := setupTestDestinationServerFunc(t, func(conn net.Conn) {
+		io.Copy(conn, conn)
+		conn.Close()
+	})
+	t.Cleanup(func() { destServer.Close() })
+
+	tunnel := NewTunnel(sshCfg, "127.0.0.1", destServer.Addr().(*net.TCPAddr).Port, 0)
+	tunnel.SetTap(fn)
+
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { tunnel.Stop() })
+
+	return tunnel
+}
+
+// echoThrough writes payload through the tunnel and reads the echo back.
+func echoThrough(t *testing.T, tunnel *Tunnel, payload []byte) []byte {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", tunnel.LocalAddr())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	go conn.Write(payload)
+
+	echoed := make([]byte, len(payload))
+	if _, err := io.ReadFull(conn, echoed); err != nil {
+		t.Fatalf("failed to read echo: %v", err)
+	}
+	return echoed
+}
+
+func TestTap_ObservesBothDirections(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[Direction]*bytes.Buffer{DirectionOut: {}, DirectionIn: {}}
+
+	tunnel := startEchoTunnel(t, func(dir Direction, data []byte) {
+		mu.Lock()
+		seen[dir].Write(data)
+		mu.Unlock()
+
+		// Scribbling over the chunk must not reach the relayed stream.
+		clear(data)
+	})
+
+	payload := make([]byte, 64*1024)
+	rand.Read(payload)
+
+	if echoed := echoThrough(t, tunnel, payload); !bytes.Equal(echoed, payload) {
+		t.Fatal("expected the transfer to arrive intact with a tap attached")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		complete := seen[DirectionOut].Len() == len(payload) && seen[DirectionIn].Len() == len(payload)
+		mu.Unlock()
+		if complete {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for dir, buf := range seen {
+		if !bytes.Equal(buf.Bytes(), payload) {
+			t.Errorf("expected the tap to observe the payload %s, got %d of %d bytes", dir, buf.Len(), len(payload))
+		}
+	}
+}
+
+func TestTap_SlowTapDoesNotBlockRelay(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	tunnel := startEchoTunnel(t, func(Direction, []byte) {
+		<-release
+	})
+
+	// Small writes produce many chunks, so the stuck tap's buffer fills up.
+	conn, err := net.Dial("tcp", tunnel.LocalAddr())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	buf := make([]byte, 1)
+	for i := range 2 * tapBuffer {
+		if _, err := conn.Write([]byte{byte(i)}); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		if _, err := io.ReadFull(conn, buf); err != nil || buf[0] != byte(i) {
+			t.Fatalf("expected the relay to keep flowing past a stuck tap, got %v, %v", buf, err)
+		}
+	}
+
+	if dropped := tunnel.Stats().TapDropped; dropped == 0 {
+		t.Error("expected chunks to be dropped while the tap was stuck")
+	}
+
+	tunnel.SetTap(nil)
+	if echoed := echoThrough(t, tunnel, []byte("after")); string(echoed) != "after" {
+		t.Errorf("expected relaying to continue with the tap disabled, got %q", echoed)
+	}
+}
@@ -0,0 +1,1649 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// drainPollInterval is how often Drain checks whether the forwarded connections have finished.
+const drainPollInterval = 10 * time.Millisecond
+
+// Status defines a string-based enumeration for representing the operational state of a process or system.
+type Status string
+
+const (
+	StatusStopped  Status = "stopped"
+	StatusStarting Status = "starting"
+	StatusRunning  Status = "running"
+	StatusError    Status = "error"
+	// StatusDisabled is reported by the manager for tunnels disabled in their config; a Tunnel never enters it itself.
+	StatusDisabled Status = "disabled"
+	// StatusPaused is reported by the manager for tunnels paused through it; a Tunnel never enters it itself.
+	StatusPaused Status = "paused"
+)
+
+// Phase identifies where a forwarded connection is in its lifecycle.
+type Phase int
+
+const (
+	PhaseAccepted Phase = iota
+	PhaseEstablishing
+	PhaseActive
+	PhaseClosing
+	phaseDone
+)
+
+// PhaseStats counts the forwarded connections currently in each lifecycle phase: accepted and waiting for the SSH
+// connection, establishing the remote channel, actively relaying, and closing.
+type PhaseStats struct {
+	Accepted     int64
+	Establishing int64
+	Active       int64
+	Closing      int64
+}
+
+// gauge returns a pointer to the counter tracking the given phase, or nil for phases that are not counted.
+func (p *PhaseStats) gauge(phase Phase) *int64 {
+	switch phase {
+	case PhaseAccepted:
+		return &p.Accepted
+	case PhaseEstablishing:
+		return &p.Establishing
+	case PhaseActive:
+		return &p.Active
+	case PhaseClosing:
+		return &p.Closing
+	}
+	return nil
+}
+
+// Stats represent statistical data related to network connections and activity over a specific period of time.
+// QueuedConnections counts connections waiting for a slot under the tunnel's connection limit; Dequeued and QueueWait
+// total the connections that left the queue to be served and the time they waited, and RefusedConnections those
+// closed because both the limit and the queue were full. TapDropped counts chunks a slow TapFunc never saw. LocalPort
+// is the port the local listener is bound to while running, such as the SOCKS port of a dynamic tunnel.
+type Stats struct {
+	BytesIn            int64
+	BytesOut           int64
+	Connections        int64
+	ActiveConnections  int64
+	QueuedConnections  int64
+	Dequeued           int64
+	QueueWait          time.Duration
+	RefusedConnections int64
+	TapDropped         int64
+	Phases             PhaseStats
+	LastActivity       time.Time
+	StartedAt          time.Time
+	LocalPort          int
+}
+
+// AvgQueueWait returns the average time dequeued connections waited for a slot, or 0 when none has waited.
+func (s Stats) AvgQueueWait() time.Duration {
+	if s.Dequeued == 0 {
+		return 0
+	}
+	return s.QueueWait / time.Duration(s.Dequeued)
+}
+
+// DrainResult reports how many forwarded connections finished on their own during a drain and how many were closed
+// forcibly when the drain timeout expired.
+type DrainResult struct {
+	Drained int
+	Forced  int
+}
+
+// ConnectionInfo describes the parameters negotiated during the handshake of the tunnel's active SSH connection.
+// RemoteAddr is the resolved address of the SSH server the connection landed on. AuthKey is the key file the server
+// accepted when authenticating with keys, and empty otherwise.
+type ConnectionInfo struct {
+	ServerVersion string
+	RemoteAddr    string
+	KeyExchange   string
+	HostKey       string
+	AuthKey       string
+	CipherIn      string
+	CipherOut     string
+	MACIn         string
+	MACOut        string
+}
+
+// AcceptFunc decides whether a newly accepted local connection may be forwarded, given the client's address. Returning
+// an error refuses the connection: it is closed before any channel is opened and is not counted in the tunnel's stats.
+type AcceptFunc func(remote net.Addr) error
+
+// StatusFunc observes a tunnel's status changing from one value to another. When the change ends a start, stop, or
+// reconnect, took is how long that operation ran, and 0 otherwise. It is called with the tunnel's lock held, so it
+// must return quickly and must not call back into the tunnel.
+type StatusFunc func(from, to Status, took time.Duration)
+
+// RelayPool bounds how many forwarded connections are relayed at once across the tunnels sharing it, and with them the
+// copy goroutines serving those connections. Connections beyond the limit wait in the listener's accept backlog until
+// a slot frees up, trading latency for bounded memory use.
+type RelayPool struct {
+	slots chan struct{}
+}
+
+// NewRelayPool creates a RelayPool that relays at most size connections at once.
+func NewRelayPool(size int) *RelayPool {
+	return &RelayPool{slots: make(chan struct{}, size)}
+}
+
+// InUse returns the number of connections currently holding a slot.
+func (p *RelayPool) InUse() int {
+	return len(p.slots)
+}
+
+// acquire blocks until a slot is free, returning false if done is closed first.
+func (p *RelayPool) acquire(done <-chan struct{}) bool {
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// release frees a slot taken by acquire.
+func (p *RelayPool) release() {
+	<-p.slots
+}
+
+// connLimiter bounds how many connections a single tunnel serves at once, holding up to a fixed number of excess
+// connections in a queue until a slot frees up.
+type connLimiter struct {
+	slots chan struct{}
+	queue chan struct{}
+}
+
+// newConnLimiter creates a connLimiter serving at most limit connections with room for queueSize waiting ones.
+func newConnLimiter(limit, queueSize int) *connLimiter {
+	return &connLimiter{
+		slots: make(chan struct{}, limit),
+		queue: make(chan struct{}, queueSize),
+	}
+}
+
+// tryAcquire takes a slot if one is free without waiting.
+func (l *connLimiter) tryAcquire() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// tryEnqueue takes a place in the queue if one is free without waiting.
+func (l *connLimiter) tryEnqueue() bool {
+	select {
+	case l.queue <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait blocks a queued connection until a slot is free, giving up its place in the queue either way. It returns false
+// if done is closed first.
+func (l *connLimiter) wait(done <-chan struct{}) bool {
+	defer func() { <-l.queue }()
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// release frees a slot taken by tryAcquire or wait.
+func (l *connLimiter) release() {
+	<-l.slots
+}
+
+// defaultLocalBind is the address a local listener binds unless SetLocalBind says otherwise.
+const defaultLocalBind = "127.0.0.1"
+
+// Tunnel represents a secure SSH-based port forwarding connection between a local and a remote host. A reverse tunnel,
+// created with NewReverseTunnel, forwards the other way: from a listener on the SSH server to a local address. A
+// dynamic tunnel, created with NewDynamicTunnel, serves SOCKS5 locally and forwards to the address each client asks for.
+type Tunnel struct {
+	config      *SSHConfig
+	remoteHost  string
+	remotePort  int
+	localPort   int
+	localHost   string // the bind address, or the target of a reverse tunnel
+	localSocket string
+	reverse     bool
+	dynamic     bool
+
+	resolveRemotePort func() (int, error)
+	noDelay           bool
+	retryChannel      bool
+	openRetries       int
+	openBackoff       time.Duration
+	relayPool         *RelayPool
+	connLimiter       *connLimiter
+	upLimit           *rateLimiter
+	downLimit         *rateLimiter
+	idleTimeout       time.Duration
+	acceptFunc        AcceptFunc
+	reconnectGate     func() error
+	tapFunc           TapFunc
+	statusFunc        StatusFunc
+	opStarted         time.Time
+	tap               *tap
+	lastDialAddr      string
+	dialResolved      string // lastDialAddr with its host looked up, once resolveDialAddr has done so
+	resolving         atomic.Bool
+
+	client      *ssh.Client
+	clientReady chan struct{}
+	clientGone  chan struct{}
+	listener    net.Listener
+	actualPort  int
+	boundPort   int
+	connInfo    ConnectionInfo
+
+	status      Status
+	downSince   time.Time
+	connectedAt time.Time
+	lastError   error
+	stats       Stats
+	statsGen    uint64
+
+	done chan struct{}
+	mu   sync.RWMutex
+}
+
+// NewTunnel initializes a Tunnel with the provided SSHConfig, remote host, remote port, and local port settings.
+func NewTunnel(config *SSHConfig, remoteHost string, remotePort, localPort int) *Tunnel {
+	return &Tunnel{
+		config:     config,
+		remoteHost: remoteHost,
+		remotePort: remotePort,
+		localPort:  localPort,
+		localHost:  defaultLocalBind,
+		noDelay:    true,
+		status:     StatusStopped,
+		downSince:  time.Now(),
+	}
+}
+
+// Validate checks if the Tunnel's configuration and parameters are valid, returning an error if any validation fails.
+func (t *Tunnel) Validate() error {
+	if t.config == nil {
+		return fmt.Errorf("config is required")
+	}
+
+	if net.ParseIP(t.localHost) == nil && !t.reverse {
+		return fmt.Errorf("local bind address %q is not an IP address", t.localHost)
+	}
+
+	if t.dynamic {
+		if t.localPort < 0 {
+			return fmt.Errorf("localPort must be 0 or greater")
+		}
+		return nil
+	}
+
+	if t.remoteHost == "" {
+		return fmt.Errorf("remoteHost is required")
+	}
+
+	if t.reverse {
+		return t.validateReverse()
+	}
+
+	if t.remotePort <= 0 {
+		return fmt.Errorf("remotePort must be greater than 0")
+	}
+
+	if t.localPort < 0 {
+		return fmt.Errorf("localPort must be 0 or greater")
+	}
+
+	return nil
+}
+
+// setError updates the tunnel's status to error and records the provided error as the last encountered error.
+func (t *Tunnel) setError(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.setStatus(StatusError)
+	t.lastError = err
+}
+
+// setStatus updates the tunnel's status, recording when it last stopped running and timing the start, stop, or
+// reconnect the change begins or ends. The caller must hold t.mu.
+func (t *Tunnel) setStatus(status Status) {
+	now := time.Now()
+	if status == StatusRunning {
+		t.downSince = time.Time{}
+	} else if t.status == StatusRunning {
+		t.downSince = now
+	}
+
+	var took time.Duration
+	switch {
+	case status == StatusStarting:
+		t.opStarted = now
+	case !t.opStarted.IsZero():
+		took = now.Sub(t.opStarted)
+		t.opStarted = time.Time{}
+	}
+
+	from := t.status
+	t.status = status
+	if t.statusFunc != nil && from != status {
+		t.statusFunc(from, status, took)
+	}
+}
+
+// Start initializes and starts the tunnel, setting up the SSH connection and local listener. Returns an error if it fails.
+func (t *Tunnel) Start() error {
+	return t.StartContext(context.Background())
+}
+
+// StartContext is Start, but gives up connecting to the SSH server once ctx is done, leaving the tunnel in the error
+// state with ctx's error. A tunnel that finished starting is not affected by ctx afterwards.
+func (t *Tunnel) StartContext(ctx context.Context) error {
+	t.mu.Lock()
+
+	if t.status == StatusRunning {
+		t.mu.Unlock()
+		return fmt.Errorf("tunnel is already running")
+	}
+
+	t.setStatus(StatusStarting)
+	t.lastError = nil
+	t.mu.Unlock()
+
+	if err := t.refreshRemotePort(); err != nil {
+		t.setError(err)
+		return err
+	}
+
+	if err := t.Validate(); err != nil {
+		t.setError(err)
+		return err
+	}
+
+	client, authKey, err := t.dial(ctx)
+	if err != nil {
+		t.setError(err)
+		return err
+	}
+
+	listener, err := t.listen(client)
+	if err != nil {
+		_ = client.Close()
+		t.setError(err)
+		return err
+	}
+
+	var port int
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+		port = addr.Port
+	}
+	done := make(chan struct{})
+
+	t.mu.Lock()
+	t.client = client
+	t.clientGone = watchClient(client)
+	t.clientReady = closedChan()
+	t.listener = listener
+	if t.reverse {
+		t.boundPort = port
+	} else {
+		t.actualPort = port
+	}
+	t.connInfo = newConnectionInfo(client, authKey)
+	t.setStatus(StatusRunning)
+	t.done = done
+	t.stats = Stats{StartedAt: time.Now()}
+	t.connectedAt = t.stats.StartedAt
+	t.statsGen++
+	if t.tapFunc != nil {
+		t.tap = newTap(t.tapFunc, done)
+	}
+	t.mu.Unlock()
+
+	go t.forward(listener, done)
+
+	return nil
+}
+
+// Stop terminates the tunnel by closing any active connections, freeing resources, and updating the tunnel's status.
+func (t *Tunnel) Stop() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.status == StatusStopped {
+		return nil
+	}
+	t.opStarted = time.Now()
+
+	if t.done != nil {
+		close(t.done)
+		t.done = nil
+	}
+	t.tap = nil
+
+	var errs []error
+	if t.listener != nil {
+		if err := t.listener.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close listener: %w", err))
+		}
+		t.listener = nil
+	}
+
+	// Closing a socket listener normally unlinks its file; this catches a listener already closed by Drain. A socket
+	// answering by now belongs to another process and is left to it.
+	if t.localSocket != "" {
+		if err := removeSocketFile(t.localSocket); err != nil && !errors.Is(err, errSocketInUse) {
+			errs = append(errs, err)
+		}
+	}
+
+	if t.client != nil {
+		if err := t.client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close ssh client: %w", err))
+		}
+		t.client = nil
+	}
+
+	t.clientReady = nil
+	t.clientGone = nil
+	t.setStatus(StatusStopped)
+	t.actualPort = 0
+	t.boundPort = 0
+	t.connInfo = ConnectionInfo{}
+	t.connectedAt = time.Time{}
+	t.stats = Stats{}
+	t.statsGen++
+
+	if len(errs) > 0 {
+		return fmt.Errorf("errors stopping tunnel: %v", errs)
+	}
+
+	return nil
+}
+
+// Drain stops accepting new connections, waits up to timeout for the forwarded connections to finish, and then stops the
+// tunnel, forcibly closing whatever is still open.
+func (t *Tunnel) Drain(timeout time.Duration) (DrainResult, error) {
+	return t.DrainContext(context.Background(), timeout)
+}
+
+// DrainContext is Drain, but stops waiting for open connections as soon as ctx is cancelled.
+func (t *Tunnel) DrainContext(ctx context.Context, timeout time.Duration) (DrainResult, error) {
+	t.mu.Lock()
+	if t.status != StatusRunning {
+		t.mu.Unlock()
+		return DrainResult{}, fmt.Errorf("tunnel is not running")
+	}
+
+	listener := t.listener
+	t.listener = nil
+	inFlight := t.stats.ActiveConnections
+	t.mu.Unlock()
+
+	if listener != nil {
+		_ = listener.Close()
+	}
+
+	deadline := time.Now().Add(timeout)
+	remaining := t.activeConnections()
+	for remaining > 0 && time.Now().Before(deadline) && ctx.Err() == nil {
+		select {
+		case <-time.After(drainPollInterval):
+		case <-ctx.Done():
+		}
+		remaining = t.activeConnections()
+	}
+
+	result := DrainResult{
+		Drained: int(inFlight - remaining),
+		Forced:  int(remaining),
+	}
+
+	if err := t.Stop(); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// Reconnect replaces the tunnel's SSH connection while keeping the local listener bound, so clients are queued rather than
+// refused during the switch. Connections accepted while reconnecting wait for the new SSH connection before being forwarded.
+func (t *Tunnel) Reconnect() error {
+	return t.reconnect(nil)
+}
+
+// reconnect implements Reconnect. When old is not nil the SSH connection is only replaced if old is still the current
+// one, so relays recovering from the same dropped connection reconnect it once.
+func (t *Tunnel) reconnect(old *ssh.Client) error {
+	if old != nil {
+		t.mu.RLock()
+		current, gate := t.client, t.reconnectGate
+		t.mu.RUnlock()
+
+		if current != old {
+			return nil
+		}
+
+		if gate != nil {
+			if err := gate(); err != nil {
+				t.setError(err)
+				return err
+			}
+		}
+	}
+
+	t.mu.Lock()
+	if old != nil && t.client != old {
+		t.mu.Unlock()
+		return nil
+	}
+
+	if t.status != StatusRunning {
+		t.mu.Unlock()
+		return fmt.Errorf("tunnel is not running")
+	}
+
+	oldClient := t.client
+	t.client = nil
+	t.clientReady = make(chan struct{})
+	t.connInfo = ConnectionInfo{}
+	t.setStatus(StatusStarting)
+
+	// A reverse tunnel's listener lives on the SSH server and goes away with the connection.
+	var oldListener net.Listener
+	if t.reverse {
+		oldListener = t.listener
+		t.listener = nil
+	}
+	t.mu.Unlock()
+
+	if oldListener != nil {
+		_ = oldListener.Close()
+	}
+	if oldClient != nil {
+		_ = oldClient.Close()
+	}
+
+	if err := t.refreshRemotePort(); err != nil {
+		t.setError(err)
+		return err
+	}
+
+	client, authKey, err := t.dial(context.Background())
+	if err != nil {
+		t.setError(err)
+		return err
+	}
+
+	var listener net.Listener
+	if t.reverse {
+		if listener, err = t.listen(client); err != nil {
+			_ = client.Close()
+			t.setError(err)
+			return err
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.status != StatusStarting {
+		_ = client.Close()
+		return fmt.Errorf("tunnel stopped while reconnecting")
+	}
+
+	if listener != nil {
+		t.listener = listener
+		t.boundPort = listener.Addr().(*net.TCPAddr).Port
+		go t.forward(listener, t.done)
+	}
+
+	t.client = client
+	t.clientGone = watchClient(client)
+	t.connInfo = newConnectionInfo(client, authKey)
+	t.connectedAt = time.Now()
+	t.setStatus(StatusRunning)
+	close(t.clientReady)
+
+	return nil
+}
+
+// Restart stops the tunnel if running and then starts it again, returning an error if either operation fails.
+func (t *Tunnel) Restart() error {
+	if err := t.Stop(); err != nil {
+		return fmt.Errorf("failed to stop: %w", err)
+	}
+
+	return t.Start()
+}
+
+// SetRemotePortResolver configures a function invoked on every Start and Reconnect to determine the remote port.
+func (t *Tunnel) SetRemotePortResolver(resolve func() (int, error)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.resolveRemotePort = resolve
+}
+
+// SetNoDelay controls whether TCP_NODELAY is set on accepted local connections and on the SSH connection. Disabling it
+// lets Nagle's algorithm coalesce small packets; it is enabled by default for interactive protocols.
+func (t *Tunnel) SetNoDelay(noDelay bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.noDelay = noDelay
+}
+
+// SetRetryChannel controls whether a forwarded connection whose SSH connection drops mid-relay is resumed over a fresh
+// channel once, reconnecting the tunnel if needed, instead of being reset. Bytes the client sent while the channel was
+// failing are replayed on the new channel, so this only suits protocols that tolerate a new remote connection.
+func (t *Tunnel) SetRetryChannel(retry bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.retryChannel = retry
+}
+
+// SetChannelOpenRetry configures how often opening the channel for a forwarded connection is retried when the SSH
+// server refuses it for lack of resources, and the backoff before the first retry, doubled on each further attempt.
+// Administrative prohibitions and unreachable destinations are never retried.
+func (t *Tunnel) SetChannelOpenRetry(retries int, backoff time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.openRetries = retries
+	t.openBackoff = backoff
+}
+
+// SetLocalBind sets the address the local listener binds, 127.0.0.1 by default; 0.0.0.0 accepts connections on every
+// interface. It takes effect on the next Start and has no effect on a reverse tunnel, whose listener is on the server.
+func (t *Tunnel) SetLocalBind(addr string) {
+	if t.reverse {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.localHost = addr
+}
+
+// SetAcceptFunc installs a hook consulted for every accepted local connection before it is forwarded; nil accepts all.
+func (t *Tunnel) SetAcceptFunc(accept AcceptFunc) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.acceptFunc = accept
+}
+
+// SetConnectionLimit bounds how many forwarded connections the tunnel serves at once. Up to queueSize connections
+// beyond the limit are accepted and wait for a slot; any more are closed. A limit of 0 removes the bound.
+func (t *Tunnel) SetConnectionLimit(limit, queueSize int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.connLimiter = nil
+	if limit > 0 {
+		t.connLimiter = newConnLimiter(limit, queueSize)
+	}
+}
+
+// SetRateLimit caps the bytes per second relayed in each direction across all of the tunnel's connections, including
+// those already open. A limit of 0 removes the cap.
+func (t *Tunnel) SetRateLimit(bytesPerSecond int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case bytesPerSecond <= 0:
+		t.upLimit, t.downLimit = nil, nil
+	case t.upLimit == nil:
+		t.upLimit, t.downLimit = newRateLimiter(bytesPerSecond), newRateLimiter(bytesPerSecond)
+	default:
+		t.upLimit.setRate(bytesPerSecond)
+		t.downLimit.setRate(bytesPerSecond)
+	}
+}
+
+// SetIdleTimeout closes forwarded connections established from now on once no bytes have flowed in either direction
+// for d. Only the idle connection ends; the tunnel keeps running. A timeout of 0 lets connections idle indefinitely.
+func (t *Tunnel) SetIdleTimeout(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.idleTimeout = d
+}
+
+// SetReconnectGate installs a hook consulted before the tunnel reconnects on its own after losing its SSH connection; an
+// error aborts the reconnect and leaves the tunnel in the error state. Explicit Reconnect calls are not gated.
+func (t *Tunnel) SetReconnectGate(gate func() error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reconnectGate = gate
+}
+
+// SetStatusFunc installs a hook called on every status change from now on; nil removes it.
+func (t *Tunnel) SetStatusFunc(fn StatusFunc) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.statusFunc = fn
+}
+
+// SetTap installs a hook observing every chunk relayed by connections established from now on; nil disables tapping.
+// See TapFunc for its cost.
+func (t *Tunnel) SetTap(fn TapFunc) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.tap != nil {
+		t.tap.close()
+		t.tap = nil
+	}
+
+	t.tapFunc = fn
+	if fn != nil && t.done != nil {
+		t.tap = newTap(fn, t.done)
+	}
+}
+
+// SetRelayPool makes the tunnel take a slot from pool for every connection it relays; nil removes the limit.
+func (t *Tunnel) SetRelayPool(pool *RelayPool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.relayPool = pool
+}
+
+// UpdateConfig updates the tunnel's SSH configuration with the provided config, ensuring thread-safe access.
+func (t *Tunnel) UpdateConfig(config *SSHConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.config = config
+}
+
+// Status returns the current operational state of the tunnel in a thread-safe manner.
+func (t *Tunnel) Status() Status {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.status
+}
+
+// DownSince returns when the tunnel last left the running state, or the zero time while it is running. Failed start
+// attempts do not reset it, so a tunnel that keeps failing reports how long it has been down overall.
+func (t *Tunnel) DownSince() time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.downSince
+}
+
+// ConnectedAt returns when the tunnel's current SSH connection was established, by Start or a later reconnect, or the
+// zero time while it is stopped.
+func (t *Tunnel) ConnectedAt() time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.connectedAt
+}
+
+// LastError retrieves the last recorded error encountered by the tunnel in a thread-safe manner.
+func (t *Tunnel) LastError() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.lastError
+}
+
+// LocalPort returns the port number being used by the tunnel for local connections, ensuring thread-safe access.
+func (t *Tunnel) LocalPort() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.actualPort > 0 {
+		return t.actualPort
+	}
+	return t.localPort
+}
+
+// LocalAddr returns the local address and port as a string in the format "<bind address>:<port>", the path of a local
+// socket, or the local target of a reverse tunnel.
+func (t *Tunnel) LocalAddr() string {
+	t.mu.RLock()
+	host, socket := t.localHost, t.localSocket
+	t.mu.RUnlock()
+
+	if socket != "" {
+		return socket
+	}
+	if t.reverse {
+		return net.JoinHostPort(host, strconv.Itoa(t.localPort))
+	}
+	return net.JoinHostPort(host, strconv.Itoa(t.LocalPort()))
+}
+
+// DialAddr returns the address a client on this host connects to the tunnel's local end at, over LocalNetwork:
+// LocalAddr, with an unspecified bind address such as 0.0.0.0 replaced by the loopback address.
+func (t *Tunnel) DialAddr() string {
+	if socket := t.LocalSocket(); socket != "" {
+		return socket
+	}
+
+	host, port, _ := net.SplitHostPort(t.LocalAddr())
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+		if ip.To4() == nil {
+			host = "::1"
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// RemoteAddr returns the remote address and port as a string in the format "host:port". For a running reverse tunnel
+// it is the address the SSH server listens on, and for a dynamic tunnel, whose clients pick their own destinations, it
+// is empty.
+func (t *Tunnel) RemoteAddr() string {
+	if t.dynamic {
+		return ""
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.boundPort > 0 {
+		return fmt.Sprintf("%s:%d", t.remoteHost, t.boundPort)
+	}
+	return fmt.Sprintf("%s:%d", t.remoteHost, t.remotePort)
+}
+
+// Stats retrieves the statistical data related to network activity for the tunnel in a thread-safe manner.
+func (t *Tunnel) Stats() Stats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	stats := t.stats
+	stats.LocalPort = t.actualPort
+	if t.tap != nil {
+		stats.TapDropped = t.tap.dropped.Load()
+	}
+	return stats
+}
+
+// ResetStats zeroes the tunnel's cumulative counters (bytes, connections, and queue totals) and returns the stats as they were just
+// before the reset. Gauges describing connections that are still open are left untouched.
+func (t *Tunnel) ResetStats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous := t.stats
+	t.stats.BytesIn = 0
+	t.stats.BytesOut = 0
+	t.stats.Connections = 0
+	t.stats.Dequeued = 0
+	t.stats.QueueWait = 0
+	t.stats.RefusedConnections = 0
+
+	return previous
+}
+
+// Probe opens a channel to the remote address over the tunnel's existing SSH connection and closes it again. It checks
+// that both the SSH server and the remote service are reachable without going through the local listener, so it does
+// not show up in the tunnel's connection statistics.
+func (t *Tunnel) Probe(timeout time.Duration) error {
+	if t.reverse {
+		return t.probeReverse(timeout)
+	}
+
+	if t.dynamic {
+		t.mu.RLock()
+		client := t.client
+		t.mu.RUnlock()
+		return pingClient(client)
+	}
+
+	t.mu.RLock()
+	client := t.client
+	addr := net.JoinHostPort(t.remoteHost, strconv.Itoa(t.remotePort))
+	t.mu.RUnlock()
+
+	if client == nil {
+		return fmt.Errorf("tunnel is not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, err := client.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s over ssh: %w", addr, err)
+	}
+
+	_ = conn.Close()
+	return nil
+}
+
+// RemoteDialAddr returns the address the most recent forwarded connection was opened to. When the remote host is a name
+// it is reported as the IP it resolves to here, as the SSH server resolves it itself and does not say which address it
+// connected to; until that lookup completes, or when it fails, the configured host is reported. It is empty until a
+// connection has been forwarded.
+func (t *Tunnel) RemoteDialAddr() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.dialResolved != "" {
+		return t.dialResolved
+	}
+	return t.lastDialAddr
+}
+
+// ConnectionInfo returns the negotiated parameters of the active SSH connection and whether the tunnel is connected.
+func (t *Tunnel) ConnectionInfo() (ConnectionInfo, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.connInfo, t.client != nil
+}
+
+// Close gracefully shuts down the tunnel by stopping all active connections and releasing resources.
+func (t *Tunnel) Close() error {
+	return t.Stop()
+}
+
+// newConnectionInfo extracts the handshake details of an established SSH client connection.
+func newConnectionInfo(client *ssh.Client, authKey string) ConnectionInfo {
+	info := ConnectionInfo{
+		ServerVersion: string(client.ServerVersion()),
+		RemoteAddr:    client.RemoteAddr().String(),
+		AuthKey:       authKey,
+	}
+
+	if meta, ok := client.Conn.(ssh.AlgorithmsConnMetadata); ok {
+		algorithms := meta.Algorithms()
+		info.KeyExchange = algorithms.KeyExchange
+		info.HostKey = algorithms.HostKey
+		info.CipherIn = algorithms.Read.Cipher
+		info.CipherOut = algorithms.Write.Cipher
+		info.MACIn = algorithms.Read.MAC
+		info.MACOut = algorithms.Write.MAC
+	}
+
+	return info
+}
+
+// refreshRemotePort updates the remote port from the configured resolver, if any.
+func (t *Tunnel) refreshRemotePort() error {
+	t.mu.RLock()
+	resolve := t.resolveRemotePort
+	t.mu.RUnlock()
+
+	if resolve == nil {
+		return nil
+	}
+
+	port, err := resolve()
+	if err != nil {
+		return fmt.Errorf("failed to resolve remote port: %w", err)
+	}
+
+	t.mu.Lock()
+	t.remotePort = port
+	t.mu.Unlock()
+
+	return nil
+}
+
+// dial opens a new SSH connection to the server described by the tunnel's current configuration, through its jump hosts
+// if it has any, unless ctx is done first. It also returns the key file used to authenticate, if any.
+func (t *Tunnel) dial(ctx context.Context) (*ssh.Client, string, error) {
+	t.mu.RLock()
+	config := t.config
+	t.mu.RUnlock()
+
+	var authKey string
+	sshClientConfig, closeAuth, err := config.clientConfig(func(path string) { authKey = path })
+	if err != nil {
+		return nil, "", err
+	}
+	defer closeAuth()
+
+	var conn net.Conn
+	var release func()
+	if config.jumps != nil {
+		conn, release, err = config.jumps.dial(ctx, config.Addr())
+	} else {
+		conn, err = config.dialServer(ctx, config.Addr())
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to connect to ssh server: %w", err)
+	}
+
+	t.configureConn(conn)
+
+	client, err := config.handshake(ctx, conn, config.Addr(), sshClientConfig)
+	if err != nil {
+		_ = conn.Close()
+		if release != nil {
+			release()
+		}
+		return nil, "", fmt.Errorf("failed to connect to ssh server: %w", err)
+	}
+
+	if config.KeepAliveInterval > 0 {
+		go t.keepAlive(client, config.KeepAliveInterval)
+	}
+	if release != nil {
+		go func() {
+			_ = client.Wait()
+			release()
+		}()
+	}
+
+	return client, authKey, nil
+}
+
+// configureConn applies the tunnel's socket options to a TCP connection.
+func (t *Tunnel) configureConn(conn net.Conn) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+
+	t.mu.RLock()
+	noDelay := t.noDelay
+	t.mu.RUnlock()
+
+	_ = tcpConn.SetNoDelay(noDelay)
+}
+
+// waitForClient blocks until an SSH connection is available, returning nil if the tunnel stops first. The returned
+// channel is closed once that SSH connection has been lost.
+func (t *Tunnel) waitForClient() (*ssh.Client, <-chan struct{}) {
+	for {
+		t.mu.RLock()
+		client, gone, ready, done := t.client, t.clientGone, t.clientReady, t.done
+		t.mu.RUnlock()
+
+		if client != nil {
+			return client, gone
+		}
+		if done == nil {
+			return nil, nil
+		}
+
+		select {
+		case <-ready:
+		case <-done:
+			return nil, nil
+		}
+	}
+}
+
+// watchClient returns a channel that is closed once the SSH connection of client has been lost or closed.
+func watchClient(client *ssh.Client) chan struct{} {
+	gone := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(gone)
+	}()
+	return gone
+}
+
+// activeConnections returns the number of forwarded connections currently open.
+func (t *Tunnel) activeConnections() int64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.stats.ActiveConnections
+}
+
+// closedChan returns an already closed channel, used to signal that an SSH connection is ready.
+func closedChan() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+// forward establishes and manages a connection between a local endpoint and a remote endpoint through the tunnel.
+func (t *Tunnel) forward(listener net.Listener, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		localConn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if t.reverse {
+				t.remoteListenerLost(listener, err)
+				return
+			}
+			continue
+		}
+
+		t.mu.RLock()
+		pool, limiter, accept := t.relayPool, t.connLimiter, t.acceptFunc
+		t.mu.RUnlock()
+
+		if accept != nil {
+			if err := accept(localConn.RemoteAddr()); err != nil {
+				_ = localConn.Close()
+				continue
+			}
+		}
+
+		t.configureConn(localConn)
+
+		if limiter == nil {
+			if !t.relayConn(localConn, pool, nil, done) {
+				return
+			}
+			continue
+		}
+
+		if limiter.tryAcquire() {
+			if !t.relayConn(localConn, pool, limiter, done) {
+				return
+			}
+			continue
+		}
+
+		if !limiter.tryEnqueue() {
+			t.countRefused()
+			_ = localConn.Close()
+			continue
+		}
+
+		go t.queueConn(localConn, pool, limiter, done)
+	}
+}
+
+// relayConn relays a connection that holds a slot under limiter, if any, first taking a slot from pool when one is
+// set. The limiter slot is freed once the connection is done. It returns false if done is closed while waiting for
+// the pool.
+func (t *Tunnel) relayConn(localConn net.Conn, pool *RelayPool, limiter *connLimiter, done chan struct{}) bool {
+	if pool != nil && !pool.acquire(done) {
+		_ = localConn.Close()
+		if limiter != nil {
+			limiter.release()
+		}
+		return false
+	}
+
+	tracker := t.track()
+	go func() {
+		if limiter != nil {
+			defer limiter.release()
+		}
+		if pool != nil {
+			defer pool.release()
+		}
+		t.handle(localConn, tracker)
+	}()
+
+	return true
+}
+
+// queueConn holds a connection in the tunnel's queue until limiter frees a slot, then relays it. The connection is
+// closed if the tunnel stops first.
+func (t *Tunnel) queueConn(localConn net.Conn, pool *RelayPool, limiter *connLimiter, done chan struct{}) {
+	t.mu.Lock()
+	gen := t.statsGen
+	t.stats.QueuedConnections++
+	t.mu.Unlock()
+
+	queuedAt := time.Now()
+	served := limiter.wait(done)
+
+	t.mu.Lock()
+	if t.statsGen == gen {
+		t.stats.QueuedConnections--
+		if served {
+			t.stats.Dequeued++
+			t.stats.QueueWait += time.Since(queuedAt)
+		}
+	}
+	t.mu.Unlock()
+
+	if !served {
+		_ = localConn.Close()
+		return
+	}
+
+	t.relayConn(localConn, pool, limiter, done)
+}
+
+// countRefused records a connection closed because the tunnel's connection limit and queue were both full.
+func (t *Tunnel) countRefused() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stats.RefusedConnections++
+}
+
+// connTracker follows a single forwarded connection through its lifecycle phases and attributes its traffic to the
+// stats generation it was accepted in, so connections outliving a Stop do not skew the counters of a later Start.
+type connTracker struct {
+	tunnel *Tunnel
+	gen    uint64
+	phase  Phase
+	done   chan struct{}
+
+	idle        *time.Timer
+	idleTimeout time.Duration
+}
+
+// track registers a newly accepted connection in the tunnel's stats and returns its tracker.
+func (t *Tunnel) track() *connTracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stats.Connections++
+	t.stats.ActiveConnections++
+	t.stats.Phases.Accepted++
+
+	return &connTracker{tunnel: t, gen: t.statsGen, phase: PhaseAccepted, done: t.done}
+}
+
+// move transitions the connection to the next phase, updating the phase gauges; phaseDone releases the connection.
+func (c *connTracker) move(next Phase) {
+	t := c.tunnel
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if c.gen == t.statsGen {
+		if gauge := t.stats.Phases.gauge(c.phase); gauge != nil {
+			*gauge--
+		}
+		if gauge := t.stats.Phases.gauge(next); gauge != nil {
+			*gauge++
+		}
+		if next == phaseDone {
+			t.stats.ActiveConnections--
+		}
+	}
+
+	c.phase = next
+}
+
+// closeWhenIdle closes conn once no bytes are recorded for timeout, ending the relay it is part of.
+func (c *connTracker) closeWhenIdle(conn net.Conn, timeout time.Duration) {
+	c.idleTimeout = timeout
+	c.idle = time.AfterFunc(timeout, func() {
+		_ = conn.Close()
+	})
+}
+
+// stopIdle stops the idle timer of a connection that has finished.
+func (c *connTracker) stopIdle() {
+	if c.idle != nil {
+		c.idle.Stop()
+	}
+}
+
+// record adds relayed bytes to the tunnel's stats and remembers copy errors. Relayed bytes restart the idle timer.
+func (c *connTracker) record(bytesIn, bytesOut int64, err error) {
+	if c.idle != nil && bytesIn+bytesOut > 0 {
+		c.idle.Reset(c.idleTimeout)
+	}
+
+	t := c.tunnel
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if c.gen == t.statsGen {
+		t.stats.BytesIn += bytesIn
+		t.stats.BytesOut += bytesOut
+		t.stats.LastActivity = time.Now()
+	}
+
+	if err != nil {
+		t.lastError = err
+	}
+}
+
+// throttle waits until the tunnel's rate limit lets n more bytes through in the given direction, or the tunnel run the
+// connection belongs to ends.
+func (c *connTracker) throttle(n int, inbound bool) {
+	t := c.tunnel
+	t.mu.RLock()
+	limiter := t.upLimit
+	if inbound {
+		limiter = t.downLimit
+	}
+	t.mu.RUnlock()
+
+	if limiter == nil {
+		return
+	}
+
+	wait := limiter.reserve(n)
+	if wait <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-c.done:
+	}
+}
+
+// meteredWriter credits every write to a connection's stats as it happens, so long-lived connections show their traffic
+// before they close. Inbound writes count as bytes received from the remote side, the others as bytes sent to it. Each
+// write first waits for the tunnel's rate limit, if any.
+type meteredWriter struct {
+	w       io.Writer
+	tracker *connTracker
+	inbound bool
+}
+
+func (m *meteredWriter) Write(p []byte) (int, error) {
+	m.tracker.throttle(len(p), m.inbound)
+	n, err := m.w.Write(p)
+	if n > 0 {
+		if m.inbound {
+			m.tracker.record(int64(n), 0, nil)
+		} else {
+			m.tracker.record(0, int64(n), nil)
+		}
+	}
+	return n, err
+}
+
+// handle waits for the SSH connection, dials the remote endpoint for an accepted local connection, and relays data.
+func (t *Tunnel) handle(localConn net.Conn, tracker *connTracker) {
+	client, gone := t.waitForClient()
+	if client == nil {
+		_ = localConn.Close()
+		tracker.move(phaseDone)
+		return
+	}
+
+	tracker.move(PhaseEstablishing)
+
+	var remoteConn net.Conn
+	var err error
+	switch {
+	case t.reverse:
+		remoteConn, err = t.dialLocalTarget()
+	case t.dynamic:
+		remoteConn, err = t.openSOCKS(localConn, client)
+	default:
+		remoteConn, err = t.openChannel(client)
+	}
+	if err != nil {
+		_ = localConn.Close()
+		tracker.move(phaseDone)
+		return
+	}
+
+	tracker.move(PhaseActive)
+
+	t.mu.RLock()
+	retry, tp, idleTimeout := t.retryChannel, t.tap, t.idleTimeout
+	t.mu.RUnlock()
+
+	// Closing the local side ends the relay in both directions, whichever channel it is on.
+	if idleTimeout > 0 {
+		tracker.closeWhenIdle(localConn, idleTimeout)
+		defer tracker.stopIdle()
+	}
+
+	if tp != nil {
+		localConn = &tappedConn{Conn: localConn, tap: tp}
+	}
+
+	if retry && !t.reverse && !t.dynamic {
+		t.pipeWithRetry(localConn, remoteConn, client, gone, tracker)
+		return
+	}
+
+	t.pipe(localConn, remoteConn, tracker)
+}
+
+// openChannel opens a channel to the remote endpoint over client, leaving the SSH server to resolve the remote host,
+// and records the address it was opened to.
+func (t *Tunnel) openChannel(client *ssh.Client) (net.Conn, error) {
+	t.mu.RLock()
+	addr := net.JoinHostPort(t.remoteHost, strconv.Itoa(t.remotePort))
+	t.mu.RUnlock()
+
+	conn, err := t.openChannelTo(client, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	if addr != t.lastDialAddr {
+		t.lastDialAddr = addr
+		t.dialResolved = ""
+	}
+	t.mu.Unlock()
+
+	if host, _, _ := net.SplitHostPort(addr); net.ParseIP(host) == nil && t.resolving.CompareAndSwap(false, true) {
+		go t.resolveDialAddr(addr)
+	}
+
+	return conn, nil
+}
+
+// resolveTimeout bounds the lookup of the remote host behind a forwarded connection.
+const resolveTimeout = 5 * time.Second
+
+// resolveDialAddr looks up the host of addr, a forwarded connection's remote address, so RemoteDialAddr can report an
+// IP. It only reports: the connection itself was opened to addr and resolved by the SSH server, which picks the same
+// address unless its DNS answers differently. At most one lookup runs at a time.
+func (t *Tunnel) resolveDialAddr(addr string) {
+	defer t.resolving.Store(false)
+
+	host, port, _ := net.SplitHostPort(addr)
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(ips) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.lastDialAddr == addr {
+		t.dialResolved = net.JoinHostPort(ips[0].IP.String(), port)
+	}
+}
+
+// openChannelTo opens a channel to addr over client, backing off and retrying while the SSH server refuses new channels
+// for lack of resources. It gives up early when the tunnel is stopped.
+func (t *Tunnel) openChannelTo(client *ssh.Client, addr string) (net.Conn, error) {
+	t.mu.RLock()
+	retries, backoff, done := t.openRetries, t.openBackoff, t.done
+	t.mu.RUnlock()
+
+	for attempt := 0; ; attempt++ {
+		conn, err := client.Dial("tcp", addr)
+		if err == nil || attempt >= retries || !isTransientOpenError(err) {
+			return conn, err
+		}
+
+		select {
+		case <-time.After(backoff << attempt):
+		case <-done:
+			return nil, err
+		}
+	}
+}
+
+// isTransientOpenError reports whether a channel open was refused for a reason expected to clear up on its own, as
+// when the server has run out of sessions, rather than being prohibited or failing to reach the destination.
+func isTransientOpenError(err error) bool {
+	var openErr *ssh.OpenChannelError
+	return errors.As(err, &openErr) && openErr.Reason == ssh.ResourceShortage
+}
+
+// pipe establishes bidirectional data transfer between local and remote connections and manages connection lifecycle.
+func (t *Tunnel) pipe(local, remote net.Conn, tracker *connTracker) {
+	done := make(chan struct{}, 2)
+
+	defer func() {
+		tracker.move(PhaseClosing)
+		_ = local.Close()
+		_ = remote.Close()
+		<-done
+		tracker.move(phaseDone)
+	}()
+
+	// Local -> Remote
+	go func() {
+		_, err := io.Copy(&meteredWriter{w: remote, tracker: tracker}, local)
+		tracker.record(0, 0, copyError("local->remote", err))
+		done <- struct{}{}
+	}()
+
+	// Remote -> Local
+	go func() {
+		_, err := io.Copy(&meteredWriter{w: local, tracker: tracker, inbound: true}, remote)
+		tracker.record(0, 0, copyError("remote->local", err))
+		done <- struct{}{}
+	}()
+
+	<-done
+}
+
+// copyError describes a failed copy in one direction of a relay. Errors from reading or writing a connection the relay
+// itself closed once the other direction finished are expected and reported as nil.
+func copyError(direction string, err error) error {
+	if err == nil || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return fmt.Errorf("%s copy failed: %w", direction, err)
+}
+
+// pipeWithRetry relays like pipe, but when the SSH connection carrying the channel is lost it opens a fresh channel once,
+// reconnecting the tunnel if no other relay has done so yet, and resumes relaying with the bytes that could not be sent.
+func (t *Tunnel) pipeWithRetry(local, remote net.Conn, client *ssh.Client, gone <-chan struct{}, tracker *connTracker) {
+	defer func() {
+		tracker.move(PhaseClosing)
+		_ = local.Close()
+		tracker.move(phaseDone)
+	}()
+
+	unsent, lost := relay(local, remote, nil, gone, tracker)
+	_ = remote.Close()
+	if !lost {
+		return
+	}
+
+	if err := t.reconnect(client); err != nil {
+		return
+	}
+
+	client, gone = t.waitForClient()
+	if client == nil {
+		return
+	}
+
+	remote, err := t.openChannel(client)
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+
+	_, _ = relay(local, remote, unsent, gone, tracker)
+}
+
+// channelLossWait bounds how long a relay whose channel ended waits to learn whether the SSH connection was lost, since
+// the channel observes the end of the connection slightly before the connection itself reports it.
+const channelLossWait = 250 * time.Millisecond
+
+// relayResult is what the local->remote half of a relay reports when it stops.
+type relayResult struct {
+	unsent  []byte
+	readErr bool
+}
+
+// relay copies between local and remote, first writing pending to remote, until either direction stops. It returns the
+// bytes read from local that never reached remote, and whether the relay stopped because the SSH connection was lost
+// rather than because either side finished. Local is left open so the relay can resume on another channel.
+func relay(local, remote net.Conn, pending []byte, gone <-chan struct{}, tracker *connTracker) ([]byte, bool) {
+	if len(pending) > 0 {
+		tracker.throttle(len(pending), false)
+		n, err := remote.Write(pending)
+		tracker.record(0, int64(n), nil)
+		if err != nil {
+			return pending[n:], connectionLost(gone)
+		}
+	}
+
+	upstream := make(chan relayResult, 1)
+	downstream := make(chan struct{})
+
+	// Local -> Remote
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := local.Read(buf)
+			if n > 0 {
+				tracker.throttle(n, false)
+				written, writeErr := remote.Write(buf[:n])
+				tracker.record(0, int64(written), nil)
+				if writeErr != nil {
+					upstream <- relayResult{unsent: slices.Clone(buf[written:n])}
+					return
+				}
+			}
+			if err != nil {
+				upstream <- relayResult{readErr: true}
+				return
+			}
+		}
+	}()
+
+	// Remote -> Local
+	go func() {
+		_, err := io.Copy(&meteredWriter{w: local, tracker: tracker, inbound: true}, remote)
+		tracker.record(0, 0, copyError("remote->local", err))
+		close(downstream)
+	}()
+
+	select {
+	case result := <-upstream:
+		if result.readErr || !connectionLost(gone) {
+			return nil, false
+		}
+		_ = remote.Close()
+		<-downstream
+		return result.unsent, true
+
+	case <-downstream:
+		if !connectionLost(gone) {
+			return nil, false
+		}
+		_ = local.SetReadDeadline(time.Now())
+		result := <-upstream
+		_ = local.SetReadDeadline(time.Time{})
+		return result.unsent, true
+	}
+}
+
+// connectionLost reports whether the SSH connection signalled by gone has been lost, waiting up to channelLossWait.
+func connectionLost(gone <-chan struct{}) bool {
+	select {
+	case <-gone:
+		return true
+	case <-time.After(channelLossWait):
+		return false
+	}
+}
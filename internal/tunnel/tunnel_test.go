@@ -0,0 +1,1661 @@
+package tunnel
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// TestNewTunnel verifies the creation of a new Tunnel instance and its initial state, ensuring proper configuration and status.
+func TestNewTunnel(t *testing.T) {
+	cfg, _ := NewSSHConfig("user", "pass", "", "localhost", "", 22)
+
+	tun := NewTunnel(cfg, "remote-host", 1521, 0)
+
+	if tun == nil {
+		t.Fatal("expected tunnel to be created")
+	}
+
+	if tun.Status() != StatusStopped {
+		t.Errorf("expected status %s, got %s", StatusStopped, tun.Status())
+	}
+}
+
+// TestNewTunnel_DoesNotConnect verifies that a newly created tunnel is not connected and remains in the 'stopped' status.
+func TestNewTunnel_DoesNotConnect(t *testing.T) {
+	cfg, _ := NewSSHConfig("user", "pass", "", "localhost", "", 22)
+
+	tun := NewTunnel(cfg, "remote-host", 1521, 0)
+
+	if tun.Status() != StatusStopped {
+		t.Errorf("expected status %s, got %s", StatusStopped, tun.Status())
+	}
+
+	if tun.client != nil {
+		t.Error("expected client to be nil")
+	}
+}
+
+// TestValidate_Success verifies that a tunnel with valid configuration passes the validation without errors.
+func TestValidate_Success(t *testing.T) {
+	cfg, _ := NewSSHConfig("user", "pass", "", "localhost", "", 22)
+	tun := NewTunnel(cfg, "remote-host", 1521, 0)
+
+	err := tun.Validate()
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// TestValidate_NilConfig verifies that the Validate method returns an error when the Tunnel is initialized with a nil SSHConfig.
+func TestValidate_NilConfig(t *testing.T) {
+	tun := NewTunnel(nil, "remote-host", 1521, 0)
+
+	err := tun.Validate()
+	if err == nil {
+		t.Fatal("expected error for nil config")
+	}
+
+	expected := "config is required"
+	if err.Error() != expected {
+		t.Errorf("expected error '%s', got '%s'", expected, err.Error())
+	}
+}
+
+// TestValidate_EmptyRemoteHost verifies that the validation fails when the remoteHost is empty, returning the expected error.
+func TestValidate_EmptyRemoteHost(t *testing.T) {
+	cfg, _ := NewSSHConfig("user", "pass", "", "localhost", "", 22)
+	tun := NewTunnel(cfg, "", 1521, 0)
+
+	err := tun.Validate()
+	if err == nil {
+		t.Fatal("expected error for empty remoteHost")
+	}
+
+	expected := "remoteHost is required"
+	if err.Error() != expected {
+		t.Errorf("expected error '%s', got '%s'", expected, err.Error())
+	}
+}
+
+// TestValidate_InvalidRemotePort tests the validation of invalid remotePort values in Tunnel configuration.
+func TestValidate_InvalidRemotePort(t *testing.T) {
+	cfg, _ := NewSSHConfig("user", "pass", "", "localhost", "", 22)
+
+	tests := []struct {
+		name string
+		port int
+	}{
+		{"zero", 0},
+		{"negative", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tun := NewTunnel(cfg, "remote-host", tt.port, 0)
+
+			err := tun.Validate()
+			if err == nil {
+				t.Fatal("expected error for invalid remotePort")
+			}
+		})
+	}
+}
+
+// TestValidate_InvalidLocalPort verifies that Tunnel.Validate() returns an error when the localPort is set to a negative value.
+func TestValidate_InvalidLocalPort(t *testing.T) {
+	cfg, _ := NewSSHConfig("user", "pass", "", "localhost", "", 22)
+	tun := NewTunnel(cfg, "remote-host", 1521, -1)
+
+	err := tun.Validate()
+	if err == nil {
+		t.Fatal("expected error for negative localPort")
+	}
+}
+
+// TestStart_Success verifies that the tunnel starts successfully, achieves a running status, and assigns a valid port.
+func TestStart_Success(t *testing.T) {
+	sshServer, cfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	tun := NewTunnel(cfg, "127.0.0.1", 1521, 0)
+
+	err := tun.Start()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tun.Close()
+
+	if tun.Status() != StatusRunning {
+		t.Errorf("expected status %s, got %s", StatusRunning, tun.Status())
+	}
+
+	if tun.LocalPort() <= 0 {
+		t.Errorf("expected positive local port, got %d", tun.LocalPort())
+	}
+}
+
+// TestStart_AlreadyRunning validates that attempting to start an already running tunnel returns an appropriate error.
+func TestStart_AlreadyRunning(t *testing.T) {
+	sshServer, cfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	tun := NewTunnel(cfg, "127.0.0.1", 1521, 0)
+
+	err := tun.Start()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tun.Close()
+
+	err = tun.Start()
+	if err == nil {
+		t.Fatal("expected error for already running tunnel")
+	}
+}
+
+// TestStart_ValidationError verifies that the Tunnel's Start method correctly handles invalid configurations and updates its status.
+func TestStart_ValidationError(t *testing.T) {
+	tun := NewTunnel(nil, "remote-host", 1521, 0)
+
+	err := tun.Start()
+	if err == nil {
+		t.Fatal("expected error for invalid config")
+	}
+
+	if tun.Status() != StatusError {
+		t.Errorf("expected status %s, got %s", StatusError, tun.Status())
+	}
+
+	if tun.LastError() == nil {
+		t.Error("expected LastError to be set")
+	}
+}
+
+// TestStart_SSHConnectionFailed verifies that the tunnel's Start method handles a failed SSH connection gracefully.
+// It checks if an error is returned and ensures the tunnel's status is set to StatusError.
+func TestStart_SSHConnectionFailed(t *testing.T) {
+	cfg, _ := NewSSHConfig("user", "pass", "", "localhost", "", 59999)
+	tun := NewTunnel(cfg, "remote-host", 1521, 0)
+
+	err := tun.Start()
+	if err == nil {
+		t.Fatal("expected error for failed SSH connection")
+	}
+
+	if tun.Status() != StatusError {
+		t.Errorf("expected status %s, got %s", StatusError, tun.Status())
+	}
+}
+
+// TestStart_FixedLocalPort verifies that the tunnel starts successfully with a fixed local port and matches the expected port.
+func TestStart_FixedLocalPort(t *testing.T) {
+	sshServer, cfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find free port: %v", err)
+	}
+	freePort := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	tun := NewTunnel(cfg, "127.0.0.1", 1521, freePort)
+
+	err = tun.Start()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tun.Close()
+
+	if tun.LocalPort() != freePort {
+		t.Errorf("expected local port %d, got %d", freePort, tun.LocalPort())
+	}
+}
+
+// TestStop_Success verifies that the Tunnel's Stop method successfully terminates the connection and updates the status.
+func TestStop_Success(t *testing.T) {
+	sshServer, cfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	tun := NewTunnel(cfg, "127.0.0.1", 1521, 0)
+
+	err := tun.Start()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = tun.Stop()
+	if err != nil {
+		t.Errorf("unexpected error on stop: %v", err)
+	}
+
+	if tun.Status() != StatusStopped {
+		t.Errorf("expected status %s, got %s", StatusStopped, tun.Status())
+	}
+}
+
+// TestStop_AlreadyStopped verifies that calling Stop on a tunnel that hasn't been started does not return an error.
+func TestStop_AlreadyStopped(t *testing.T) {
+	cfg, _ := NewSSHConfig("user", "pass", "", "localhost", "", 22)
+	tun := NewTunnel(cfg, "remote-host", 1521, 0)
+
+	err := tun.Stop()
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// TestStop_ReleasesPort verifies that the tunnel releases the local port and prevents new connections after stopping.
+func TestStop_ReleasesPort(t *testing.T) {
+	sshServer, cfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	tun := NewTunnel(cfg, "127.0.0.1", 1521, 0)
+
+	err := tun.Start()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	localAddr := tun.LocalAddr()
+
+	err = tun.Stop()
+	if err != nil {
+		t.Fatalf("unexpected error on stop: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = net.Dial("tcp", localAddr)
+	if err == nil {
+		t.Error("expected connection to fail after stop")
+	}
+}
+
+// TestRestart_Success verifies that a tunnel can successfully restart and maintains the expected StatusRunning state afterward.
+func TestRestart_Success(t *testing.T) {
+	sshServer, cfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	tun := NewTunnel(cfg, "127.0.0.1", 1521, 0)
+
+	err := tun.Start()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tun.Close()
+
+	err = tun.Restart()
+	if err != nil {
+		t.Errorf("unexpected error on restart: %v", err)
+	}
+
+	if tun.Status() != StatusRunning {
+		t.Errorf("expected status %s, got %s", StatusRunning, tun.Status())
+	}
+}
+
+// TestRestart_FromStopped verifies the behavior of the Tunnel's Restart method when invoked on a tunnel in a stopped state.
+func TestRestart_FromStopped(t *testing.T) {
+	sshServer, cfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	tun := NewTunnel(cfg, "127.0.0.1", 1521, 0)
+
+	err := tun.Restart()
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if tun.Status() != StatusRunning {
+		t.Errorf("expected status %s, got %s", StatusRunning, tun.Status())
+	}
+
+	defer tun.Close()
+}
+
+// TestUpdateConfig verifies the behavior of the Tunnel's UpdateConfig method by ensuring the SSH configuration is updated correctly.
+func TestUpdateConfig(t *testing.T) {
+	cfg1, _ := NewSSHConfig("user1", "pass1", "", "host1", "", 22)
+	cfg2, _ := NewSSHConfig("user2", "pass2", "", "host2", "", 22)
+
+	tun := NewTunnel(cfg1, "remote-host", 1521, 0)
+
+	if tun.config.User != "user1" {
+		t.Errorf("expected user 'user1', got '%s'", tun.config.User)
+	}
+
+	tun.UpdateConfig(cfg2)
+
+	if tun.config.User != "user2" {
+		t.Errorf("expected user 'user2', got '%s'", tun.config.User)
+	}
+}
+
+// TestLocalAddr verifies that the LocalAddr method of the Tunnel returns the correct formatted local address and port.
+func TestLocalAddr(t *testing.T) {
+	sshServer, cfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	tun := NewTunnel(cfg, "127.0.0.1", 1521, 0)
+
+	err := tun.Start()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tun.Close()
+
+	expected := fmt.Sprintf("127.0.0.1:%d", tun.LocalPort())
+	if tun.LocalAddr() != expected {
+		t.Errorf("expected '%s', got '%s'", expected, tun.LocalAddr())
+	}
+}
+
+func TestLocalAddr_Bind(t *testing.T) {
+	sshServer, cfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	tun := NewTunnel(cfg, "127.0.0.1", 1521, 0)
+	tun.SetLocalBind("0.0.0.0")
+
+	if err := tun.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tun.Close()
+
+	if want := fmt.Sprintf("0.0.0.0:%d", tun.LocalPort()); tun.LocalAddr() != want {
+		t.Errorf("expected '%s', got '%s'", want, tun.LocalAddr())
+	}
+	if want := fmt.Sprintf("127.0.0.1:%d", tun.LocalPort()); tun.DialAddr() != want {
+		t.Errorf("expected clients to dial '%s', got '%s'", want, tun.DialAddr())
+	}
+
+	conn, err := net.Dial("tcp", tun.DialAddr())
+	if err != nil {
+		t.Fatalf("expected the listener to accept connections on loopback: %v", err)
+	}
+	_ = conn.Close()
+
+	invalid := NewTunnel(cfg, "127.0.0.1", 1521, 0)
+	invalid.SetLocalBind("not-an-ip")
+	if err := invalid.Validate(); err == nil {
+		t.Error("expected an invalid bind address to fail validation")
+	}
+}
+
+// TestRemoteAddr verifies that the Tunnel's RemoteAddr method returns the expected remote address in the correct format.
+func TestRemoteAddr(t *testing.T) {
+	cfg, _ := NewSSHConfig("user", "pass", "", "localhost", "", 22)
+	tun := NewTunnel(cfg, "oracle-server", 1521, 0)
+
+	expected := "oracle-server:1521"
+	if tun.RemoteAddr() != expected {
+		t.Errorf("expected '%s', got '%s'", expected, tun.RemoteAddr())
+	}
+}
+
+// TestLastError_NilWhenNoError ensures that calling LastError on a tunnel returns nil when no error has occurred.
+func TestLastError_NilWhenNoError(t *testing.T) {
+	cfg, _ := NewSSHConfig("user", "pass", "", "localhost", "", 22)
+	tun := NewTunnel(cfg, "remote-host", 1521, 0)
+
+	if tun.LastError() != nil {
+		t.Errorf("expected nil error, got %v", tun.LastError())
+	}
+}
+
+// TestForwardData verifies the functionality of tunneling data through an SSH server to a destination server.
+func TestForwardData(t *testing.T) {
+	sshServer, cfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer := setupTestDestinationServer(t, "hello from oracle")
+	defer destServer.Close()
+
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+
+	tun := NewTunnel(cfg, "127.0.0.1", destPort, 0)
+
+	err := tun.Start()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tun.Close()
+
+	conn, err := net.Dial("tcp", tun.LocalAddr())
+	if err != nil {
+		t.Fatalf("failed to connect to tunnel: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil && err != io.EOF {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	response := string(buf[:n])
+	if response != "hello from oracle" {
+		t.Errorf("expected 'hello from oracle', got '%s'", response)
+	}
+}
+
+// TestMultipleConnections verifies if multiple sequential connections to the tunnel are handled correctly without errors.
+func TestMultipleConnections(t *testing.T) {
+	sshServer, cfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	var connCount atomic.Int32
+	destServer := setupTestDestinationServerFunc(t, func(conn net.Conn) {
+		fmt.Fprintf(conn, "connection %d", connCount.Add(1))
+		conn.Close()
+	})
+	defer destServer.Close()
+
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+
+	tun := NewTunnel(cfg, "127.0.0.1", destPort, 0)
+
+	err := tun.Start()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tun.Close()
+
+	for i := 1; i <= 3; i++ {
+		conn, err := net.Dial("tcp", tun.LocalAddr())
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]byte, 1024)
+		n, _ := conn.Read(buf)
+		conn.Close()
+
+		expected := fmt.Sprintf("connection %d", i)
+		if string(buf[:n]) != expected {
+			t.Errorf("expected '%s', got '%s'", expected, string(buf[:n]))
+		}
+	}
+}
+
+// setupTestSSHServer creates and starts an SSH server for testing purposes and returns the listener and SSH config.
+func setupTestSSHServer(t *testing.T) (net.Listener, *SSHConfig) {
+	t.Helper()
+	return setupTestSSHServerWithHandler(t, forwardTestChannel)
+}
+
+// TestForwardData_BastionLoopback verifies that a loopback remoteHost is passed to the SSH server as is, so the
+// connection reaches a service bound to the server's own loopback.
+func TestForwardData_BastionLoopback(t *testing.T) {
+	requested := make(chan string, 1)
+	sshServer, sshCfg := setupTestSSHServerWithHandler(t, func(newChannel ssh.NewChannel) {
+		var payload struct {
+			DestHost string
+			DestPort uint32
+		}
+		ssh.Unmarshal(newChannel.ExtraData(), &payload)
+		requested <- payload.DestHost
+		forwardTestChannel(newChannel)
+	})
+	defer sshServer.Close()
+
+	destServer := setupTestDestinationServer(t, "bastion-only")
+	defer destServer.Close()
+
+	tunnel := NewTunnel(sshCfg, "127.0.0.1", destServer.Addr().(*net.TCPAddr).Port, 0)
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tunnel.Stop()
+
+	conn, err := net.Dial("tcp", tunnel.LocalAddr())
+	if err != nil {
+		t.Fatalf("failed to connect to tunnel: %v", err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, len("bastion-only"))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "bastion-only" {
+		t.Fatalf("expected the service on the server's loopback, got %q: %v", buf, err)
+	}
+
+	if host := <-requested; host != "127.0.0.1" {
+		t.Errorf("expected the server to be asked for 127.0.0.1, got %q", host)
+	}
+}
+
+// TestStart_TriesKeyFilesInOrder verifies that every configured key is offered until the server accepts one, and that
+// the accepted key is reported in the connection info.
+func TestStart_TriesKeyFilesInOrder(t *testing.T) {
+	oldKeyPath, _ := writeTestKeyFile(t, "id_old")
+	newKeyPath, newKey := writeTestKeyFile(t, "id_new")
+
+	hostKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("failed to create host signer: %v", err)
+	}
+
+	accepted := newKey.PublicKey().Marshal()
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), accepted) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key")
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handleTestSSHConnection(conn, serverConfig, forwardTestChannel)
+		}
+	}()
+
+	sshCfg := &SSHConfig{
+		User:                  "testuser",
+		KeyFile:               KeyFiles{oldKeyPath, newKeyPath},
+		Host:                  "127.0.0.1",
+		Port:                  listener.Addr().(*net.TCPAddr).Port,
+		InsecureIgnoreHostKey: true,
+	}
+	if err := sshCfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tunnel := NewTunnel(sshCfg, "127.0.0.1", 1521, 0)
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("expected the second key to authenticate, got: %v", err)
+	}
+	defer tunnel.Stop()
+
+	info, _ := tunnel.ConnectionInfo()
+	if info.AuthKey != newKeyPath {
+		t.Errorf("expected auth key %s, got %q", newKeyPath, info.AuthKey)
+	}
+}
+
+// TestStart_AuthenticatesWithAgent verifies that with agent set the keys held by the agent on SSH_AUTH_SOCK are
+// offered, and that a missing agent socket fails Start with a clear error.
+func TestStart_AuthenticatesWithAgent(t *testing.T) {
+	agentKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: agentKey}); err != nil {
+		t.Fatalf("failed to add key to agent: %v", err)
+	}
+	agentSigner, err := ssh.NewSignerFromKey(agentKey)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+
+	hostKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("failed to create host signer: %v", err)
+	}
+
+	accepted := agentSigner.PublicKey().Marshal()
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), accepted) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key")
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handleTestSSHConnection(conn, serverConfig, forwardTestChannel)
+		}
+	}()
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	agentListener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen for agent: %v", err)
+	}
+	defer agentListener.Close()
+
+	go func() {
+		for {
+			conn, err := agentListener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+
+	sshCfg := &SSHConfig{
+		User:                  "testuser",
+		Agent:                 true,
+		Host:                  "127.0.0.1",
+		Port:                  listener.Addr().(*net.TCPAddr).Port,
+		InsecureIgnoreHostKey: true,
+	}
+	if err := sshCfg.Validate(); err != nil {
+		t.Fatalf("expected agent alone to satisfy auth, got: %v", err)
+	}
+
+	t.Setenv("SSH_AUTH_SOCK", socket)
+	tunnel := NewTunnel(sshCfg, "127.0.0.1", 1521, 0)
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("expected the agent key to authenticate, got: %v", err)
+	}
+	tunnel.Stop()
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+	tunnel = NewTunnel(sshCfg, "127.0.0.1", 1521, 0)
+	err = tunnel.Start()
+	if err == nil {
+		tunnel.Stop()
+		t.Fatal("expected error without SSH_AUTH_SOCK")
+	}
+	if !strings.Contains(err.Error(), "SSH_AUTH_SOCK is not set") {
+		t.Errorf("expected a clear agent error, got: %v", err)
+	}
+}
+
+// TestStart_HostKeyChecking verifies that a server missing from known_hosts is rejected when checking is strict and
+// trusted on first use otherwise, and that a key differing from the listed one is rejected either way.
+func TestStart_HostKeyChecking(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(knownHosts, nil, 0600); err != nil {
+		t.Fatalf("failed to write known_hosts: %v", err)
+	}
+
+	start := func(strict bool) error {
+		t.Helper()
+
+		cfg := *sshCfg
+		cfg.KnownHostsFile = knownHosts
+		cfg.StrictHostKeys = &strict
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		tunnel := NewTunnel(&cfg, "127.0.0.1", 1521, 0)
+		if err := tunnel.Start(); err != nil {
+			return err
+		}
+		return tunnel.Stop()
+	}
+
+	if err := start(true); err == nil || !strings.Contains(err.Error(), "is not in") {
+		t.Fatalf("expected an unknown host to be rejected, got: %v", err)
+	}
+
+	if err := start(false); err != nil {
+		t.Fatalf("expected the host to be trusted on first use, got: %v", err)
+	}
+	if err := start(true); err != nil {
+		t.Fatalf("expected the host added on first use to be known, got: %v", err)
+	}
+	if data, _ := os.ReadFile(knownHosts); strings.Count(string(data), "\n") != 1 {
+		t.Errorf("expected the host to be added once, got:\n%s", data)
+	}
+
+	_, otherKey := writeTestKeyFile(t, "id_other")
+	addr := knownhosts.Normalize(sshCfg.Addr())
+	if err := os.WriteFile(knownHosts, []byte(knownhosts.Line([]string{addr}, otherKey.PublicKey())+"\n"), 0600); err != nil {
+		t.Fatalf("failed to write known_hosts: %v", err)
+	}
+
+	for _, strict := range []bool{true, false} {
+		if err := start(strict); err == nil || !strings.Contains(err.Error(), "host key mismatch") {
+			t.Errorf("expected a changed key to be rejected with strict=%t, got: %v", strict, err)
+		}
+	}
+
+	for _, strict := range []bool{true, false} {
+		cfg := *sshCfg
+		cfg.StrictHostKeys = &strict
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "requires knownHostsFile") {
+			t.Errorf("expected strictHostKeyChecking: %t without knownHostsFile to be rejected, got: %v", strict, err)
+		}
+	}
+}
+
+// writeTestKeyFile generates an RSA private key, writes it in OpenSSH format to a temporary file, and returns its path
+// and signer.
+func writeTestKeyFile(t *testing.T, name string) (string, ssh.Signer) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+
+	return path, signer
+}
+
+// setupTestSSHServerWithHandler starts a test SSH server that passes every direct-tcpip channel request to handler.
+func setupTestSSHServerWithHandler(t *testing.T, handler func(ssh.NewChannel)) (net.Listener, *SSHConfig) {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate private key: %v", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "testuser" && string(pass) == "testpass" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("invalid credentials")
+		},
+	}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handleTestSSHConnection(conn, serverConfig, handler)
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	cfg, err := NewSSHConfig("testuser", "testpass", "", "127.0.0.1", "", port)
+	if err != nil {
+		listener.Close()
+		t.Fatalf("failed to create ssh config: %v", err)
+	}
+
+	return listener, cfg
+}
+
+// handleTestSSHConnection manages an incoming SSH connection and handles direct-tcpip channel requests for forwarding,
+// as well as tcpip-forward requests for reverse tunnels.
+func handleTestSSHConnection(conn net.Conn, config *ssh.ServerConfig, handler func(ssh.NewChannel)) {
+	defer conn.Close()
+
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	defer sshConn.Close()
+
+	go serveTestForwards(sshConn, reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() == "direct-tcpip" {
+			handler(newChannel)
+		}
+	}
+}
+
+// forwardTestChannel relays a direct-tcpip channel to the requested destination, rejecting it like sshd does when the
+// destination cannot be reached.
+func forwardTestChannel(newChannel ssh.NewChannel) {
+	var payload struct {
+		DestHost   string
+		DestPort   uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	ssh.Unmarshal(newChannel.ExtraData(), &payload)
+
+	destAddr := net.JoinHostPort(payload.DestHost, strconv.Itoa(int(payload.DestPort)))
+	destConn, err := net.Dial("tcp", destAddr)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		destConn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	go func() {
+		defer channel.Close()
+		defer destConn.Close()
+		io.Copy(channel, destConn)
+	}()
+	go func() {
+		defer channel.Close()
+		defer destConn.Close()
+		io.Copy(destConn, channel)
+	}()
+}
+
+// setupGatedSSHServer starts a test SSH server that holds every direct-tcpip channel open request until gate is closed.
+func setupGatedSSHServer(t *testing.T, gate <-chan struct{}) (net.Listener, *SSHConfig) {
+	t.Helper()
+
+	return setupTestSSHServerWithHandler(t, func(newChannel ssh.NewChannel) {
+		go func() {
+			<-gate
+			forwardTestChannel(newChannel)
+		}()
+	})
+}
+
+// setupTestDestinationServer creates a test TCP server that sends a fixed response to incoming connections.
+func setupTestDestinationServer(t *testing.T, response string) net.Listener {
+	t.Helper()
+	return setupTestDestinationServerFunc(t, func(conn net.Conn) {
+		conn.Write([]byte(response))
+		conn.Close()
+	})
+}
+
+// setupTestDestinationServerFunc creates a test TCP server, uses the provided handler for incoming connections, and returns a listener.
+func setupTestDestinationServerFunc(t *testing.T, handler func(net.Conn)) net.Listener {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handler(conn)
+		}
+	}()
+
+	return listener
+}
+
+// TestConnectionInfo verifies that the negotiated SSH algorithms are captured after connecting and cleared after stopping.
+func TestConnectionInfo(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	tunnel := NewTunnel(sshCfg, "127.0.0.1", 1521, 0)
+
+	if _, connected := tunnel.ConnectionInfo(); connected {
+		t.Fatal("expected no connection info before start")
+	}
+
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info, connected := tunnel.ConnectionInfo()
+	if !connected {
+		t.Fatal("expected connection info after start")
+	}
+
+	if info.KeyExchange == "" || info.HostKey == "" {
+		t.Errorf("expected key exchange and host key to be reported, got %+v", info)
+	}
+
+	if info.CipherIn == "" || info.CipherOut == "" {
+		t.Errorf("expected ciphers to be reported, got %+v", info)
+	}
+
+	if info.HostKey != ssh.KeyAlgoRSASHA256 && info.HostKey != ssh.KeyAlgoRSASHA512 && info.HostKey != ssh.KeyAlgoRSA {
+		t.Errorf("expected an rsa host key algorithm, got %s", info.HostKey)
+	}
+
+	if info.RemoteAddr != sshServer.Addr().String() {
+		t.Errorf("expected remote addr %s, got %s", sshServer.Addr(), info.RemoteAddr)
+	}
+
+	_ = tunnel.Stop()
+
+	if _, connected := tunnel.ConnectionInfo(); connected {
+		t.Error("expected no connection info after stop")
+	}
+}
+
+// TestReconnect_KeepsListenerBound verifies that the local listener keeps accepting connections while the SSH side reconnects.
+func TestReconnect_KeepsListenerBound(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer := setupTestDestinationServer(t, "ok")
+	defer destServer.Close()
+
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+	tunnel := NewTunnel(sshCfg, "127.0.0.1", destPort, 0)
+
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tunnel.Stop()
+
+	localAddr := tunnel.LocalAddr()
+
+	stop := make(chan struct{})
+	dialErrs := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				close(dialErrs)
+				return
+			default:
+			}
+
+			conn, err := net.Dial("tcp", localAddr)
+			if err != nil {
+				dialErrs <- err
+				close(dialErrs)
+				return
+			}
+			conn.Close()
+			time.Sleep(2 * time.Millisecond)
+		}
+	}()
+
+	if err := tunnel.Reconnect(); err != nil {
+		t.Fatalf("unexpected error reconnecting: %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+
+	if err := <-dialErrs; err != nil {
+		t.Errorf("expected listener to stay bound during reconnect, got %v", err)
+	}
+
+	if tunnel.LocalAddr() != localAddr {
+		t.Errorf("expected local addr %s to be kept, got %s", localAddr, tunnel.LocalAddr())
+	}
+
+	if tunnel.Status() != StatusRunning {
+		t.Errorf("expected status running, got %s", tunnel.Status())
+	}
+
+	conn, err := net.Dial("tcp", localAddr)
+	if err != nil {
+		t.Fatalf("failed to connect after reconnect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("failed to read through reconnected tunnel: %v", err)
+	}
+
+	if string(buf) != "ok" {
+		t.Errorf("expected 'ok', got %q", buf)
+	}
+}
+
+// TestReconnect_NotRunning verifies that reconnecting a stopped tunnel returns an error.
+func TestReconnect_NotRunning(t *testing.T) {
+	sshCfg, _ := NewSSHConfig("user", "pass", "", "localhost", "", 22)
+	tunnel := NewTunnel(sshCfg, "127.0.0.1", 1521, 0)
+
+	if err := tunnel.Reconnect(); err == nil {
+		t.Fatal("expected error reconnecting a stopped tunnel")
+	}
+}
+
+// TestStats_ConnectionPhases verifies that forwarded connections move through the establishing, active, and closing gauges.
+func TestStats_ConnectionPhases(t *testing.T) {
+	gate := make(chan struct{})
+	sshServer, sshCfg := setupGatedSSHServer(t, gate)
+	defer sshServer.Close()
+
+	destServer := setupTestDestinationServerFunc(t, func(conn net.Conn) {
+		io.Copy(io.Discard, conn)
+		conn.Close()
+	})
+	defer destServer.Close()
+
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+	tunnel := NewTunnel(sshCfg, "127.0.0.1", destPort, 0)
+
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tunnel.Stop()
+
+	conn, err := net.Dial("tcp", tunnel.LocalAddr())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	waitForPhases(t, tunnel, PhaseStats{Establishing: 1})
+
+	close(gate)
+	waitForPhases(t, tunnel, PhaseStats{Active: 1})
+
+	conn.Close()
+	waitForPhases(t, tunnel, PhaseStats{})
+
+	stats := tunnel.Stats()
+	if stats.Connections != 1 || stats.ActiveConnections != 0 {
+		t.Errorf("expected 1 total and 0 active connections, got %d and %d", stats.Connections, stats.ActiveConnections)
+	}
+}
+
+// waitForPhases polls the tunnel's phase gauges until they match want, failing the test after a timeout.
+func waitForPhases(t *testing.T, tunnel *Tunnel, want PhaseStats) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if tunnel.Stats().Phases == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("expected phases %+v, got %+v", want, tunnel.Stats().Phases)
+}
+
+// TestDrain_ReportsDrainedAndForced verifies that Drain lets finishing connections drain and force-closes the rest.
+func TestDrain_ReportsDrainedAndForced(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer := setupTestDestinationServerFunc(t, func(conn net.Conn) {
+		io.Copy(conn, conn)
+		conn.Close()
+	})
+	defer destServer.Close()
+
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+	tunnel := NewTunnel(sshCfg, "127.0.0.1", destPort, 0)
+
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tunnel.Stop()
+
+	localAddr := tunnel.LocalAddr()
+	finishing := dialEcho(t, localAddr)
+	lingering := dialEcho(t, localAddr)
+	defer lingering.Close()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		finishing.Close()
+	}()
+
+	result, err := tunnel.Drain(500 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error draining: %v", err)
+	}
+
+	if result.Drained != 1 || result.Forced != 1 {
+		t.Errorf("expected 1 drained and 1 forced, got %+v", result)
+	}
+
+	if tunnel.Status() != StatusStopped {
+		t.Errorf("expected status stopped after drain, got %s", tunnel.Status())
+	}
+
+	if conn, err := net.Dial("tcp", localAddr); err == nil {
+		conn.Close()
+		t.Error("expected new connections to be refused after drain")
+	}
+}
+
+// TestDrain_NotRunning verifies that draining a stopped tunnel returns an error.
+func TestDrain_NotRunning(t *testing.T) {
+	sshCfg, _ := NewSSHConfig("user", "pass", "", "localhost", "", 22)
+	tunnel := NewTunnel(sshCfg, "127.0.0.1", 1521, 0)
+
+	if _, err := tunnel.Drain(time.Second); err == nil {
+		t.Fatal("expected error draining a stopped tunnel")
+	}
+}
+
+// dialEcho connects to an echo destination through the tunnel and round-trips a byte to make sure the relay is active.
+func dialEcho(t *testing.T, addr string) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write([]byte("x")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	buf := make([]byte, 1)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("failed to read echo: %v", err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return conn
+}
+
+// TestStop_AfterFailedRestart verifies that a tunnel whose restart failed can be stopped again without panicking.
+func TestStop_AfterFailedRestart(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+
+	tunnel := NewTunnel(sshCfg, "127.0.0.1", 1521, 0)
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sshServer.Close()
+	if err := tunnel.Restart(); err == nil {
+		t.Fatal("expected restart to fail with the ssh server closed")
+	}
+
+	if err := tunnel.Stop(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tunnel.Status() != StatusStopped {
+		t.Errorf("expected status %s, got %s", StatusStopped, tunnel.Status())
+	}
+}
+
+// TestProbe_NotConnected verifies that probing a tunnel without an SSH connection fails.
+func TestProbe_NotConnected(t *testing.T) {
+	cfg, _ := NewSSHConfig("user", "pass", "", "localhost", "", 22)
+	tunnel := NewTunnel(cfg, "remote-host", 1521, 0)
+
+	if err := tunnel.Probe(time.Second); err == nil {
+		t.Error("expected probe to fail before start")
+	}
+}
+
+// TestRetryChannel_SurvivesDroppedSSHConnection verifies that with channel retries enabled a client connection keeps
+// working after the SSH connection drops mid-transfer, over a single reconnect.
+func TestRetryChannel_SurvivesDroppedSSHConnection(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer := setupTestDestinationServerFunc(t, func(conn net.Conn) {
+		io.Copy(conn, conn)
+		conn.Close()
+	})
+	defer destServer.Close()
+
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+	tunnel := NewTunnel(sshCfg, "127.0.0.1", destPort, 0)
+	tunnel.SetRetryChannel(true)
+
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tunnel.Stop()
+
+	conn := dialEcho(t, tunnel.LocalAddr())
+	defer conn.Close()
+
+	tunnel.mu.RLock()
+	dropped := tunnel.client
+	tunnel.mu.RUnlock()
+	_ = dropped.Close()
+
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Write([]byte("after")); err != nil {
+		t.Fatalf("failed to write after the drop: %v", err)
+	}
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("expected the client connection to survive the drop, got %v", err)
+	}
+	if string(buf) != "after" {
+		t.Errorf("expected echo 'after', got %q", buf)
+	}
+
+	tunnel.mu.RLock()
+	current := tunnel.client
+	tunnel.mu.RUnlock()
+	if current == nil || current == dropped {
+		t.Error("expected the tunnel to have reconnected over a new SSH connection")
+	}
+	if tunnel.Status() != StatusRunning {
+		t.Errorf("expected status running, got %s", tunnel.Status())
+	}
+}
+
+// TestChannelOpen_RetriesResourceShortage verifies that a channel refused for lack of resources is retried until the
+// server accepts it, while an administratively prohibited one fails the forward at once.
+func TestChannelOpen_RetriesResourceShortage(t *testing.T) {
+	var opens atomic.Int32
+	sshServer, sshCfg := setupTestSSHServerWithHandler(t, func(newChannel ssh.NewChannel) {
+		switch opens.Add(1) {
+		case 1:
+			newChannel.Reject(ssh.ResourceShortage, "no more sessions")
+		case 3:
+			newChannel.Reject(ssh.Prohibited, "administratively prohibited")
+		default:
+			forwardTestChannel(newChannel)
+		}
+	})
+	defer sshServer.Close()
+
+	destServer := setupTestDestinationServer(t, "ok")
+	defer destServer.Close()
+
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+	tunnel := NewTunnel(sshCfg, "127.0.0.1", destPort, 0)
+	tunnel.SetChannelOpenRetry(2, 10*time.Millisecond)
+
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tunnel.Stop()
+
+	conn, err := net.Dial("tcp", tunnel.LocalAddr())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("expected the forward to succeed after a retry, got %v", err)
+	}
+	if string(buf) != "ok" {
+		t.Errorf("expected 'ok', got %q", buf)
+	}
+	if got := opens.Load(); got != 2 {
+		t.Errorf("expected 2 channel opens, got %d", got)
+	}
+
+	prohibited, err := net.Dial("tcp", tunnel.LocalAddr())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer prohibited.Close()
+
+	prohibited.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, err := prohibited.Read(buf); err == nil {
+		t.Errorf("expected a prohibited channel to close the connection, read %q", buf[:n])
+	}
+	if got := opens.Load(); got != 3 {
+		t.Errorf("expected a prohibited channel not to be retried, got %d opens", got)
+	}
+}
+
+// TestRelayPool_BoundsGoroutines verifies that a small relay pool keeps the goroutine count bounded while many
+// connections queue, and that every queued connection still transfers its data once it gets a slot.
+func TestRelayPool_BoundsGoroutines(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer := setupTestDestinationServerFunc(t, func(conn net.Conn) {
+		io.Copy(conn, conn)
+		conn.Close()
+	})
+	defer destServer.Close()
+
+	const workers, conns = 4, 40
+
+	pool := NewRelayPool(workers)
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+	tunnel := NewTunnel(sshCfg, "127.0.0.1", destPort, 0)
+	tunnel.SetRelayPool(pool)
+
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tunnel.Stop()
+
+	baseline := runtime.NumGoroutine()
+
+	var peak atomic.Int64
+	stopSampling := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		for {
+			if n := int64(runtime.NumGoroutine()); n > peak.Load() {
+				peak.Store(n)
+			}
+			if inUse := pool.InUse(); inUse > workers {
+				t.Errorf("expected at most %d slots in use, got %d", workers, inUse)
+			}
+			select {
+			case <-stopSampling:
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}()
+
+	clients := make([]net.Conn, conns)
+	for i := range clients {
+		conn, err := net.Dial("tcp", tunnel.LocalAddr())
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := fmt.Fprintf(conn, "conn-%02d", i); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		clients[i] = conn
+	}
+
+	for i, conn := range clients {
+		buf := make([]byte, len("conn-00"))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatalf("connection %d: failed to read echo: %v", i, err)
+		}
+		if want := fmt.Sprintf("conn-%02d", i); string(buf) != want {
+			t.Errorf("connection %d: expected %q, got %q", i, want, buf)
+		}
+		conn.Close()
+	}
+
+	close(stopSampling)
+	<-sampled
+
+	// Each relayed connection costs a handful of goroutines across the tunnel, the in-process SSH server, and the echo
+	// server; without the pool all 40 connections would be relayed at once.
+	if grown := peak.Load() - int64(baseline); grown > 12*workers {
+		t.Errorf("expected goroutines to stay bounded by the pool, grew by %d", grown)
+	}
+}
+
+// TestRelayPool_ClosedConnectionsLeaveNoError verifies that relays torn down once the destination hangs up do not report
+// the client connection they closed themselves as the tunnel's last error.
+func TestRelayPool_ClosedConnectionsLeaveNoError(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer := setupTestDestinationServer(t, "bye")
+	defer destServer.Close()
+
+	tunnel := NewTunnel(sshCfg, "127.0.0.1", destServer.Addr().(*net.TCPAddr).Port, 0)
+	tunnel.SetRelayPool(NewRelayPool(2))
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tunnel.Stop()
+
+	// The clients stay connected and silent, so each relay is still reading from them when it closes them.
+	for range 5 {
+		conn, err := net.Dial("tcp", tunnel.LocalAddr())
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if data, err := io.ReadAll(conn); err != nil || string(data) != "bye" {
+			t.Fatalf("expected the destination's reply, got %q (%v)", data, err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for tunnel.Stats().ActiveConnections > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if active := tunnel.Stats().ActiveConnections; active != 0 {
+		t.Fatalf("expected every relay to finish, got %d active", active)
+	}
+	if err := tunnel.LastError(); err != nil {
+		t.Errorf("expected no error from relays closing their own connections, got %v", err)
+	}
+}
+
+// TestRemoteDialAddr_RecordsResolvedAddresses verifies that the concrete IPs behind a DNS name are recorded for both the
+// SSH connection and forwarded connections, while the forwarded connection is still opened to the name.
+func TestRemoteDialAddr_RecordsResolvedAddresses(t *testing.T) {
+	sshServer, _ := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer := setupTestDestinationServer(t, "ok")
+	defer destServer.Close()
+
+	sshPort := sshServer.Addr().(*net.TCPAddr).Port
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+
+	sshCfg, err := NewSSHConfig("testuser", "testpass", "", "localhost", "", sshPort)
+	if err != nil {
+		t.Fatalf("failed to create ssh config: %v", err)
+	}
+
+	tunnel := NewTunnel(sshCfg, "localhost", destPort, 0)
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tunnel.Close()
+
+	info, _ := tunnel.ConnectionInfo()
+	if want := net.JoinHostPort("127.0.0.1", strconv.Itoa(sshPort)); info.RemoteAddr != want {
+		t.Errorf("expected ssh connection to record %s, got %s", want, info.RemoteAddr)
+	}
+
+	conn, err := net.Dial("tcp", tunnel.LocalAddr())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("failed to read through tunnel: %v", err)
+	}
+	conn.Close()
+
+	want := net.JoinHostPort("127.0.0.1", strconv.Itoa(destPort))
+	deadline := time.Now().Add(2 * time.Second)
+	for tunnel.RemoteDialAddr() != want && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := tunnel.RemoteDialAddr(); got != want {
+		t.Errorf("expected forwarded connection to record %s, got %s", want, got)
+	}
+}
+
+// TestConnectionLimit_QueuesThenRefuses verifies that connections beyond the limit wait in the queue and are served as
+// slots free, and that connections beyond the queue are refused, with the queue gauges following along.
+func TestConnectionLimit_QueuesThenRefuses(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer := setupTestDestinationServerFunc(t, func(conn net.Conn) {
+		io.Copy(conn, conn)
+		conn.Close()
+	})
+	defer destServer.Close()
+
+	destPort := destServer.Addr().(*net.TCPAddr).Port
+	tunnel := NewTunnel(sshCfg, "127.0.0.1", destPort, 0)
+	tunnel.SetConnectionLimit(1, 1)
+
+	if err := tunnel.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tunnel.Stop()
+
+	active := dialEcho(t, tunnel.LocalAddr())
+
+	queued, err := net.Dial("tcp", tunnel.LocalAddr())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer queued.Close()
+
+	waitForStats(t, tunnel, func(s Stats) bool { return s.QueuedConnections == 1 })
+
+	refused, err := net.Dial("tcp", tunnel.LocalAddr())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer refused.Close()
+
+	refused.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := refused.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected the connection beyond the queue to be closed, got %v", err)
+	}
+	waitForStats(t, tunnel, func(s Stats) bool { return s.RefusedConnections == 1 })
+
+	time.Sleep(50 * time.Millisecond)
+	active.Close()
+
+	queued.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := queued.Write([]byte("q")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	buf := make([]byte, 1)
+	if _, err := io.ReadFull(queued, buf); err != nil || string(buf) != "q" {
+		t.Fatalf("expected the queued connection to be served once the slot freed, got %q, %v", buf, err)
+	}
+
+	stats := tunnel.Stats()
+	if stats.QueuedConnections != 0 || stats.Dequeued != 1 {
+		t.Errorf("expected the queue to drain into one served connection, got %+v", stats)
+	}
+	if stats.AvgQueueWait() < 50*time.Millisecond {
+		t.Errorf("expected the average wait to cover the time queued, got %s", stats.AvgQueueWait())
+	}
+}
+
+// waitForStats polls the tunnel's stats until ok reports true, failing the test after a timeout.
+func waitForStats(t *testing.T, tunnel *Tunnel, ok func(Stats) bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if ok(tunnel.Stats()) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("stats did not reach the expected state, got %+v", tunnel.Stats())
+}
+
+// TestIdleTimeout_ClosesIdleConnection verifies that a connection without traffic is closed after the idle timeout
+// while a busy one is kept, and that the tunnel keeps running.
+func TestIdleTimeout_ClosesIdleConnection(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	destServer := setupTestDestinationServerFunc(t, func(conn net.Conn) {
+		io.Copy(conn, conn)
+		conn.Close()
+	})
+	defer destServer.Close()
+
+	tun := NewTunnel(sshCfg, "127.0.0.1", destServer.Addr().(*net.TCPAddr).Port, 0)
+	tun.SetIdleTimeout(300 * time.Millisecond)
+	if err := tun.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tun.Close()
+
+	idle := dialEcho(t, tun.LocalAddr())
+	defer idle.Close()
+	busy := dialEcho(t, tun.LocalAddr())
+	defer busy.Close()
+
+	// Keep the busy connection active for longer than the timeout.
+	buf := make([]byte, 1)
+	for range 6 {
+		time.Sleep(100 * time.Millisecond)
+		busy.SetDeadline(time.Now().Add(time.Second))
+		if _, err := busy.Write([]byte("x")); err != nil {
+			t.Fatalf("busy connection failed to write: %v", err)
+		}
+		if _, err := io.ReadFull(busy, buf); err != nil {
+			t.Fatalf("busy connection was closed: %v", err)
+		}
+	}
+
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := idle.Read(buf); err != io.EOF {
+		t.Errorf("expected the idle connection to be closed, got %v", err)
+	}
+
+	if status := tun.Status(); status != StatusRunning {
+		t.Errorf("expected the tunnel to keep running, got %s", status)
+	}
+	if err := tun.LastError(); err != nil {
+		t.Errorf("expected no error from closing an idle connection, got %v", err)
+	}
+	dialEcho(t, tun.LocalAddr()).Close()
+}
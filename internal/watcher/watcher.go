@@ -1,10 +1,18 @@
 package watcher
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/pperesbr/conduit/internal/config"
@@ -12,51 +20,359 @@ import (
 )
 
 // Watcher monitors filesystem changes to the configuration file and manages its lifecycle with the associated Manager.
+// The parent of the config directory is watched as well, so that a directory swapped out from under the watcher (for
+// example by repointing a symlink) is noticed and the watch moved to the new target. Files the config includes are
+// watched too, through their own directories, and the list follows the includes of each config applied. A Watcher
+// given a directory of config fragments reloads whenever any fragment in it is written, created, or removed.
 type Watcher struct {
 	configPath string
+	dirMode    bool
 	configDir  string
 	configName string
+	parentDir  string
+	watchedDir string
 	manager    *manager.Manager
 	fsWatcher  *fsnotify.Watcher
+	overrides  []config.Override
+	loader     config.Loader
+	addWatch   func(string) error
+	debounce   time.Duration
+	pollEvery  time.Duration
+	logger     *slog.Logger
+	polling    atomic.Bool
 	done       chan struct{}
+	wg         sync.WaitGroup
+
+	appliedHash string
+	includes    []string
+	includeDirs map[string]bool
+	mu          sync.Mutex
+	reloading   sync.Mutex
+}
+
+// pollInterval is how often the config file is re-read once the watcher has fallen back to polling.
+var pollInterval = 2 * time.Second
+
+// DefaultDebounce is how long the config file must settle after a change before the watcher reloads it, unless
+// SetDebounce says otherwise.
+const DefaultDebounce = 300 * time.Millisecond
+
+// Drift describes how the config file on disk compares with the config the watcher last applied.
+type Drift struct {
+	Drifted     bool
+	AppliedHash string
+	DiskHash    string
+	Diff        manager.ConfigDiff
 }
 
 // New creates a new Watcher instance configured to monitor the specified `configPath` and interact with the given Manager.
+// The config file as it is now is taken to be the one the Manager was set up from.
 func New(configPath string, mgr *manager.Manager) (*Watcher, error) {
+	w, err := newWatcher(configPath, mgr)
+	if err != nil {
+		return nil, err
+	}
+
 	fsWatcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create watcher: %w", err)
 	}
+	w.fsWatcher = fsWatcher
+	w.addWatch = fsWatcher.Add
+
+	return w, nil
+}
+
+// NewWithPolling creates a Watcher like New that notices changes by checking the config file every interval instead of
+// through filesystem events, for network filesystems where those never arrive. It does not use inotify at all.
+func NewWithPolling(configPath string, mgr *manager.Manager, interval time.Duration) (*Watcher, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("poll interval must be greater than 0")
+	}
+
+	w, err := newWatcher(configPath, mgr)
+	if err != nil {
+		return nil, err
+	}
+	w.pollEvery = interval
+
+	return w, nil
+}
+
+// newWatcher creates a Watcher for configPath, a config file or a directory of fragments, that has yet to be given a
+// way to notice changes.
+func newWatcher(configPath string, mgr *manager.Manager) (*Watcher, error) {
+	info, err := os.Stat(configPath)
+	dirMode := err == nil && info.IsDir()
+
+	dir := filepath.Dir(configPath)
+	if dirMode {
+		dir = configPath
+	}
+	configDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve config directory: %w", err)
+	}
+
+	w := &Watcher{
+		configPath:  configPath,
+		dirMode:     dirMode,
+		configDir:   configDir,
+		configName:  filepath.Base(configPath),
+		parentDir:   filepath.Dir(configDir),
+		manager:     mgr,
+		debounce:    DefaultDebounce,
+		logger:      slog.Default(),
+		done:        make(chan struct{}),
+		includeDirs: make(map[string]bool),
+	}
+
+	data, err := w.readFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
 
-	return &Watcher{
-		configPath: configPath,
-		configDir:  filepath.Dir(configPath),
-		configName: filepath.Base(configPath),
-		manager:    mgr,
-		fsWatcher:  fsWatcher,
-		done:       make(chan struct{}),
-	}, nil
+	if cfg, err := w.load(data); err == nil {
+		w.includes = cfg.IncludedFiles()
+	}
+	w.appliedHash = w.hashFiles(data)
+
+	return w, nil
+}
+
+// NewFromLoader creates a Watcher that reloads through loader whenever the config file it declares changes. The loader
+// must implement config.Watchable and declare exactly one file; loaders over stdin or the environment have nothing to
+// watch.
+func NewFromLoader(loader config.Loader, mgr *manager.Manager) (*Watcher, error) {
+	watchable, ok := loader.(config.Watchable)
+	if !ok || len(watchable.WatchPaths()) == 0 {
+		return nil, fmt.Errorf("config source has no files to watch")
+	}
+
+	paths := watchable.WatchPaths()
+	if len(paths) > 1 {
+		return nil, fmt.Errorf("watching %d config files is not supported, only one", len(paths))
+	}
+
+	w, err := New(paths[0], mgr)
+	if err != nil {
+		return nil, err
+	}
+	w.loader = loader
+
+	return w, nil
+}
+
+// SetOverrides sets the overrides applied to the config on every reload, so settings given on the command line survive
+// edits to the file. It must be called before Start, and has no effect on a Watcher created by NewFromLoader, whose
+// loader carries its own overrides.
+func (w *Watcher) SetOverrides(overrides []config.Override) {
+	w.overrides = overrides
+}
+
+// SetPollInterval makes the watcher check the config file every interval instead of relying on filesystem events, as a
+// Watcher created by NewWithPolling does. It must be called before Start.
+func (w *Watcher) SetPollInterval(interval time.Duration) {
+	w.pollEvery = interval
+}
+
+// SetLogger sets the logger the watcher reports file events and reloads to; it defaults to slog.Default. It must be
+// called before Start.
+func (w *Watcher) SetLogger(logger *slog.Logger) {
+	w.logger = logger
+}
+
+// SetDebounce sets how long the config file must go without further changes before a reload runs, coalescing the
+// bursts of events editors and atomic writes produce into one reload. Zero reloads on every event. It must be called
+// before Start.
+func (w *Watcher) SetDebounce(debounce time.Duration) {
+	w.debounce = debounce
 }
 
 // Start begins monitoring the specified directory for changes and launches the file watcher in a separate goroutine.
+// A polling watcher starts polling the config file instead.
 func (w *Watcher) Start() error {
-	if err := w.fsWatcher.Add(w.configDir); err != nil {
+	if w.pollEvery > 0 {
+		w.polling.Store(true)
+		w.logger.Info("watcher: polling config file for changes", "path", w.configPath, "interval", w.pollEvery)
+		w.wg.Add(1)
+		go w.poll(w.pollEvery)
+		return nil
+	}
+
+	watchedDir, err := filepath.EvalSymlinks(w.configDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	if err := w.addWatch(watchedDir); err != nil {
+		if isWatchLimit(err) {
+			w.fallBackToPolling(err)
+			return nil
+		}
 		return fmt.Errorf("failed to watch directory: %w", err)
 	}
+	w.watchedDir = watchedDir
+
+	if w.parentDir != w.configDir {
+		if err := w.addWatch(w.parentDir); err != nil {
+			if isWatchLimit(err) {
+				_ = w.fsWatcher.Remove(watchedDir)
+				w.watchedDir = ""
+				w.fallBackToPolling(err)
+				return nil
+			}
+			return fmt.Errorf("failed to watch parent directory: %w", err)
+		}
+	}
 
+	w.mu.Lock()
+	w.watchIncludesLocked()
+	w.mu.Unlock()
+
+	w.wg.Add(1)
 	go w.watch()
 
 	return nil
 }
 
-// Stop gracefully stops the file watch process and releases associated resources.
+// Polling reports whether the watcher polls the config file, because it was set up to or has fallen back to it.
+func (w *Watcher) Polling() bool {
+	return w.polling.Load()
+}
+
+// isWatchLimit reports whether err means the system ran out of inotify watches, which inotify reports as ENOSPC.
+func isWatchLimit(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
+
+// fallBackToPolling starts polling the config file after adding a watch failed with err, so changes are still
+// noticed. It does nothing when the watcher already polls.
+func (w *Watcher) fallBackToPolling(err error) {
+	if w.polling.Swap(true) {
+		return
+	}
+
+	w.logger.Warn("watcher: the inotify watch limit is exhausted, raise it with "+
+		"sysctl fs.inotify.max_user_watches=<n> (or free watches held by other processes) and restart conduit; "+
+		"polling the config file until then", "dir", w.configDir, "error", err, "interval", pollInterval)
+
+	w.wg.Add(1)
+	go w.poll(pollInterval)
+}
+
+// poll checks the config file and the files it includes every interval and reloads them whenever their contents
+// change. The files are only re-read when the size or modification time of one moved, which is cheap on network
+// filesystems; an unchanged hash then skips the reload, for example after a touch.
+func (w *Watcher) poll(interval time.Duration) {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	w.mu.Lock()
+	seen := w.appliedHash
+	w.mu.Unlock()
+
+	type stamp struct {
+		size    int64
+		modTime time.Time
+	}
+	last := make(map[string]stamp)
+
+	for {
+		select {
+		case <-ticker.C:
+			paths := []string{w.configPath}
+			if w.dirMode {
+				fragments, err := config.Fragments(w.configPath)
+				if err != nil {
+					continue
+				}
+				paths = append(paths, fragments...)
+			}
+			w.mu.Lock()
+			paths = append(paths, w.includes...)
+			w.mu.Unlock()
+
+			moved := false
+			for _, path := range paths {
+				info, err := os.Stat(path)
+				if err != nil {
+					continue
+				}
+				if s := (stamp{info.Size(), info.ModTime()}); s != last[path] {
+					last[path] = s
+					moved = true
+				}
+			}
+			if !moved {
+				continue
+			}
+
+			_, hash, err := w.readConfig()
+			if err != nil {
+				continue
+			}
+
+			if hash != seen && !w.stopped() {
+				seen = hash
+				w.logger.Info("watcher: config changed, reloading", "reason", "polled", "path", w.configPath)
+				w.reload()
+			}
+
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Stop gracefully stops the file watch process, including any polling, and releases associated resources. It waits
+// for a reload already under way, so none runs once Stop has returned.
 func (w *Watcher) Stop() error {
 	close(w.done)
-	return w.fsWatcher.Close()
+
+	var err error
+	if w.fsWatcher != nil {
+		err = w.fsWatcher.Close()
+	}
+	w.wg.Wait()
+
+	return err
+}
+
+// stopped reports whether Stop has been called, for the goroutines to check before reloading: a tick or timer that
+// fired alongside Stop may be picked over it.
+func (w *Watcher) stopped() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
 }
 
 // watch monitors filesystem events, processes relevant changes, and triggers reloads or handles errors accordingly.
+// A reload runs once no relevant event has arrived for the debounce window, each event restarting the wait.
 func (w *Watcher) watch() {
+	defer w.wg.Done()
+
+	var settled <-chan time.Time
+	var reason string
+
+	changed := func(why string) {
+		reason = why
+		if w.stopped() {
+			return
+		}
+		if w.debounce <= 0 {
+			w.logger.Info("watcher: config changed, reloading", "reason", reason)
+			w.reload()
+			return
+		}
+		settled = time.After(w.debounce)
+	}
+
 	for {
 		select {
 		case event, ok := <-w.fsWatcher.Events:
@@ -64,16 +380,39 @@ func (w *Watcher) watch() {
 				return
 			}
 
+			if w.isDirEvent(event) {
+				if w.rewatch() {
+					changed(fmt.Sprintf("config directory now resolves to %s", w.watchedDir))
+				}
+				continue
+			}
+
+			if w.isIncludeEvent(event) {
+				changed(fmt.Sprintf("included file changed (%s: %s)", event.Op, event.Name))
+				continue
+			}
+
+			if filepath.Dir(event.Name) == w.parentDir {
+				continue
+			}
+
 			if w.isRelevantEvent(event) {
-				log.Printf("watcher: config changed (%s: %s), reloading...", event.Op, event.Name)
-				w.reload()
+				changed(fmt.Sprintf("config changed (%s: %s)", event.Op, event.Name))
+			}
+
+		case <-settled:
+			settled = nil
+			if w.stopped() {
+				return
 			}
+			w.logger.Info("watcher: config changed, reloading", "reason", reason)
+			w.reload()
 
 		case err, ok := <-w.fsWatcher.Errors:
 			if !ok {
 				return
 			}
-			log.Printf("watcher: error: %v", err)
+			w.logger.Error("watcher: filesystem watch failed", "error", err)
 
 		case <-w.done:
 			return
@@ -81,10 +420,55 @@ func (w *Watcher) watch() {
 	}
 }
 
+// isDirEvent reports whether the event concerns the config directory itself rather than a file inside it.
+func (w *Watcher) isDirEvent(event fsnotify.Event) bool {
+	return event.Name == w.configDir || event.Name == w.watchedDir
+}
+
+// rewatch re-resolves the config directory and moves the watch to it when it points somewhere new, reporting whether
+// the watch moved. While the directory is missing the old watch is dropped and rewatch waits for it to reappear.
+func (w *Watcher) rewatch() bool {
+	resolved, err := filepath.EvalSymlinks(w.configDir)
+	if err != nil {
+		if w.watchedDir != "" {
+			w.logger.Warn("watcher: config directory is gone, waiting for it to reappear", "dir", w.configDir)
+			_ = w.fsWatcher.Remove(w.watchedDir)
+			w.watchedDir = ""
+		}
+		return false
+	}
+
+	if resolved == w.watchedDir {
+		return false
+	}
+
+	if w.watchedDir != "" {
+		_ = w.fsWatcher.Remove(w.watchedDir)
+	}
+
+	if err := w.addWatch(resolved); err != nil {
+		w.watchedDir = ""
+		if isWatchLimit(err) {
+			w.fallBackToPolling(err)
+			return false
+		}
+		w.logger.Error("watcher: failed to watch config directory", "dir", resolved, "error", err)
+		return false
+	}
+	w.watchedDir = resolved
+
+	return true
+}
+
 // isRelevantEvent determines if a filesystem event is relevant, such as a write or create operation on the config file or symlink updates.
+// In a directory of fragments, writing, creating, removing, or renaming any fragment is relevant.
 func (w *Watcher) isRelevantEvent(event fsnotify.Event) bool {
 	name := filepath.Base(event.Name)
 
+	if w.dirMode && config.IsFragment(name) {
+		return event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0
+	}
+
 	isWriteOrCreate := event.Op&fsnotify.Write == fsnotify.Write ||
 		event.Op&fsnotify.Create == fsnotify.Create
 
@@ -103,15 +487,221 @@ func (w *Watcher) isRelevantEvent(event fsnotify.Event) bool {
 	return false
 }
 
-// reload reloads the configuration by reading the file, parsing its contents, and reconciling with the Manager state.
+// isIncludeEvent reports whether the event is a write or create of one of the files the config includes.
+func (w *Watcher) isIncludeEvent(event fsnotify.Event) bool {
+	if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+		return false
+	}
+
+	name := event.Name
+	if filepath.Dir(name) == w.watchedDir {
+		name = filepath.Join(w.configDir, filepath.Base(name))
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, path := range w.includes {
+		if name == path {
+			return true
+		}
+	}
+	return false
+}
+
+// setIncludes records the files the config applied last includes and, outside of polling, moves the directory watches
+// to follow them.
+func (w *Watcher) setIncludes(includes []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.includes = includes
+	if w.fsWatcher != nil && !w.polling.Load() {
+		w.watchIncludesLocked()
+	}
+}
+
+// watchIncludesLocked watches the directories of the included files that are not watched yet and stops watching those
+// no included file lives in anymore. The config directory and its parent are watched already and left alone. The
+// caller must hold w.mu.
+func (w *Watcher) watchIncludesLocked() {
+	wanted := make(map[string]bool)
+	for _, path := range w.includes {
+		dir := filepath.Dir(path)
+		if dir != w.configDir && dir != w.parentDir {
+			wanted[dir] = true
+		}
+	}
+
+	for dir := range w.includeDirs {
+		if !wanted[dir] {
+			_ = w.fsWatcher.Remove(dir)
+			delete(w.includeDirs, dir)
+		}
+	}
+
+	for dir := range wanted {
+		if w.includeDirs[dir] {
+			continue
+		}
+		if err := w.addWatch(dir); err != nil {
+			if isWatchLimit(err) {
+				w.fallBackToPolling(err)
+				return
+			}
+			w.logger.Error("watcher: failed to watch included file directory", "dir", dir, "error", err)
+			continue
+		}
+		w.includeDirs[dir] = true
+	}
+}
+
+// readConfig reads the config file and returns its contents along with hashFiles of them.
+func (w *Watcher) readConfig() ([]byte, string, error) {
+	data, err := w.readFiles()
+	if err != nil {
+		return nil, "", err
+	}
+	return data, w.hashFiles(data), nil
+}
+
+// readFiles returns the contents of the config file or, in a directory of fragments, the name and contents of every
+// fragment in turn.
+func (w *Watcher) readFiles() ([]byte, error) {
+	if !w.dirMode {
+		return os.ReadFile(w.configPath)
+	}
+
+	fragments, err := config.Fragments(w.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	for _, path := range fragments {
+		fragment, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, filepath.Base(path)...)
+		data = append(data, fragment...)
+	}
+	return data, nil
+}
+
+// hashFiles returns a hash covering data, the contents of the config file, and the files it included when last
+// loaded. An included file that cannot be read is hashed by its path alone, so it appearing is noticed as a change.
+func (w *Watcher) hashFiles(data []byte) string {
+	w.mu.Lock()
+	includes := w.includes
+	w.mu.Unlock()
+
+	if len(includes) == 0 {
+		return hashConfig(data)
+	}
+
+	all := append([]byte(nil), data...)
+	for _, path := range includes {
+		included, _ := os.ReadFile(path)
+		all = append(all, path...)
+		all = append(all, included...)
+	}
+	return hashConfig(all)
+}
+
+// reload reloads the configuration like Reload, logging what changed or why it failed.
 func (w *Watcher) reload() {
-	newConfig, err := config.Load(w.configPath)
+	result, err := w.Reload()
 	if err != nil {
-		log.Printf("watcher: invalid config, keeping current state: %v", err)
+		w.logger.Error("watcher: reload failed", "error", err)
 		return
 	}
+	w.logger.Info("watcher: config reloaded", "added", result.Added, "removed", result.Removed,
+		"restarted", result.Changed, "updated", result.Updated, "failed", len(result.Failed))
+}
+
+// Reload reads the config file, parses its contents, and reconciles the Manager with it at once, as a change to the file
+// would, for hosts where file events do not arrive reliably. Tunnels whose config is unchanged are left alone, and
+// reloads never run concurrently, so a reload requested while a file change is being applied runs after it.
+func (w *Watcher) Reload() (manager.ReconcileResult, error) {
+	w.reloading.Lock()
+	defer w.reloading.Unlock()
+
+	data, err := w.readFiles()
+	if err != nil {
+		return manager.ReconcileResult{}, fmt.Errorf("failed to read config, keeping current state: %w", err)
+	}
+
+	newConfig, err := w.load(data)
+	if err != nil {
+		return manager.ReconcileResult{}, fmt.Errorf("invalid config, keeping current state: %w", err)
+	}
+
+	for _, warning := range newConfig.Warnings() {
+		w.logger.Warn("watcher: config warning", "warning", warning)
+	}
+
+	if len(newConfig.TunnelConfigs) == 0 {
+		w.logger.Info("watcher: config explicitly allows an empty tunnel list, removing all tunnels")
+	}
+
+	w.manager.SetReconcileMode(newConfig.Reload.Mode)
+	result, err := w.manager.Reconcile(newConfig)
+	if err != nil {
+		return result, fmt.Errorf("failed to reconcile: %w", err)
+	}
+
+	w.setIncludes(newConfig.IncludedFiles())
+	hash := w.hashFiles(data)
+
+	w.mu.Lock()
+	w.appliedHash = hash
+	w.mu.Unlock()
 
-	if err := w.manager.Reconcile(newConfig); err != nil {
-		log.Printf("watcher: failed to reconcile: %v", err)
+	return result, nil
+}
+
+// DriftStatus re-reads the config file and reports whether it differs from the config last applied, for example because
+// a change was made without the watcher noticing. The tunnels the file would add, remove, or change are listed without
+// applying them; an unreadable or invalid file is returned as an error.
+func (w *Watcher) DriftStatus() (Drift, error) {
+	data, hash, err := w.readConfig()
+	if err != nil {
+		return Drift{}, fmt.Errorf("failed to read config file: %w", err)
 	}
+
+	w.mu.Lock()
+	drift := Drift{AppliedHash: w.appliedHash, DiskHash: hash}
+	w.mu.Unlock()
+
+	if drift.DiskHash == drift.AppliedHash {
+		return drift, nil
+	}
+	drift.Drifted = true
+
+	diskConfig, err := w.load(data)
+	if err != nil {
+		return drift, fmt.Errorf("config on disk differs from the applied one but cannot be loaded: %w", err)
+	}
+	drift.Diff = w.manager.Diff(diskConfig)
+
+	return drift, nil
+}
+
+// load builds the config from data, the current contents of the config file, or through the loader when the watcher
+// has one. A directory of fragments is loaded afresh.
+func (w *Watcher) load(data []byte) (*config.Config, error) {
+	if w.loader != nil {
+		return w.loader.Load()
+	}
+	if w.dirMode {
+		return config.Load(w.configPath, w.overrides...)
+	}
+	return config.ParseFile(w.configPath, data, w.overrides...)
+}
+
+// hashConfig returns the hex-encoded SHA-256 of a config file's contents.
+func hashConfig(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
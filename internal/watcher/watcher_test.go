@@ -9,12 +9,16 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/pperesbr/conduit/internal/config"
 	"github.com/pperesbr/conduit/internal/manager"
-	"github.com/pperesbr/gokit/pkg/tunnel"
+	"github.com/pperesbr/conduit/internal/tunnel"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -83,6 +87,7 @@ ssh:
   password: testpass
   host: 127.0.0.1
   port: %d
+  insecureIgnoreHostKey: true
 
 tunnels:
   - name: tunnel1
@@ -111,6 +116,7 @@ ssh:
   password: testpass
   host: 127.0.0.1
   port: %d
+  insecureIgnoreHostKey: true
 
 tunnels:
   - name: tunnel1
@@ -136,6 +142,296 @@ tunnels:
 	}
 }
 
+// TestNewFromLoader_ReloadsThroughLoader verifies that a watcher built from a loader reloads the file it declares
+// through that loader, merging in the environment, and that a loader with nothing to watch is rejected.
+func TestNewFromLoader_ReloadsThroughLoader(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	port := sshServer.Addr().(*net.TCPAddr).Port
+	envPort := randomPort()
+	t.Setenv("CONDUIT_TUNNEL_1_NAME", "tunnel2")
+	t.Setenv("CONDUIT_TUNNEL_1_LOCALPORT", strconv.Itoa(envPort))
+
+	content := `
+ssh:
+  user: testuser
+  password: testpass
+  host: 127.0.0.1
+  port: %d
+  insecureIgnoreHostKey: true
+
+tunnels:
+  - name: tunnel1
+    remoteHost: 127.0.0.1
+    remotePort: 1521
+    localPort: %d
+`
+	configPath := createTempConfigFile(t, fmt.Sprintf(content, port, randomPort()))
+
+	loader := &config.CompositeLoader{Loaders: []config.Loader{&config.FileLoader{Path: configPath}, &config.EnvLoader{}}}
+	if _, err := NewFromLoader(&config.EnvLoader{}, manager.NewManager(sshCfg)); err == nil {
+		t.Error("expected error for a loader with nothing to watch")
+	}
+
+	mgr := manager.NewManager(sshCfg)
+	w, err := NewFromLoader(loader, mgr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.Start(); err != nil {
+		t.Fatalf("failed to start watcher: %v", err)
+	}
+	defer w.Stop()
+	defer mgr.StopAll()
+
+	time.Sleep(100 * time.Millisecond)
+
+	newConfig := fmt.Sprintf(content, port, randomPort()) + `  - name: tunnel2
+    remoteHost: 127.0.0.1
+    remotePort: 1522
+    localPort: 1
+`
+	if err := os.WriteFile(configPath, []byte(newConfig), 0644); err != nil {
+		t.Fatalf("failed to write new config: %v", err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	tun := mgr.Get("tunnel2")
+	if tun == nil {
+		t.Fatalf("expected tunnel2 to be added, got %v", mgr.List())
+	}
+	if tun.LocalPort() != envPort {
+		t.Errorf("expected the environment's port %d, got %d", envPort, tun.LocalPort())
+	}
+}
+
+// TestReload_AppliesFileWithoutEvents verifies that Reload applies the config file on demand, without the watcher
+// running, and that reloading an unchanged file leaves the tunnels alone.
+func TestReload_AppliesFileWithoutEvents(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	port := sshServer.Addr().(*net.TCPAddr).Port
+	content := `
+ssh:
+  user: testuser
+  password: testpass
+  host: 127.0.0.1
+  port: %d
+  insecureIgnoreHostKey: true
+
+tunnels:
+  - name: %s
+    remoteHost: 127.0.0.1
+    remotePort: 1521
+    localPort: %d
+`
+	configPath := createTempConfigFile(t, fmt.Sprintf(content, port, "tunnel1", randomPort()))
+
+	mgr := manager.NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	w, err := New(configPath, mgr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer w.Stop()
+
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(content, port, "tunnel2", randomPort())), 0644); err != nil {
+		t.Fatalf("failed to write new config: %v", err)
+	}
+
+	result, err := w.Reload()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Added) != 1 || result.Added[0] != "tunnel2" {
+		t.Errorf("expected tunnel2 to be added, got %+v", result)
+	}
+
+	result, err = w.Reload()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Added)+len(result.Removed)+len(result.Changed)+len(result.Updated) != 0 {
+		t.Errorf("expected reloading an unchanged file to change nothing, got %+v", result)
+	}
+}
+
+// TestReload_JSONConfig verifies that a .json config file is reloaded like a YAML one.
+func TestReload_JSONConfig(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	port := sshServer.Addr().(*net.TCPAddr).Port
+	content := `{
+  "ssh": {"user": "testuser", "password": "testpass", "host": "127.0.0.1", "port": %d,
+          "insecureIgnoreHostKey": true},
+  "tunnels": [{"name": %q, "remoteHost": "127.0.0.1", "remotePort": 1521, "localPort": %d}]
+}`
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(content, port, "tunnel1", randomPort())), 0644); err != nil {
+		t.Fatalf("failed to create temp config: %v", err)
+	}
+
+	mgr := manager.NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	w, err := New(configPath, mgr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer w.Stop()
+
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(content, port, "tunnel2", randomPort())), 0644); err != nil {
+		t.Fatalf("failed to write new config: %v", err)
+	}
+
+	result, err := w.Reload()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Added) != 1 || result.Added[0] != "tunnel2" {
+		t.Errorf("expected tunnel2 to be added, got %+v", result)
+	}
+
+	// YAML that is not JSON is rejected in a .json file.
+	if err := os.WriteFile(configPath, []byte("tunnels: []\n"), 0644); err != nil {
+		t.Fatalf("failed to write new config: %v", err)
+	}
+	if _, err := w.Reload(); err == nil || !strings.Contains(err.Error(), "JSON") {
+		t.Errorf("expected a JSON parse error, got %v", err)
+	}
+}
+
+// countingLoader loads a config file like config.FileLoader, counting how often it is asked to.
+type countingLoader struct {
+	*config.FileLoader
+	loads atomic.Int32
+}
+
+// Load counts the call and loads the file.
+func (l *countingLoader) Load() (*config.Config, error) {
+	l.loads.Add(1)
+	return l.FileLoader.Load()
+}
+
+// TestWatcher_DebouncesRapidWrites verifies that two writes in quick succession are applied by a single reload of the
+// final contents.
+func TestWatcher_DebouncesRapidWrites(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	port := sshServer.Addr().(*net.TCPAddr).Port
+	content := `
+ssh:
+  user: testuser
+  password: testpass
+  host: 127.0.0.1
+  port: %d
+  insecureIgnoreHostKey: true
+
+tunnels:
+  - name: %s
+    remoteHost: 127.0.0.1
+    remotePort: 1521
+    localPort: %d
+`
+	configPath := createTempConfigFile(t, fmt.Sprintf(content, port, "tunnel1", randomPort()))
+
+	loader := &countingLoader{FileLoader: &config.FileLoader{Path: configPath}}
+	mgr := manager.NewManager(sshCfg)
+	w, err := NewFromLoader(loader, mgr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w.SetDebounce(200 * time.Millisecond)
+	if err := w.Start(); err != nil {
+		t.Fatalf("failed to start watcher: %v", err)
+	}
+	defer w.Stop()
+	defer mgr.StopAll()
+
+	time.Sleep(100 * time.Millisecond)
+
+	for _, name := range []string{"tunnel2", "tunnel3"} {
+		if err := os.WriteFile(configPath, []byte(fmt.Sprintf(content, port, name, randomPort())), 0644); err != nil {
+			t.Fatalf("failed to write new config: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	time.Sleep(600 * time.Millisecond)
+
+	if loads := loader.loads.Load(); loads != 1 {
+		t.Errorf("expected a single reload, got %d", loads)
+	}
+	if list := mgr.List(); len(list) != 1 || list[0] != "tunnel3" {
+		t.Errorf("expected only tunnel3 after the reload, got %v", list)
+	}
+}
+
+// TestStart_FallsBackToPollingWhenOutOfWatches verifies that running out of inotify watches switches the watcher to
+// polling, which still picks up a change to the config file.
+func TestStart_FallsBackToPollingWhenOutOfWatches(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	defer func(interval time.Duration) { pollInterval = interval }(pollInterval)
+	pollInterval = 50 * time.Millisecond
+
+	port := sshServer.Addr().(*net.TCPAddr).Port
+	content := `
+ssh:
+  user: testuser
+  password: testpass
+  host: 127.0.0.1
+  port: %d
+  insecureIgnoreHostKey: true
+
+tunnels:
+  - name: tunnel1
+    remoteHost: 127.0.0.1
+    remotePort: 1521
+    localPort: %d
+`
+	configPath := createTempConfigFile(t, fmt.Sprintf(content, port, randomPort()))
+
+	mgr := manager.NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	w, err := New(configPath, mgr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w.addWatch = func(string) error {
+		return fmt.Errorf("add watch: %w", syscall.ENOSPC)
+	}
+
+	if err := w.Start(); err != nil {
+		t.Fatalf("expected the watch limit to be handled, got %v", err)
+	}
+	defer w.Stop()
+
+	if !w.Polling() {
+		t.Fatal("expected the watcher to fall back to polling")
+	}
+
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(content, port, randomPort())), 0644); err != nil {
+		t.Fatalf("failed to write new config: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for mgr.Get("tunnel1") == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if mgr.Get("tunnel1") == nil {
+		t.Errorf("expected the polled change to be applied, got %v", mgr.List())
+	}
+}
+
 // TestWatcher_InvalidConfigKeepsCurrentState verifies that the watcher retains the current state when an invalid config is provided.
 func TestWatcher_InvalidConfigKeepsCurrentState(t *testing.T) {
 	sshServer, sshCfg := setupTestSSHServer(t)
@@ -150,6 +446,7 @@ ssh:
   password: testpass
   host: 127.0.0.1
   port: %d
+  insecureIgnoreHostKey: true
 
 tunnels:
   - name: tunnel1
@@ -172,6 +469,7 @@ tunnels:
 	invalidConfig := `
 ssh:
   user: testuser
+  insecureIgnoreHostKey: true
 
 tunnels: []
 `
@@ -206,6 +504,7 @@ ssh:
   password: testpass
   host: 127.0.0.1
   port: %d
+  insecureIgnoreHostKey: true
 
 tunnels:
   - name: tunnel1
@@ -238,6 +537,7 @@ ssh:
   password: testpass
   host: 127.0.0.1
   port: %d
+  insecureIgnoreHostKey: true
 
 tunnels:
   - name: tunnel1
@@ -289,6 +589,7 @@ ssh:
   password: testpass
   host: localhost
   port: 22
+  insecureIgnoreHostKey: true
 
 tunnels:
   - name: test
@@ -375,7 +676,7 @@ func handleTestSSHConnection(conn net.Conn, config *ssh.ServerConfig) {
 			}
 			ssh.Unmarshal(newChannel.ExtraData(), &payload)
 
-			destAddr := fmt.Sprintf("%s:%d", payload.DestHost, payload.DestPort)
+			destAddr := net.JoinHostPort(payload.DestHost, strconv.Itoa(int(payload.DestPort)))
 			destConn, err := net.Dial("tcp", destAddr)
 			if err != nil {
 				channel.Close()
@@ -395,3 +696,438 @@ func handleTestSSHConnection(conn net.Conn, config *ssh.ServerConfig) {
 		}
 	}
 }
+
+// TestWatcher_EmptyConfigWithPolicyRemovesAllTunnels verifies that reloading an explicitly empty config removes every tunnel when allowed.
+func TestWatcher_EmptyConfigWithPolicyRemovesAllTunnels(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	port := sshServer.Addr().(*net.TCPAddr).Port
+	localPort1 := randomPort()
+
+	initialConfig := fmt.Sprintf(`
+ssh:
+  user: testuser
+  password: testpass
+  host: 127.0.0.1
+  port: %d
+  insecureIgnoreHostKey: true
+
+tunnels:
+  - name: tunnel1
+    remoteHost: 127.0.0.1
+    remotePort: 1521
+    localPort: %d
+`, port, localPort1)
+
+	configPath := createTempConfigFile(t, initialConfig)
+
+	mgr := manager.NewManager(sshCfg)
+	mgr.Add(config.TunnelConfig{Name: "tunnel1", RemoteHost: "127.0.0.1", RemotePort: 1521, LocalPort: localPort1})
+	mgr.StartAll()
+	defer mgr.StopAll()
+
+	w, _ := New(configPath, mgr)
+	_ = w.Start()
+	defer w.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+
+	emptyConfig := fmt.Sprintf(`
+ssh:
+  user: testuser
+  password: testpass
+  host: 127.0.0.1
+  port: %d
+  insecureIgnoreHostKey: true
+
+reload:
+  allowEmpty: true
+
+tunnels: []
+`, port)
+	err := os.WriteFile(configPath, []byte(emptyConfig), 0644)
+	if err != nil {
+		t.Fatalf("failed to write empty config: %v", err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	list := mgr.List()
+	if len(list) != 0 {
+		t.Errorf("expected all tunnels to be removed, got %v", list)
+	}
+}
+
+// TestWatcher_FollowsSwappedConfigDirectory verifies that the watcher keeps detecting changes after the config directory
+// is atomically replaced by repointing the symlink it is reached through.
+func TestWatcher_FollowsSwappedConfigDirectory(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	port := sshServer.Addr().(*net.TCPAddr).Port
+	localPort1 := randomPort()
+	localPort2 := randomPort()
+
+	oneTunnel := fmt.Sprintf(`
+ssh:
+  user: testuser
+  password: testpass
+  host: 127.0.0.1
+  port: %d
+  insecureIgnoreHostKey: true
+
+tunnels:
+  - name: tunnel1
+    remoteHost: 127.0.0.1
+    remotePort: 1521
+    localPort: %d
+`, port, localPort1)
+
+	twoTunnels := oneTunnel + fmt.Sprintf(`
+  - name: tunnel2
+    remoteHost: 127.0.0.1
+    remotePort: 1522
+    localPort: %d
+`, localPort2)
+
+	base := t.TempDir()
+	for _, dir := range []string{"v1", "v2"} {
+		if err := os.Mkdir(filepath.Join(base, dir), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+		if err := os.WriteFile(filepath.Join(base, dir, "config.yaml"), []byte(oneTunnel), 0644); err != nil {
+			t.Fatalf("failed to write %s config: %v", dir, err)
+		}
+	}
+
+	current := filepath.Join(base, "current")
+	if err := os.Symlink(filepath.Join(base, "v1"), current); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	mgr := manager.NewManager(sshCfg)
+
+	w, err := New(filepath.Join(current, "config.yaml"), mgr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.Start(); err != nil {
+		t.Fatalf("failed to start watcher: %v", err)
+	}
+	defer w.Stop()
+	defer mgr.StopAll()
+
+	next := filepath.Join(base, "current.next")
+	if err := os.Symlink(filepath.Join(base, "v2"), next); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if err := os.Rename(next, current); err != nil {
+		t.Fatalf("failed to swap symlink: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(base, "v1")); err != nil {
+		t.Fatalf("failed to remove old directory: %v", err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	if err := os.WriteFile(filepath.Join(base, "v2", "config.yaml"), []byte(twoTunnels), 0644); err != nil {
+		t.Fatalf("failed to write new config: %v", err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	if list := mgr.List(); len(list) != 2 {
+		t.Errorf("expected 2 tunnels after the directory swap, got %d: %v", len(list), list)
+	}
+}
+
+// TestDriftStatus_ReportsUnappliedEdit verifies that an edit the watcher never reloaded is reported as drift, with the
+// tunnels it would add and change, while leaving the running tunnels untouched.
+func TestDriftStatus_ReportsUnappliedEdit(t *testing.T) {
+	configPath := createTempConfigFile(t, validConfigContent())
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	mgr := manager.NewManager(&cfg.SSH)
+	for _, tunnelCfg := range cfg.TunnelConfigs {
+		if err := mgr.Add(tunnelCfg); err != nil {
+			t.Fatalf("failed to add tunnel: %v", err)
+		}
+	}
+
+	w, err := New(configPath, mgr)
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+
+	drift, err := w.DriftStatus()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if drift.Drifted || drift.AppliedHash != drift.DiskHash {
+		t.Errorf("expected no drift before editing, got %+v", drift)
+	}
+
+	edited := fmt.Sprintf(`
+ssh:
+  user: testuser
+  password: testpass
+  host: localhost
+  port: 22
+  insecureIgnoreHostKey: true
+
+tunnels:
+  - name: test
+    remoteHost: localhost
+    remotePort: 1522
+    localPort: %d
+  - name: extra
+    remoteHost: localhost
+    remotePort: 1523
+    localPort: %d
+`, cfg.TunnelConfigs[0].LocalPort, randomPort())
+
+	if err := os.WriteFile(configPath, []byte(edited), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	drift, err = w.DriftStatus()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !drift.Drifted || drift.AppliedHash == drift.DiskHash {
+		t.Fatalf("expected drift after editing, got %+v", drift)
+	}
+	if len(drift.Diff.Added) != 1 || drift.Diff.Added[0] != "extra" {
+		t.Errorf("expected extra to be reported as added, got %v", drift.Diff.Added)
+	}
+	if len(drift.Diff.Changed) != 1 || drift.Diff.Changed[0] != "test" {
+		t.Errorf("expected test to be reported as changed, got %v", drift.Diff.Changed)
+	}
+	if len(drift.Diff.Removed) != 0 {
+		t.Errorf("expected nothing removed, got %v", drift.Diff.Removed)
+	}
+
+	if list := mgr.List(); len(list) != 1 {
+		t.Errorf("expected DriftStatus not to apply the edit, got tunnels %v", list)
+	}
+}
+
+// TestNewWithPolling_ReloadsChangedFile verifies that a polling watcher applies a change to the config file without
+// filesystem events and stops polling once stopped.
+func TestNewWithPolling_ReloadsChangedFile(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	port := sshServer.Addr().(*net.TCPAddr).Port
+	content := `
+ssh:
+  user: testuser
+  password: testpass
+  host: 127.0.0.1
+  port: %d
+  insecureIgnoreHostKey: true
+
+tunnels:
+  - name: %s
+    remoteHost: 127.0.0.1
+    remotePort: 1521
+    localPort: %d
+`
+	configPath := createTempConfigFile(t, fmt.Sprintf(content, port, "tunnel1", randomPort()))
+
+	mgr := manager.NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	if _, err := NewWithPolling(configPath, mgr, 0); err == nil {
+		t.Error("expected error for a zero poll interval")
+	}
+
+	w, err := NewWithPolling(configPath, mgr, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.Start(); err != nil {
+		t.Fatalf("failed to start watcher: %v", err)
+	}
+	if !w.Polling() {
+		t.Error("expected the watcher to poll")
+	}
+
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(content, port, "tunnel2", randomPort())), 0644); err != nil {
+		t.Fatalf("failed to write new config: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for mgr.Get("tunnel2") == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if mgr.Get("tunnel2") == nil {
+		t.Fatalf("expected the polled change to be applied, got %v", mgr.List())
+	}
+
+	if err := w.Stop(); err != nil {
+		t.Fatalf("unexpected error stopping: %v", err)
+	}
+
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(content, port, "tunnel3", randomPort())), 0644); err != nil {
+		t.Fatalf("failed to write new config: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if mgr.Get("tunnel3") != nil {
+		t.Error("expected no reload after the watcher stopped")
+	}
+}
+
+// TestWatcher_DetectsIncludedFileChange verifies that an edit to a file the config includes from another directory is
+// noticed and applied like an edit to the config file itself.
+func TestWatcher_DetectsIncludedFileChange(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "main"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "shared"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+
+	configPath := filepath.Join(root, "main", "config.yaml")
+	mainConfig := fmt.Sprintf(`
+ssh:
+  user: testuser
+  password: testpass
+  host: 127.0.0.1
+  port: %d
+  insecureIgnoreHostKey: true
+
+include:
+  - ../shared/tunnels.yaml
+
+tunnels:
+  - name: tunnel1
+    remoteHost: 127.0.0.1
+    remotePort: 1521
+    localPort: %d
+`, sshServer.Addr().(*net.TCPAddr).Port, randomPort())
+	if err := os.WriteFile(configPath, []byte(mainConfig), 0644); err != nil {
+		t.Fatalf("failed to create temp config: %v", err)
+	}
+
+	includedPath := filepath.Join(root, "shared", "tunnels.yaml")
+	included := `
+tunnels:
+  - name: tunnel2
+    remoteHost: 127.0.0.1
+    remotePort: 1522
+    localPort: %d
+`
+	if err := os.WriteFile(includedPath, []byte(fmt.Sprintf(included, randomPort())), 0644); err != nil {
+		t.Fatalf("failed to create included file: %v", err)
+	}
+
+	mgr := manager.NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	w, err := New(configPath, mgr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := w.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.Start(); err != nil {
+		t.Fatalf("failed to start watcher: %v", err)
+	}
+	defer w.Stop()
+
+	if len(mgr.List()) != 2 {
+		t.Fatalf("expected 2 tunnels, got %v", mgr.List())
+	}
+
+	included += `  - name: tunnel3
+    remoteHost: 127.0.0.1
+    remotePort: 1523
+    localPort: %d
+`
+	if err := os.WriteFile(includedPath, []byte(fmt.Sprintf(included, randomPort(), randomPort())), 0644); err != nil {
+		t.Fatalf("failed to write included file: %v", err)
+	}
+
+	time.Sleep(800 * time.Millisecond)
+
+	if list := mgr.List(); len(list) != 3 {
+		t.Errorf("expected 3 tunnels after editing the included file, got %d: %v", len(list), list)
+	}
+}
+
+// TestWatcher_DirectoryOfFragments verifies that a watcher over a directory of fragments reloads when a fragment is
+// added and when one is removed.
+func TestWatcher_DirectoryOfFragments(t *testing.T) {
+	sshServer, sshCfg := setupTestSSHServer(t)
+	defer sshServer.Close()
+
+	dir := t.TempDir()
+	sshFragment := fmt.Sprintf(`
+ssh:
+  user: testuser
+  password: testpass
+  host: 127.0.0.1
+  port: %d
+  insecureIgnoreHostKey: true
+`, sshServer.Addr().(*net.TCPAddr).Port)
+	fragment := `
+tunnels:
+  - name: %s
+    remoteHost: 127.0.0.1
+    remotePort: 1521
+    localPort: %d
+`
+	if err := os.WriteFile(filepath.Join(dir, "00-ssh.yaml"), []byte(sshFragment), 0644); err != nil {
+		t.Fatalf("failed to write fragment: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "10-db.yaml"), []byte(fmt.Sprintf(fragment, "db", randomPort())), 0644); err != nil {
+		t.Fatalf("failed to write fragment: %v", err)
+	}
+
+	mgr := manager.NewManager(sshCfg)
+	defer mgr.StopAll()
+
+	w, err := New(dir, mgr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w.SetDebounce(50 * time.Millisecond)
+	if _, err := w.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.Start(); err != nil {
+		t.Fatalf("failed to start watcher: %v", err)
+	}
+	defer w.Stop()
+
+	webPath := filepath.Join(dir, "20-web.yaml")
+	if err := os.WriteFile(webPath, []byte(fmt.Sprintf(fragment, "web", randomPort())), 0644); err != nil {
+		t.Fatalf("failed to write fragment: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	if list := mgr.List(); len(list) != 2 {
+		t.Fatalf("expected 2 tunnels after adding a fragment, got %v", list)
+	}
+
+	if err := os.Remove(webPath); err != nil {
+		t.Fatalf("failed to remove fragment: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	if list := mgr.List(); len(list) != 1 || list[0] != "db" {
+		t.Errorf("expected only db after removing a fragment, got %v", list)
+	}
+}